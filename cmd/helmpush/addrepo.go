@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/IxDay/helm-push-cloudflare-access/pkg/config"
+	"github.com/IxDay/helm-push-cloudflare-access/pkg/helm"
+	"github.com/IxDay/helm-push-cloudflare-access/pkg/wincred"
+)
+
+// checkAddRepo makes sure the repository pushed to can be registered with
+// --add-repo before pushing. cm:// URLs are downloaded with https unless
+// $HELM_REPO_USE_HTTP is set, plain http repositories are only registered
+// when it is.
+func (p *pushCmd) checkAddRepo() error {
+	switch {
+	case p.addRepo == "":
+		return nil
+	case !isRepoURL(p.repoName):
+		return fmt.Errorf("--add-repo requires a repository URL, %s is a repository name", p.repoName)
+	case strings.HasPrefix(p.repoName, "http://") && !p.useHTTP:
+		return fmt.Errorf("--add-repo cannot register %s: cm:// repositories are downloaded with https, set HELM_REPO_USE_HTTP=true for plain http ones", p.repoName)
+	}
+	return nil
+}
+
+// registerRepo adds the repository pushed to, a URL, to the local
+// repository list with the cm:// scheme so that the plugin handles its
+// downloads, see --add-repo. The context path given with --context-path
+// is made part of the URL, the downloader not knowing it otherwise.
+func (p *pushCmd) registerRepo() error {
+	u, err := url.Parse(p.repoName)
+	if err != nil {
+		return err
+	}
+	if contextPath := strings.TrimSuffix(p.contextPath, "/"); contextPath != "" {
+		u.Path = path.Join(contextPath, strings.TrimPrefix(u.Path, contextPath))
+	}
+	u.Scheme = "cm"
+	if err := helm.AddRepo(p.addRepo, u.String()); err != nil {
+		return err
+	}
+	p.log.Info("repository added", "name", p.addRepo, "url", u.String())
+	if !p.saveCredentials {
+		return nil
+	}
+
+	clientID, clientSecret := p.credentials(p.config.Repository(p.repoName), p.repoName)
+	if clientID == "" && clientSecret == "" {
+		p.log.Warn("no credentials to save", "name", p.addRepo)
+		return nil
+	}
+	// The Credential Manager protects the secret better than a file
+	if wincred.Supported && p.configPath == "" {
+		if err := wincred.Set(wincred.Target(p.addRepo), clientID, clientSecret); err != nil {
+			return err
+		}
+		p.log.Info("credentials saved", "name", p.addRepo, "target", wincred.Target(p.addRepo))
+		return nil
+	}
+	path := p.configPath
+	if path == "" {
+		path = config.DefaultPath()
+	}
+	if err := config.SetCredentials(path, p.addRepo, clientID, clientSecret); err != nil {
+		return err
+	}
+	p.log.Info("credentials saved", "name", p.addRepo, "config", path)
+	return nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/IxDay/helm-push-cloudflare-access/pkg/chartmuseumtest"
+	"github.com/IxDay/helm-push-cloudflare-access/pkg/config"
+	"k8s.io/helm/pkg/helm/helmpath"
+	"k8s.io/helm/pkg/repo"
+)
+
+func TestPushCmdAddRepo(t *testing.T) {
+	ts := chartmuseumtest.NewServer(chartmuseumtest.ContextPath("/helm"))
+	defer ts.Close()
+
+	tmp, err := ioutil.TempDir("", "helm-push-test")
+	if err != nil {
+		t.Fatal("unexpected error creating temp test dir", err)
+	}
+	defer os.RemoveAll(tmp)
+	home := helmpath.Home(tmp)
+	os.Setenv("HELM_HOME", home.String())
+	configPath := filepath.Join(tmp, "push.yaml")
+	os.Setenv("HELM_PUSH_CONFIG", configPath)
+	defer os.Unsetenv("HELM_PUSH_CONFIG")
+
+	// A repository name is already registered
+	args := []string{testTarballPath, "chartmuseum"}
+	cmd := newPushCmd(args)
+	cmd.Flags().Set("add-repo", "mirror")
+	if err := cmd.RunE(cmd, args); err == nil {
+		t.Error("expected error adding a repository name, instead got nil")
+	}
+
+	// cm:// repositories are downloaded with https by default
+	os.Unsetenv("HELM_REPO_USE_HTTP")
+	args = []string{testTarballPath, ts.URL}
+	cmd = newPushCmd(args)
+	cmd.Flags().Set("add-repo", "mirror")
+	if err := cmd.RunE(cmd, args); err == nil || !strings.Contains(err.Error(), "HELM_REPO_USE_HTTP") {
+		t.Errorf("expected error adding a plain http repository, got %v", err)
+	}
+	if len(ts.Requests()) != 0 {
+		t.Error("expected the repository to be refused before pushing")
+	}
+
+	// The context path is part of the registered URL
+	os.Setenv("HELM_REPO_USE_HTTP", "true")
+	defer os.Unsetenv("HELM_REPO_USE_HTTP")
+	cmd = newPushCmd(args)
+	cmd.Flags().Set("context-path", "/helm")
+	cmd.Flags().Set("add-repo", "mirror")
+	cmd.Flags().Set("save-credentials", "true")
+	cmd.Flags().Set("client-id", "my-id")
+	cmd.Flags().Set("client-secret", "my-secret")
+	if err := cmd.RunE(cmd, args); err != nil {
+		t.Fatalf("unexpected error pushing chart: %s", err)
+	}
+	if _, ok := ts.Chart("mychart", "0.1.0"); !ok {
+		t.Errorf("expected the chart to be pushed, got %v", ts.Charts())
+	}
+
+	f, err := repo.LoadRepositoriesFile(home.RepositoryFile())
+	if err != nil {
+		t.Fatalf("unexpected error loading repository list: %s", err)
+	}
+	expected := strings.Replace(ts.URL, "http://", "cm://", 1) + "/helm"
+	if len(f.Repositories) != 1 || f.Repositories[0].Name != "mirror" || f.Repositories[0].URL != expected {
+		t.Errorf("expected repository mirror at %s, got %+v", expected, f.Repositories)
+	}
+	c, err := config.Load(configPath)
+	if err != nil {
+		t.Fatalf("unexpected error loading config: %s", err)
+	}
+	if r := c.Repository("mirror"); r.ClientID != "my-id" || r.ClientSecret != "my-secret" {
+		t.Errorf("unexpected repository settings %+v", r)
+	}
+}
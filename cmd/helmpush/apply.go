@@ -0,0 +1,65 @@
+package main
+
+import (
+	"github.com/IxDay/helm-push-cloudflare-access/pkg/manifest"
+	"github.com/IxDay/helm-push-cloudflare-access/pkg/redact"
+	"github.com/spf13/cobra"
+)
+
+func newApplyCmd() *cobra.Command {
+	p := &pushCmd{}
+	var file string
+	cmd := &cobra.Command{
+		Use:   "apply -f charts.yaml",
+		Short: "Publish the charts described in a manifest",
+		Long: `Publish every chart listed in a manifest, each with its own target repository,
+version strategy, app version and annotations. Charts are published in order,
+a failure does not prevent the next charts from being published.`,
+		Example: `  $ helm push apply -f charts.yaml`,
+		Args:    cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) (err error) {
+			// Errors are printed by cobra, make sure they leak no secret
+			defer func() { err = redact.Error(err) }()
+
+			if err := p.setup(cmd); err != nil {
+				return err
+			}
+			m, err := manifest.Load(file)
+			if err != nil {
+				return err
+			}
+			return p.publish(func() error { return p.apply(m) })
+		},
+	}
+	f := cmd.Flags()
+	f.StringVarP(&file, "file", "f", "", "Manifest listing the charts to publish")
+	f.StringVarP(&p.appVersion, "app-version", "a", "", "App version of the charts whose manifest entry does not set one")
+	f.BoolVarP(&p.forceUpload, "force", "", false, "Force upload even if chart version exists, for every chart of the manifest")
+	p.addRepoFlags(f)
+	p.addPushFlags(f)
+	cmd.MarkFlagRequired("file")
+	return cmd
+}
+
+// apply publishes the charts of m, the manifest entry overrides the
+// target repository and app version of each push, and may force it
+func (p *pushCmd) apply(m *manifest.Manifest) error {
+	var failed []string
+	p.results = nil
+	appVersion, force := p.appVersion, p.forceUpload
+	for i := range m.Charts {
+		c := &m.Charts[i]
+		p.entry = c
+		p.repoName = c.Repo
+		p.appVersion = appVersion
+		if c.AppVersion != "" {
+			p.appVersion = c.AppVersion
+		}
+		p.forceUpload = force || c.Force
+		if err := p.pushChart(c.Path); err != nil {
+			p.log.Error("push failed", "chart", c.Path, "repo", c.Repo, "error", err)
+			failed = append(failed, c.Path)
+		}
+	}
+	return p.finish(failed)
+}
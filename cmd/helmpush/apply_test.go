@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/IxDay/helm-push-cloudflare-access/pkg/chartmuseumtest"
+)
+
+func TestApplyCmd(t *testing.T) {
+	a, b, fail := chartmuseumtest.NewServer(), chartmuseumtest.NewServer(), chartmuseumtest.NewServer()
+	defer a.Close()
+	defer b.Close()
+	defer fail.Close()
+	fail.InjectFault(chartmuseumtest.Fault{Method: "POST", Path: "/api/charts", Status: 500})
+
+	tmp, err := ioutil.TempDir("", "helm-push-test")
+	if err != nil {
+		t.Fatal("unexpected error creating temp test dir", err)
+	}
+	defer os.RemoveAll(tmp)
+	chartPath, _ := filepath.Abs(testTarballPath)
+	manifestPath := filepath.Join(tmp, "charts.yaml")
+	ioutil.WriteFile(manifestPath, []byte(`
+repo: `+a.URL+`
+charts:
+- path: `+chartPath+`
+  version: 1.2.3
+  app_version: 9.9.9
+  annotations:
+    team: payments
+- path: `+chartPath+`
+  repo: `+b.URL+`
+  version_strategy: timestamp
+- path: `+chartPath+`
+  repo: `+fail.URL+`
+`), 0600)
+
+	args := []string{"apply", "-f", manifestPath, "--context-path", "/", "--app-version", "7.7.7"}
+	cmd := newPushCmd(args)
+	cmd.SetArgs(args)
+	var out bytes.Buffer
+	cmd.SetOut(&out)
+	cmd.SetErr(&out)
+	err = cmd.Execute()
+	if err == nil || !strings.Contains(err.Error(), "1 of 3 charts failed") {
+		t.Errorf("expected a single failure, got %v", err)
+	}
+
+	pushed := loadPushed(t, a, "mychart", "1.2.3")
+	if pushed.Metadata.AppVersion != "9.9.9" || pushed.Metadata.Annotations["team"] != "payments" {
+		t.Errorf("unexpected chart pushed to a: %+v", pushed.Metadata)
+	}
+	charts := b.Charts()
+	if len(charts) != 1 || !strings.HasPrefix(charts[0].Version, "0.1.0-") {
+		t.Fatalf("expected a timestamp version pushed to b, got %v", charts)
+	}
+	pushed = loadPushed(t, b, "mychart", charts[0].Version)
+	if pushed.Metadata.AppVersion != "7.7.7" || pushed.Metadata.Annotations["team"] != "" {
+		t.Errorf("unexpected chart pushed to b: %+v", pushed.Metadata)
+	}
+
+	// Invalid manifest
+	ioutil.WriteFile(manifestPath, []byte("charts: [{path: mychart}]"), 0600)
+	cmd = newPushCmd(args)
+	cmd.SetArgs(args)
+	cmd.SetOut(ioutil.Discard)
+	cmd.SetErr(ioutil.Discard)
+	if err := cmd.Execute(); err == nil || !strings.Contains(err.Error(), "missing repo") {
+		t.Errorf("expected invalid manifest error, got %v", err)
+	}
+}
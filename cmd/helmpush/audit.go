@@ -0,0 +1,43 @@
+package main
+
+import (
+	"os"
+	"os/user"
+	"time"
+
+	"github.com/IxDay/helm-push-cloudflare-access/pkg/audit"
+)
+
+// writeAudit appends the outcome of action to the audit log, if enabled
+func (p *pushCmd) writeAudit(action string, err error) error {
+	if p.auditLog == "" {
+		return nil
+	}
+	clientID, _ := p.credentials(p.config.Repository(p.repoName, p.result.url), p.result.url)
+	r := audit.Record{
+		Time:     time.Now().UTC(),
+		Action:   action,
+		ClientID: clientID,
+		Chart:    p.result.name,
+		Version:  p.result.version,
+		Repo:     p.result.url,
+		Digest:   p.result.digest,
+		Result:   "success",
+	}
+	if r.Repo == "" {
+		r.Repo = p.repoName
+	}
+	if u, err := user.Current(); err == nil {
+		r.User = u.Username
+	}
+	r.Host, _ = os.Hostname()
+	if err != nil {
+		r.Result = "failure"
+		r.Error = err.Error()
+	} else if p.result.unchanged {
+		r.Result = "unchanged"
+	} else if p.result.exists {
+		r.Result = "exists"
+	}
+	return audit.Append(p.auditLog, r, []byte(os.Getenv("HELM_PUSH_AUDIT_KEY")))
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/IxDay/helm-push-cloudflare-access/pkg/git"
+	"github.com/IxDay/helm-push-cloudflare-access/pkg/helm"
+)
+
+// changedCharts narrows charts down to the ones changed since ref, along
+// with the charts depending on them through file:// dependencies. The
+// charts are ordered so that dependencies are pushed first.
+func changedCharts(charts []string, ref string) ([]string, error) {
+	if len(charts) == 0 {
+		return nil, nil
+	}
+	paths := make([]string, len(charts))
+	byPath := map[string]int{}
+	for i, name := range charts {
+		paths[i] = realPath(name)
+		byPath[paths[i]] = i
+	}
+	dir := paths[0]
+	if fi, err := os.Stat(dir); err == nil && !fi.IsDir() {
+		dir = filepath.Dir(dir)
+	}
+	files, err := git.ChangedFiles(dir, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	selected := make([]bool, len(charts))
+	deps := make([][]int, len(charts))
+	for i, path := range paths {
+		for _, f := range files {
+			if f == path || strings.HasPrefix(f, path+string(filepath.Separator)) {
+				selected[i] = true
+				break
+			}
+		}
+		if fi, err := os.Stat(path); err != nil || !fi.IsDir() {
+			continue
+		}
+		local, err := helm.LocalDependencies(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, d := range local {
+			if j, ok := byPath[realPath(d)]; ok {
+				deps[i] = append(deps[i], j)
+			}
+		}
+	}
+
+	// A chart depending on a changed chart changes too
+	for changed := true; changed; {
+		changed = false
+		for i := range charts {
+			for _, j := range deps[i] {
+				if selected[j] && !selected[i] {
+					selected[i], changed = true, true
+				}
+			}
+		}
+	}
+
+	var ordered []string
+	visited := make([]bool, len(charts))
+	var visit func(i int)
+	visit = func(i int) {
+		if visited[i] {
+			return
+		}
+		visited[i] = true
+		for _, j := range deps[i] {
+			if selected[j] {
+				visit(j)
+			}
+		}
+		ordered = append(ordered, charts[i])
+	}
+	for i := range charts {
+		if selected[i] {
+			visit(i)
+		}
+	}
+	return ordered, nil
+}
+
+// realPath returns the absolute path of name with symbolic links resolved,
+// as git reports them
+func realPath(name string) string {
+	path, err := filepath.Abs(name)
+	if err != nil {
+		return filepath.Clean(name)
+	}
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		return resolved
+	}
+	return path
+}
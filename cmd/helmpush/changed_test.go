@@ -0,0 +1,78 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestChangedCharts(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	tmp, err := ioutil.TempDir("", "helm-push-test")
+	if err != nil {
+		t.Fatal("unexpected error creating temp test dir", err)
+	}
+	defer os.RemoveAll(tmp)
+	git := func(args ...string) {
+		cmd := exec.Command("git", append([]string{"-C", tmp, "-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %s", args, out)
+		}
+	}
+	write := func(name, data string) {
+		path := filepath.Join(tmp, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		ioutil.WriteFile(path, []byte(data), 0644)
+	}
+	write("charts/common/Chart.yaml", "apiVersion: v2\nname: common\nversion: 0.1.0\ntype: library\n")
+	write("charts/api/Chart.yaml", "apiVersion: v2\nname: api\nversion: 0.1.0\ndependencies:\n- name: common\n  version: 0.1.0\n  repository: file://../common\n")
+	write("charts/web/Chart.yaml", "apiVersion: v2\nname: web\nversion: 0.1.0\n")
+	git("init", "-q")
+	git("add", "-A")
+	git("commit", "-q", "-m", "init")
+	git("tag", "v1")
+
+	charts := []string{
+		filepath.Join(tmp, "charts/api"),
+		filepath.Join(tmp, "charts/common"),
+		filepath.Join(tmp, "charts/web"),
+	}
+	selected, err := changedCharts(charts, "v1")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(selected) != 0 {
+		t.Errorf("expected no changed chart, got %v", selected)
+	}
+
+	// The dependent chart is pushed too, after its dependency
+	write("charts/common/values.yaml", "common: true\n")
+	selected, err = changedCharts(charts, "v1")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if expected := []string{charts[1], charts[0]}; !reflect.DeepEqual(selected, expected) {
+		t.Errorf("expected %v, got %v", expected, selected)
+	}
+
+	git("add", "-A")
+	git("commit", "-q", "-m", "common values")
+	git("tag", "v2")
+	write("charts/web/values.yaml", "web: true\n")
+	selected, err = changedCharts(charts, "v2")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if expected := []string{charts[2]}; !reflect.DeepEqual(selected, expected) {
+		t.Errorf("expected %v, got %v", expected, selected)
+	}
+
+	if _, err := changedCharts(charts, "unknown-ref"); err == nil {
+		t.Error("expected error with unknown ref, instead got nil")
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"github.com/IxDay/helm-push-cloudflare-access/pkg/changelog"
+	"github.com/IxDay/helm-push-cloudflare-access/pkg/helm"
+)
+
+// annotateChanges sets the Artifact Hub changes annotation from the
+// section of the chart changelog matching the version pushed, it tells
+// whether the chart was annotated. A missing changelog or section is not
+// an error.
+func (p *pushCmd) annotateChanges(chart *helm.Chart) (bool, error) {
+	var data []byte
+	for _, f := range chart.Files {
+		if f.Name == changelog.FileName {
+			data = f.Data
+		}
+	}
+	if data == nil {
+		p.log.Warn("no changelog found in chart", "chart", chart.Metadata.Name, "file", changelog.FileName)
+		return false, nil
+	}
+	changes, ok := changelog.Changes(data, chart.Metadata.Version)
+	if !ok || len(changes) == 0 {
+		p.log.Warn("no changes found in changelog", "chart", chart.Metadata.Name, "version", chart.Metadata.Version)
+		return false, nil
+	}
+	value, err := changelog.Annotate(changes)
+	if err != nil {
+		return false, err
+	}
+	chart.SetAnnotations(map[string]string{changelog.Annotation: value})
+	p.log.Debug("changes annotation set", "chart", chart.Metadata.Name, "changes", len(changes))
+	return true, nil
+}
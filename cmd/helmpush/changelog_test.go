@@ -0,0 +1,48 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/IxDay/helm-push-cloudflare-access/pkg/changelog"
+	"github.com/IxDay/helm-push-cloudflare-access/pkg/chartmuseumtest"
+)
+
+func TestPushCmdChangelog(t *testing.T) {
+	ts := chartmuseumtest.NewServer()
+	defer ts.Close()
+
+	tmp, err := ioutil.TempDir("", "helm-push-test")
+	if err != nil {
+		t.Fatal("unexpected error creating temp test dir", err)
+	}
+	defer os.RemoveAll(tmp)
+	ioutil.WriteFile(filepath.Join(tmp, "Chart.yaml"), []byte("apiVersion: v2\nname: mychart\nversion: 1.2.0\n"), 0644)
+	ioutil.WriteFile(filepath.Join(tmp, "CHANGELOG.md"), []byte("## [1.2.0]\n### Fixed\n- Service port name\n"), 0644)
+
+	push := func(version string) {
+		args := []string{tmp, ts.URL}
+		cmd := newPushCmd(args)
+		cmd.Flags().Set("context-path", "/")
+		cmd.Flags().Set("changelog", "true")
+		cmd.Flags().Set("version", version)
+		if err := cmd.RunE(cmd, args); err != nil {
+			t.Fatalf("unexpected error pushing chart: %s", err)
+		}
+	}
+
+	push("1.2.0")
+	pushed := loadPushed(t, ts, "mychart", "1.2.0")
+	expected := "- description: Service port name\n  kind: fixed\n"
+	if a := pushed.Metadata.Annotations[changelog.Annotation]; a != expected {
+		t.Errorf("expected changes annotation %q, got %q", expected, a)
+	}
+
+	// No section for the version, the chart is pushed as is
+	push("1.3.0")
+	if a, ok := loadPushed(t, ts, "mychart", "1.3.0").Metadata.Annotations[changelog.Annotation]; ok {
+		t.Errorf("expected no changes annotation, got %q", a)
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/IxDay/helm-push-cloudflare-access/pkg/ci"
+	"github.com/IxDay/helm-push-cloudflare-access/pkg/helm"
+	"github.com/spf13/pflag"
+)
+
+// CI integrations, see --ci
+const (
+	ciAuto   = "auto"
+	ciGitHub = "github"
+)
+
+// ciRetries is the number of retries of the CI mode, unless --retries is
+// given
+const ciRetries = 3
+
+// setCIMode applies the defaults of the CI mode, enabled by --ci: JSON
+// logs and retries. Secrets given on the command line are refused, other
+// processes can read it.
+func (p *pushCmd) setCIMode(flags *pflag.FlagSet) error {
+	if p.ci == "" {
+		return nil
+	}
+	if p.ci == ciAuto && os.Getenv("GITHUB_ACTIONS") == "true" {
+		p.ci = ciGitHub
+	}
+	if flags.Changed("client-secret") {
+		return errors.New("--client-secret is refused in CI mode as command lines are visible to other processes: use $HELM_REPO_CLIENT_SECRET or the configuration file")
+	}
+	if p.logFormat == "" {
+		p.logFormat = "json"
+	}
+	if _, ok := os.LookupEnv("HELM_PUSH_RETRIES"); !ok && !flags.Changed("retries") {
+		p.retries = ciRetries
+	}
+	return nil
+}
+
+// checkShadowedRepo refuses, in CI mode, a helmfile repository shadowing
+// a repository of the local list with another URL
+func (p *pushCmd) checkShadowedRepo(repo *helm.Repo) error {
+	local, err := helm.GetRepoByName(p.repoName)
+	if err != nil {
+		return nil
+	}
+	if p.repoURL(local) != p.repoURL(repo) {
+		return fmt.Errorf("repository %s is both in %s (%s) and in the local repository list (%s): rename one of them", p.repoName, p.helmfile, p.repoURL(repo), p.repoURL(local))
+	}
+	return nil
+}
+
+// reportCI publishes the outcome of the pushes to the configured CI system.
+// Workflow commands go to stderr, which the runner reads as well, stdout
+// being left to --events.
+func (p *pushCmd) reportCI() error {
+	if p.ci == ciGitHub {
+		return p.reportGitHub(ci.NewGitHub(p.errOut))
+	}
+	return nil
+}
+
+// reportGitHub sets the step outputs from the successful pushes, one line
+// per chart when several were pushed, annotates failures and summarizes
+// everything in a table
+func (p *pushCmd) reportGitHub(gh *ci.GitHub) error {
+	var charts, versions, digests, urls []string
+	var summary strings.Builder
+	summary.WriteString("| Chart | Version | Repository | Digest | Result |\n")
+	summary.WriteString("| --- | --- | --- | --- | --- |\n")
+
+	for _, r := range p.results {
+		result := ":white_check_mark: pushed"
+		if r.unchanged {
+			result = ":white_check_mark: unchanged"
+		} else if r.exists {
+			result = ":warning: exists, skipped"
+		}
+		if r.err != nil {
+			gh.Error("helm push "+r.chart, r.err.Error())
+			result = ":x: " + strings.ReplaceAll(r.err.Error(), "|", "\\|")
+		} else {
+			charts = append(charts, r.name)
+			versions = append(versions, r.version)
+			digests = append(digests, r.digest)
+			urls = append(urls, r.url)
+		}
+		fmt.Fprintf(&summary, "| %s | %s | %s | `%s` | %s |\n", r.displayName(), r.version, r.url, r.digest, result)
+	}
+
+	if len(charts) > 0 {
+		outputs := []struct {
+			name   string
+			values []string
+		}{
+			{"chart", charts},
+			{"version", versions},
+			{"digest", digests},
+			{"repo-url", urls},
+		}
+		for _, o := range outputs {
+			if err := gh.SetOutput(o.name, strings.Join(o.values, "\n")); err != nil {
+				return err
+			}
+		}
+	}
+	return gh.AppendSummary(summary.String())
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/IxDay/helm-push-cloudflare-access/pkg/chartmuseumtest"
+)
+
+func TestPushCmdCIMode(t *testing.T) {
+	ts := chartmuseumtest.NewServer()
+	defer ts.Close()
+	os.Unsetenv("GITHUB_ACTIONS")
+	os.Setenv("HELM_REPO_CLIENT_ID", "my-id")
+	defer os.Unsetenv("HELM_REPO_CLIENT_ID")
+
+	push := func(flags map[string]string) (string, error) {
+		var stderr bytes.Buffer
+		args := []string{testTarballPath, ts.URL}
+		cmd := newPushCmd(args)
+		cmd.SetErr(&stderr)
+		cmd.Flags().Set("context-path", "/")
+		cmd.Flags().Set("ci", "auto")
+		for k, v := range flags {
+			cmd.Flags().Set(k, v)
+		}
+		err := cmd.RunE(cmd, args)
+		return stderr.String(), err
+	}
+
+	if _, err := push(map[string]string{"client-secret": "my-secret"}); err == nil || !strings.Contains(err.Error(), "--client-secret is refused") {
+		t.Errorf("expected --client-secret to be refused, got %v", err)
+	}
+	if _, err := push(nil); err == nil || !strings.Contains(err.Error(), "incomplete Cloudflare Access credentials") {
+		t.Errorf("expected incomplete credentials error, got %v", err)
+	}
+
+	os.Setenv("HELM_REPO_CLIENT_SECRET", "my-secret")
+	defer os.Unsetenv("HELM_REPO_CLIENT_SECRET")
+	// A transient failure, retried in CI mode
+	ts.InjectFault(chartmuseumtest.Fault{Method: "POST", Path: "/api/charts", Status: 503, Times: 1})
+	stderr, err := push(nil)
+	if err != nil {
+		t.Fatalf("unexpected error pushing in CI mode: %s", err)
+	}
+	if countRequests(ts, "POST", "/api/charts") != 2 {
+		t.Errorf("expected the upload to be retried once, got %d uploads", countRequests(ts, "POST", "/api/charts"))
+	}
+	if !strings.Contains(stderr, `"msg":"chart pushed"`) {
+		t.Errorf("expected JSON logs in CI mode, got:\n%s", stderr)
+	}
+
+	ts.InjectFault(chartmuseumtest.Fault{Method: "POST", Path: "/api/charts", Status: 503, Times: 1})
+	if _, err := push(map[string]string{"retries": "0", "force": "true"}); err == nil || countRequests(ts, "POST", "/api/charts") != 3 {
+		t.Errorf("expected a single failed upload with --retries=0, got %v after %d uploads", err, countRequests(ts, "POST", "/api/charts")-2)
+	}
+}
+
+func TestPushCmdGitHubEvents(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "helm-push-test")
+	if err != nil {
+		t.Fatal("unexpected error creating temp test dir", err)
+	}
+	defer os.RemoveAll(tmp)
+	os.Setenv("GITHUB_OUTPUT", filepath.Join(tmp, "output"))
+	os.Setenv("GITHUB_STEP_SUMMARY", filepath.Join(tmp, "summary"))
+	defer os.Unsetenv("GITHUB_OUTPUT")
+	defer os.Unsetenv("GITHUB_STEP_SUMMARY")
+	ts := chartmuseumtest.NewServer()
+	defer ts.Close()
+	ts.InjectFault(chartmuseumtest.Fault{Status: 500})
+
+	var stdout, stderr bytes.Buffer
+	args := []string{testTarballPath, ts.URL}
+	cmd := newPushCmd(args)
+	cmd.SetOut(&stdout)
+	cmd.SetErr(&stderr)
+	cmd.Flags().Set("context-path", "/")
+	cmd.Flags().Set("ci", "github")
+	cmd.Flags().Set("events", "true")
+	if err := cmd.RunE(cmd, args); err == nil {
+		t.Fatal("expected error pushing to a failing server, instead got nil")
+	}
+
+	// stdout only holds the events
+	for _, line := range strings.Split(strings.TrimSpace(stdout.String()), "\n") {
+		if !json.Valid([]byte(line)) {
+			t.Errorf("expected only JSON events on stdout, got %q", line)
+		}
+	}
+	if !strings.Contains(stderr.String(), "::error title=helm push") {
+		t.Errorf("expected the error annotation on stderr, got:\n%s", stderr.String())
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/IxDay/helm-push-cloudflare-access/pkg/redact"
+)
+
+type (
+	// eventStream writes newline-delimited JSON events, a nil *eventStream
+	// is valid and writes nothing
+	eventStream struct {
+		mu  sync.Mutex
+		enc *json.Encoder
+	}
+
+	// event is a single line of the stream, unset fields are omitted
+	event struct {
+		Time    time.Time `json:"time"`
+		Event   string    `json:"event"`
+		Chart   string    `json:"chart"`
+		Name    string    `json:"name,omitempty"`
+		Version string    `json:"version,omitempty"`
+		Digest  string    `json:"digest,omitempty"`
+		Repo    string    `json:"repo,omitempty"`
+		Sent    int64     `json:"sent,omitempty"`
+		Total   int64     `json:"total,omitempty"`
+		Success *bool     `json:"success,omitempty"`
+		Error   string    `json:"error,omitempty"`
+	}
+)
+
+func newEventStream(w io.Writer) *eventStream {
+	return &eventStream{enc: json.NewEncoder(w)}
+}
+
+func (s *eventStream) emit(e event) {
+	if s == nil {
+		return
+	}
+	e.Time = time.Now().UTC()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.enc.Encode(e)
+}
+
+// uploadProgress returns a progress callback emitting an upload-progress
+// event each time another percent of the chart has been sent
+func (s *eventStream) uploadProgress(chart string) func(sent, total int64) {
+	last := int64(-1)
+	return func(sent, total int64) {
+		percent := sent * 100 / total
+		if percent == last {
+			return
+		}
+		last = percent
+		s.emit(event{Event: "upload-progress", Chart: chart, Sent: sent, Total: total})
+	}
+}
+
+// uploadDone emits the upload-done event for the current chart
+func (p *pushCmd) uploadDone(err error) {
+	success := err == nil
+	e := event{
+		Event:   "upload-done",
+		Chart:   p.chartName,
+		Name:    p.result.name,
+		Version: p.result.version,
+		Digest:  p.result.digest,
+		Repo:    p.result.url,
+		Success: &success,
+	}
+	if err != nil {
+		e.Error = redact.String(err.Error())
+	}
+	p.events.emit(e)
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestEventStream(t *testing.T) {
+	// A nil stream writes nothing and does not panic
+	var disabled *eventStream
+	disabled.emit(event{Event: "package-start"})
+	(&pushCmd{}).uploadDone(nil)
+
+	var buf bytes.Buffer
+	s := newEventStream(&buf)
+	progress := s.uploadProgress("mychart/")
+	for sent := int64(0); sent <= 1000; sent += 5 {
+		progress(sent, 1000)
+	}
+	p := &pushCmd{chartName: "mychart/", events: s, result: pushResult{name: "mychart", version: "0.1.0"}}
+	p.uploadDone(errors.New("409: already exists"))
+
+	var events []map[string]interface{}
+	scanner := bufio.NewScanner(&buf)
+	for scanner.Scan() {
+		var e map[string]interface{}
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			t.Fatalf("expected one json event per line, got %q: %s", scanner.Text(), err)
+		}
+		events = append(events, e)
+	}
+
+	// One progress event per percent, plus upload-done
+	if len(events) != 102 {
+		t.Fatalf("expected 102 events, got %d", len(events))
+	}
+	if e := events[100]; e["event"] != "upload-progress" || e["sent"] != float64(1000) || e["total"] != float64(1000) {
+		t.Errorf("unexpected last progress event %v", e)
+	}
+	if e := events[101]; e["event"] != "upload-done" || e["success"] != false || e["error"] != "409: already exists" || e["version"] != "0.1.0" {
+		t.Errorf("unexpected upload-done event %v", e)
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/IxDay/helm-push-cloudflare-access/pkg/helm"
+	"github.com/IxDay/helm-push-cloudflare-access/pkg/helmfile"
+)
+
+// helmfileRepo returns the repository named p.repoName in the helmfile, or
+// nil if it is not declared there. The TLS files declared along with it
+// are used unless given by flags, credentials are looked up by name in the
+// plugin configuration as usual.
+func (p *pushCmd) helmfileRepo() (*helm.Repo, error) {
+	repos, err := helmfile.Load(p.helmfile)
+	if err != nil {
+		return nil, err
+	}
+	r, ok := helmfile.Find(repos, p.repoName)
+	if !ok {
+		return nil, nil
+	}
+	if r.OCI {
+		return nil, fmt.Errorf("repository %s of %s is an OCI registry, which is not supported", r.Name, p.helmfile)
+	}
+	repo, err := helm.TempRepoFromURL(r.URL)
+	if err != nil {
+		return nil, err
+	}
+	repo.Config.Name = r.Name
+	if p.caFile == "" {
+		p.caFile = r.CAFile
+	}
+	if p.certFile == "" {
+		p.certFile = r.CertFile
+	}
+	if p.keyFile == "" {
+		p.keyFile = r.KeyFile
+	}
+	p.log.Debug("repository read from helmfile", "name", r.Name, "url", repo.Config.URL, "helmfile", p.helmfile)
+	return repo, nil
+}
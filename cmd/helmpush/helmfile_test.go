@@ -0,0 +1,44 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/IxDay/helm-push-cloudflare-access/pkg/chartmuseumtest"
+)
+
+func TestPushCmdHelmfile(t *testing.T) {
+	ts := chartmuseumtest.NewServer(chartmuseumtest.RequireAccess("my-id", "my-secret"))
+	defer ts.Close()
+
+	tmp, err := ioutil.TempDir("", "helm-push-test")
+	if err != nil {
+		t.Fatal("unexpected error creating temp test dir", err)
+	}
+	defer os.RemoveAll(tmp)
+	helmfilePath := filepath.Join(tmp, "helmfile.yaml")
+	ioutil.WriteFile(helmfilePath, []byte("repositories:\n- name: internal\n  url: "+ts.URL+"\n"), 0644)
+	configPath := filepath.Join(tmp, "push.yaml")
+	ioutil.WriteFile(configPath, []byte("helmfile: "+helmfilePath+"\nrepositories:\n  internal:\n    client_id: my-id\n    client_secret: my-secret\n"), 0600)
+
+	push := func(repo string) error {
+		args := []string{testTarballPath, repo}
+		cmd := newPushCmd(args)
+		cmd.Flags().Set("context-path", "/")
+		cmd.Flags().Set("config", configPath)
+		return cmd.RunE(cmd, args)
+	}
+	if err := push("internal"); err != nil {
+		t.Fatalf("unexpected error pushing chart: %s", err)
+	}
+	if _, ok := ts.Chart("mychart", "0.1.0"); !ok || len(ts.Unauthenticated()) != 0 {
+		t.Errorf("expected credentials of the internal profile to be sent, got %d unauthenticated requests", len(ts.Unauthenticated()))
+	}
+
+	// Neither in the helmfile nor in the local repository list
+	if err := push("unknown"); err == nil {
+		t.Error("expected error with unknown repository, instead got nil")
+	}
+}
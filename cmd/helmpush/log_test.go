@@ -0,0 +1,48 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestNewLogger(t *testing.T) {
+	var buf bytes.Buffer
+
+	// JSON format
+	logger, err := newLogger(&buf, "json", "info")
+	if err != nil {
+		t.Fatalf("unexpected error creating json logger: %s", err)
+	}
+	logger.Info("pushing chart", "chart", "mychart-0.1.0.tgz")
+	var record map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("expected a json record, got %q: %s", buf.String(), err)
+	}
+	if record["msg"] != "pushing chart" || record["chart"] != "mychart-0.1.0.tgz" {
+		t.Errorf("unexpected json record: %v", record)
+	}
+
+	// Text format, debug filtered out at info level
+	buf.Reset()
+	logger, err = newLogger(&buf, "text", "info")
+	if err != nil {
+		t.Fatalf("unexpected error creating text logger: %s", err)
+	}
+	logger.Debug("hidden")
+	logger.Warn("shown")
+	if out := buf.String(); strings.Contains(out, "hidden") || !strings.Contains(out, "msg=shown") {
+		t.Errorf("unexpected text output: %q", out)
+	}
+
+	// Bad format
+	if _, err := newLogger(&buf, "xml", "info"); err == nil {
+		t.Error("expected error with bad log format, instead got nil")
+	}
+
+	// Bad level
+	if _, err := newLogger(&buf, "text", "loud"); err == nil {
+		t.Error("expected error with bad log level, instead got nil")
+	}
+}
@@ -1,26 +1,40 @@
 package main
 
 import (
-	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
-	"io/ioutil"
-	"net/http"
+	"log/slog"
 	"net/url"
 	"os"
 	"path/filepath"
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
+	"github.com/IxDay/helm-push-cloudflare-access/pkg/changelog"
 	cm "github.com/IxDay/helm-push-cloudflare-access/pkg/chartmuseum"
+	"github.com/IxDay/helm-push-cloudflare-access/pkg/config"
+	"github.com/IxDay/helm-push-cloudflare-access/pkg/fips"
 	"github.com/IxDay/helm-push-cloudflare-access/pkg/helm"
+	"github.com/IxDay/helm-push-cloudflare-access/pkg/hints"
+	"github.com/IxDay/helm-push-cloudflare-access/pkg/manifest"
+	"github.com/IxDay/helm-push-cloudflare-access/pkg/netrc"
+	"github.com/IxDay/helm-push-cloudflare-access/pkg/project"
+	"github.com/IxDay/helm-push-cloudflare-access/pkg/push"
+	"github.com/IxDay/helm-push-cloudflare-access/pkg/redact"
+	"github.com/IxDay/helm-push-cloudflare-access/pkg/sbom"
+	"github.com/IxDay/helm-push-cloudflare-access/pkg/telemetry"
+	"github.com/IxDay/helm-push-cloudflare-access/pkg/tmpdir"
+	"github.com/IxDay/helm-push-cloudflare-access/pkg/wincred"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 	"helm.sh/helm/v3/pkg/chartutil"
 	"helm.sh/helm/v3/pkg/cli"
 	"helm.sh/helm/v3/pkg/downloader"
 	"helm.sh/helm/v3/pkg/getter"
+	"helm.sh/helm/v3/pkg/provenance"
 	v2downloader "k8s.io/helm/pkg/downloader"
 	v2getter "k8s.io/helm/pkg/getter"
 	v2environment "k8s.io/helm/pkg/helm/environment"
@@ -28,33 +42,90 @@ import (
 
 type (
 	pushCmd struct {
+		chartNames         []string
 		chartName          string
 		appVersion         string
 		chartVersion       string
+		versionSuffix      string
+		expandEnv          bool
 		repoName           string
+		channel            string
 		clientID           string
 		clientSecret       string
+		signingKey         string
 		contextPath        string
 		forceUpload        bool
+		lock               bool
+		lockTTL            time.Duration
+		waitIndex          time.Duration
+		skipUnchanged      bool
+		onConflict         string
 		useHTTP            bool
 		checkHelmVersion   bool
 		caFile             string
 		certFile           string
 		keyFile            string
 		insecureSkipVerify bool
+		pins               []string
 		keyring            string
+		sign               bool
+		signKey            string
+		passphraseFile     string
 		dependencyUpdate   bool
+		logFormat          string
+		logLevel           string
+		debugHTTP          bool
+		debugHTTPBody      bool
+		retries            int
+		chartAPI           bool
+		maxIndexSize       int64
+		showStats          bool
 		out                io.Writer
+		errOut             io.Writer
+		log                *slog.Logger
+		stats              *stats
+		telemetry          *telemetry.Exporter
+		span               *telemetry.Span
+		auditLog           string
+		ci                 string
+		report             string
+		reportFormat       string
+		showEvents         bool
+		events             *eventStream
+		verify             string
+		sbom               string
+		sbomImages         bool
+		sbomOut            string
+		configPath         string
+		helmfile           string
+		entry              *manifest.Chart
+		changedSince       string
+		changelog          bool
+		addRepo            string
+		saveCredentials    bool
+		policies           []string
+		patches            []string
+		watchChart         bool
+		watchDebounce      time.Duration
+		config             *config.Config
+		result             pushResult
+		results            []pushResult
 	}
 
-	config struct {
-		CurrentContext string             `json:"current-context"`
-		Contexts       map[string]context `json:"contexts"`
-	}
-
-	context struct {
-		Name  string `json:"name"`
-		Token string `json:"token"`
+	// pushResult describes the chart package handled by a push
+	pushResult struct {
+		chart    string
+		name     string
+		version  string
+		digest   string
+		url      string
+		duration time.Duration
+		err      error
+		// unchanged is set when the upload was skipped, see --skip-unchanged
+		unchanged bool
+		// exists is set when the repository had the chart version and the
+		// upload was skipped, see --on-conflict skip
+		exists bool
 	}
 )
 
@@ -69,6 +140,7 @@ Examples:
   $ helm push . chartmuseum                       # package and push chart directory
   $ helm push . --version="7c4d121" chartmuseum   # override version in Chart.yaml
   $ helm push . https://my.chart.repo.com         # push directly to chart repo URL
+  $ helm push charts/* chartmuseum                # push several charts at once
 `
 )
 
@@ -79,7 +151,10 @@ func newPushCmd(args []string) *cobra.Command {
 		Short:        "Helm plugin to push chart package to ChartMuseum",
 		Long:         globalUsage,
 		SilenceUsage: false,
-		RunE: func(cmd *cobra.Command, args []string) error {
+		Args:         cobra.ArbitraryArgs,
+		RunE: func(cmd *cobra.Command, args []string) (err error) {
+			// Errors are printed by cobra, make sure they leak no secret
+			defer func() { err = redact.Error(err) }()
 
 			// If the --check-helm-version flag is provided, short circuit
 			if p.checkHelmVersion {
@@ -87,44 +162,162 @@ func newPushCmd(args []string) *cobra.Command {
 				return nil
 			}
 
-			p.out = cmd.OutOrStdout()
+			if err := p.setup(cmd); err != nil {
+				return err
+			}
 
 			// If there are 4 args, this is likely being used as a downloader for cm:// protocol
 			if len(args) == 4 && strings.HasPrefix(args[3], "cm://") {
-				p.setFieldsFromEnv()
-				return p.download(args[3])
+				return hints.Annotate(p.download(args[3]))
 			}
 
-			if len(args) != 2 {
-				return errors.New("This command needs 2 arguments: name of chart, name of chart repository (or repo URL)")
+			if err := p.setTarget(args); err != nil {
+				return err
+			}
+			if err := p.checkAddRepo(); err != nil {
+				return err
 			}
-			p.chartName = args[0]
-			p.repoName = args[1]
-			p.setFieldsFromEnv()
-			return p.push()
+			if p.changedSince != "" {
+				charts, err := changedCharts(p.chartNames, p.changedSince)
+				if err != nil {
+					return err
+				}
+				if len(charts) == 0 {
+					p.log.Info("no chart changed", "since", p.changedSince)
+					return nil
+				}
+				p.log.Debug("changed charts", "since", p.changedSince, "charts", charts)
+				p.chartNames = charts
+			}
+			if p.watchChart {
+				p.chartName = p.chartNames[0]
+				return p.watch(cmd.Context())
+			}
+			if err := p.publish(p.pushAll); err != nil {
+				return err
+			}
+			if p.addRepo != "" {
+				return p.registerRepo()
+			}
+			return nil
 		},
 	}
 	f := cmd.Flags()
 	f.StringVarP(&p.chartVersion, "version", "v", "", "Override chart version pre-push")
 	f.StringVarP(&p.appVersion, "app-version", "a", "", "Override app version pre-push")
+	f.StringVarP(&p.versionSuffix, "version-suffix", "", "", "Append a pre-release identifier to the chart version, one of: git-sha, timestamp or a literal identifier [$HELM_PUSH_VERSION_SUFFIX]")
+	p.addRepoFlags(f)
+	p.addPushFlags(f)
+	f.StringVarP(&p.changedSince, "changed-since", "", "", "Only push the charts changed since this git ref, and the charts depending on them [$HELM_PUSH_CHANGED_SINCE]")
+	f.BoolVarP(&p.forceUpload, "force", "f", false, "Force upload even if chart version exists")
+	f.StringVarP(&p.channel, "channel", "", "", "Push to the repository of this release channel of the configuration file, every argument is then a chart [$HELM_PUSH_CHANNEL]")
+	f.BoolVarP(&p.watchChart, "watch", "", false, "Push the chart directory again, with a dev prerelease version, every time it changes")
+	f.DurationVarP(&p.watchDebounce, "watch-debounce", "", 0, "With --watch, how long the chart must stay unchanged before being pushed (default 1s)")
+	f.StringVarP(&p.addRepo, "add-repo", "", "", "Once pushed, add the repository URL to the local repository list under this name")
+	f.BoolVarP(&p.saveCredentials, "save-credentials", "", false, "With --add-repo, also store the client ID and secret in the plugin configuration file")
+	f.BoolVarP(&p.checkHelmVersion, "check-helm-version", "", false, `outputs either "2" or "3" indicating the current Helm major version`)
+
+	f.Parse(args)
+
+	// Helm settings are shared with the subcommands
+	v2settings.AddFlags(cmd.PersistentFlags())
+	v2settings.Init(cmd.PersistentFlags())
+
+	for _, sub := range []*cobra.Command{newStatusCmd(), newApplyCmd(), newPullCmd(), newReindexCmd(), newVerifyRemoteCmd(), newServeCmd(), newPromoteCmd(), newMigrateCmd()} {
+		if !shadowsChart(sub, f.Args()) {
+			cmd.AddCommand(sub)
+		}
+	}
+	return cmd
+}
+
+// shadowsChart tells if the subcommand sub would run in place of pushing
+// the chart directory named like it, first of args. The chart is pushed,
+// subcommands take no chart directory as first argument.
+func shadowsChart(sub *cobra.Command, args []string) bool {
+	if len(args) == 0 || (args[0] != sub.Name() && !sub.HasAlias(args[0])) {
+		return false
+	}
+	isChart, _ := chartutil.IsChartDir(args[0])
+	return isChart
+}
+
+// addRepoFlags registers the flags configuring how to reach and
+// authenticate against the repository, shared by every command
+func (p *pushCmd) addRepoFlags(f *pflag.FlagSet) {
 	f.StringVarP(&p.clientID, "client-id", "", "", "Cloudflare access client ID [$HELM_REPO_CLIENT_ID]")
 	f.StringVarP(&p.clientSecret, "client-secret", "", "", "Cloudflare access client secret [$HELM_REPO_CLIENT_SECRET]")
 	f.StringVarP(&p.contextPath, "context-path", "", "", "ChartMuseum context path [$HELM_REPO_CONTEXT_PATH]")
 	f.StringVarP(&p.caFile, "ca-file", "", "", "Verify certificates of HTTPS-enabled servers using this CA bundle [$HELM_REPO_CA_FILE]")
 	f.StringVarP(&p.certFile, "cert-file", "", "", "Identify HTTPS client using this SSL certificate file [$HELM_REPO_CERT_FILE]")
 	f.StringVarP(&p.keyFile, "key-file", "", "", "Identify HTTPS client using this SSL key file [$HELM_REPO_KEY_FILE]")
-	f.StringVar(&p.keyring, "keyring", defaultKeyring(), "location of a public keyring")
+	f.StringVarP(&p.configPath, "config", "", "", "Plugin configuration file (default is push.yaml in the Helm configuration directory) [$HELM_PUSH_CONFIG]")
+	f.StringVarP(&p.helmfile, "helmfile", "", "", "Also look up repositories by name in this helmfile.yaml [$HELM_PUSH_HELMFILE]")
+	f.StringVarP(&p.logFormat, "log-format", "", "", "Log output format, one of: text (default), json [$HELM_PUSH_LOG_FORMAT]")
+	f.StringVarP(&p.logLevel, "log-level", "", "", "Log level, one of: debug, info (default), warn, error [$HELM_PUSH_LOG_LEVEL]")
+	f.StringArrayVarP(&p.pins, "pin-sha256", "", nil, "Only accept servers presenting this public key, base64 encoded SHA-256 of its SPKI, can be repeated [$HELM_REPO_PIN_SHA256]")
 	f.BoolVarP(&p.insecureSkipVerify, "insecure", "", false, "Connect to server with an insecure way by skipping certificate verification [$HELM_REPO_INSECURE]")
-	f.BoolVarP(&p.forceUpload, "force", "f", false, "Force upload even if chart version exists")
-	f.BoolVarP(&p.dependencyUpdate, "dependency-update", "d", false, `update dependencies from "requirements.yaml" to dir "charts/" before packaging`)
-	f.BoolVarP(&p.checkHelmVersion, "check-helm-version", "", false, `outputs either "2" or "3" indicating the current Helm major version`)
-
-	f.Parse(args)
+	f.BoolVarP(&p.debugHTTP, "debug-http", "", false, "Dump HTTP request and response headers to stderr, credentials are redacted [$HELM_PUSH_DEBUG_HTTP]")
+	f.BoolVarP(&p.debugHTTPBody, "debug-http-body", "", false, "Also dump HTTP request and response bodies, implies --debug-http")
+	f.IntVarP(&p.retries, "retries", "", 0, "Retry idempotent requests and uploads failing with a network error or a 429, 502, 503 or 504 status this many times (3 with --ci) [$HELM_PUSH_RETRIES]")
+	f.BoolVarP(&p.chartAPI, "chart-api", "", false, "Look up chart versions with the ChartMuseum chart API rather than in the whole index [$HELM_PUSH_CHART_API]")
+	f.Int64VarP(&p.maxIndexSize, "max-index-size", "", 0, "Refuse repository indexes larger than this many MiB, 0 for no limit [$HELM_PUSH_MAX_INDEX_SIZE]")
+}
 
-	v2settings.AddFlags(f)
-	v2settings.Init(f)
+// addPushFlags registers the flags controlling how charts are published,
+// shared by the commands pushing charts
+func (p *pushCmd) addPushFlags(f *pflag.FlagSet) {
+	f.StringVar(&p.keyring, "keyring", defaultKeyring(), "location of a public keyring [$HELM_PUSH_KEYRING]")
+	f.BoolVarP(&p.sign, "sign", "", false, "Sign the chart package and push its provenance file [$HELM_PUSH_SIGN]")
+	f.StringVarP(&p.signKey, "key", "", "", "Name of the key to sign with, read from --keyring [$HELM_PUSH_SIGN_KEY]")
+	f.StringVarP(&p.passphraseFile, "passphrase-file", "", "", "File holding the passphrase of the signing key [$HELM_KEY_PASSPHRASE]")
+	f.BoolVarP(&p.lock, "lock", "", false, "Lock the chart version in the repository while pushing it, concurrent pushes of the same version fail [$HELM_PUSH_LOCK]")
+	f.DurationVarP(&p.lockTTL, "lock-ttl", "", 10*time.Minute, "With --lock, age after which a lock left by a crashed push is taken over")
+	f.BoolVarP(&p.skipUnchanged, "skip-unchanged", "", false, "Skip the upload when the repository has the chart version with the same digest [$HELM_PUSH_SKIP_UNCHANGED]")
+	f.StringVarP(&p.onConflict, "on-conflict", "", "", "What to do when the repository has the chart version, one of: fail (default), skip, force, bump [$HELM_PUSH_ON_CONFLICT]")
+	f.BoolVarP(&p.showStats, "stats", "", false, "Print a per-phase timing summary once done [$HELM_PUSH_STATS]")
+	f.DurationVarP(&p.waitIndex, "wait-index", "", 0, "Wait up to this long for the repository index to list the pushed chart version, 0 to not wait [$HELM_PUSH_WAIT_INDEX]")
+	f.StringVarP(&p.auditLog, "audit-log", "", "", "Append a JSON record of the operation to this file [$HELM_PUSH_AUDIT_LOG]")
+	f.StringVarP(&p.ci, "ci", "", "", "Run in CI mode and integrate with the CI system, one of: auto (detected from the environment, --ci alone), github [$HELM_PUSH_CI]")
+	f.Lookup("ci").NoOptDefVal = ciAuto
+	f.StringVarP(&p.report, "report", "", "", "Write a per-chart report to this file [$HELM_PUSH_REPORT]")
+	f.StringVarP(&p.reportFormat, "report-format", "", "", "Report format, one of: json, junit (defaults to junit for .xml files, json otherwise)")
+	f.BoolVarP(&p.showEvents, "events", "", false, "Write newline-delimited JSON progress events to stdout [$HELM_PUSH_EVENTS]")
+	f.BoolVarP(&p.expandEnv, "expand-env", "", false, "Replace ${NAME} placeholders of Chart.yaml version, appVersion and annotations with environment variables [$HELM_PUSH_EXPAND_ENV]")
+	f.BoolVarP(&p.changelog, "changelog", "", false, "Set the artifacthub.io/changes annotation from the section of the chart CHANGELOG.md matching the version pushed [$HELM_PUSH_CHANGELOG]")
+	f.StringVarP(&p.sbom, "sbom", "", "", "Embed an SBOM of the chart in the package, one of: cyclonedx, spdx [$HELM_PUSH_SBOM]")
+	f.BoolVarP(&p.sbomImages, "sbom-images", "", false, "Include the container images referenced in the chart values in the SBOM [$HELM_PUSH_SBOM_IMAGES]")
+	f.StringVarP(&p.sbomOut, "sbom-out", "", "", "Also write the SBOM to this directory")
+	f.StringArrayVarP(&p.patches, "patch", "", nil, "Merge this patch file into Chart.yaml and values.yaml before packaging, can be repeated")
+	f.StringArrayVarP(&p.policies, "policy", "", nil, "Refuse charts denied by this Rego policy file, evaluated with opa, can be repeated")
+	f.BoolVarP(&p.dependencyUpdate, "dependency-update", "d", false, `update dependencies from "requirements.yaml" to dir "charts/" before packaging`)
+}
 
-	return cmd
+// setup prepares the command once flags are parsed: output streams,
+// environment, logger and configuration
+func (p *pushCmd) setup(cmd *cobra.Command) error {
+	p.out = cmd.OutOrStdout()
+	p.errOut = redact.Writer(cmd.ErrOrStderr())
+	p.setFieldsFromEnv()
+	redact.Secret(p.clientSecret, p.signingKey, os.Getenv("HELM_PUSH_AUDIT_KEY"))
+	if err := p.setCIMode(cmd.Flags()); err != nil {
+		return err
+	}
+	if err := p.setLogger(p.errOut); err != nil {
+		return err
+	}
+	if err := p.loadConfig(); err != nil {
+		return err
+	}
+	if fips.Enabled {
+		p.log.Debug("FIPS mode enabled, using BoringCrypto")
+	}
+	// Remove what crashed runs left behind, temporary files are deferred
+	// removed otherwise
+	for _, path := range tmpdir.Prune(tmpdir.MaxAge) {
+		p.log.Debug("removed stale temporary file", "path", path)
+	}
+	return nil
 }
 
 func (p *pushCmd) setFieldsFromEnv() {
@@ -134,6 +327,9 @@ func (p *pushCmd) setFieldsFromEnv() {
 	if v, ok := os.LookupEnv("HELM_REPO_CLIENT_SECRET"); ok && p.clientSecret == "" {
 		p.clientSecret = v
 	}
+	if v, ok := os.LookupEnv("HELM_REPO_SIGNING_KEY"); ok && p.signingKey == "" {
+		p.signingKey = v
+	}
 	if v, ok := os.LookupEnv("HELM_REPO_CONTEXT_PATH"); ok && p.contextPath == "" {
 		p.contextPath = v
 	}
@@ -149,72 +345,538 @@ func (p *pushCmd) setFieldsFromEnv() {
 	if v, ok := os.LookupEnv("HELM_REPO_KEY_FILE"); ok && p.keyFile == "" {
 		p.keyFile = v
 	}
+	if v, ok := os.LookupEnv("HELM_REPO_PIN_SHA256"); ok && len(p.pins) == 0 {
+		p.pins = strings.Split(v, ",")
+	}
 	if v, ok := os.LookupEnv("HELM_REPO_INSECURE"); ok {
 		p.insecureSkipVerify, _ = strconv.ParseBool(v)
 	}
+	if v, ok := os.LookupEnv("HELM_PUSH_DEBUG_HTTP"); ok && !p.debugHTTP {
+		p.debugHTTP, _ = strconv.ParseBool(v)
+	}
+	if v, ok := os.LookupEnv("HELM_PUSH_STATS"); ok && !p.showStats {
+		p.showStats, _ = strconv.ParseBool(v)
+	}
+	if v, ok := os.LookupEnv("HELM_PUSH_WAIT_INDEX"); ok && p.waitIndex == 0 {
+		p.waitIndex, _ = time.ParseDuration(v)
+	}
+	if v, ok := os.LookupEnv("HELM_PUSH_AUDIT_LOG"); ok && p.auditLog == "" {
+		p.auditLog = v
+	}
+	if v, ok := os.LookupEnv("HELM_PUSH_CI"); ok && p.ci == "" {
+		p.ci = v
+	}
+	if v, ok := os.LookupEnv("HELM_PUSH_REPORT"); ok && p.report == "" {
+		p.report = v
+	}
+	if v, ok := os.LookupEnv("HELM_PUSH_EVENTS"); ok && !p.showEvents {
+		p.showEvents, _ = strconv.ParseBool(v)
+	}
+	if v, ok := os.LookupEnv("HELM_PUSH_VERIFY"); ok && p.verify == "" {
+		p.verify = v
+	}
+	if v, ok := os.LookupEnv("HELM_PUSH_SBOM"); ok && p.sbom == "" {
+		p.sbom = v
+	}
+	if v, ok := os.LookupEnv("HELM_PUSH_SBOM_IMAGES"); ok && !p.sbomImages {
+		p.sbomImages, _ = strconv.ParseBool(v)
+	}
+	if v, ok := os.LookupEnv("HELM_PUSH_SIGN"); ok && !p.sign {
+		p.sign, _ = strconv.ParseBool(v)
+	}
+	if v, ok := os.LookupEnv("HELM_PUSH_SIGN_KEY"); ok && p.signKey == "" {
+		p.signKey = v
+	}
+	if v, ok := os.LookupEnv("HELM_PUSH_KEYRING"); ok && p.keyring == defaultKeyring() {
+		p.keyring = v
+	}
+	if v, ok := os.LookupEnv("HELM_PUSH_EXPAND_ENV"); ok && !p.expandEnv {
+		p.expandEnv, _ = strconv.ParseBool(v)
+	}
+	if v, ok := os.LookupEnv("HELM_PUSH_CHANGELOG"); ok && !p.changelog {
+		p.changelog, _ = strconv.ParseBool(v)
+	}
+	if v, ok := os.LookupEnv("HELM_PUSH_CHANGED_SINCE"); ok && p.changedSince == "" {
+		p.changedSince = v
+	}
+	if v, ok := os.LookupEnv("HELM_PUSH_HELMFILE"); ok && p.helmfile == "" {
+		p.helmfile = v
+	}
+	if v, ok := os.LookupEnv("HELM_PUSH_LOG_FORMAT"); ok && p.logFormat == "" {
+		p.logFormat = v
+	}
+	if v, ok := os.LookupEnv("HELM_PUSH_LOG_LEVEL"); ok && p.logLevel == "" {
+		p.logLevel = v
+	}
+	if v, ok := os.LookupEnv("HELM_PUSH_RETRIES"); ok && p.retries == 0 {
+		p.retries, _ = strconv.Atoi(v)
+	}
+	if v, ok := os.LookupEnv("HELM_PUSH_CHART_API"); ok && !p.chartAPI {
+		p.chartAPI, _ = strconv.ParseBool(v)
+	}
+	if v, ok := os.LookupEnv("HELM_PUSH_MAX_INDEX_SIZE"); ok && p.maxIndexSize == 0 {
+		p.maxIndexSize, _ = strconv.ParseInt(v, 10, 64)
+	}
+	if v, ok := os.LookupEnv("HELM_PUSH_VERSION_SUFFIX"); ok && p.versionSuffix == "" {
+		p.versionSuffix = v
+	}
+	if v, ok := os.LookupEnv("HELM_PUSH_CHANNEL"); ok && p.channel == "" {
+		p.channel = v
+	}
+	if v, ok := os.LookupEnv("HELM_PUSH_LOCK"); ok && !p.lock {
+		p.lock, _ = strconv.ParseBool(v)
+	}
+	if v, ok := os.LookupEnv("HELM_PUSH_SKIP_UNCHANGED"); ok && !p.skipUnchanged {
+		p.skipUnchanged, _ = strconv.ParseBool(v)
+	}
+	if v, ok := os.LookupEnv("HELM_PUSH_ON_CONFLICT"); ok && p.onConflict == "" {
+		p.onConflict = v
+	}
 }
 
-func (p *pushCmd) push() error {
-	var repo *helm.Repo
+// validate checks the enumerated options before doing any work
+func (p *pushCmd) validate() error {
+	if p.ci != "" && p.ci != ciAuto && p.ci != ciGitHub {
+		return fmt.Errorf("unsupported CI integration %q, must be one of: %s, %s", p.ci, ciAuto, ciGitHub)
+	}
+	if p.reportFormat != "" && p.reportFormat != "json" && p.reportFormat != "junit" {
+		return fmt.Errorf("invalid report format %q, must be one of: json, junit", p.reportFormat)
+	}
+	switch p.verify {
+	case "", verifyProvenance:
+	case verifyCosign:
+		if err := p.config.Cosign.Validate(); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("invalid verification %q, must be one of: %s, %s", p.verify, verifyProvenance, verifyCosign)
+	}
+	for _, pin := range p.pins {
+		if _, err := cm.ParsePin(pin); err != nil {
+			return err
+		}
+	}
+	if err := push.Conflict(p.onConflict).Validate(); err != nil {
+		return err
+	}
+	if p.versionSuffix != "" {
+		if err := validateSuffix(p.versionSuffix); err != nil {
+			return err
+		}
+	}
+	if p.sbom != "" {
+		return sbom.Validate(p.sbom)
+	}
+	return nil
+}
+
+// loadConfig loads the plugin configuration, settings not provided by
+// flags or environment are taken from it
+func (p *pushCmd) loadConfig() error {
 	var err error
+	if p.configPath != "" {
+		p.config, err = config.Load(p.configPath)
+	} else {
+		p.config, err = config.LoadDefault()
+	}
+	if err != nil {
+		return err
+	}
+	for _, h := range p.config.Webhooks {
+		// Slack and Teams incoming webhook URLs are bearer secrets
+		redact.Secret(h.URL)
+		for _, v := range h.Headers {
+			redact.Secret(v)
+		}
+	}
+	for _, r := range p.config.Repositories {
+		redact.Secret(r.ClientSecret, r.Signing.Key)
+	}
+	if p.auditLog == "" {
+		p.auditLog = p.config.AuditLog
+	}
+	if p.verify == "" {
+		p.verify = p.config.Verify
+	}
+	if p.keyring == defaultKeyring() && p.config.Keyring != "" {
+		p.keyring = p.config.Keyring
+	}
+	if p.helmfile == "" {
+		p.helmfile = p.config.Helmfile
+	}
+	return p.validate()
+}
 
-	// If the argument looks like a URL, just create a temp repo object
-	// instead of looking for the entry in the local repository list
-	if regexp.MustCompile(`^https?://`).MatchString(p.repoName) {
-		repo, err = helm.TempRepoFromURL(p.repoName)
-		p.repoName = repo.Config.URL
+// setLogger configures the structured logger, --debug forces the debug level.
+func (p *pushCmd) setLogger(w io.Writer) error {
+	format, level := p.logFormat, p.logLevel
+	if format == "" {
+		format = "text"
+	}
+	if level == "" {
+		level = "info"
+	}
+	if v2settings.Debug {
+		level = "debug"
+	}
+	logger, err := newLogger(w, format, level)
+	if err != nil {
+		return err
+	}
+	p.log = logger
+	return nil
+}
+
+// reportStats outputs the timing summary, as a log record when logging JSON
+func (p *pushCmd) reportStats() {
+	if p.logFormat == "json" {
+		p.stats.log(p.log)
 	} else {
-		repo, err = helm.GetRepoByName(p.repoName)
+		p.stats.print(p.errOut)
+	}
+}
+
+// displayName returns the chart name, or the argument it was loaded from
+// when loading failed
+func (r pushResult) displayName() string {
+	if r.name != "" {
+		return r.name
+	}
+	return r.chart
+}
+
+// publish runs push with the reporting requested by the flags
+func (p *pushCmd) publish(push func() error) error {
+	if p.showStats {
+		p.stats = newStats()
+		defer p.reportStats()
+	}
+	// Like export failures, telemetry settings never fail the push
+	tel, err := telemetry.FromEnv()
+	if err != nil {
+		p.log.Warn("telemetry disabled", "error", err)
+	}
+	p.telemetry = tel
+	defer p.flushTelemetry()
+	if p.showEvents {
+		p.events = newEventStream(p.out)
+	}
+	return push()
+}
+
+// pushAll pushes every chart given on the command line, a failure does
+// not prevent the next charts from being pushed
+func (p *pushCmd) pushAll() error {
+	var failed []string
+	p.results = nil
+	for _, name := range p.chartNames {
+		if err := p.pushChart(name); err != nil {
+			if len(p.chartNames) == 1 {
+				break
+			}
+			p.log.Error("push failed", "chart", name, "error", err)
+			failed = append(failed, name)
+		}
+	}
+	return p.finish(failed)
+}
+
+// pushChart pushes a single chart and records its result
+func (p *pushCmd) pushChart(name string) error {
+	p.chartName = name
+	p.result = pushResult{chart: name}
+	p.span = p.telemetry.StartSpan("helm push", nil)
+
+	start := time.Now()
+	err := redact.Error(hints.Annotate(p.push()))
+	p.result.duration = time.Since(start)
+	p.result.err = err
+	p.endSpan()
+
+	if auditErr := p.writeAudit("push", err); auditErr != nil {
+		p.log.Error("could not write audit log", "error", auditErr)
+		if err == nil {
+			err = auditErr
+		}
+	}
+	p.results = append(p.results, p.result)
+	return err
+}
+
+// finish notifies and reports the results once every chart is handled
+func (p *pushCmd) finish(failed []string) error {
+	p.notifyWebhooks()
+	if err := p.reportCI(); err != nil {
+		p.log.Warn("could not report to CI", "error", err)
+	}
+	if err := p.writeReport(); err != nil {
+		p.log.Error("could not write report", "error", err)
+		return err
+	}
+
+	if len(p.results) == 1 {
+		return p.results[0].err
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("%d of %d charts failed to push: %s", len(failed), len(p.results), strings.Join(failed, ", "))
 	}
+	return nil
+}
 
+func (p *pushCmd) push() error {
+	repo, err := p.getRepo()
 	if err != nil {
 		return err
 	}
 
 	if p.dependencyUpdate {
-		name := filepath.FromSlash(p.chartName)
-		fi, err := os.Stat(name)
+		stop := p.track("dependency_update")
+		err := p.updateDependencies()
+		stop()
 		if err != nil {
 			return err
 		}
-		if fi.IsDir() {
-			if validChart, err := chartutil.IsChartDir(name); !validChart {
-				return err
-			}
-			chartPath, err := filepath.Abs(p.chartName)
-			if err != nil {
+	}
+
+	chart, modified, err := p.loadChart()
+	if err != nil {
+		return err
+	}
+	p.result.name = chart.Metadata.Name
+	p.result.version = chart.Metadata.Version
+	p.span.SetAttribute("helm.chart.name", chart.Metadata.Name)
+	p.span.SetAttribute("helm.chart.version", chart.Metadata.Version)
+	p.span.SetAttribute("helm.repo", p.repoName)
+
+	url := p.repoURL(repo)
+	p.result.url = url
+
+	client, err := p.newClient(url)
+	if err != nil {
+		return err
+	}
+
+	// update context path if not overrided, the chart API is meant to
+	// spare downloading the index: only the cached index of a repository
+	// of the local list is read then
+	chartAPI := p.chartAPI || p.config.Repository(p.repoName, url).ChartAPI
+	if p.contextPath == "" && (!chartAPI || repo.Config.Name != "") {
+		stop := p.track("index_fetch")
+		index, err := helm.GetIndexByRepo(repo, p.pusher(client).DownloadIndex, chart.Metadata.Name)
+		stop()
+		if err != nil {
+			return err
+		}
+		client.Option(cm.ContextPath(index.ServerInfo.ContextPath))
+		p.log.Debug("context path read from index", "contextPath", index.ServerInfo.ContextPath)
+	}
+
+	// A bumped version is packaged and uploaded again, until the
+	// repository has no such version
+	conflict := p.conflict(url)
+	return push.UploadBumping(chart, conflict, func() error {
+		if version := chart.Metadata.Version; version != p.result.version {
+			p.log.Info("chart version exists, bumping it", "version", p.result.version, "bumped", version)
+			if err := p.bumped(chart); err != nil {
 				return err
 			}
-			if helm.HelmMajorVersionCurrent() == helm.HelmMajorVersion2 {
-				v2downloadManager := &v2downloader.Manager{
-					Out:       p.out,
-					ChartPath: chartPath,
-					HelmHome:  v2settings.Home,
-					Keyring:   p.keyring,
-					Getters:   v2getter.All(v2settings),
-					Debug:     v2settings.Debug,
-				}
-				if err := v2downloadManager.Update(); err != nil {
-					return err
-				}
-			} else {
-				downloadManager := &downloader.Manager{
-					Out:       p.out,
-					ChartPath: chartPath,
-					Keyring:   p.keyring,
-					Getters:   getter.All(settings),
-					Debug:     v2settings.Debug,
-				}
-				if err := downloadManager.Update(); err != nil {
-					return err
-				}
+			modified = true
+			p.result.version = version
+			p.span.SetAttribute("helm.chart.version", version)
+		}
+		return p.upload(chart, modified, client, url, conflict)
+	})
+}
+
+// bumped regenerates the parts of chart depending on its version once it
+// is bumped: the changes annotation and the SBOM
+func (p *pushCmd) bumped(chart *helm.Chart) error {
+	// snapshots carry the notes of the version they lead to, which a bump
+	// of the suffix leaves as is
+	if p.changelog && p.versionSuffix == "" {
+		annotated, err := p.annotateChanges(chart)
+		if err != nil {
+			return err
+		}
+		if !annotated {
+			// the changes of the version bumped do not describe this one
+			delete(chart.Metadata.Annotations, changelog.Annotation)
+		}
+	}
+	if p.sbom != "" {
+		stop := p.track("sbom")
+		defer stop()
+		return p.attachSBOM(chart)
+	}
+	return nil
+}
+
+// upload packages chart and uploads it to the repository at url, the
+// upload is skipped or forced according to conflict
+func (p *pushCmd) upload(chart *helm.Chart, modified bool, client *cm.Client, url string, conflict push.Conflict) error {
+	tmp, err := tmpdir.New("helm-push-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+
+	p.events.emit(event{Event: "package-start", Chart: p.chartName, Name: chart.Metadata.Name, Version: chart.Metadata.Version})
+	stop := p.track("packaging")
+	chartPackagePath, err := helm.CreateChartPackage(chart, tmp)
+	stop()
+	if err != nil {
+		return err
+	}
+	chartPackagePath, provPath, err := p.signature(chartPackagePath, modified)
+	if err != nil {
+		return err
+	}
+	if err := p.checkPolicy(chart, chartPackagePath, url); err != nil {
+		return err
+	}
+	if p.config.Repository(p.repoName, url).RequireSignature {
+		if err := p.checkSignature(chartPackagePath, provPath); err != nil {
+			return err
+		}
+	}
+	if p.result.digest, err = provenance.DigestFile(chartPackagePath); err != nil {
+		return err
+	}
+	p.events.emit(event{Event: "package-done", Chart: p.chartName, Name: chart.Metadata.Name, Version: chart.Metadata.Version, Digest: p.result.digest})
+
+	log := p.log.With("chart", filepath.Base(chartPackagePath), "repo", p.repoName)
+	if p.skipUnchanged {
+		stop := p.track("index_fetch")
+		published, err := p.pusher(client).Published(chart.Metadata.Name, chart.Metadata.Version, p.result.digest)
+		stop()
+		if err != nil {
+			return err
+		}
+		if published {
+			p.result.unchanged = true
+			p.events.emit(event{Event: "upload-skipped", Chart: p.chartName, Name: chart.Metadata.Name, Version: chart.Metadata.Version, Digest: p.result.digest, Repo: url})
+			log.Info("chart unchanged, upload skipped")
+			return nil
+		}
+	}
+	if p.lock {
+		lock, err := p.pusher(client).Lock(chart.Metadata.Name, chart.Metadata.Version, p.lockTTL)
+		if err != nil {
+			return err
+		}
+		log.Debug("chart version locked")
+		defer func() {
+			if err := lock.Release(); err != nil {
+				log.Warn("could not release lock, it is taken over once older than --lock-ttl", "error", err)
 			}
+		}()
+	}
+	log.Info("pushing chart")
+	stop = p.track("upload")
+	opts := []push.Option{push.OnConflict(conflict)}
+	if p.events != nil {
+		opts = append(opts, push.Progress(p.events.uploadProgress(p.chartName)))
+	}
+	err = p.pusher(client, opts...).Upload(chartPackagePath, provPath)
+	stop()
+	p.uploadDone(err)
+	if push.IsConflict(err) && conflict == push.ConflictSkip {
+		p.result.exists = true
+		p.events.emit(event{Event: "upload-skipped", Chart: p.chartName, Name: chart.Metadata.Name, Version: chart.Metadata.Version, Digest: p.result.digest, Repo: url})
+		log.Info("chart version exists, upload skipped")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if p.waitIndex > 0 {
+		// the index is what helm repo update reads, whatever --chart-api
+		stop := p.track("index_propagation")
+		err := p.pusher(client, push.ChartAPI(false)).WaitPublished(chart.Metadata.Name, chart.Metadata.Version, p.result.digest, p.waitIndex)
+		stop()
+		if err != nil {
+			return err
 		}
 	}
+	if provPath != "" {
+		log = log.With("prov", filepath.Base(provPath))
+	}
+	log.Info("chart pushed")
+	return nil
+}
 
+// loadChart loads the chart to push and applies the changes requested
+// by the flags, it tells whether the chart differs from its sources
+func (p *pushCmd) loadChart() (*helm.Chart, bool, error) {
 	chart, err := helm.GetChartByName(p.chartName)
 	if err != nil {
-		return err
+		return nil, false, err
+	}
+	proj, err := p.projectConfig(p.chartName)
+	if err != nil {
+		return nil, false, err
+	}
+
+	// excluded files are removed before vendoring, the dependencies are
+	// packaged whole
+	excluded, err := chart.Exclude(proj.Exclude)
+	if err != nil {
+		return nil, false, err
+	}
+	if len(excluded) > 0 {
+		p.log.Debug("files excluded", "files", excluded)
+	}
+
+	// file:// dependencies are not reachable by the chart consumers, the
+	// package embeds them instead
+	if fi, err := os.Stat(p.chartName); err == nil && fi.IsDir() {
+		vendored, err := chart.VendorLocalDependencies(p.chartName)
+		if err != nil {
+			return nil, false, err
+		}
+		if len(vendored) > 0 {
+			p.log.Debug("local dependencies vendored", "dependencies", vendored)
+		}
+	}
+
+	// ${NAME} placeholders are expanded in the package only, the chart
+	// sources are left untouched. Charts may hold literal ${...} values,
+	// hence the opt-in.
+	expanded := false
+	if p.expandEnv {
+		if expanded, err = chart.ExpandEnv(); err != nil {
+			return nil, false, err
+		}
+	}
+	if expanded {
+		p.log.Debug("placeholders expanded", "version", chart.Metadata.Version, "appVersion", chart.Metadata.AppVersion)
+	}
+
+	// patches are applied before the overrides, which take precedence
+	patched := false
+	for _, path := range p.patches {
+		patch, err := helm.LoadPatch(path)
+		if err != nil {
+			return nil, false, err
+		}
+		ok, err := chart.Apply(patch)
+		if err != nil {
+			return nil, false, err
+		}
+		patched = patched || ok
+	}
+
+	// project defaults, overridden by the flags and the manifest entry
+	defaults := proj.Chart(p.chartName)
+	if defaults != nil {
+		chart.SetAnnotations(defaults.Annotations)
+		if p.chartVersion == "" && p.entry == nil && !p.watchChart {
+			version, err := defaults.ResolveVersion(chart.Metadata.Version)
+			if err != nil {
+				return nil, false, err
+			}
+			chart.SetVersion(version)
+		}
 	}
 
 	// version override
@@ -227,56 +889,186 @@ func (p *pushCmd) push() error {
 		chart.SetAppVersion(p.appVersion)
 	}
 
-	// in case the repo is stored with cm:// protocol, remove it
-	var url string
-	if p.useHTTP {
-		url = strings.Replace(repo.Config.URL, "cm://", "http://", 1)
-	} else {
-		url = strings.Replace(repo.Config.URL, "cm://", "https://", 1)
+	// manifest entry, see apply
+	if p.entry != nil {
+		version, err := p.entry.ResolveVersion(chart.Metadata.Version)
+		if err != nil {
+			return nil, false, err
+		}
+		chart.SetVersion(version)
+		chart.SetAnnotations(p.entry.Annotations)
 	}
+	if p.watchChart {
+		version, err := devVersion(chart.Metadata.Version, time.Now())
+		if err != nil {
+			return nil, false, err
+		}
+		chart.SetVersion(version)
+	}
+	annotated := false
+	if p.changelog {
+		if annotated, err = p.annotateChanges(chart); err != nil {
+			return nil, false, err
+		}
+	}
+	// the suffix is appended once the changes of the release are found,
+	// snapshots carry the notes of the version they lead to
+	if p.versionSuffix != "" {
+		version, err := suffixVersion(chart.Metadata.Version, p.versionSuffix, p.chartName, time.Now())
+		if err != nil {
+			return nil, false, err
+		}
+		chart.SetVersion(version)
+	}
+	if p.sbom != "" {
+		stop := p.track("sbom")
+		err := p.attachSBOM(chart)
+		stop()
+		if err != nil {
+			return nil, false, err
+		}
+	}
+	modified := p.chartVersion != "" || p.versionSuffix != "" || p.appVersion != "" || p.sbom != "" || p.entry.Modifies() || defaults.Modifies() || len(excluded) > 0 || annotated || expanded || patched || p.watchChart
+	return chart, modified, nil
+}
 
-	client, err := cm.NewClient(
-		cm.URL(url),
-		cm.ClientID(p.clientID),
-		cm.ClientSecret(p.clientSecret),
-		cm.ContextPath(p.contextPath),
-		cm.CAFile(p.caFile),
-		cm.CertFile(p.certFile),
-		cm.KeyFile(p.keyFile),
-		cm.InsecureSkipVerify(p.insecureSkipVerify),
-	)
-
-	if err != nil {
-		return err
+// projectConfig returns the project configuration applying to the chart,
+// an empty one when there is none, see project.Find
+func (p *pushCmd) projectConfig(chart string) (*project.Config, error) {
+	path, err := project.Find(chart)
+	if err != nil || path == "" {
+		return &project.Config{}, err
 	}
+	p.log.Debug("project configuration found", "path", path)
+	return project.Load(path)
+}
 
-	// update context path if not overrided
-	if p.contextPath == "" {
-		index, err := helm.GetIndexByRepo(repo, getIndexDownloader(client))
+// setTarget splits the arguments into the charts and the repository, the
+// repository comes from the channel when one is given, and may be left to
+// the project configuration
+func (p *pushCmd) setTarget(args []string) error {
+	if p.channel != "" {
+		if len(args) == 0 {
+			return errors.New("This command needs at least 1 argument with --channel: name of chart(s)")
+		}
+		p.chartNames = args
+		return p.useChannel(p.channel)
+	}
+	if len(args) == 1 {
+		proj, err := p.projectConfig(args[0])
 		if err != nil {
 			return err
 		}
-		client.Option(cm.ContextPath(index.ServerInfo.ContextPath))
+		if proj.Repo != "" {
+			args = append(args, proj.Repo)
+		}
+	}
+	if len(args) < 2 {
+		return errors.New("This command needs at least 2 arguments: name of chart(s), name of chart repository (or repo URL)")
 	}
+	p.chartNames = args[:len(args)-1]
+	p.repoName = args[len(args)-1]
+	return nil
+}
 
-	tmp, err := ioutil.TempDir("", "helm-push-")
+// useChannel targets the repository of the release channel name, the
+// context path of the channel applies unless --context-path is given
+func (p *pushCmd) useChannel(name string) error {
+	ch, err := p.config.Channel(name)
 	if err != nil {
 		return err
 	}
-	defer os.RemoveAll(tmp)
+	p.repoName = ch.Repo
+	if p.contextPath == "" {
+		p.contextPath = ch.ContextPath
+	}
+	p.log.Debug("channel selected", "channel", name, "repo", ch.Repo, "contextPath", p.contextPath)
+	return nil
+}
 
-	chartPackagePath, err := helm.CreateChartPackage(chart, tmp)
-	if err != nil {
-		return err
+// getRepo returns the repository named by p.repoName, either an entry of
+// the local repository list or a repository URL
+func (p *pushCmd) getRepo() (*helm.Repo, error) {
+	// If the argument looks like a URL, just create a temp repo object
+	// instead of looking for the entry in the local repository list
+	if isRepoURL(p.repoName) {
+		repo, err := helm.TempRepoFromURL(p.repoName)
+		if err != nil {
+			return nil, err
+		}
+		p.repoName = repo.Config.URL
+		return repo, nil
 	}
+	if p.helmfile != "" {
+		repo, err := p.helmfileRepo()
+		if err != nil || repo != nil {
+			if err == nil && p.ci != "" {
+				err = p.checkShadowedRepo(repo)
+			}
+			return repo, err
+		}
+	}
+	return helm.GetRepoByName(p.repoName)
+}
+
+// isRepoURL tells if name is a repository URL rather than the name of an
+// entry of the local repository list
+func isRepoURL(name string) bool {
+	return regexp.MustCompile(`^https?://`).MatchString(name)
+}
 
-	fmt.Printf("Pushing %s to %s...\n", filepath.Base(chartPackagePath), p.repoName)
-	resp, err := client.UploadChartPackage(chartPackagePath, p.forceUpload)
+// repoURL returns the URL of repo, in case the repo is stored with cm://
+// protocol it is replaced by http or https
+func (p *pushCmd) repoURL(repo *helm.Repo) string {
+	if p.useHTTP {
+		return strings.Replace(repo.Config.URL, "cm://", "http://", 1)
+	}
+	return strings.Replace(repo.Config.URL, "cm://", "https://", 1)
+}
+
+// updateDependencies updates the dependencies of a chart directory,
+// packaged charts are left untouched
+func (p *pushCmd) updateDependencies() error {
+	name := filepath.FromSlash(p.chartName)
+	fi, err := os.Stat(name)
 	if err != nil {
 		return err
 	}
-
-	return handlePushResponse(resp)
+	if fi.IsDir() {
+		if validChart, err := chartutil.IsChartDir(name); !validChart {
+			return err
+		}
+		chartPath, err := filepath.Abs(p.chartName)
+		if err != nil {
+			return err
+		}
+		p.log.Debug("updating chart dependencies", "chart", chartPath)
+		if helm.HelmMajorVersionCurrent() == helm.HelmMajorVersion2 {
+			v2downloadManager := &v2downloader.Manager{
+				Out:       p.out,
+				ChartPath: chartPath,
+				HelmHome:  v2settings.Home,
+				Keyring:   p.keyring,
+				Getters:   v2getter.All(v2settings),
+				Debug:     v2settings.Debug,
+			}
+			if err := v2downloadManager.Update(); err != nil {
+				return err
+			}
+		} else {
+			downloadManager := &downloader.Manager{
+				Out:       p.out,
+				ChartPath: chartPath,
+				Keyring:   p.keyring,
+				Getters:   getter.All(settings),
+				Debug:     v2settings.Debug,
+			}
+			if err := downloadManager.Update(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
 }
 
 func (p *pushCmd) download(fileURL string) error {
@@ -301,90 +1093,204 @@ func (p *pushCmd) download(fileURL string) error {
 
 	parsedURL.Path = strings.Join(parts[:numParts-numRemoveParts], "/")
 
-	if p.useHTTP {
+	if ok, err := p.resolveRepoName(parsedURL); err != nil {
+		return err
+	} else if !ok && p.useHTTP {
 		parsedURL.Scheme = "http"
-	} else {
+	} else if !ok {
 		parsedURL.Scheme = "https"
 	}
 
-	client, err := cm.NewClient(
-		cm.URL(parsedURL.String()),
-		cm.ClientID(p.clientID),
-		cm.ClientSecret(p.clientSecret),
-		cm.ContextPath(p.contextPath),
-		cm.CAFile(p.caFile),
-		cm.CertFile(p.certFile),
-		cm.KeyFile(p.keyFile),
-		cm.InsecureSkipVerify(p.insecureSkipVerify),
-	)
-
+	client, err := p.newClient(parsedURL.String())
 	if err != nil {
 		return err
 	}
 
+	p.log.Debug("downloading file", "url", parsedURL.String(), "file", filePath)
 	resp, err := client.DownloadFile(filePath)
 	if err != nil {
 		return err
 	}
 
-	return handleDownloadResponse(resp)
-}
+	op := cm.OpDownload
+	if filePath == "index.yaml" {
+		op = cm.OpIndex
+	}
+	b, err := push.ReadResponse(op, resp)
+	if err != nil {
+		return err
+	}
 
-func handlePushResponse(resp *http.Response) error {
-	if resp.StatusCode != 201 {
-		b, err := ioutil.ReadAll(resp.Body)
-		if err != nil {
+	if strings.HasSuffix(filePath, ".tgz") {
+		if err := p.verifyDownload(client, filePath, b); err != nil {
 			return err
 		}
-		return getChartmuseumError(b, resp.StatusCode)
 	}
-	fmt.Println("Done.")
-	return nil
+	_, err = p.out.Write(b)
+	return err
 }
 
-func handleDownloadResponse(resp *http.Response) error {
-	b, err := ioutil.ReadAll(resp.Body)
-	defer resp.Body.Close()
+// resolveRepoName replaces the host of the cm:// URL u with the URL of
+// the repository it names, if any, so that cm://<repo>/chart-1.2.3.tgz
+// does not depend on the host of the repository. The settings of the
+// repository in the configuration file, credentials included, then apply.
+func (p *pushCmd) resolveRepoName(u *url.URL) (bool, error) {
+	if u.Port() != "" || u.User != nil {
+		return false, nil
+	}
+	p.repoName = u.Host
+	repo, err := p.getRepo()
+	var notFound *helm.RepoNotFoundError
+	if errors.As(err, &notFound) {
+		// Not a repository name, but a host
+		p.repoName = ""
+		return false, nil
+	}
 	if err != nil {
-		return err
+		return false, err
 	}
-	if resp.StatusCode != 200 {
-		return getChartmuseumError(b, resp.StatusCode)
+	base, err := url.Parse(p.repoURL(repo))
+	if err != nil {
+		return false, err
 	}
-	fmt.Print(string(b))
-	return nil
+	p.log.Debug("repository name resolved", "repo", u.Host, "url", redact.URL(base))
+	u.Scheme, u.User, u.Host = base.Scheme, base.User, base.Host
+	u.Path = strings.TrimSuffix(base.Path, "/") + u.Path
+	return true, nil
 }
 
-func getChartmuseumError(b []byte, code int) error {
-	var er struct {
-		Error string `json:"error"`
+// newClient creates a ChartMuseum client for url configured from the command fields
+func (p *pushCmd) newClient(url string) (*cm.Client, error) {
+	repo := p.config.Repository(p.repoName, url)
+	clientID, clientSecret := p.credentials(repo, url)
+	if p.ci != "" && repo.Auth.Scheme != cm.AuthBearer && (clientID == "") != (clientSecret == "") {
+		return nil, fmt.Errorf("incomplete Cloudflare Access credentials for %s: both the client ID and secret must be set in CI mode", p.repoName)
+	}
+	opts := []cm.Option{
+		cm.URL(url),
+		cm.ClientID(clientID),
+		cm.ClientSecret(clientSecret),
+		cm.Authentication(repo.Auth),
+		cm.ContextPath(p.contextPath),
+		cm.CAFile(p.caFile),
+		cm.CertFile(p.certFile),
+		cm.KeyFile(p.keyFile),
+		cm.InsecureSkipVerify(p.insecureSkipVerify),
+	}
+	pins := p.pins
+	if len(pins) == 0 {
+		pins = repo.PinSHA256
 	}
-	err := json.Unmarshal(b, &er)
-	if err != nil || er.Error == "" {
-		return fmt.Errorf("%d: could not properly parse response JSON: %s", code, string(b))
+	if len(pins) > 0 {
+		opts = append(opts, cm.PinSHA256(pins...))
 	}
-	return fmt.Errorf("%d: %s", code, er.Error)
+	signing := repo.Signing
+	if p.signingKey != "" {
+		signing.Key = p.signingKey
+	}
+	if signing.Key != "" {
+		opts = append(opts, cm.RequestSigning(signing))
+	}
+	if p.debugHTTP || p.debugHTTPBody {
+		opts = append(opts, cm.DebugHTTP(p.errOut, p.debugHTTPBody))
+	}
+	if p.retries > 0 {
+		opts = append(opts, cm.Retries(p.retries))
+	}
+	if p.stats != nil || p.telemetry != nil {
+		// Cloudflare Access checks the credentials on the first request,
+		// the next ones reuse its connection
+		opts = append(opts, cm.FirstRoundTrip(func(start time.Time, d time.Duration) {
+			p.record("auth", start, d)
+		}))
+	}
+	return cm.NewClient(opts...)
 }
 
-func getIndexDownloader(client *cm.Client) helm.IndexDownloader {
-	return func() ([]byte, error) {
-		resp, err := client.DownloadFile("index.yaml")
-		if err != nil {
-			return nil, err
-		}
-		defer resp.Body.Close()
-		b, err := ioutil.ReadAll(resp.Body)
-		if err != nil {
-			return nil, err
+// pusher returns a Pusher uploading with client, with the index settings
+// of the repository unless opts override them
+func (p *pushCmd) pusher(client *cm.Client, opts ...push.Option) *push.Pusher {
+	repo := p.config.Repository(p.repoName, client.URL())
+	opts = append([]push.Option{push.ChartAPI(p.chartAPI || repo.ChartAPI), push.MaxIndexSize(p.maxIndexSize << 20)}, opts...)
+	return push.New(client, opts...)
+}
+
+// conflict returns what to do when the repository at url has the chart
+// version: --force, --on-conflict, then the repository configuration
+func (p *pushCmd) conflict(url string) push.Conflict {
+	if p.forceUpload {
+		return push.ConflictForce
+	}
+	if p.onConflict != "" {
+		return push.Conflict(p.onConflict)
+	}
+	if c := p.config.Repository(p.repoName, url).OnConflict; c != "" {
+		return c
+	}
+	return push.ConflictFail
+}
+
+// credentials returns the Cloudflare Access credentials of the repository
+// at url, taken from repo when not provided by flags or environment, then
+// from the Windows Credential Manager, then from the .netrc entry of its
+// host. The last two are skipped in CI mode.
+func (p *pushCmd) credentials(repo config.Repository, url string) (string, string) {
+	clientID, clientSecret := p.clientID, p.clientSecret
+	if clientID == "" {
+		clientID = repo.ClientID
+	}
+	if clientSecret == "" {
+		clientSecret = repo.ClientSecret
+	}
+	if p.ci != "" {
+		return clientID, clientSecret
+	}
+	if wincred.Supported && (clientID == "" || clientSecret == "") {
+		id, secret, err := wincred.Get(wincred.Target(p.repoName))
+		switch {
+		case err == nil:
+			redact.Secret(secret)
+			if clientID == "" {
+				clientID = id
+			}
+			if clientSecret == "" {
+				clientSecret = secret
+			}
+		case !errors.Is(err, wincred.ErrNotFound):
+			p.log.Warn("could not read the Credential Manager", "target", wincred.Target(p.repoName), "error", err)
 		}
-		if resp.StatusCode != 200 {
-			return nil, getChartmuseumError(b, resp.StatusCode)
+	}
+	if clientID == "" || clientSecret == "" {
+		if m, ok := p.netrcMachine(url); ok {
+			redact.Secret(m.Password)
+			if clientID == "" {
+				clientID = m.Login
+			}
+			if clientSecret == "" {
+				clientSecret = m.Password
+			}
 		}
-		return b, nil
 	}
+	return clientID, clientSecret
+}
+
+// netrcMachine returns the .netrc entry of the host of the repository at
+// rawURL, see netrc.Path
+func (p *pushCmd) netrcMachine(rawURL string) (netrc.Machine, bool) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Hostname() == "" {
+		return netrc.Machine{}, false
+	}
+	f, err := netrc.Load(netrc.Path())
+	if err != nil {
+		p.log.Warn("could not read .netrc", "error", err)
+		return netrc.Machine{}, false
+	}
+	return f.Machine(u.Hostname())
 }
 
 func main() {
+	defer redact.Recover()
 	cmd := newPushCmd(os.Args[1:])
 	if err := cmd.Execute(); err != nil {
 		os.Exit(1)
@@ -393,5 +1299,5 @@ func main() {
 
 // defaultKeyring returns the expanded path to the default keyring.
 func defaultKeyring() string {
-	return os.ExpandEnv("$HOME/.gnupg/pubring.gpg")
+	return helm.DefaultKeyring()
 }
@@ -1,15 +1,26 @@
 package main
 
 import (
+	"bytes"
 	"crypto/rand"
 	"crypto/tls"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
-
+	"time"
+
+	"github.com/IxDay/helm-push-cloudflare-access/pkg/changelog"
+	cm "github.com/IxDay/helm-push-cloudflare-access/pkg/chartmuseum"
+	"github.com/IxDay/helm-push-cloudflare-access/pkg/chartmuseumtest"
+	"github.com/IxDay/helm-push-cloudflare-access/pkg/helm"
+	pushpkg "github.com/IxDay/helm-push-cloudflare-access/pkg/push"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
 	"k8s.io/helm/pkg/getter"
 	"k8s.io/helm/pkg/helm/helmpath"
 	"k8s.io/helm/pkg/repo"
@@ -26,6 +37,52 @@ var (
 	testClientKeyPath  = "../../testdata/tls/client.key"
 )
 
+// addChart stores an empty chart version in ts
+func addChart(t *testing.T, ts *chartmuseumtest.Server, name, version string) {
+	t.Helper()
+	tmp, err := ioutil.TempDir("", "helm-push-test")
+	if err != nil {
+		t.Fatal("unexpected error creating temp test dir", err)
+	}
+	defer os.RemoveAll(tmp)
+	packaged, err := chartutil.Save(&chart.Chart{Metadata: &chart.Metadata{APIVersion: "v2", Name: name, Version: version}}, tmp)
+	if err != nil {
+		t.Fatalf("unexpected error packaging %s-%s: %s", name, version, err)
+	}
+	b, err := ioutil.ReadFile(packaged)
+	if err != nil {
+		t.Fatalf("unexpected error reading %s: %s", packaged, err)
+	}
+	if _, err := ts.AddChart(b, nil); err != nil {
+		t.Fatalf("unexpected error storing %s-%s: %s", name, version, err)
+	}
+}
+
+// countRequests returns the number of method requests to path received by ts
+func countRequests(ts *chartmuseumtest.Server, method, path string) int {
+	n := 0
+	for _, r := range ts.Requests() {
+		if r.Method == method && r.Path == path {
+			n++
+		}
+	}
+	return n
+}
+
+// loadPushed returns the chart version stored by ts
+func loadPushed(t *testing.T, ts *chartmuseumtest.Server, name, version string) *chart.Chart {
+	t.Helper()
+	c, ok := ts.Chart(name, version)
+	if !ok {
+		t.Fatalf("expected %s-%s to be pushed, got %v", name, version, ts.Charts())
+	}
+	pushed, err := loader.LoadArchive(bytes.NewReader(c.Package))
+	if err != nil {
+		t.Fatalf("unexpected error loading pushed chart: %s", err)
+	}
+	return pushed
+}
+
 func TestPushCmd(t *testing.T) {
 	statusCode := 201
 	body := "{\"success\": true}"
@@ -103,6 +160,23 @@ func TestPushCmd(t *testing.T) {
 		t.Error("unexpecting error uploading tarball, using repo URL", err)
 	}
 
+	// Multiple charts, one failing, with report
+	reportPath := filepath.Join(tmp, "report.xml")
+	args = []string{testTarballPath, "/this/this/not/a/chart", "helm-push-test"}
+	cmd = newPushCmd(args)
+	cmd.Flags().Set("report", reportPath)
+	err = cmd.RunE(cmd, args)
+	if err == nil {
+		t.Error("expecting error with a failing chart, instead got nil")
+	}
+	report, err := ioutil.ReadFile(reportPath)
+	if err != nil {
+		t.Error("unexpected error reading report", err)
+	}
+	if !strings.Contains(string(report), `<testsuite name="helm push helm-push-test" tests="2" failures="1"`) {
+		t.Errorf("unexpected report content:\n%s", report)
+	}
+
 	// Trigger 409
 	statusCode = 409
 	body = "{\"error\": \"package already exists\"}"
@@ -151,6 +225,28 @@ func TestPushCmd(t *testing.T) {
 	if err != nil {
 		t.Error("unexpected error trying to download charts/mychart-0.1.0.tgz", err)
 	}
+
+	// Repository name rather than host
+	args = []string{"", "", "", "cm://helm-push-test/charts/mychart-0.1.0.tgz"}
+	cmd = newPushCmd(args)
+	err = cmd.RunE(cmd, args)
+	if err != nil {
+		t.Error("unexpected error trying to download from repository name", err)
+	}
+	args = []string{"", "", "", "cm://helm-push-missing/charts/mychart-0.1.0.tgz"}
+	cmd = newPushCmd(args)
+	err = cmd.RunE(cmd, args)
+	if err == nil {
+		t.Error("expecting error with unknown repository name, instead got nil")
+	}
+
+	// The repository list is not mistaken for a host when unreadable
+	ioutil.WriteFile(home.RepositoryFile(), []byte("repositories: ["), 0644)
+	cmd = newPushCmd(args)
+	err = cmd.RunE(cmd, args)
+	if err == nil || !strings.Contains(err.Error(), "yaml") {
+		t.Errorf("expected repository list error, got %v", err)
+	}
 }
 
 func TestPushCmdWithTlsEnabledServer(t *testing.T) {
@@ -224,3 +320,499 @@ func TestPushCmdWithTlsEnabledServer(t *testing.T) {
 		t.Fatalf("unexpecting error uploading tarball: %s", err)
 	}
 }
+
+func TestPushCmdRedactsSecrets(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// A misbehaving proxy echoing the request headers
+		w.WriteHeader(500)
+		w.Write([]byte(`{"error": "rejected CF-Access-Client-Secret ` + r.Header.Get("CF-Access-Client-Secret") + `"}`))
+	}))
+	defer ts.Close()
+
+	var stderr bytes.Buffer
+	args := []string{testTarballPath, ts.URL}
+	cmd := newPushCmd(args)
+	cmd.SetErr(&stderr)
+	cmd.Flags().Set("context-path", "/")
+	cmd.Flags().Set("client-secret", "my-service-token-secret")
+	cmd.Flags().Set("log-level", "debug")
+	cmd.Flags().Set("debug-http-body", "true")
+	err := cmd.RunE(cmd, args)
+	if err == nil {
+		t.Fatal("expecting error with server error, instead got nil")
+	}
+	if strings.Contains(err.Error(), "my-service-token-secret") {
+		t.Errorf("expected secret to be redacted from error %q", err)
+	}
+	if strings.Contains(stderr.String(), "my-service-token-secret") {
+		t.Errorf("expected secret to be redacted from output:\n%s", stderr.String())
+	}
+}
+
+func TestPushCmdExpandEnv(t *testing.T) {
+	ts := chartmuseumtest.NewServer()
+	defer ts.Close()
+
+	tmp, err := ioutil.TempDir("", "helm-push-test")
+	if err != nil {
+		t.Fatal("unexpected error creating temp test dir", err)
+	}
+	defer os.RemoveAll(tmp)
+	chartYAML := "apiVersion: v2\nname: mychart\nversion: 0.1.0-build.${BUILD_NUMBER}\nappVersion: ${GIT_SHA}\n"
+	ioutil.WriteFile(filepath.Join(tmp, "Chart.yaml"), []byte(chartYAML), 0644)
+	os.Setenv("BUILD_NUMBER", "42")
+	defer os.Unsetenv("BUILD_NUMBER")
+
+	args := []string{tmp, ts.URL}
+	push := func() error {
+		cmd := newPushCmd(args)
+		cmd.Flags().Set("context-path", "/")
+		cmd.Flags().Set("expand-env", "true")
+		return cmd.RunE(cmd, args)
+	}
+	if err := push(); err == nil || !strings.Contains(err.Error(), "undefined variable GIT_SHA") {
+		t.Errorf("expected undefined variable error, got %v", err)
+	}
+
+	os.Setenv("GIT_SHA", "1a2b3c4")
+	defer os.Unsetenv("GIT_SHA")
+	if err := push(); err != nil {
+		t.Fatalf("unexpected error pushing chart: %s", err)
+	}
+	if _, ok := ts.Chart("mychart", "0.1.0-build.42"); !ok {
+		t.Errorf("expected mychart-0.1.0-build.42 to be uploaded, got %+v", ts.Charts())
+	}
+	if b, _ := ioutil.ReadFile(filepath.Join(tmp, "Chart.yaml")); string(b) != chartYAML {
+		t.Errorf("expected chart sources to be left untouched, got:\n%s", b)
+	}
+
+	// Literal placeholders are kept without --expand-env
+	ioutil.WriteFile(filepath.Join(tmp, "Chart.yaml"), []byte("apiVersion: v2\nname: mychart\nversion: 0.2.0\nannotations:\n  example.com/template: ${UNDEFINED}\n"), 0644)
+	cmd := newPushCmd(args)
+	cmd.Flags().Set("context-path", "/")
+	if err := cmd.RunE(cmd, args); err != nil {
+		t.Errorf("unexpected error pushing chart with a literal placeholder: %s", err)
+	}
+}
+
+func TestPushCmdVendorLocalDependencies(t *testing.T) {
+	ts := chartmuseumtest.NewServer()
+	defer ts.Close()
+
+	tmp, err := ioutil.TempDir("", "helm-push-test")
+	if err != nil {
+		t.Fatal("unexpected error creating temp test dir", err)
+	}
+	defer os.RemoveAll(tmp)
+	os.MkdirAll(filepath.Join(tmp, "app"), 0755)
+	os.MkdirAll(filepath.Join(tmp, "lib"), 0755)
+	ioutil.WriteFile(filepath.Join(tmp, "app", "Chart.yaml"), []byte("apiVersion: v2\nname: app\nversion: 0.1.0\ndependencies:\n- name: lib\n  version: 1.x\n  repository: file://../lib\n"), 0644)
+	ioutil.WriteFile(filepath.Join(tmp, "lib", "Chart.yaml"), []byte("apiVersion: v2\nname: lib\nversion: 1.4.0\n"), 0644)
+
+	args := []string{filepath.Join(tmp, "app"), ts.URL}
+	cmd := newPushCmd(args)
+	cmd.Flags().Set("context-path", "/")
+	if err := cmd.RunE(cmd, args); err != nil {
+		t.Fatalf("unexpected error pushing chart: %s", err)
+	}
+	if deps := loadPushed(t, ts, "app", "0.1.0").Dependencies(); len(deps) != 1 || deps[0].Name() != "lib" || deps[0].Metadata.Version != "1.4.0" {
+		t.Errorf("expected lib 1.4.0 to be packaged, got %+v", deps)
+	}
+	if _, err := os.Stat(filepath.Join(tmp, "app", "charts")); !os.IsNotExist(err) {
+		t.Errorf("expected chart sources to be left untouched, got %v", err)
+	}
+}
+
+func TestPushCmdPatch(t *testing.T) {
+	ts := chartmuseumtest.NewServer()
+	defer ts.Close()
+
+	tmp, err := ioutil.TempDir("", "helm-push-test")
+	if err != nil {
+		t.Fatal("unexpected error creating temp test dir", err)
+	}
+	defer os.RemoveAll(tmp)
+	patchPath := filepath.Join(tmp, "patch.yaml")
+	ioutil.WriteFile(patchPath, []byte("chart:\n  home: https://charts.example.com\n  version: 9.9.9\nvalues:\n  replicaCount: 3\n"), 0644)
+
+	args := []string{testTarballPath, ts.URL}
+	cmd := newPushCmd(args)
+	cmd.Flags().Set("context-path", "/")
+	cmd.Flags().Set("patch", patchPath)
+	cmd.Flags().Set("version", "0.2.0")
+	if err := cmd.RunE(cmd, args); err != nil {
+		t.Fatalf("unexpected error pushing chart: %s", err)
+	}
+	pushed := loadPushed(t, ts, "mychart", "0.2.0")
+	if pushed.Metadata.Home != "https://charts.example.com" {
+		t.Errorf("expected patched metadata, got %+v", pushed.Metadata)
+	}
+	if pushed.Values["replicaCount"] != float64(3) {
+		t.Errorf("expected patched values, got %+v", pushed.Values)
+	}
+}
+
+func TestPushCmdProjectConfig(t *testing.T) {
+	ts := chartmuseumtest.NewServer()
+	defer ts.Close()
+
+	tmp, err := ioutil.TempDir("", "helm-push-test")
+	if err != nil {
+		t.Fatal("unexpected error creating temp test dir", err)
+	}
+	defer os.RemoveAll(tmp)
+	dir := filepath.Join(tmp, "charts", "mychart")
+	os.MkdirAll(filepath.Join(dir, "ci"), 0755)
+	ioutil.WriteFile(filepath.Join(dir, "Chart.yaml"), []byte("apiVersion: v2\nname: mychart\nversion: 0.1.0\n"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "NOTES.md"), []byte("notes"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "ci", "values.yaml"), []byte("replicaCount: 1\n"), 0644)
+	project := "repo: " + ts.URL + "\nversion_strategy: timestamp\nannotations:\n  team: payments\nexclude:\n- ci\n- '*.md'\n"
+	ioutil.WriteFile(filepath.Join(tmp, ".helmpush.yaml"), []byte(project), 0644)
+
+	// The repository comes from the project configuration
+	args := []string{dir}
+	cmd := newPushCmd(args)
+	cmd.Flags().Set("context-path", "/")
+	if err := cmd.RunE(cmd, args); err != nil {
+		t.Fatalf("unexpected error pushing chart: %s", err)
+	}
+	charts := ts.Charts()
+	if len(charts) != 1 || !strings.HasPrefix(charts[0].Version, "0.1.0-") {
+		t.Fatalf("expected the project version strategy, got %+v", charts)
+	}
+	pushed := loadPushed(t, ts, "mychart", charts[0].Version)
+	if pushed.Metadata.Annotations["team"] != "payments" {
+		t.Errorf("expected project annotations, got %+v", pushed.Metadata)
+	}
+	if len(pushed.Files) != 0 {
+		t.Errorf("expected files to be excluded, got %d files", len(pushed.Files))
+	}
+
+	// Flags take precedence
+	args = []string{dir, ts.URL}
+	cmd = newPushCmd(args)
+	cmd.Flags().Set("context-path", "/")
+	cmd.Flags().Set("version", "0.2.0")
+	if err := cmd.RunE(cmd, args); err != nil {
+		t.Fatalf("unexpected error pushing chart: %s", err)
+	}
+	if _, ok := ts.Chart("mychart", "0.2.0"); !ok {
+		t.Errorf("expected version 0.2.0, got %+v", ts.Charts())
+	}
+}
+
+func TestPushCmdLock(t *testing.T) {
+	ts := chartmuseumtest.NewServer()
+	defer ts.Close()
+	push := func(url string) error {
+		args := []string{testTarballPath, url}
+		cmd := newPushCmd(args)
+		cmd.Flags().Set("context-path", "/")
+		cmd.Flags().Set("lock", "true")
+		cmd.Flags().Set("force", "true")
+		return cmd.RunE(cmd, args)
+	}
+	if err := push(ts.URL); err != nil {
+		t.Fatalf("unexpected error pushing chart: %s", err)
+	}
+	if charts := ts.Charts(); len(charts) != 1 || charts[0].Name != "mychart" {
+		t.Errorf("expected the chart to be pushed under lock and the lock released, got %+v", charts)
+	}
+
+	// The lock is held by another push
+	client, err := cm.NewClient(cm.URL(ts.URL))
+	if err != nil {
+		t.Fatalf("unexpected error creating client: %s", err)
+	}
+	lock, err := pushpkg.New(client).Lock("mychart", "0.1.0", time.Minute)
+	if err != nil {
+		t.Fatalf("unexpected error acquiring lock: %s", err)
+	}
+	defer lock.Release()
+	if err := push(ts.URL); err == nil || !strings.Contains(err.Error(), "already being published") {
+		t.Errorf("expected locked error, got %v", err)
+	}
+	if _, ok := ts.Chart("helm-push-lock-mychart", "0.1.0"); !ok {
+		t.Error("expected the lock of the other push to be kept")
+	}
+
+	// Locks cannot work when the repository overwrites chart versions
+	overwrite := chartmuseumtest.NewServer(chartmuseumtest.AllowOverwrite(true))
+	defer overwrite.Close()
+	if err := push(overwrite.URL); err == nil || !strings.Contains(err.Error(), "locks cannot work") {
+		t.Errorf("expected unsupported lock error, got %v", err)
+	}
+	if charts := overwrite.Charts(); len(charts) != 0 {
+		t.Errorf("expected nothing to be pushed, got %+v", charts)
+	}
+}
+
+func TestPushCmdSkipUnchanged(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "helm-push-test")
+	if err != nil {
+		t.Fatal("unexpected error creating temp test dir", err)
+	}
+	defer os.RemoveAll(tmp)
+	// Packages are reproducible, the chart is pushed as packaged here
+	c, err := helm.GetChartByName(testTarballPath)
+	if err != nil {
+		t.Fatal("unexpected error loading test tarball", err)
+	}
+	packaged, err := helm.CreateChartPackage(c, tmp)
+	if err != nil {
+		t.Fatal("unexpected error packaging test chart", err)
+	}
+	b, err := ioutil.ReadFile(packaged)
+	if err != nil {
+		t.Fatal("unexpected error reading test package", err)
+	}
+	ts := chartmuseumtest.NewServer()
+	defer ts.Close()
+	if _, err := ts.AddChart(b, nil); err != nil {
+		t.Fatal("unexpected error storing test package", err)
+	}
+	report := filepath.Join(tmp, "report.json")
+
+	push := func(flags ...string) error {
+		args := []string{testTarballPath, ts.URL}
+		cmd := newPushCmd(args)
+		cmd.Flags().Set("context-path", "/")
+		cmd.Flags().Set("skip-unchanged", "true")
+		cmd.Flags().Set("report", report)
+		for i := 0; i < len(flags); i += 2 {
+			cmd.Flags().Set(flags[i], flags[i+1])
+		}
+		return cmd.RunE(cmd, args)
+	}
+	if err := push(); err != nil {
+		t.Fatalf("unexpected error pushing chart: %s", err)
+	}
+	if n := countRequests(ts, "POST", "/api/charts"); n != 0 {
+		t.Errorf("expected the upload to be skipped, got %d uploads", n)
+	}
+	if b, _ := ioutil.ReadFile(report); !strings.Contains(string(b), `"status": "unchanged"`) {
+		t.Errorf("expected unchanged status in report:\n%s", b)
+	}
+
+	// Another version is uploaded
+	if err := push("version", "0.2.0"); err != nil {
+		t.Fatalf("unexpected error pushing chart: %s", err)
+	}
+	if _, ok := ts.Chart("mychart", "0.2.0"); !ok {
+		t.Errorf("expected the chart to be uploaded, got %+v", ts.Charts())
+	}
+	if b, _ := ioutil.ReadFile(report); !strings.Contains(string(b), `"status": "success"`) {
+		t.Errorf("expected success status in report:\n%s", b)
+	}
+}
+
+func TestPushCmdChartAPI(t *testing.T) {
+	ts := chartmuseumtest.NewServer()
+	defer ts.Close()
+	os.Unsetenv("HELM_REPO_CONTEXT_PATH")
+
+	args := []string{testTarballPath, ts.URL}
+	cmd := newPushCmd(args)
+	cmd.Flags().Set("chart-api", "true")
+	cmd.Flags().Set("skip-unchanged", "true")
+	if err := cmd.RunE(cmd, args); err != nil {
+		t.Fatalf("unexpected error pushing chart: %s", err)
+	}
+	if _, ok := ts.Chart("mychart", "0.1.0"); !ok {
+		t.Error("expected the chart to be pushed")
+	}
+	for _, r := range ts.Requests() {
+		if r.Path == "/index.yaml" {
+			t.Error("expected the index not to be downloaded with --chart-api")
+		}
+	}
+}
+
+func TestPushCmdStats(t *testing.T) {
+	ts := chartmuseumtest.NewServer()
+	defer ts.Close()
+
+	args := []string{testTarballPath, ts.URL}
+	cmd := newPushCmd(args)
+	var stderr bytes.Buffer
+	cmd.SetErr(&stderr)
+	cmd.Flags().Set("context-path", "/")
+	cmd.Flags().Set("stats", "true")
+	cmd.Flags().Set("wait-index", "5s")
+	if err := cmd.RunE(cmd, args); err != nil {
+		t.Fatalf("unexpected error pushing chart: %s", err)
+	}
+	for _, phase := range []string{"auth", "packaging", "upload", "index_propagation", "total"} {
+		if !strings.Contains(stderr.String(), phase) {
+			t.Errorf("expected the %s phase in the timing summary, got:\n%s", phase, stderr.String())
+		}
+	}
+}
+
+func TestPushCmdOnConflict(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "helm-push-test")
+	if err != nil {
+		t.Fatal("unexpected error creating temp test dir", err)
+	}
+	defer os.RemoveAll(tmp)
+	ts := chartmuseumtest.NewServer()
+	defer ts.Close()
+	data, err := ioutil.ReadFile(testTarballPath)
+	if err != nil {
+		t.Fatal("unexpected error reading test tarball", err)
+	}
+	if _, err := ts.AddChart(data, nil); err != nil {
+		t.Fatalf("unexpected error adding chart: %s", err)
+	}
+	configPath := filepath.Join(tmp, "push.yaml")
+	report := filepath.Join(tmp, "report.json")
+
+	push := func(flags ...string) error {
+		args := []string{testTarballPath, ts.URL}
+		cmd := newPushCmd(args)
+		cmd.Flags().Set("context-path", "/")
+		cmd.Flags().Set("config", configPath)
+		cmd.Flags().Set("report", report)
+		for i := 0; i < len(flags); i += 2 {
+			cmd.Flags().Set(flags[i], flags[i+1])
+		}
+		return cmd.RunE(cmd, args)
+	}
+	ioutil.WriteFile(configPath, nil, 0600)
+	if err := push(); err == nil || !strings.Contains(err.Error(), "--on-conflict") {
+		t.Errorf("expected conflict error with hint, got %v", err)
+	}
+	if err := push("on-conflict", "retry"); err == nil {
+		t.Error("expected error with unknown strategy, instead got nil")
+	}
+
+	if err := push("on-conflict", "skip"); err != nil {
+		t.Fatalf("unexpected error pushing chart: %s", err)
+	}
+	if c, _ := ts.Chart("mychart", "0.1.0"); !bytes.Equal(c.Package, data) {
+		t.Error("expected the chart version to be left as is")
+	}
+	if b, _ := ioutil.ReadFile(report); !strings.Contains(string(b), `"status": "exists"`) {
+		t.Errorf("expected exists status in report:\n%s", b)
+	}
+
+	// Per repository strategy, the flag takes precedence
+	ioutil.WriteFile(configPath, []byte("repositories:\n  "+ts.URL+":\n    on_conflict: bump\n"), 0600)
+	if err := push("on-conflict", "fail"); err == nil {
+		t.Error("expected conflict error, instead got nil")
+	}
+	for _, version := range []string{"0.1.1", "0.1.2"} {
+		if err := push(); err != nil {
+			t.Fatalf("unexpected error pushing chart: %s", err)
+		}
+		if _, ok := ts.Chart("mychart", version); !ok {
+			t.Errorf("expected version %s to be pushed, got %v", version, ts.Charts())
+		}
+	}
+	if b, _ := ioutil.ReadFile(report); !strings.Contains(string(b), `"version": "0.1.2"`) {
+		t.Errorf("expected bumped version in report:\n%s", b)
+	}
+}
+
+func TestPushCmdBumpRegenerates(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "helm-push-test")
+	if err != nil {
+		t.Fatal("unexpected error creating temp test dir", err)
+	}
+	defer os.RemoveAll(tmp)
+	ioutil.WriteFile(filepath.Join(tmp, "Chart.yaml"), []byte("apiVersion: v2\nname: mychart\nversion: 1.2.0\n"), 0644)
+	ioutil.WriteFile(filepath.Join(tmp, "CHANGELOG.md"), []byte("## [1.2.1]\n### Fixed\n- Probe port\n\n## [1.2.0]\n### Fixed\n- Service port name\n"), 0644)
+	ts := chartmuseumtest.NewServer()
+	defer ts.Close()
+
+	push := func() {
+		args := []string{tmp, ts.URL}
+		cmd := newPushCmd(args)
+		cmd.Flags().Set("context-path", "/")
+		cmd.Flags().Set("on-conflict", "bump")
+		cmd.Flags().Set("changelog", "true")
+		cmd.Flags().Set("sbom", "cyclonedx")
+		if err := cmd.RunE(cmd, args); err != nil {
+			t.Fatalf("unexpected error pushing chart: %s", err)
+		}
+	}
+	sbomOf := func(c *chart.Chart) string {
+		for _, f := range c.Files {
+			if f.Name == "sbom.cdx.json" {
+				return string(f.Data)
+			}
+		}
+		return ""
+	}
+
+	push()
+	push()
+	pushed := loadPushed(t, ts, "mychart", "1.2.1")
+	if a := pushed.Metadata.Annotations[changelog.Annotation]; !strings.Contains(a, "Probe port") {
+		t.Errorf("expected the changes of the bumped version, got %q", a)
+	}
+	if doc := sbomOf(pushed); !strings.Contains(doc, "pkg:helm/mychart@1.2.1") || strings.Contains(doc, "@1.2.0") {
+		t.Errorf("expected the sbom of the bumped version, got:\n%s", doc)
+	}
+
+	// no section for the version bumped to
+	push()
+	if a, ok := loadPushed(t, ts, "mychart", "1.2.2").Metadata.Annotations[changelog.Annotation]; ok {
+		t.Errorf("expected no changes annotation, got %q", a)
+	}
+}
+
+func TestPushCmdUnsupportedTelemetry(t *testing.T) {
+	ts := chartmuseumtest.NewServer()
+	defer ts.Close()
+	os.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", ts.URL)
+	os.Setenv("OTEL_EXPORTER_OTLP_PROTOCOL", "grpc")
+	defer os.Unsetenv("OTEL_EXPORTER_OTLP_ENDPOINT")
+	defer os.Unsetenv("OTEL_EXPORTER_OTLP_PROTOCOL")
+
+	args := []string{testTarballPath, ts.URL}
+	cmd := newPushCmd(args)
+	cmd.Flags().Set("context-path", "/")
+	cmd.SetErr(ioutil.Discard)
+	if err := cmd.RunE(cmd, args); err != nil {
+		t.Fatalf("expected telemetry settings not to fail the push, got %s", err)
+	}
+	if _, ok := ts.Chart("mychart", "0.1.0"); !ok {
+		t.Error("expected the chart to be pushed")
+	}
+}
+
+func TestPushCmdChartNamedLikeSubcommand(t *testing.T) {
+	ts := chartmuseumtest.NewServer()
+	defer ts.Close()
+
+	tmp, err := ioutil.TempDir("", "helm-push-test")
+	if err != nil {
+		t.Fatal("unexpected error creating temp test dir", err)
+	}
+	defer os.RemoveAll(tmp)
+	os.MkdirAll(filepath.Join(tmp, "apply"), 0755)
+	ioutil.WriteFile(filepath.Join(tmp, "apply", "Chart.yaml"), []byte("apiVersion: v2\nname: apply\nversion: 0.1.0\n"), 0644)
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal("unexpected error getting working dir", err)
+	}
+	defer os.Chdir(wd)
+	os.Chdir(tmp)
+	// The test TLS files are relative to the package directory
+	for _, env := range []string{"HELM_REPO_CA_FILE", "HELM_REPO_CERT_FILE", "HELM_REPO_KEY_FILE"} {
+		os.Unsetenv(env)
+	}
+
+	args := []string{"--context-path", "/", "apply", ts.URL}
+	cmd := newPushCmd(args)
+	cmd.SetArgs(args)
+	cmd.SetOut(ioutil.Discard)
+	cmd.SetErr(ioutil.Discard)
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("unexpected error pushing chart: %s", err)
+	}
+	if _, ok := ts.Chart("apply", "0.1.0"); !ok {
+		t.Errorf("expected the apply chart to be pushed, got %+v", ts.Charts())
+	}
+}
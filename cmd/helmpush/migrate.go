@@ -0,0 +1,195 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	cm "github.com/IxDay/helm-push-cloudflare-access/pkg/chartmuseum"
+	"github.com/IxDay/helm-push-cloudflare-access/pkg/helm"
+	"github.com/IxDay/helm-push-cloudflare-access/pkg/hints"
+	"github.com/IxDay/helm-push-cloudflare-access/pkg/migrate"
+	"github.com/IxDay/helm-push-cloudflare-access/pkg/push"
+	"github.com/IxDay/helm-push-cloudflare-access/pkg/redact"
+	"github.com/IxDay/helm-push-cloudflare-access/pkg/tmpdir"
+	"github.com/spf13/cobra"
+	"helm.sh/helm/v3/pkg/repo"
+)
+
+type migrateCmd struct {
+	*pushCmd
+	state  string
+	dryRun bool
+	filter migrate.Filter
+}
+
+func newMigrateCmd() *cobra.Command {
+	p := &migrateCmd{pushCmd: &pushCmd{}}
+	cmd := &cobra.Command{
+		Use:   "migrate <source> <target>",
+		Short: "Copy every chart version from a chart repository to another",
+		Long: `Download every chart version of a repository (name or URL), and their provenance
+files, and upload them as is to another repository. Progress is saved to a state
+file after each chart version, so an interrupted migration resumes where it
+stopped when run again: versions done are skipped, failed ones are tried again.
+Versions already in the target repository with the same digest are skipped.`,
+		Example: `  $ helm push migrate https://old.chart.repo.com chartmuseum --state migrate.json
+  $ helm push migrate old chartmuseum --include 'api-*' --exclude '*-legacy' --dry-run`,
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) (err error) {
+			// Errors are printed by cobra, make sure they leak no secret
+			defer func() { err = redact.Error(err) }()
+
+			if err := p.setup(cmd); err != nil {
+				return err
+			}
+			if err := p.filter.Validate(); err != nil {
+				return err
+			}
+			return hints.Annotate(p.migrate(args[0], args[1]))
+		},
+	}
+	f := cmd.Flags()
+	f.StringVarP(&p.state, "state", "", "helm-push-migrate.json", "File recording the progress of the migration")
+	f.BoolVarP(&p.dryRun, "dry-run", "", false, "List the chart versions left to migrate without uploading them")
+	f.StringSliceVarP(&p.filter.Include, "include", "", nil, "Only migrate the charts whose name matches one of these patterns")
+	f.StringSliceVarP(&p.filter.Exclude, "exclude", "", nil, "Skip the charts whose name matches one of these patterns")
+	f.BoolVarP(&p.forceUpload, "force", "f", false, "Overwrite the chart versions the target repository has with another digest")
+	p.addRepoFlags(f)
+	return cmd
+}
+
+// migrate copies the chart versions of the source repository to the
+// target one, --context-path only applies to the target
+func (p *migrateCmd) migrate(source, target string) error {
+	contextPath := p.contextPath
+	p.contextPath = ""
+	src, err := p.repoClient(source)
+	if err != nil {
+		return err
+	}
+	p.contextPath = contextPath
+	dst, err := p.repoClient(target)
+	if err != nil {
+		return err
+	}
+
+	sourceIndex, err := p.pusher(src).Index()
+	if err != nil {
+		return err
+	}
+	targetIndex, err := p.pusher(dst).Index()
+	if err != nil {
+		return err
+	}
+	state, err := migrate.Load(p.state, src.URL(), dst.URL())
+	if err != nil {
+		return err
+	}
+
+	var todo []*migrate.Chart
+	skipped := 0
+	if sourceIndex.IndexFile != nil {
+		names := make([]string, 0, len(sourceIndex.Entries))
+		for name := range sourceIndex.Entries {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if !p.filter.Match(name) {
+				continue
+			}
+			for _, cv := range sourceIndex.Entries[name] {
+				c := state.Add(cv.Name, cv.Version)
+				if c.Status == migrate.StatusDone {
+					continue
+				}
+				if published(targetIndex, cv.Name, cv.Version, cv.Digest) {
+					c.Status, c.Error = migrate.StatusDone, ""
+					skipped++
+					continue
+				}
+				todo = append(todo, c)
+			}
+		}
+	}
+
+	if p.dryRun {
+		for _, c := range todo {
+			p.log.Info("chart would be migrated", "chart", c.Name, "version", c.Version, "status", c.Status)
+		}
+		p.log.Info("dry run, nothing migrated", "pending", len(todo), "skipped", skipped)
+		return nil
+	}
+	if err := state.Save(); err != nil {
+		return err
+	}
+
+	migrator := p.pusher(dst, push.Force(p.forceUpload), push.DiscoverContextPath(p.contextPath == ""))
+	failed := 0
+	for i, c := range todo {
+		log := p.log.With("chart", c.Name, "version", c.Version, "progress", fmt.Sprintf("%d/%d", i+1, len(todo)))
+		entry, err := sourceIndex.Get(c.Name, c.Version)
+		if err == nil {
+			err = p.copyChart(src, migrator, entry)
+		}
+		if err != nil {
+			failed++
+			log.Error("chart migration failed", "error", redact.Error(err))
+		} else {
+			log.Info("chart migrated")
+		}
+		if err := state.Mark(c, err); err != nil {
+			return err
+		}
+	}
+	p.log.Info("migration finished", "migrated", len(todo)-failed, "skipped", skipped, "failed", failed, "state", p.state)
+	if failed > 0 {
+		return fmt.Errorf("%d chart versions failed to migrate, run the command again to retry them, see %s", failed, p.state)
+	}
+	return nil
+}
+
+// repoClient returns a client of the repository given by name or URL
+func (p *migrateCmd) repoClient(name string) (*cm.Client, error) {
+	p.repoName = name
+	r, err := p.getRepo()
+	if err != nil {
+		return nil, err
+	}
+	return p.newClient(p.repoURL(r))
+}
+
+// copyChart downloads the package of entry, and its provenance file when
+// there is one, and uploads them with migrator
+func (p *migrateCmd) copyChart(src *cm.Client, migrator *push.Pusher, entry *repo.ChartVersion) error {
+	source := p.pusher(src)
+	chart, err := source.Fetch(entry)
+	if err != nil {
+		return err
+	}
+	tmp, err := tmpdir.New("helm-push-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+	chartPath, provPath, err := source.Save(chart, tmp)
+	if err != nil {
+		return err
+	}
+	return migrator.Upload(chartPath, provPath)
+}
+
+// published tells if index lists the chart version with digest
+func published(index *helm.Index, name, version, digest string) bool {
+	if index.IndexFile == nil || digest == "" {
+		return false
+	}
+	for _, cv := range index.Entries[name] {
+		if cv.Version == version {
+			return strings.EqualFold(strings.TrimPrefix(cv.Digest, "sha256:"), strings.TrimPrefix(digest, "sha256:"))
+		}
+	}
+	return false
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/IxDay/helm-push-cloudflare-access/pkg/chartmuseumtest"
+	"github.com/IxDay/helm-push-cloudflare-access/pkg/migrate"
+)
+
+func TestMigrateCmd(t *testing.T) {
+	chart, err := ioutil.ReadFile(testTarballPath)
+	if err != nil {
+		t.Fatal("unexpected error reading test tarball", err)
+	}
+	old := chartmuseumtest.NewServer()
+	defer old.Close()
+	if _, err := old.AddChart(chart, []byte("provenance")); err != nil {
+		t.Fatal("unexpected error storing test tarball", err)
+	}
+	addChart(t, old, "broken", "1.0.0")
+	addChart(t, old, "legacy", "1.0.0")
+	old.InjectFault(chartmuseumtest.Fault{Method: "GET", Path: "/charts/broken-1.0.0.tgz", Status: 404})
+	target := chartmuseumtest.NewServer()
+	defer target.Close()
+	uploads := func() int { return countRequests(target, "POST", "/api/charts") }
+
+	tmp, err := ioutil.TempDir("", "helm-push-test")
+	if err != nil {
+		t.Fatal("unexpected error creating temp test dir", err)
+	}
+	defer os.RemoveAll(tmp)
+	os.Unsetenv("HELM_REPO_CONTEXT_PATH")
+	statePath := filepath.Join(tmp, "migrate.json")
+	run := func(args ...string) error {
+		args = append([]string{"migrate", old.URL, target.URL, "--state", statePath}, args...)
+		cmd := newPushCmd(args)
+		cmd.SetArgs(args)
+		cmd.SetOut(ioutil.Discard)
+		cmd.SetErr(ioutil.Discard)
+		return cmd.Execute()
+	}
+
+	if err := run("--dry-run"); err != nil {
+		t.Fatalf("unexpected error with dry run: %s", err)
+	}
+	if _, err := os.Stat(statePath); !os.IsNotExist(err) || uploads() != 0 {
+		t.Errorf("expected dry run to neither upload nor save state, got %d uploads, %v", uploads(), err)
+	}
+
+	err = run("--exclude", "legacy")
+	if err == nil || !strings.Contains(err.Error(), "1 chart versions failed to migrate") {
+		t.Errorf("expected broken chart to fail, got %v", err)
+	}
+	if c, ok := target.Chart("mychart", "0.1.0"); !ok || uploads() != 1 || string(c.Provenance) != "provenance" {
+		t.Errorf("expected the chart to be uploaded with its provenance file, got %+v", target.Charts())
+	}
+	state, err := migrate.Load(statePath, old.URL, target.URL)
+	if err != nil {
+		t.Fatalf("unexpected error loading state: %s", err)
+	}
+	if state.Count(migrate.StatusDone) != 1 || state.Count(migrate.StatusFailed) != 1 || len(state.Charts) != 2 {
+		t.Errorf("unexpected state %+v", state.Charts)
+	}
+
+	// Resume, only the failed version is tried again
+	if err := run("--include", "mychart"); err != nil {
+		t.Fatalf("unexpected error resuming: %s", err)
+	}
+	if uploads() != 1 {
+		t.Errorf("expected migrated chart not to be uploaded again, got %d uploads", uploads())
+	}
+
+	// Versions already in the target are skipped
+	os.Remove(statePath)
+	if err := run("--include", "mychart"); err != nil || uploads() != 1 {
+		t.Errorf("expected published chart to be skipped, got %d uploads, %v", uploads(), err)
+	}
+
+	if err := run("--include", "["); err == nil {
+		t.Error("expected error with invalid pattern, instead got nil")
+	}
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"os"
+
+	"github.com/IxDay/helm-push-cloudflare-access/pkg/helm"
+)
+
+// checkPolicy refuses the chart packaged at path if it does not follow the
+// policy of the repository, or the global one. Rego files given by
+// --policy are evaluated on top of it.
+func (p *pushCmd) checkPolicy(chart *helm.Chart, path, url string) error {
+	policy := p.config.Policy
+	if r := p.config.Repository(p.repoName, url).Policy; r != nil {
+		policy = *r
+	}
+	policy.Rego = append(append([]string{}, policy.Rego...), p.policies...)
+	if policy.Empty() {
+		return nil
+	}
+	defer p.track("policy")()
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if err := policy.Check(chart.Chart, fi.Size()); err != nil {
+		return err
+	}
+	p.log.Debug("policy checked", "chart", chart.Metadata.Name)
+	return nil
+}
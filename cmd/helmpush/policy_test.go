@@ -0,0 +1,47 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/IxDay/helm-push-cloudflare-access/pkg/chartmuseumtest"
+)
+
+func TestPushCmdPolicy(t *testing.T) {
+	ts := chartmuseumtest.NewServer()
+	defer ts.Close()
+
+	tmp, err := ioutil.TempDir("", "helm-push-test")
+	if err != nil {
+		t.Fatal("unexpected error creating temp test dir", err)
+	}
+	defer os.RemoveAll(tmp)
+	configPath := filepath.Join(tmp, "push.yaml")
+	config := "policy:\n  name_pattern: ^company-\n  require_maintainers: true\nrepositories:\n  " + ts.URL + ":\n    policy:\n      max_size: 1\n"
+	ioutil.WriteFile(configPath, []byte(config), 0600)
+
+	push := func(repo string) error {
+		args := []string{testTarballPath, repo}
+		cmd := newPushCmd(args)
+		cmd.Flags().Set("context-path", "/")
+		cmd.Flags().Set("config", configPath)
+		return cmd.RunE(cmd, args)
+	}
+
+	// Global policy
+	err = push(strings.Replace(ts.URL, "127.0.0.1", "localhost", 1))
+	if err == nil || !strings.Contains(err.Error(), "name mychart does not match ^company-") || !strings.Contains(err.Error(), "no maintainers") {
+		t.Errorf("expected global policy violations, got %v", err)
+	}
+	// Repository policy
+	err = push(ts.URL)
+	if err == nil || !strings.Contains(err.Error(), "exceeds 1 bytes") || strings.Contains(err.Error(), "no maintainers") {
+		t.Errorf("expected repository policy violation, got %v", err)
+	}
+	if n := countRequests(ts, "POST", "/api/charts"); n != 0 {
+		t.Errorf("expected refused charts not to be uploaded, got %d uploads", n)
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/IxDay/helm-push-cloudflare-access/pkg/hints"
+	"github.com/IxDay/helm-push-cloudflare-access/pkg/push"
+	"github.com/IxDay/helm-push-cloudflare-access/pkg/redact"
+	"github.com/IxDay/helm-push-cloudflare-access/pkg/tmpdir"
+	"github.com/spf13/cobra"
+)
+
+type promoteCmd struct {
+	*pushCmd
+	version string
+	from    string
+	to      string
+}
+
+func newPromoteCmd() *cobra.Command {
+	p := &promoteCmd{pushCmd: &pushCmd{}}
+	cmd := &cobra.Command{
+		Use:   "promote <chart> --from <channel> --to <channel>",
+		Short: "Copy a chart version from a release channel to another",
+		Long: `Download a chart package, and its provenance file when there is one, from the
+repository of a release channel and upload it as is to the repository of another
+channel. The package is not rebuilt, it has the same digest in both channels, and
+the version stays in the source channel. Channels are defined in the
+configuration file.`,
+		Example: `  $ helm push promote mychart --version 0.3.2 --from dev --to stable`,
+		Args:    cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) (err error) {
+			// Errors are printed by cobra, make sure they leak no secret
+			defer func() { err = redact.Error(err) }()
+
+			if err := p.setup(cmd); err != nil {
+				return err
+			}
+			if p.from == p.to {
+				return fmt.Errorf("--from and --to are the same channel %q", p.from)
+			}
+			err = hints.Annotate(p.promote(args[0]))
+			if auditErr := p.writeAudit("promote", err); auditErr != nil {
+				p.log.Error("could not write audit log", "error", auditErr)
+				if err == nil {
+					err = auditErr
+				}
+			}
+			return err
+		},
+	}
+	f := cmd.Flags()
+	f.StringVarP(&p.version, "version", "", "", "Chart version or constraint, defaults to the latest version of the source channel")
+	f.StringVarP(&p.from, "from", "", "", "Channel to promote the chart from")
+	f.StringVarP(&p.to, "to", "", "", "Channel to promote the chart to")
+	f.BoolVarP(&p.forceUpload, "force", "f", false, "Overwrite the chart version if the target channel has it")
+	f.StringVarP(&p.auditLog, "audit-log", "", "", "Append a JSON record of the promotion to this file [$HELM_PUSH_AUDIT_LOG]")
+	p.addRepoFlags(f)
+	cmd.MarkFlagRequired("from")
+	cmd.MarkFlagRequired("to")
+	return cmd
+}
+
+// promote copies the chart name from the repository of the source channel
+// to the one of the target channel
+func (p *promoteCmd) promote(name string) error {
+	// --context-path applies to both channels
+	contextPath := p.contextPath
+	if err := p.useChannel(p.from); err != nil {
+		return err
+	}
+	repo, err := p.getRepo()
+	if err != nil {
+		return err
+	}
+	client, err := p.newClient(p.repoURL(repo))
+	if err != nil {
+		return err
+	}
+	source := p.pusher(client)
+	chart, err := source.Pull(name, p.version)
+	if err != nil {
+		return err
+	}
+	p.result = pushResult{chart: name, name: chart.Name, version: chart.Version, digest: strings.TrimPrefix(chart.Digest, "sha256:")}
+	if chart.Digest == "" {
+		p.log.Warn("no digest in the index, chart integrity not checked", "chart", chart.Name, "version", chart.Version)
+	}
+
+	tmp, err := tmpdir.New("helm-push-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+	chartPath, provPath, err := source.Save(chart, tmp)
+	if err != nil {
+		return err
+	}
+	file := filepath.Base(chartPath)
+
+	p.contextPath = contextPath
+	if err := p.useChannel(p.to); err != nil {
+		return err
+	}
+	if repo, err = p.getRepo(); err != nil {
+		return err
+	}
+	url := p.repoURL(repo)
+	p.result.url = url
+	if client, err = p.newClient(url); err != nil {
+		return err
+	}
+	log := p.log.With("chart", file, "from", p.from, "to", p.to)
+	log.Info("promoting chart")
+	err = p.pusher(client, push.Force(p.forceUpload), push.DiscoverContextPath(p.contextPath == "")).Upload(chartPath, provPath)
+	if err != nil {
+		return err
+	}
+	if provPath != "" {
+		log = log.With("prov", file+".prov")
+	}
+	log.Info("chart promoted")
+	return nil
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/IxDay/helm-push-cloudflare-access/pkg/chartmuseumtest"
+)
+
+func TestPromoteCmd(t *testing.T) {
+	chart, err := ioutil.ReadFile(testTarballPath)
+	if err != nil {
+		t.Fatal("unexpected error reading test tarball", err)
+	}
+	dev := chartmuseumtest.NewServer()
+	defer dev.Close()
+	if _, err := dev.AddChart(chart, []byte("provenance")); err != nil {
+		t.Fatal("unexpected error storing test tarball", err)
+	}
+	stable := chartmuseumtest.NewServer(chartmuseumtest.ContextPath("/stable"))
+	defer stable.Close()
+
+	tmp, err := ioutil.TempDir("", "helm-push-test")
+	if err != nil {
+		t.Fatal("unexpected error creating temp test dir", err)
+	}
+	defer os.RemoveAll(tmp)
+	os.Unsetenv("HELM_REPO_CONTEXT_PATH")
+	configPath := filepath.Join(tmp, "push.yaml")
+	config := "channels:\n  dev: {repo: " + dev.URL + "}\n  stable: {repo: " + stable.URL + ", context_path: /stable}\n"
+	ioutil.WriteFile(configPath, []byte(config), 0600)
+
+	run := func(args ...string) error {
+		args = append(args, "--config", configPath)
+		cmd := newPushCmd(args)
+		cmd.SetArgs(args)
+		cmd.SetOut(ioutil.Discard)
+		cmd.SetErr(ioutil.Discard)
+		return cmd.Execute()
+	}
+
+	if err := run("promote", "mychart", "--from", "dev", "--to", "stable"); err != nil {
+		t.Fatalf("unexpected error promoting chart: %s", err)
+	}
+	c, ok := stable.Chart("mychart", "0.1.0")
+	if !ok || !bytes.Equal(c.Package, chart) {
+		t.Fatalf("expected the package to be uploaded as is to the stable context path, got %+v", stable.Charts())
+	}
+	if string(c.Provenance) != "provenance" {
+		t.Errorf("expected the provenance file to be uploaded, got %q", c.Provenance)
+	}
+
+	if err := run("promote", "mychart", "--from", "dev", "--to", "staging"); err == nil || !strings.Contains(err.Error(), `unknown channel "staging"`) {
+		t.Errorf("expected unknown channel error, got %v", err)
+	}
+	if err := run("promote", "mychart", "--from", "dev", "--to", "dev"); err == nil {
+		t.Error("expected error promoting to the same channel, instead got nil")
+	}
+	if err := run("promote", "mychart", "--version", "9.9.9", "--from", "dev", "--to", "stable"); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("expected version not found error, got %v", err)
+	}
+
+	// Pushing to a channel
+	if err := run(testTarballPath, "--channel", "stable", "--version", "0.2.0"); err != nil {
+		t.Fatalf("unexpected error pushing to channel: %s", err)
+	}
+	if _, ok := stable.Chart("mychart", "0.2.0"); !ok {
+		t.Errorf("expected the chart to be pushed to the stable context path, got %+v", stable.Charts())
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	neturl "net/url"
+	"os"
+	"path"
+	"path/filepath"
+
+	cm "github.com/IxDay/helm-push-cloudflare-access/pkg/chartmuseum"
+	"github.com/IxDay/helm-push-cloudflare-access/pkg/hints"
+	"github.com/IxDay/helm-push-cloudflare-access/pkg/redact"
+	"github.com/spf13/cobra"
+	"helm.sh/helm/v3/pkg/chartutil"
+)
+
+type pullCmd struct {
+	*pushCmd
+	version     string
+	destination string
+	untar       bool
+}
+
+func newPullCmd() *cobra.Command {
+	p := &pullCmd{pushCmd: &pushCmd{}}
+	cmd := &cobra.Command{
+		Use:   "pull <chart> <repo>",
+		Short: "Download a chart from a chart repository",
+		Long: `Download a chart package, and its provenance file when there is one, from a
+chart repository (name or URL) to a local file. The repository does not need to
+be added to Helm and the cm:// protocol is not involved, so deploy tooling can
+use the result as is. The package digest is checked against the index.`,
+		Example: `  $ helm push pull mychart chartmuseum --version 0.1.0
+  $ helm push pull mychart https://my.chart.repo.com --untar -d charts/`,
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) (err error) {
+			// Errors are printed by cobra, make sure they leak no secret
+			defer func() { err = redact.Error(err) }()
+
+			if err := p.setup(cmd); err != nil {
+				return err
+			}
+			p.repoName = args[1]
+			return hints.Annotate(p.pull(args[0]))
+		},
+	}
+	f := cmd.Flags()
+	f.StringVarP(&p.version, "version", "", "", "Chart version or constraint, defaults to the latest version")
+	f.StringVarP(&p.destination, "destination", "d", ".", "Directory to write the chart to")
+	f.BoolVarP(&p.untar, "untar", "", false, "Extract the chart in the destination directory instead of writing the package")
+	f.StringVarP(&p.verify, "verify", "", "", "Verify the chart, one of: provenance, cosign [$HELM_PUSH_VERIFY]")
+	f.StringVar(&p.keyring, "keyring", defaultKeyring(), "location of a public keyring [$HELM_PUSH_KEYRING]")
+	p.addRepoFlags(f)
+	return cmd
+}
+
+// pull downloads the chart name from the repository
+func (p *pullCmd) pull(name string) error {
+	repo, err := p.getRepo()
+	if err != nil {
+		return err
+	}
+	url := p.repoURL(repo)
+	client, err := p.newClient(url)
+	if err != nil {
+		return err
+	}
+
+	chart, err := p.pusher(client).Pull(name, p.version)
+	if err != nil {
+		return err
+	}
+	chartURL, err := neturl.Parse(chart.URL)
+	if err != nil {
+		return err
+	}
+	dir, file := path.Split(chartURL.Path)
+	chartURL.Path = dir
+	// Credentials are only sent to the repository host, see At
+	if client, err = client.At(chartURL.String()); err != nil {
+		return err
+	}
+	p.log.Debug("chart downloaded", "url", redact.URL(chartURL), "file", file)
+	data := chart.Data
+	if chart.Digest == "" {
+		p.log.Warn("no digest in the index, chart integrity not checked", "chart", file)
+	}
+	if err := p.verifyDownload(client, file, data); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(p.destination, 0755); err != nil {
+		return err
+	}
+	if p.untar {
+		if err := chartutil.Expand(p.destination, bytes.NewReader(data)); err != nil {
+			return err
+		}
+		p.log.Info("chart pulled", "chart", file, "path", filepath.Join(p.destination, chart.Name))
+		return nil
+	}
+	chartPath := filepath.Join(p.destination, file)
+	if err := ioutil.WriteFile(chartPath, data, 0644); err != nil {
+		return err
+	}
+	provPath, err := p.pullProvenance(client, file, chartPath)
+	if err != nil {
+		return err
+	}
+	if provPath != "" {
+		p.log.Info("chart pulled", "chart", file, "path", chartPath, "prov", provPath)
+	} else {
+		p.log.Info("chart pulled", "chart", file, "path", chartPath)
+	}
+	return nil
+}
+
+// pullProvenance downloads the provenance file of the chart next to it, if
+// the repository has one, and returns its path
+func (p *pullCmd) pullProvenance(client *cm.Client, file, chartPath string) (string, error) {
+	prov, err := fetchSignatureFile(client, file+".prov")
+	var se *cm.StatusError
+	if errors.As(err, &se) && se.StatusCode == http.StatusNotFound {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("fetching provenance file of %s: %w", file, err)
+	}
+	provPath := chartPath + ".prov"
+	return provPath, ioutil.WriteFile(provPath, prov, 0644)
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/IxDay/helm-push-cloudflare-access/pkg/chartmuseumtest"
+)
+
+func TestPullCmd(t *testing.T) {
+	chart, err := ioutil.ReadFile(testTarballPath)
+	if err != nil {
+		t.Fatal("unexpected error reading test tarball", err)
+	}
+	ts := chartmuseumtest.NewServer(chartmuseumtest.RequireAccess("my-id", "my-secret"))
+	defer ts.Close()
+	if _, err := ts.AddChart(chart, nil); err != nil {
+		t.Fatalf("unexpected error adding chart: %s", err)
+	}
+	addChart(t, ts, "mychart", "0.0.1")
+	ts.InjectFault(chartmuseumtest.Fault{Method: "GET", Path: "/charts/mychart-0.0.1.tgz", Corrupt: true})
+
+	tmp, err := ioutil.TempDir("", "helm-push-test")
+	if err != nil {
+		t.Fatal("unexpected error creating temp test dir", err)
+	}
+	defer os.RemoveAll(tmp)
+	os.Unsetenv("HELM_REPO_CONTEXT_PATH")
+
+	pull := func(args ...string) error {
+		args = append([]string{"pull", "mychart", ts.URL, "--client-id", "my-id", "--client-secret", "my-secret", "-d", tmp}, args...)
+		cmd := newPushCmd(args)
+		cmd.SetArgs(args)
+		cmd.SetOut(ioutil.Discard)
+		cmd.SetErr(ioutil.Discard)
+		return cmd.Execute()
+	}
+
+	if err := pull(); err != nil {
+		t.Fatalf("unexpected error pulling chart: %s", err)
+	}
+	if b, _ := ioutil.ReadFile(filepath.Join(tmp, "mychart-0.1.0.tgz")); !bytes.Equal(b, chart) {
+		t.Error("expected the chart package to be written to the destination")
+	}
+	if _, err := os.Stat(filepath.Join(tmp, "mychart-0.1.0.tgz.prov")); !os.IsNotExist(err) {
+		t.Error("expected no provenance file to be written")
+	}
+
+	if err := pull("--untar"); err != nil {
+		t.Fatalf("unexpected error pulling chart: %s", err)
+	}
+	if _, err := os.Stat(filepath.Join(tmp, "mychart", "Chart.yaml")); err != nil {
+		t.Errorf("expected the chart to be extracted: %s", err)
+	}
+
+	if err := pull("--version", "0.0.1"); err == nil || !strings.Contains(err.Error(), "digest mismatch") {
+		t.Errorf("expected digest mismatch error, got %v", err)
+	}
+	if err := pull("--version", "2.0.0"); err == nil || !strings.Contains(err.Error(), `version "2.0.0" not found`) {
+		t.Errorf("expected version not found error, got %v", err)
+	}
+}
+
+func TestPullCmdChartAPI(t *testing.T) {
+	ts := chartmuseumtest.NewServer(chartmuseumtest.RequireAccess("my-id", "my-secret"))
+	defer ts.Close()
+	chart, err := ioutil.ReadFile(testTarballPath)
+	if err != nil {
+		t.Fatal("unexpected error reading test tarball", err)
+	}
+	if _, err := ts.AddChart(chart, nil); err != nil {
+		t.Fatalf("unexpected error adding chart: %s", err)
+	}
+
+	tmp, err := ioutil.TempDir("", "helm-push-test")
+	if err != nil {
+		t.Fatal("unexpected error creating temp test dir", err)
+	}
+	defer os.RemoveAll(tmp)
+	os.Unsetenv("HELM_REPO_CONTEXT_PATH")
+
+	args := []string{"pull", "mychart", ts.RepoURL(), "--client-id", "my-id", "--client-secret", "my-secret", "-d", tmp, "--chart-api"}
+	cmd := newPushCmd(args)
+	cmd.SetArgs(args)
+	cmd.SetOut(ioutil.Discard)
+	cmd.SetErr(ioutil.Discard)
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("unexpected error pulling chart: %s", err)
+	}
+	if b, _ := ioutil.ReadFile(filepath.Join(tmp, "mychart-0.1.0.tgz")); !bytes.Equal(b, chart) {
+		t.Error("expected the chart package to be written to the destination")
+	}
+	for _, r := range ts.Requests() {
+		if r.Path == "/index.yaml" {
+			t.Error("expected the index not to be downloaded with --chart-api")
+		}
+	}
+	if r := ts.Unauthenticated(); len(r) != 0 {
+		t.Errorf("expected every request to carry the Access token, got %+v", r)
+	}
+}
+
+func TestPullCmdOtherHost(t *testing.T) {
+	chart, err := ioutil.ReadFile(testTarballPath)
+	if err != nil {
+		t.Fatal("unexpected error reading test tarball", err)
+	}
+	var leaked []string
+	storage := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("CF-Access-Client-Id") != "" || r.Header.Get("CF-Access-Client-Secret") != "" {
+			leaked = append(leaked, r.URL.Path)
+		}
+		if r.URL.Path != "/mychart-0.1.0.tgz" {
+			w.WriteHeader(404)
+			return
+		}
+		w.Write(chart)
+	}))
+	defer storage.Close()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("apiVersion: v1\nentries:\n  mychart:\n  - name: mychart\n    version: 0.1.0\n    urls: [" + storage.URL + "/mychart-0.1.0.tgz]\n"))
+	}))
+	defer ts.Close()
+
+	tmp, err := ioutil.TempDir("", "helm-push-test")
+	if err != nil {
+		t.Fatal("unexpected error creating temp test dir", err)
+	}
+	defer os.RemoveAll(tmp)
+	os.Unsetenv("HELM_REPO_CONTEXT_PATH")
+
+	args := []string{"pull", "mychart", ts.URL, "--client-id", "my-id", "--client-secret", "my-secret", "-d", tmp}
+	cmd := newPushCmd(args)
+	cmd.SetArgs(args)
+	cmd.SetOut(ioutil.Discard)
+	cmd.SetErr(ioutil.Discard)
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("unexpected error pulling chart: %s", err)
+	}
+	if b, _ := ioutil.ReadFile(filepath.Join(tmp, "mychart-0.1.0.tgz")); !bytes.Equal(b, chart) {
+		t.Error("expected the chart package to be written to the destination")
+	}
+	if len(leaked) != 0 {
+		t.Errorf("expected no credentials to be sent to the package host, got requests %v", leaked)
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"path/filepath"
+
+	"github.com/IxDay/helm-push-cloudflare-access/pkg/index"
+	"github.com/IxDay/helm-push-cloudflare-access/pkg/redact"
+	"github.com/spf13/cobra"
+)
+
+func newReindexCmd() *cobra.Command {
+	p := &pushCmd{}
+	var opts index.Options
+	cmd := &cobra.Command{
+		Use:   "reindex <dir>",
+		Short: "Generate or update the index.yaml of a static chart repository",
+		Long: `Index the chart packages of a directory served as a static chart repository and
+merge them into its index.yaml. Entries already listed are preserved, packages
+whose digest changed are updated and concurrent runs are serialized with a lock
+file.`,
+		Example: `  $ helm push reindex ./repo --url https://charts.example.com`,
+		Args:    cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) (err error) {
+			// Errors are printed by cobra, make sure they leak no secret
+			defer func() { err = redact.Error(err) }()
+
+			if err := p.setup(cmd); err != nil {
+				return err
+			}
+			i, err := index.Update(args[0], opts)
+			if err != nil {
+				return err
+			}
+			versions := 0
+			for _, cvs := range i.Entries {
+				versions += len(cvs)
+			}
+			p.log.Info("index updated", "path", filepath.Join(args[0], index.FileName), "charts", len(i.Entries), "versions", versions)
+			return nil
+		},
+	}
+	f := cmd.Flags()
+	f.StringVarP(&opts.URL, "url", "", "", "Base URL of the chart packages, URLs are relative to the index otherwise")
+	f.BoolVarP(&opts.Prune, "prune", "", false, "Remove the entries whose package is not in the directory")
+	f.DurationVarP(&opts.LockTimeout, "lock-timeout", "", 0, "How long to wait for a concurrent run to release the index (default 30s)")
+	return cmd
+}
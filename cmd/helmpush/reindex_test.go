@@ -0,0 +1,36 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/IxDay/helm-push-cloudflare-access/pkg/index"
+)
+
+func TestReindexCmd(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "helm-push-test")
+	if err != nil {
+		t.Fatal("unexpected error creating temp test dir", err)
+	}
+	defer os.RemoveAll(tmp)
+	chart, _ := ioutil.ReadFile(testTarballPath)
+	ioutil.WriteFile(filepath.Join(tmp, "mychart-0.1.0.tgz"), chart, 0644)
+
+	args := []string{"reindex", tmp, "--url", "https://charts.example.com"}
+	cmd := newPushCmd(args)
+	cmd.SetArgs(args)
+	cmd.SetOut(ioutil.Discard)
+	cmd.SetErr(ioutil.Discard)
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	i, err := index.Load(filepath.Join(tmp, index.FileName))
+	if err != nil {
+		t.Fatalf("unexpected error loading index: %s", err)
+	}
+	if cvs := i.Entries["mychart"]; len(cvs) != 1 || cvs[0].URLs[0] != "https://charts.example.com/mychart-0.1.0.tgz" {
+		t.Errorf("unexpected index entries %+v", i.Entries)
+	}
+}
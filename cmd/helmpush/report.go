@@ -0,0 +1,138 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+type (
+	jsonReport struct {
+		Repo   string            `json:"repo"`
+		Charts []jsonReportChart `json:"charts"`
+	}
+
+	jsonReportChart struct {
+		Chart    string  `json:"chart"`
+		Name     string  `json:"name,omitempty"`
+		Version  string  `json:"version,omitempty"`
+		Digest   string  `json:"digest,omitempty"`
+		Status   string  `json:"status"`
+		Duration float64 `json:"duration"`
+		Error    string  `json:"error,omitempty"`
+	}
+
+	junitTestSuites struct {
+		XMLName xml.Name         `xml:"testsuites"`
+		Suites  []junitTestSuite `xml:"testsuite"`
+	}
+
+	junitTestSuite struct {
+		Name     string          `xml:"name,attr"`
+		Tests    int             `xml:"tests,attr"`
+		Failures int             `xml:"failures,attr"`
+		Skipped  int             `xml:"skipped,attr,omitempty"`
+		Time     string          `xml:"time,attr"`
+		Cases    []junitTestCase `xml:"testcase"`
+	}
+
+	junitTestCase struct {
+		ClassName string        `xml:"classname,attr"`
+		Name      string        `xml:"name,attr"`
+		Time      string        `xml:"time,attr"`
+		Failure   *junitFailure `xml:"failure,omitempty"`
+		Skipped   *junitSkipped `xml:"skipped,omitempty"`
+	}
+
+	junitSkipped struct {
+		Message string `xml:"message,attr"`
+	}
+
+	junitFailure struct {
+		Message string `xml:"message,attr"`
+		Text    string `xml:",chardata"`
+	}
+)
+
+// writeReport writes the per-chart results to the report file, if enabled
+func (p *pushCmd) writeReport() error {
+	if p.report == "" {
+		return nil
+	}
+	format := p.reportFormat
+	if format == "" {
+		format = "json"
+		if strings.EqualFold(filepath.Ext(p.report), ".xml") {
+			format = "junit"
+		}
+	}
+
+	var b []byte
+	var err error
+	switch format {
+	case "json":
+		b, err = json.MarshalIndent(p.jsonReport(), "", "  ")
+	case "junit":
+		b, err = xml.MarshalIndent(p.junitReport(), "", "  ")
+		b = append([]byte(xml.Header), b...)
+	default:
+		return fmt.Errorf("invalid report format %q, must be one of: json, junit", format)
+	}
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(p.report, append(b, '\n'), 0644)
+}
+
+func (p *pushCmd) jsonReport() jsonReport {
+	report := jsonReport{Repo: p.repoName, Charts: []jsonReportChart{}}
+	for _, r := range p.results {
+		c := jsonReportChart{
+			Chart:    r.chart,
+			Name:     r.name,
+			Version:  r.version,
+			Digest:   r.digest,
+			Status:   "success",
+			Duration: r.duration.Seconds(),
+		}
+		if r.err != nil {
+			c.Status = "failure"
+			c.Error = r.err.Error()
+		} else if r.unchanged {
+			c.Status = "unchanged"
+		} else if r.exists {
+			c.Status = "exists"
+		}
+		report.Charts = append(report.Charts, c)
+	}
+	return report
+}
+
+func (p *pushCmd) junitReport() junitTestSuites {
+	suite := junitTestSuite{Name: "helm push " + p.repoName, Tests: len(p.results)}
+	var total float64
+	for _, r := range p.results {
+		name := r.displayName()
+		if r.version != "" {
+			name += "-" + r.version
+		}
+		c := junitTestCase{ClassName: p.repoName, Name: name, Time: fmt.Sprintf("%.3f", r.duration.Seconds())}
+		if r.err != nil {
+			suite.Failures++
+			c.Failure = &junitFailure{Message: r.err.Error(), Text: r.err.Error()}
+		} else if r.unchanged {
+			suite.Skipped++
+			c.Skipped = &junitSkipped{Message: "unchanged"}
+		} else if r.exists {
+			suite.Skipped++
+			c.Skipped = &junitSkipped{Message: "chart version exists"}
+		}
+		total += r.duration.Seconds()
+		suite.Cases = append(suite.Cases, c)
+	}
+	suite.Time = fmt.Sprintf("%.3f", total)
+	return junitTestSuites{Suites: []junitTestSuite{suite}}
+}
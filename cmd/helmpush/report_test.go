@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteReport(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "helm-push-test")
+	if err != nil {
+		t.Fatal("unexpected error creating temp test dir", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	p := &pushCmd{
+		repoName: "chartmuseum",
+		results: []pushResult{
+			{chart: "mychart/", name: "mychart", version: "0.1.0", digest: "abc", duration: time.Second},
+			{chart: "broken/", duration: time.Millisecond, err: errors.New("Chart.yaml file is missing")},
+		},
+	}
+
+	// Disabled
+	if err := p.writeReport(); err != nil {
+		t.Errorf("unexpected error without report: %s", err)
+	}
+
+	// JSON, inferred from extension
+	p.report = filepath.Join(tmp, "report.json")
+	if err := p.writeReport(); err != nil {
+		t.Fatalf("unexpected error writing json report: %s", err)
+	}
+	b, _ := ioutil.ReadFile(p.report)
+	var report jsonReport
+	if err := json.Unmarshal(b, &report); err != nil {
+		t.Fatalf("unexpected error parsing json report: %s", err)
+	}
+	if len(report.Charts) != 2 || report.Charts[0].Status != "success" || report.Charts[1].Error != "Chart.yaml file is missing" {
+		t.Errorf("unexpected json report: %s", b)
+	}
+
+	// JUnit, inferred from extension
+	p.report = filepath.Join(tmp, "report.xml")
+	if err := p.writeReport(); err != nil {
+		t.Fatalf("unexpected error writing junit report: %s", err)
+	}
+	b, _ = ioutil.ReadFile(p.report)
+	for _, expected := range []string{
+		`<testsuite name="helm push chartmuseum" tests="2" failures="1" time="1.001">`,
+		`<testcase classname="chartmuseum" name="mychart-0.1.0" time="1.000"></testcase>`,
+		`<failure message="Chart.yaml file is missing">`,
+	} {
+		if !strings.Contains(string(b), expected) {
+			t.Errorf("expected junit report to contain %q:\n%s", expected, b)
+		}
+	}
+
+	// Explicit format
+	p.report = filepath.Join(tmp, "report.txt")
+	p.reportFormat = "junit"
+	if err := p.writeReport(); err != nil {
+		t.Fatalf("unexpected error writing junit report: %s", err)
+	}
+	if b, _ = ioutil.ReadFile(p.report); !strings.HasPrefix(string(b), "<?xml") {
+		t.Errorf("expected junit report, got:\n%s", b)
+	}
+}
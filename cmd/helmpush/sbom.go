@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/IxDay/helm-push-cloudflare-access/pkg/helm"
+	"github.com/IxDay/helm-push-cloudflare-access/pkg/sbom"
+)
+
+// attachSBOM generates the SBOM of the chart and embeds it in the package,
+// a copy is written to --sbom-out for publication next to the repository
+func (p *pushCmd) attachSBOM(chart *helm.Chart) error {
+	data, err := sbom.Generate(chart.Chart, sbom.Options{Format: p.sbom, Images: p.sbomImages})
+	if err != nil {
+		return fmt.Errorf("generating sbom: %s", err)
+	}
+	sbom.Embed(chart.Chart, p.sbom, data)
+	p.log.Debug("sbom embedded", "file", sbom.FileName(p.sbom), "annotation", chart.Metadata.Annotations[sbom.Annotation])
+
+	if p.sbomOut == "" {
+		return nil
+	}
+	if err := os.MkdirAll(p.sbomOut, 0755); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s-%s.%s", chart.Metadata.Name, chart.Metadata.Version, strings.TrimPrefix(sbom.FileName(p.sbom), "sbom."))
+	path := filepath.Join(p.sbomOut, name)
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		return err
+	}
+	p.log.Info("sbom written", "path", path)
+	return nil
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/IxDay/helm-push-cloudflare-access/pkg/chartmuseumtest"
+	"github.com/IxDay/helm-push-cloudflare-access/pkg/sbom"
+)
+
+func TestPushCmdSBOM(t *testing.T) {
+	ts := chartmuseumtest.NewServer()
+	defer ts.Close()
+
+	tmp, err := ioutil.TempDir("", "helm-push-test")
+	if err != nil {
+		t.Fatal("unexpected error creating temp test dir", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	args := []string{testTarballPath, ts.URL}
+	cmd := newPushCmd(args)
+	cmd.Flags().Set("context-path", "/")
+	cmd.Flags().Set("sbom", "spdx")
+	cmd.Flags().Set("sbom-out", tmp)
+	if err := cmd.RunE(cmd, args); err != nil {
+		t.Fatal("unexpected error pushing chart", err)
+	}
+
+	uploaded := loadPushed(t, ts, "mychart", "0.1.0")
+	var embedded []byte
+	for _, f := range uploaded.Files {
+		if f.Name == "sbom.spdx.json" {
+			embedded = f.Data
+		}
+	}
+	if embedded == nil {
+		t.Fatal("expected sbom to be embedded in the chart package")
+	}
+	if uploaded.Metadata.Annotations[sbom.Annotation] == "" {
+		t.Error("expected sbom annotation in the chart metadata")
+	}
+	written, err := ioutil.ReadFile(filepath.Join(tmp, "mychart-0.1.0.spdx.json"))
+	if err != nil {
+		t.Fatal("expected sbom to be written to --sbom-out", err)
+	}
+	if string(written) != string(embedded) {
+		t.Error("expected written sbom to match the embedded one")
+	}
+
+	// Invalid format
+	args = []string{testTarballPath, ts.URL}
+	cmd = newPushCmd(args)
+	cmd.Flags().Set("sbom", "swid")
+	if err := cmd.RunE(cmd, args); err == nil {
+		t.Error("expected error with invalid sbom format, instead got nil")
+	}
+}
@@ -0,0 +1,315 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net"
+	"net/http"
+	neturl "net/url"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	cm "github.com/IxDay/helm-push-cloudflare-access/pkg/chartmuseum"
+	"github.com/IxDay/helm-push-cloudflare-access/pkg/push"
+	"github.com/IxDay/helm-push-cloudflare-access/pkg/redact"
+	"github.com/IxDay/helm-push-cloudflare-access/pkg/tmpdir"
+	"github.com/spf13/cobra"
+)
+
+// maxServeMemory is the part of an upload kept in memory, the rest is
+// staged on disk
+const maxServeMemory = 32 << 20
+
+type (
+	serveCmd struct {
+		*pushCmd
+		listen string
+		token  string
+		// allowHosts are the hosts repo URLs may point to, see allowRepo
+		allowHosts []string
+		// maxUpload is the maximum size of a request, in MiB
+		maxUpload int64
+		// mu serializes the pushes, pushCmd holds the state of one push
+		mu sync.Mutex
+	}
+
+	// serveResult is the response to a successful push
+	serveResult struct {
+		Name    string `json:"name"`
+		Version string `json:"version"`
+		Digest  string `json:"digest"`
+		Repo    string `json:"repo"`
+	}
+)
+
+func newServeCmd() *cobra.Command {
+	s := &serveCmd{pushCmd: &pushCmd{}}
+	cmd := &cobra.Command{
+		Use:   "serve",
+		Short: "Push charts received over HTTP",
+		Long: `Run an HTTP server pushing the chart packages it receives, the Cloudflare Access
+credentials are only known to the server. Charts are posted to /push as a
+multipart form with the "chart" package, an optional "prov" file, the "repo"
+(name or URL) and "force" fields. Requests must carry the token given by --token
+as a bearer token, a token is required unless listening on a loopback address.
+Repository URLs must be on a host allowed by --allow-host, or be configured in
+the configuration file, so that the credentials are never sent elsewhere.`,
+		Example: `  $ helm push serve --listen 127.0.0.1:8080
+  $ curl -F chart=@mychart-0.3.2.tgz -F repo=chartmuseum http://127.0.0.1:8080/push`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) (err error) {
+			// Errors are printed by cobra, make sure they leak no secret
+			defer func() { err = redact.Error(err) }()
+
+			if err := s.setup(cmd); err != nil {
+				return err
+			}
+			if v, ok := os.LookupEnv("HELM_PUSH_SERVE_TOKEN"); ok && s.token == "" {
+				s.token = v
+			}
+			redact.Secret(s.token)
+			if v, ok := os.LookupEnv("HELM_PUSH_SERVE_ALLOW_HOSTS"); ok && len(s.allowHosts) == 0 {
+				s.allowHosts = strings.Split(v, ",")
+			}
+			return s.serve(cmd.Context())
+		},
+	}
+	f := cmd.Flags()
+	f.StringVarP(&s.listen, "listen", "", "127.0.0.1:8080", "Address to listen on")
+	f.StringVarP(&s.token, "token", "", "", "Bearer token required from clients [$HELM_PUSH_SERVE_TOKEN]")
+	f.StringSliceVarP(&s.allowHosts, "allow-host", "", nil, "Host, with an optional port, repo URLs may point to, can be repeated [$HELM_PUSH_SERVE_ALLOW_HOSTS]")
+	f.Int64VarP(&s.maxUpload, "max-upload-size", "", 100, "Refuse requests larger than this many MiB")
+	f.StringVar(&s.keyring, "keyring", defaultKeyring(), "location of a public keyring [$HELM_PUSH_KEYRING]")
+	f.BoolVarP(&s.sign, "sign", "", false, "Sign the chart packages and push their provenance file [$HELM_PUSH_SIGN]")
+	f.StringVarP(&s.signKey, "key", "", "", "Name of the key to sign with, read from --keyring [$HELM_PUSH_SIGN_KEY]")
+	f.StringVarP(&s.passphraseFile, "passphrase-file", "", "", "File holding the passphrase of the signing key [$HELM_KEY_PASSPHRASE]")
+	f.StringVarP(&s.auditLog, "audit-log", "", "", "Append a JSON record of each push to this file [$HELM_PUSH_AUDIT_LOG]")
+	f.BoolVarP(&s.lock, "lock", "", false, "Lock the chart versions in the repository while pushing them, for servers sharing a repository [$HELM_PUSH_LOCK]")
+	f.DurationVarP(&s.lockTTL, "lock-ttl", "", 10*time.Minute, "With --lock, age after which a lock left by a crashed push is taken over")
+	f.StringArrayVarP(&s.policies, "policy", "", nil, "Refuse charts denied by this Rego policy file, evaluated with opa, can be repeated")
+	s.addRepoFlags(f)
+	return cmd
+}
+
+// serve handles requests until ctx is done or the command is interrupted
+func (s *serveCmd) serve(ctx context.Context) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt)
+	defer stop()
+
+	if s.token == "" && !isLoopback(s.listen) {
+		return fmt.Errorf("refusing to listen on %s without --token: anyone reaching it could push charts", s.listen)
+	}
+	ln, err := net.Listen("tcp", s.listen)
+	if err != nil {
+		return err
+	}
+	srv := &http.Server{Handler: s.handler(), ReadHeaderTimeout: 10 * time.Second}
+	errc := make(chan error, 1)
+	go func() { errc <- srv.Serve(ln) }()
+	s.log.Info("serving", "address", ln.Addr().String())
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+	shutdown, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	return srv.Shutdown(shutdown)
+}
+
+// isLoopback tells if the listen address only accepts local connections
+func isLoopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+func (s *serveCmd) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok\n"))
+	})
+	mux.HandleFunc("/push", s.handlePush)
+	return mux
+}
+
+// handlePush pushes the chart of the request, see newServeCmd
+func (s *serveCmd) handlePush(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeServeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+	if s.token != "" {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+			writeServeError(w, http.StatusUnauthorized, errors.New("unauthorized"))
+			return
+		}
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, s.maxUpload<<20)
+	if err := r.ParseMultipartForm(maxServeMemory); err != nil {
+		var mbe *http.MaxBytesError
+		if errors.As(err, &mbe) {
+			writeServeError(w, http.StatusRequestEntityTooLarge, fmt.Errorf("request larger than %d MiB", s.maxUpload))
+			return
+		}
+		writeServeError(w, http.StatusBadRequest, fmt.Errorf("invalid form: %s", err))
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+	repo := r.FormValue("repo")
+	if repo == "" {
+		writeServeError(w, http.StatusBadRequest, errors.New("missing repo"))
+		return
+	}
+	if err := s.allowRepo(repo); err != nil {
+		writeServeError(w, http.StatusForbidden, err)
+		return
+	}
+	force := false
+	if v := r.FormValue("force"); v != "" {
+		var err error
+		if force, err = strconv.ParseBool(v); err != nil {
+			writeServeError(w, http.StatusBadRequest, fmt.Errorf("invalid force: %s", err))
+			return
+		}
+	}
+
+	tmp, err := tmpdir.New("helm-push-serve-")
+	if err != nil {
+		writeServeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	defer os.RemoveAll(tmp)
+	chartPath, err := saveFormFile(r, "chart", tmp, "")
+	if err != nil {
+		writeServeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if _, _, err := r.FormFile("prov"); err == nil {
+		if _, err := saveFormFile(r, "prov", tmp, filepath.Base(chartPath)+".prov"); err != nil {
+			writeServeError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.repoName = repo
+	s.forceUpload = force
+	s.results = nil
+	if err := s.pushChart(chartPath); err != nil {
+		writeServeError(w, serveStatus(err), err)
+		return
+	}
+	s.notifyWebhooks()
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(serveResult{
+		Name:    s.result.name,
+		Version: s.result.version,
+		Digest:  s.result.digest,
+		Repo:    s.result.url,
+	})
+}
+
+// allowRepo checks that the credentials of the server can be sent to repo:
+// repository names are resolved from the local repository list or the
+// configuration, URLs must be configured or on one of --allow-host
+func (s *serveCmd) allowRepo(repo string) error {
+	if !isRepoURL(repo) {
+		return nil
+	}
+	if s.config.HasRepository(repo) {
+		return nil
+	}
+	u, err := neturl.Parse(repo)
+	if err != nil {
+		return fmt.Errorf("invalid repo: %s", err)
+	}
+	for _, host := range s.allowHosts {
+		if strings.EqualFold(host, u.Host) || strings.EqualFold(host, u.Hostname()) {
+			return nil
+		}
+	}
+	return fmt.Errorf("repository host %s is not allowed, see --allow-host", u.Host)
+}
+
+// saveFormFile writes the file field of the request to dir, as name or
+// the base name of the uploaded file
+func saveFormFile(r *http.Request, field, dir, name string) (string, error) {
+	file, header, err := r.FormFile(field)
+	if errors.Is(err, http.ErrMissingFile) {
+		return "", fmt.Errorf("missing %s file", field)
+	}
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	if name == "" {
+		// The package name is only used in logs and hints
+		if name = filepath.Base(header.Filename); !strings.HasSuffix(name, ".tgz") {
+			name = "chart.tgz"
+		}
+	}
+	path := filepath.Join(dir, name)
+	return path, writeFormFile(path, file)
+}
+
+// writeFormFile copies an uploaded file to path
+func writeFormFile(path string, file multipart.File) error {
+	out, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, file); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// serveStatus maps push errors to the response status: conflicts, locked
+// versions included, are passed through, other repository errors are gateway errors and the
+// rest are refused charts
+func serveStatus(err error) int {
+	var se *cm.StatusError
+	var le *push.LockedError
+	switch {
+	case errors.As(err, &le):
+		return http.StatusConflict
+	case errors.As(err, &se) && se.StatusCode == http.StatusConflict:
+		return http.StatusConflict
+	case errors.As(err, &se):
+		return http.StatusBadGateway
+	}
+	return http.StatusUnprocessableEntity
+}
+
+// writeServeError answers with a ChartMuseum-like JSON error
+func writeServeError(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": redact.Error(err).Error()})
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/IxDay/helm-push-cloudflare-access/pkg/chartmuseumtest"
+	"github.com/IxDay/helm-push-cloudflare-access/pkg/config"
+	"github.com/spf13/cobra"
+)
+
+func TestServeCmd(t *testing.T) {
+	chart, err := ioutil.ReadFile(testTarballPath)
+	if err != nil {
+		t.Fatal("unexpected error reading test tarball", err)
+	}
+	repo := chartmuseumtest.NewServer(chartmuseumtest.RequireAccess("my-id", "my-secret"))
+	defer repo.Close()
+	os.Unsetenv("HELM_REPO_CONTEXT_PATH")
+
+	s := &serveCmd{pushCmd: &pushCmd{clientID: "my-id", clientSecret: "my-secret"}, token: "my-token", allowHosts: []string{"example.com", repo.Listener.Addr().String()}, maxUpload: 1}
+	cmd := &cobra.Command{}
+	cmd.SetOut(ioutil.Discard)
+	cmd.SetErr(ioutil.Discard)
+	if err := s.setup(cmd); err != nil {
+		t.Fatalf("unexpected error setting up command: %s", err)
+	}
+	ts := httptest.NewServer(s.handler())
+	defer ts.Close()
+
+	post := func(token string, fields map[string]string, chart []byte) (int, map[string]string) {
+		body := &bytes.Buffer{}
+		mw := multipart.NewWriter(body)
+		for k, v := range fields {
+			mw.WriteField(k, v)
+		}
+		fw, _ := mw.CreateFormFile("chart", "mychart-0.1.0.tgz")
+		fw.Write(chart)
+		mw.Close()
+		req, _ := http.NewRequest("POST", ts.URL+"/push", body)
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("unexpected error posting chart: %s", err)
+		}
+		defer resp.Body.Close()
+		out := map[string]string{}
+		json.NewDecoder(resp.Body).Decode(&out)
+		return resp.StatusCode, out
+	}
+
+	if code, _ := post("wrong", map[string]string{"repo": repo.URL}, chart); code != 401 {
+		t.Errorf("expected 401 with a wrong token, got %d", code)
+	}
+	if code, _ := post("my-token", nil, chart); code != 400 {
+		t.Errorf("expected 400 without repo, got %d", code)
+	}
+	code, out := post("my-token", map[string]string{"repo": repo.URL}, chart)
+	if code != 201 {
+		t.Fatalf("expected 201, got %d: %v", code, out)
+	}
+	if out["name"] != "mychart" || out["version"] != "0.1.0" || out["digest"] == "" || out["repo"] != repo.URL {
+		t.Errorf("unexpected push result %v", out)
+	}
+	if code, out := post("my-token", map[string]string{"repo": repo.URL}, chart); code != 409 || out["error"] == "" {
+		t.Errorf("expected 409 for an existing version, got %d: %v", code, out)
+	}
+	if code, _ := post("my-token", map[string]string{"repo": repo.URL, "force": "true"}, chart); code != 201 {
+		t.Errorf("expected 201 with force, got %d", code)
+	}
+
+	// The credentials are only sent to allowed hosts and configured
+	// repositories
+	attacker := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected request to a host not allowed: %s", r.URL)
+	}))
+	defer attacker.Close()
+	if code, _ := post("my-token", map[string]string{"repo": attacker.URL}, chart); code != 403 {
+		t.Errorf("expected 403 for a host not allowed, got %d", code)
+	}
+	if err := s.allowRepo("https://example.com/charts"); err != nil {
+		t.Errorf("unexpected error for an allowed host: %s", err)
+	}
+	s.config.Repositories = map[string]config.Repository{"cm://charts.internal.com/stable": {}}
+	if err := s.allowRepo("https://charts.internal.com/stable/"); err != nil {
+		t.Errorf("unexpected error for a configured repository: %s", err)
+	}
+	if err := s.allowRepo("chartmuseum"); err != nil {
+		t.Errorf("unexpected error for a repository name: %s", err)
+	}
+
+	if code, _ := post("my-token", map[string]string{"repo": repo.URL}, make([]byte, 2<<20)); code != 413 {
+		t.Errorf("expected 413 for a request too large, got %d", code)
+	}
+
+	if isLoopback(":8080") || !isLoopback("127.0.0.1:8080") || !isLoopback("localhost:8080") {
+		t.Error("unexpected loopback detection")
+	}
+	s.token = ""
+	s.listen = "0.0.0.0:0"
+	if err := s.serve(context.Background()); err == nil {
+		t.Error("expected error listening on all interfaces without token, instead got nil")
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/IxDay/helm-push-cloudflare-access/pkg/helm"
+)
+
+// signature returns the chart package to upload along with its provenance
+// file, if any. With --sign the package is signed, through gpg-agent when
+// the keyring is a GnuPG keybox, otherwise a pushed .tgz comes with the
+// .prov file next to it.
+func (p *pushCmd) signature(packaged string, modified bool) (string, string, error) {
+	if p.sign {
+		stop := p.track("signing")
+		defer stop()
+		// Keyboxes hold no secret key, gpg-agent does
+		if helm.IsKeybox(p.keyring) {
+			prov, err := helm.SignChartPackageWithGPG(packaged, p.keyring, p.signKey, p.passphraseFile)
+			return packaged, prov, err
+		}
+		prov, err := helm.SignChartPackage(packaged, p.keyring, p.signKey, p.passphrase)
+		return packaged, prov, err
+	}
+	if strings.HasSuffix(p.chartName, ".tgz") {
+		prov := p.chartName + ".prov"
+		if _, err := os.Stat(prov); err == nil {
+			// Repackaging would void the signature, push the package as is
+			if !modified {
+				return p.chartName, prov, nil
+			}
+			p.log.Warn("ignoring provenance file of modified chart", "prov", prov)
+		}
+	}
+	return packaged, "", nil
+}
+
+// checkSignature enforces the require_signature policy of the repository
+func (p *pushCmd) checkSignature(chartPath, provPath string) error {
+	if provPath == "" {
+		return fmt.Errorf("repository %s requires signed charts: use --sign, or push a .tgz along with its .prov file", p.repoName)
+	}
+	if _, err := helm.VerifyChartPackage(chartPath, provPath, p.keyring); err != nil {
+		return fmt.Errorf("repository %s requires signed charts, invalid provenance: %s", p.repoName, err)
+	}
+	return nil
+}
+
+// passphrase returns the passphrase of the signing key from
+// --passphrase-file or $HELM_KEY_PASSPHRASE
+func (p *pushCmd) passphrase(name string) ([]byte, error) {
+	if p.passphraseFile != "" {
+		b, err := ioutil.ReadFile(p.passphraseFile)
+		if err != nil {
+			return nil, err
+		}
+		return []byte(strings.TrimRight(string(b), "\r\n")), nil
+	}
+	if v, ok := os.LookupEnv("HELM_KEY_PASSPHRASE"); ok {
+		return []byte(v), nil
+	}
+	return nil, errors.New("the signing key is encrypted: provide its passphrase with --passphrase-file or $HELM_KEY_PASSPHRASE")
+}
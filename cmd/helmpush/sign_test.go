@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/IxDay/helm-push-cloudflare-access/pkg/chartmuseumtest"
+	"helm.sh/helm/v3/pkg/provenance"
+)
+
+func TestPushCmdRequireSignature(t *testing.T) {
+	// Signed packages are pushed twice as mychart-0.1.0
+	ts := chartmuseumtest.NewServer(chartmuseumtest.AllowOverwrite(true))
+	defer ts.Close()
+
+	tmp, err := ioutil.TempDir("", "helm-push-test")
+	if err != nil {
+		t.Fatal("unexpected error creating temp test dir", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	configPath := filepath.Join(tmp, "push.yaml")
+	ioutil.WriteFile(configPath, []byte("repositories:\n  "+ts.URL+":\n    require_signature: true\n"), 0600)
+	push := func(chart string, flags map[string]string) error {
+		args := []string{chart, ts.URL}
+		cmd := newPushCmd(args)
+		cmd.Flags().Set("config", configPath)
+		cmd.Flags().Set("context-path", "/")
+		cmd.Flags().Set("keyring", testSecretKeyringPath)
+		for k, v := range flags {
+			cmd.Flags().Set(k, v)
+		}
+		return cmd.RunE(cmd, args)
+	}
+
+	// Unsigned chart
+	if err := push(testTarballPath, nil); err == nil || !strings.Contains(err.Error(), "requires signed charts") {
+		t.Errorf("expected signature policy error, got %v", err)
+	}
+	if len(ts.Charts()) != 0 {
+		t.Error("expected nothing to be uploaded for an unsigned chart")
+	}
+
+	// Signed while pushing
+	if err := push(testTarballPath, map[string]string{"sign": "true", "key": "helm-test"}); err != nil {
+		t.Fatalf("unexpected error pushing signed chart: %s", err)
+	}
+	pushed, ok := ts.Chart("mychart", "0.1.0")
+	if !ok || pushed.Provenance == nil {
+		t.Fatalf("expected chart and provenance to be uploaded, got %+v", ts.Charts())
+	}
+	if !bytes.Contains(pushed.Provenance, []byte("BEGIN PGP SIGNATURE")) {
+		t.Errorf("unexpected provenance file %s", pushed.Provenance)
+	}
+
+	// Package signed beforehand, pushed as is
+	chart, _ := ioutil.ReadFile(testTarballPath)
+	chartPath := filepath.Join(tmp, "mychart-0.1.0.tgz")
+	ioutil.WriteFile(chartPath, chart, 0600)
+	signer, err := provenance.NewFromKeyring(testSecretKeyringPath, "helm-test")
+	if err != nil {
+		t.Fatal("unexpected error loading test key", err)
+	}
+	prov, err := signer.ClearSign(chartPath)
+	if err != nil {
+		t.Fatal("unexpected error signing test tarball", err)
+	}
+	ioutil.WriteFile(chartPath+".prov", []byte(prov), 0600)
+	if err := push(chartPath, nil); err != nil {
+		t.Fatalf("unexpected error pushing signed package: %s", err)
+	}
+	if pushed, _ = ts.Chart("mychart", "0.1.0"); !bytes.Equal(pushed.Package, chart) || string(pushed.Provenance) != prov {
+		t.Error("expected the signed package and its provenance to be uploaded unchanged")
+	}
+
+	// Modified package, its provenance no longer applies
+	if err := push(chartPath, map[string]string{"version": "0.2.0"}); err == nil {
+		t.Error("expected signature policy error pushing a modified package, instead got nil")
+	}
+	if _, ok := ts.Chart("mychart", "0.2.0"); ok {
+		t.Error("expected the modified package not to be uploaded")
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"text/tabwriter"
+	"time"
+)
+
+type (
+	// stats records the duration of each phase of a run, a nil *stats
+	// is valid and records nothing
+	stats struct {
+		start  time.Time
+		phases []phase
+	}
+
+	phase struct {
+		name     string
+		duration time.Duration
+	}
+)
+
+func newStats() *stats {
+	return &stats{start: time.Now()}
+}
+
+// track starts timing the named phase, the returned function stops it
+func (s *stats) track(name string) func() {
+	if s == nil {
+		return func() {}
+	}
+	start := time.Now()
+	return func() {
+		s.record(name, time.Since(start))
+	}
+}
+
+// record adds the named phase, timed by the caller
+func (s *stats) record(name string, duration time.Duration) {
+	if s == nil {
+		return
+	}
+	s.phases = append(s.phases, phase{name: name, duration: duration})
+}
+
+// total returns the time elapsed since the stats were created
+func (s *stats) total() time.Duration {
+	return time.Since(s.start)
+}
+
+// print writes the timing breakdown as a table
+func (s *stats) print(w io.Writer) {
+	if s == nil {
+		return
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "PHASE\tDURATION")
+	for _, p := range s.phases {
+		fmt.Fprintf(tw, "%s\t%s\n", p.name, p.duration.Round(time.Millisecond))
+	}
+	fmt.Fprintf(tw, "total\t%s\n", s.total().Round(time.Millisecond))
+	tw.Flush()
+}
+
+// log emits the timing breakdown as a single structured record
+func (s *stats) log(logger *slog.Logger) {
+	if s == nil {
+		return
+	}
+	attrs := make([]any, 0, len(s.phases))
+	for _, p := range s.phases {
+		attrs = append(attrs, slog.Float64(p.name, p.duration.Seconds()))
+	}
+	logger.Info("timing summary",
+		slog.Group("phases", attrs...),
+		slog.Float64("total", s.total().Seconds()),
+	)
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestStats(t *testing.T) {
+	// A nil stats records nothing and does not panic
+	var disabled *stats
+	disabled.track("upload")()
+	disabled.print(&bytes.Buffer{})
+
+	s := newStats()
+	s.track("packaging")()
+	s.track("upload")()
+	if len(s.phases) != 2 || s.phases[0].name != "packaging" || s.phases[1].name != "upload" {
+		t.Fatalf("unexpected phases recorded: %v", s.phases)
+	}
+
+	var buf bytes.Buffer
+	s.print(&buf)
+	for _, expected := range []string{"PHASE", "packaging", "upload", "total"} {
+		if !strings.Contains(buf.String(), expected) {
+			t.Errorf("expected table to contain %q, got:\n%s", expected, buf.String())
+		}
+	}
+
+	buf.Reset()
+	logger, err := newLogger(&buf, "json", "info")
+	if err != nil {
+		t.Fatalf("unexpected error creating logger: %s", err)
+	}
+	s.log(logger)
+	var record struct {
+		Phases map[string]float64 `json:"phases"`
+		Total  *float64           `json:"total"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("expected a json record, got %q: %s", buf.String(), err)
+	}
+	if _, ok := record.Phases["upload"]; !ok || record.Total == nil {
+		t.Errorf("unexpected timing record: %s", buf.String())
+	}
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	cm "github.com/IxDay/helm-push-cloudflare-access/pkg/chartmuseum"
+	"github.com/IxDay/helm-push-cloudflare-access/pkg/helm"
+	"github.com/IxDay/helm-push-cloudflare-access/pkg/hints"
+	"github.com/IxDay/helm-push-cloudflare-access/pkg/push"
+	"github.com/IxDay/helm-push-cloudflare-access/pkg/redact"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+type (
+	// statusRow is a setting in effect and where its value came from
+	statusRow struct {
+		setting string
+		value   string
+		source  string
+	}
+
+	// serverInfo is the body ChartMuseum serves on /info
+	serverInfo struct {
+		Version string `json:"version"`
+	}
+)
+
+func newStatusCmd() *cobra.Command {
+	p := &pushCmd{}
+	cmd := &cobra.Command{
+		Use:   "status <repo>",
+		Short: "Show the effective configuration of a chart repository",
+		Long: `Show how the plugin reaches a chart repository (name or URL): the resolved
+URL, scheme, context path and authentication in effect along with where each
+value came from (flag, environment or configuration file), the server version
+and the timestamp of the last known index.`,
+		Example: `  $ helm push status chartmuseum
+  $ helm push status https://my.chart.repo.com --client-id "$ID"`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) (err error) {
+			// Errors are printed by cobra, make sure they leak no secret
+			defer func() { err = redact.Error(err) }()
+
+			if err := p.setup(cmd); err != nil {
+				return err
+			}
+			p.repoName = args[0]
+			return hints.Annotate(p.status(cmd.Flags()))
+		},
+	}
+	p.addRepoFlags(cmd.Flags())
+	return cmd
+}
+
+// status prints the settings used to reach the repository, the server is
+// queried for its version and index, failing to do so is reported in the
+// table and returned once it is printed
+func (p *pushCmd) status(flags *pflag.FlagSet) error {
+	isURL := isRepoURL(p.repoName)
+	repo, err := p.getRepo()
+	if err != nil {
+		return err
+	}
+	url := p.repoURL(repo)
+	rows := []statusRow{{setting: "repository", value: p.repoName}}
+	if isURL {
+		rows = append(rows, statusRow{"url", url, "argument"})
+	} else {
+		rows = append(rows, statusRow{"url", url, "repository list"})
+	}
+	scheme := strings.SplitN(url, "://", 2)[0]
+	switch {
+	case !strings.HasPrefix(repo.Config.URL, "cm://"):
+		rows = append(rows, statusRow{"scheme", scheme, "url"})
+	case os.Getenv("HELM_REPO_USE_HTTP") != "":
+		rows = append(rows, statusRow{"scheme", scheme, "env $HELM_REPO_USE_HTTP"})
+	default:
+		rows = append(rows, statusRow{"scheme", scheme, "default"})
+	}
+
+	cfg := p.config.Repository(p.repoName, url)
+	clientID, clientSecret := p.credentials(cfg, url)
+	idSource := valueSource(flags, "client-id", "HELM_REPO_CLIENT_ID", p.clientID == "" && cfg.ClientID != "")
+	secretSource := valueSource(flags, "client-secret", "HELM_REPO_CLIENT_SECRET", p.clientSecret == "" && cfg.ClientSecret != "")
+	pinSource := valueSource(flags, "pin-sha256", "HELM_REPO_PIN_SHA256", len(p.pins) == 0 && len(cfg.PinSHA256) > 0)
+	contextSource := valueSource(flags, "context-path", "HELM_REPO_CONTEXT_PATH", false)
+	if m, ok := p.netrcMachine(url); ok {
+		if idSource == "" && clientID != "" && clientID == m.Login {
+			idSource = "netrc"
+		}
+		if secretSource == "" && clientSecret != "" && clientSecret == m.Password {
+			secretSource = "netrc"
+		}
+	}
+	client, err := p.newClient(url)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	index, indexErr := helm.GetIndexByRepo(repo, p.pusher(client).DownloadIndex)
+	contextPath := p.contextPath
+	if contextSource == "" {
+		contextSource = "default"
+		if indexErr == nil && index.ServerInfo.ContextPath != "" {
+			contextPath, contextSource = index.ServerInfo.ContextPath, "index"
+			client.Option(cm.ContextPath(contextPath))
+		}
+	}
+	if contextPath == "" {
+		contextPath = "/"
+	}
+	rows = append(rows, statusRow{"context path", contextPath, contextSource})
+
+	rows = append(rows, statusRow{"auth", authMethod(clientID, clientSecret, p.certFile, cfg.Auth, p.signingKey != "" || cfg.Signing.Key != ""), ""})
+	if clientID != "" {
+		rows = append(rows, statusRow{"client id", clientID, idSource})
+	}
+	if clientSecret != "" {
+		rows = append(rows, statusRow{"client secret", redact.Redacted, secretSource})
+	}
+	if p.certFile != "" {
+		rows = append(rows, statusRow{"client cert", p.certFile, valueSource(flags, "cert-file", "HELM_REPO_CERT_FILE", false)})
+		rows = append(rows, statusRow{"client key", p.keyFile, valueSource(flags, "key-file", "HELM_REPO_KEY_FILE", false)})
+	}
+	if p.caFile != "" {
+		rows = append(rows, statusRow{"ca file", p.caFile, valueSource(flags, "ca-file", "HELM_REPO_CA_FILE", false)})
+	}
+	if p.insecureSkipVerify {
+		rows = append(rows, statusRow{"insecure", "true", valueSource(flags, "insecure", "HELM_REPO_INSECURE", false)})
+	}
+	if pinSource != "" {
+		pins := p.pins
+		if len(pins) == 0 {
+			pins = cfg.PinSHA256
+		}
+		rows = append(rows, statusRow{"pins", strings.Join(pins, ", "), pinSource})
+	}
+
+	info, err := p.serverInfo(client)
+	if err != nil {
+		errs = append(errs, err)
+		rows = append(rows, statusRow{"server version", "unavailable", err.Error()})
+	} else {
+		rows = append(rows, statusRow{"server version", info.Version, "/info"})
+	}
+
+	indexSource := "server"
+	if repo.Config.Name != "" {
+		indexSource = "cache"
+	}
+	if indexErr != nil {
+		errs = append(errs, indexErr)
+		rows = append(rows, statusRow{"index", "unavailable", indexErr.Error()})
+	} else {
+		rows = append(rows, statusRow{"index", indexSummary(index), indexSource})
+	}
+
+	printStatus(p.out, rows)
+	if len(errs) > 0 {
+		return errs[0]
+	}
+	return nil
+}
+
+// serverInfo queries the server for its version
+func (p *pushCmd) serverInfo(client *cm.Client) (*serverInfo, error) {
+	resp, err := client.GetInfo()
+	if err != nil {
+		return nil, err
+	}
+	b, err := push.ReadResponse(cm.OpInfo, resp)
+	if err != nil {
+		return nil, err
+	}
+	info := &serverInfo{}
+	if err := json.Unmarshal(b, info); err != nil {
+		return nil, fmt.Errorf("could not parse server info: %s", err)
+	}
+	return info, nil
+}
+
+// valueSource tells where the value of a setting came from: the flag, the
+// environment variable or the configuration file, empty meaning unset
+func valueSource(flags *pflag.FlagSet, flag, env string, fromConfig bool) string {
+	switch {
+	case flags.Changed(flag):
+		return "flag --" + flag
+	case os.Getenv(env) != "":
+		return "env $" + env
+	case fromConfig:
+		return "config"
+	}
+	return ""
+}
+
+// authMethod describes the authentication sent along the requests
+func authMethod(clientID, clientSecret, certFile string, auth cm.Auth, signed bool) string {
+	var methods []string
+	switch {
+	case auth.Scheme == cm.AuthBearer && clientSecret != "":
+		methods = append(methods, "bearer token")
+	case auth.Scheme == cm.AuthBasic && (clientID != "" || clientSecret != ""):
+		methods = append(methods, "basic auth")
+	case auth.Scheme != cm.AuthBearer && auth.Scheme != cm.AuthBasic && clientID != "":
+		methods = append(methods, "Cloudflare Access service token")
+	}
+	if certFile != "" {
+		methods = append(methods, "TLS client certificate")
+	}
+	if signed {
+		methods = append(methods, "HMAC request signing")
+	}
+	if len(methods) == 0 {
+		return "none"
+	}
+	return strings.Join(methods, ", ")
+}
+
+// indexSummary returns the generation time and the chart count of index
+func indexSummary(index *helm.Index) string {
+	if index.IndexFile == nil {
+		return "empty"
+	}
+	generated := "unknown date"
+	if !index.Generated.IsZero() {
+		generated = index.Generated.UTC().Format(time.RFC3339)
+	}
+	return fmt.Sprintf("generated %s, %d charts", generated, len(index.Entries))
+}
+
+// printStatus writes the settings as a table
+func printStatus(w io.Writer, rows []statusRow) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "SETTING\tVALUE\tSOURCE")
+	for _, r := range rows {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", r.setting, r.value, r.source)
+	}
+	tw.Flush()
+}
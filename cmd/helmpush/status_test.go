@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/IxDay/helm-push-cloudflare-access/pkg/chartmuseumtest"
+)
+
+func TestStatusCmd(t *testing.T) {
+	ts := chartmuseumtest.NewServer(chartmuseumtest.ContextPath("/cm"), chartmuseumtest.RequireAccess("my-id", "my-secret"))
+	defer ts.Close()
+	addChart(t, ts, "mychart", "0.1.0")
+
+	tmp, err := ioutil.TempDir("", "helm-push-test")
+	if err != nil {
+		t.Fatal("unexpected error creating temp test dir", err)
+	}
+	defer os.RemoveAll(tmp)
+	configPath := filepath.Join(tmp, "push.yaml")
+	ioutil.WriteFile(configPath, []byte("repositories:\n  "+ts.RepoURL()+":\n    client_secret: my-secret\n"), 0600)
+
+	os.Unsetenv("HELM_REPO_CONTEXT_PATH")
+	os.Unsetenv("HELM_REPO_CLIENT_SECRET")
+	os.Setenv("HELM_REPO_CLIENT_ID", "my-id")
+	defer os.Unsetenv("HELM_REPO_CLIENT_ID")
+
+	status := func(args ...string) (string, error) {
+		args = append([]string{"status", ts.RepoURL(), "--config", configPath}, args...)
+		cmd := newPushCmd(args)
+		cmd.SetArgs(args)
+		var out bytes.Buffer
+		cmd.SetOut(&out)
+		cmd.SetErr(ioutil.Discard)
+		err := cmd.Execute()
+		return out.String(), err
+	}
+
+	out, err := status()
+	if err != nil {
+		t.Fatalf("unexpected error: %s\n%s", err, out)
+	}
+	for _, expected := range []string{
+		`url\s+` + ts.RepoURL() + `\s+argument`,
+		`scheme\s+http\s+url`,
+		`context path\s+/cm\s+index`,
+		`auth\s+Cloudflare Access service token`,
+		`client id\s+my-id\s+env \$HELM_REPO_CLIENT_ID`,
+		`client secret\s+REDACTED\s+config`,
+		`server version\s+chartmuseumtest\s+/info`,
+		`index\s+generated \S+, 1 charts\s+server`,
+	} {
+		if !regexp.MustCompile(expected).MatchString(out) {
+			t.Errorf("expected output to match %q, got:\n%s", expected, out)
+		}
+	}
+	if strings.Contains(out, "my-secret") {
+		t.Errorf("expected client secret not to be output, got:\n%s", out)
+	}
+
+	// Flags take precedence and server errors are reported
+	out, err = status("--client-secret", "wrong-secret", "--context-path", "/cm")
+	if err == nil {
+		t.Error("expected error with rejected credentials, instead got nil")
+	}
+	for _, expected := range []string{
+		`context path\s+/cm\s+flag --context-path`,
+		`client secret\s+REDACTED\s+flag --client-secret`,
+		`server version\s+unavailable\s+403: .*Forbidden`,
+	} {
+		if !regexp.MustCompile(expected).MatchString(out) {
+			t.Errorf("expected output to match %q, got:\n%s", expected, out)
+		}
+	}
+	// Credentials from .netrc
+	netrcPath := filepath.Join(tmp, ".netrc")
+	ioutil.WriteFile(netrcPath, []byte("machine 127.0.0.1\n  login my-id\n  password my-secret\n"), 0600)
+	ioutil.WriteFile(configPath, nil, 0600)
+	os.Setenv("NETRC", netrcPath)
+	defer os.Unsetenv("NETRC")
+	os.Unsetenv("HELM_REPO_CLIENT_ID")
+	out, err = status()
+	if err != nil {
+		t.Fatalf("unexpected error: %s\n%s", err, out)
+	}
+	for _, expected := range []string{
+		`client id\s+my-id\s+netrc`,
+		`client secret\s+REDACTED\s+netrc`,
+		`server version\s+chartmuseumtest\s+/info`,
+	} {
+		if !regexp.MustCompile(expected).MatchString(out) {
+			t.Errorf("expected output to match %q, got:\n%s", expected, out)
+		}
+	}
+	// .netrc is ignored in CI mode
+	os.Setenv("HELM_PUSH_CI", "auto")
+	defer os.Unsetenv("HELM_PUSH_CI")
+	out, _ = status()
+	if strings.Contains(out, "netrc") || strings.Contains(out, "my-id") {
+		t.Errorf("expected .netrc to be ignored in CI mode, got:\n%s", out)
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	"github.com/IxDay/helm-push-cloudflare-access/pkg/git"
+	"github.com/Masterminds/semver/v3"
+)
+
+// Version suffixes derived from the build, see --version-suffix, any
+// other suffix is appended as is
+const (
+	suffixGitSHA    = "git-sha"
+	suffixTimestamp = "timestamp"
+)
+
+// suffixVersion appends the pre-release identifier of suffix to version,
+// the git commit is the one checked out where the chart lies
+func suffixVersion(version, suffix, chart string, t time.Time) (string, error) {
+	id := suffix
+	switch suffix {
+	case suffixTimestamp:
+		id = t.UTC().Format("20060102150405")
+	case suffixGitSHA:
+		dir := chart
+		if filepath.Ext(dir) == ".tgz" {
+			dir = filepath.Dir(dir)
+		}
+		rev, err := git.Revision(dir)
+		if err != nil {
+			return "", fmt.Errorf("resolving git revision of %s: %s", chart, err)
+		}
+		// Prefixed like git describe, a numeric identifier can't start
+		// with 0 in semver
+		id = "g" + rev
+	}
+	return appendPrerelease(version, id)
+}
+
+// prereleaseID matches dot separated semver pre-release identifiers
+var prereleaseID = regexp.MustCompile(`^[0-9A-Za-z-]+(\.[0-9A-Za-z-]+)*$`)
+
+// validateSuffix checks that a literal suffix is a valid pre-release
+func validateSuffix(suffix string) error {
+	if suffix == suffixGitSHA || suffix == suffixTimestamp {
+		return nil
+	}
+	if !prereleaseID.MatchString(suffix) {
+		return fmt.Errorf("invalid version suffix %q, must be one of: %s, %s or a pre-release identifier", suffix, suffixGitSHA, suffixTimestamp)
+	}
+	return nil
+}
+
+// appendPrerelease appends id to the pre-release part of version, build
+// metadata is kept
+func appendPrerelease(version, id string) (string, error) {
+	v, err := semver.NewVersion(version)
+	if err != nil {
+		return "", fmt.Errorf("invalid chart version %q: %s", version, err)
+	}
+	if v.Prerelease() != "" {
+		id = v.Prerelease() + "." + id
+	}
+	suffixed, err := v.SetPrerelease(id)
+	if err != nil {
+		return "", err
+	}
+	return suffixed.Original(), nil
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/IxDay/helm-push-cloudflare-access/pkg/chartmuseumtest"
+)
+
+func TestSuffixVersion(t *testing.T) {
+	now := time.Date(2021, 1, 5, 10, 12, 43, 0, time.UTC)
+	tests := map[[2]string]string{
+		{"0.3.2", suffixTimestamp}:   "0.3.2-20210105101243",
+		{"0.3.2", "snapshot"}:        "0.3.2-snapshot",
+		{"1.0.0-rc.1", "snapshot.4"}: "1.0.0-rc.1.snapshot.4",
+		{"1.0.0+build", "nightly"}:   "1.0.0-nightly+build",
+		{"v1.0.0", suffixTimestamp}:  "v1.0.0-20210105101243",
+	}
+	for args, expected := range tests {
+		if v, err := suffixVersion(args[0], args[1], "", now); err != nil || v != expected {
+			t.Errorf("expected %s suffixed with %s to be %s, got %s, %v", args[0], args[1], expected, v, err)
+		}
+	}
+	if _, err := suffixVersion("latest", "snapshot", "", now); err == nil {
+		t.Error("expected error with invalid version, instead got nil")
+	}
+	for _, suffix := range []string{"snap_shot", "a..b", ".snapshot"} {
+		if err := validateSuffix(suffix); err == nil {
+			t.Errorf("expected error with suffix %q, instead got nil", suffix)
+		}
+	}
+	if err := validateSuffix(suffixGitSHA); err != nil {
+		t.Errorf("unexpected error validating %s: %s", suffixGitSHA, err)
+	}
+}
+
+func TestPushCmdVersionSuffixGit(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	ts := chartmuseumtest.NewServer()
+	defer ts.Close()
+
+	tmp, err := ioutil.TempDir("", "helm-push-test")
+	if err != nil {
+		t.Fatal("unexpected error creating temp test dir", err)
+	}
+	defer os.RemoveAll(tmp)
+	ioutil.WriteFile(filepath.Join(tmp, "Chart.yaml"), []byte("apiVersion: v2\nname: mychart\nversion: 0.1.0\n"), 0644)
+	git := func(args ...string) {
+		cmd := exec.Command("git", append([]string{"-C", tmp, "-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %s", args, out)
+		}
+	}
+	git("init", "-q")
+	git("add", ".")
+	git("commit", "-q", "-m", "init")
+
+	args := []string{tmp, ts.URL}
+	cmd := newPushCmd(args)
+	cmd.Flags().Set("context-path", "/")
+	cmd.Flags().Set("version-suffix", suffixGitSHA)
+	if err := cmd.RunE(cmd, args); err != nil {
+		t.Fatalf("unexpected error pushing chart: %s", err)
+	}
+	if charts := ts.Charts(); len(charts) != 1 || !regexp.MustCompile(`^0\.1\.0-g[0-9a-f]{7,}$`).MatchString(charts[0].Version) {
+		t.Errorf("unexpected chart versions uploaded %+v", charts)
+	}
+
+	cmd = newPushCmd(args)
+	cmd.Flags().Set("version-suffix", "snap_shot")
+	if err := cmd.RunE(cmd, args); err == nil {
+		t.Error("expected error with an invalid suffix, instead got nil")
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// durationBounds are the bucket bounds of the push duration histogram, in
+// seconds
+var durationBounds = []float64{1, 2.5, 5, 10, 30, 60, 120, 300, 600}
+
+// track times the named phase in both the stats summary and the trace,
+// the returned function ends it
+func (p *pushCmd) track(name string) func() {
+	start := time.Now()
+	return func() {
+		p.record(name, start, time.Since(start))
+	}
+}
+
+// record adds the named phase, timed by the caller, to both the stats
+// summary and the trace
+func (p *pushCmd) record(name string, start time.Time, duration time.Duration) {
+	span := p.telemetry.StartSpanAt(name, p.span, start)
+	if len(p.chartNames) > 1 {
+		name = p.chartName + "/" + name
+	}
+	p.stats.record(name, duration)
+	span.End(nil)
+}
+
+// endSpan closes the span of the current chart and records its metrics
+func (p *pushCmd) endSpan() {
+	if p.telemetry == nil {
+		return
+	}
+	p.span.End(p.result.err)
+
+	result := "success"
+	if p.result.err != nil {
+		result = "failure"
+	}
+	attrs := map[string]string{"repo": p.repoName, "result": result}
+	p.telemetry.Count("helm_push.pushes", 1, attrs)
+	p.telemetry.Histogram("helm_push.push.duration", "s", p.result.duration.Seconds(), durationBounds, attrs)
+}
+
+// flushTelemetry exports everything recorded, export failures never fail
+// the push
+func (p *pushCmd) flushTelemetry() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := p.telemetry.Shutdown(ctx); err != nil {
+		p.log.Warn("could not export telemetry", "error", err)
+	}
+}
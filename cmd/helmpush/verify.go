@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"path"
+
+	cm "github.com/IxDay/helm-push-cloudflare-access/pkg/chartmuseum"
+	"github.com/IxDay/helm-push-cloudflare-access/pkg/helm"
+	"github.com/IxDay/helm-push-cloudflare-access/pkg/push"
+)
+
+// Verification methods of downloaded charts
+const (
+	verifyProvenance = "provenance"
+	verifyCosign     = "cosign"
+)
+
+// verifyDownload checks the downloaded chart package data according to the
+// configured verification method, if any
+func (p *pushCmd) verifyDownload(client *cm.Client, filePath string, chart []byte) error {
+	switch p.verify {
+	case verifyProvenance:
+		return p.verifyProvenance(client, filePath, chart)
+	case verifyCosign:
+		return p.verifyCosign(client, filePath, chart)
+	}
+	return nil
+}
+
+func (p *pushCmd) verifyProvenance(client *cm.Client, filePath string, chart []byte) error {
+	prov, err := fetchSignatureFile(client, filePath+".prov")
+	if err != nil {
+		return fmt.Errorf("fetching provenance file of %s: %w", path.Base(filePath), err)
+	}
+	v, err := helm.VerifyChartData(path.Base(filePath), chart, prov, p.keyring)
+	if err != nil {
+		return fmt.Errorf("verifying %s: %w", path.Base(filePath), err)
+	}
+	for name := range v.SignedBy.Identities {
+		p.log.Debug("provenance verified", "chart", v.FileName, "signedBy", name)
+	}
+	return nil
+}
+
+func (p *pushCmd) verifyCosign(client *cm.Client, filePath string, chart []byte) error {
+	policy := p.config.Cosign
+	signature, err := fetchSignatureFile(client, filePath+".sig")
+	if err != nil {
+		return fmt.Errorf("fetching cosign signature of %s: %w", path.Base(filePath), err)
+	}
+	var certificate []byte
+	if policy.Keyless() {
+		if certificate, err = fetchSignatureFile(client, filePath+".pem"); err != nil {
+			return fmt.Errorf("fetching cosign certificate of %s: %w", path.Base(filePath), err)
+		}
+	}
+	if err := policy.VerifyBlob(chart, signature, certificate); err != nil {
+		return fmt.Errorf("verifying %s: %w", path.Base(filePath), err)
+	}
+	p.log.Debug("cosign signature verified", "chart", path.Base(filePath))
+	return nil
+}
+
+// fetchSignatureFile downloads a file stored next to a chart package
+func fetchSignatureFile(client *cm.Client, filePath string) ([]byte, error) {
+	resp, err := client.DownloadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	return push.ReadResponse(cm.OpDownload, resp)
+}
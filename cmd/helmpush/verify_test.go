@@ -0,0 +1,86 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/IxDay/helm-push-cloudflare-access/pkg/chartmuseumtest"
+	"helm.sh/helm/v3/pkg/provenance"
+)
+
+var (
+	testSecretKeyringPath = "../../testdata/pgp/helm-test-key.secret"
+	testPublicKeyringPath = "../../testdata/pgp/helm-test-key.pub"
+)
+
+func TestDownloadVerifyProvenance(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "helm-push-test")
+	if err != nil {
+		t.Fatal("unexpected error creating temp test dir", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	chart, err := ioutil.ReadFile(testTarballPath)
+	if err != nil {
+		t.Fatal("unexpected error reading test tarball", err)
+	}
+	chartPath := filepath.Join(tmp, "mychart-0.1.0.tgz")
+	ioutil.WriteFile(chartPath, chart, 0600)
+	signer, err := provenance.NewFromKeyring(testSecretKeyringPath, "helm-test")
+	if err != nil {
+		t.Fatal("unexpected error loading test key", err)
+	}
+	prov, err := signer.ClearSign(chartPath)
+	if err != nil {
+		t.Fatal("unexpected error signing test tarball", err)
+	}
+
+	ts := chartmuseumtest.NewServer()
+	defer ts.Close()
+	if _, err := ts.AddChart(chart, []byte(prov)); err != nil {
+		t.Fatal("unexpected error storing test tarball", err)
+	}
+	addChart(t, ts, "unsigned", "0.1.0")
+
+	os.Setenv("HELM_REPO_USE_HTTP", "true")
+	os.Unsetenv("HELM_REPO_CONTEXT_PATH")
+	os.Setenv("HELM_PUSH_VERIFY", "provenance")
+	os.Setenv("HELM_PUSH_KEYRING", testPublicKeyringPath)
+	defer os.Unsetenv("HELM_PUSH_VERIFY")
+	defer os.Unsetenv("HELM_PUSH_KEYRING")
+	baseURL := strings.Replace(ts.URL, "http://", "cm://", 1)
+
+	// Signed chart
+	args := []string{"", "", "", baseURL + "/charts/mychart-0.1.0.tgz"}
+	cmd := newPushCmd(args)
+	var out strings.Builder
+	cmd.SetOut(&out)
+	if err := cmd.RunE(cmd, args); err != nil {
+		t.Fatalf("unexpected error downloading signed chart: %s", err)
+	}
+	if out.String() != string(chart) {
+		t.Error("expected the chart to be written to stdout")
+	}
+
+	// Unsigned chart
+	args = []string{"", "", "", baseURL + "/charts/unsigned-0.1.0.tgz"}
+	cmd = newPushCmd(args)
+	out.Reset()
+	cmd.SetOut(&out)
+	if err := cmd.RunE(cmd, args); err == nil || !strings.Contains(err.Error(), "provenance") {
+		t.Errorf("expected provenance error downloading unsigned chart, got %v", err)
+	}
+	if out.Len() != 0 {
+		t.Error("expected nothing to be written for an unverified chart")
+	}
+
+	// Invalid method
+	os.Setenv("HELM_PUSH_VERIFY", "magic")
+	cmd = newPushCmd(args)
+	if err := cmd.RunE(cmd, args); err == nil {
+		t.Error("expected error with invalid verification method, instead got nil")
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/IxDay/helm-push-cloudflare-access/pkg/helm"
+	"github.com/IxDay/helm-push-cloudflare-access/pkg/hints"
+	"github.com/IxDay/helm-push-cloudflare-access/pkg/project"
+	"github.com/IxDay/helm-push-cloudflare-access/pkg/redact"
+	"github.com/IxDay/helm-push-cloudflare-access/pkg/tmpdir"
+	"github.com/spf13/cobra"
+	"helm.sh/helm/v3/pkg/provenance"
+)
+
+func newVerifyRemoteCmd() *cobra.Command {
+	p := &pushCmd{}
+	cmd := &cobra.Command{
+		Use:   "verify-remote <chart> [repo]",
+		Short: "Check that a pushed chart was built from the local sources",
+		Long: `Package the local chart (directory or .tgz) the way push does, and compare
+its digest with the one listed in the repository index for the same version.
+Packages are reproducible, set SOURCE_DATE_EPOCH to the value used when pushing
+if it was set then. The repository defaults to the one of the project
+configuration. The command fails when the digests differ or when the version is
+not in the repository.`,
+		Example: `  $ helm push verify-remote ./mychart chartmuseum
+  $ helm push verify-remote ./mychart https://my.chart.repo.com --version 0.3.2`,
+		Args: cobra.RangeArgs(1, 2),
+		RunE: func(cmd *cobra.Command, args []string) (err error) {
+			// Errors are printed by cobra, make sure they leak no secret
+			defer func() { err = redact.Error(err) }()
+
+			if err := p.setup(cmd); err != nil {
+				return err
+			}
+			p.chartName = args[0]
+			if len(args) == 2 {
+				p.repoName = args[1]
+			} else {
+				proj, err := p.projectConfig(p.chartName)
+				if err != nil {
+					return err
+				}
+				if p.repoName = proj.Repo; p.repoName == "" {
+					return fmt.Errorf("no repository given and no repo set in a %s file above %s", project.FileName, p.chartName)
+				}
+			}
+			return hints.Annotate(p.verifyRemote())
+		},
+	}
+	f := cmd.Flags()
+	f.StringVarP(&p.chartVersion, "version", "v", "", "Override chart version, as when pushing")
+	f.StringVarP(&p.appVersion, "app-version", "a", "", "Override app version, as when pushing")
+	f.StringVarP(&p.versionSuffix, "version-suffix", "", "", "Append a pre-release identifier to the chart version, as when pushing")
+	f.StringArrayVarP(&p.patches, "patch", "", nil, "Merge this patch file into Chart.yaml and values.yaml, as when pushing")
+	f.BoolVarP(&p.expandEnv, "expand-env", "", false, "Replace ${NAME} placeholders with environment variables, as when pushing")
+	f.BoolVarP(&p.changelog, "changelog", "", false, "Set the artifacthub.io/changes annotation, as when pushing")
+	f.StringVarP(&p.sbom, "sbom", "", "", "Embed an SBOM of the chart, one of: cyclonedx, spdx, as when pushing")
+	f.BoolVarP(&p.sbomImages, "sbom-images", "", false, "Include the container images in the SBOM, as when pushing")
+	p.addRepoFlags(f)
+	return cmd
+}
+
+// verifyRemote packages the local chart and compares its digest with the
+// one of the same version in the repository index
+func (p *pushCmd) verifyRemote() error {
+	repo, err := p.getRepo()
+	if err != nil {
+		return err
+	}
+	url := p.repoURL(repo)
+	client, err := p.newClient(url)
+	if err != nil {
+		return err
+	}
+
+	chart, modified, err := p.loadChart()
+	if err != nil {
+		return err
+	}
+	name, version := chart.Metadata.Name, chart.Metadata.Version
+
+	// An unmodified package is pushed as is along with its provenance file,
+	// see signature
+	local := p.chartName
+	if !strings.HasSuffix(local, ".tgz") || modified {
+		tmp, err := tmpdir.New("helm-push-")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(tmp)
+		if local, err = helm.CreateChartPackage(chart, tmp); err != nil {
+			return err
+		}
+	}
+	digest, err := provenance.DigestFile(local)
+	if err != nil {
+		return err
+	}
+
+	// The versions are always fetched from the server, the cached index
+	// could be stale
+	versions, err := p.pusher(client).Versions(name)
+	if err != nil {
+		return err
+	}
+	found := len(versions)
+	for i, v := range versions {
+		if v.Version == version {
+			found = i
+			break
+		}
+	}
+	if found == len(versions) {
+		return fmt.Errorf("chart %q version %q not found in %s", name, version, url)
+	}
+	entry := versions[found]
+	remote := strings.TrimPrefix(entry.Digest, "sha256:")
+	if remote == "" {
+		return fmt.Errorf("chart %q version %q has no digest in the index of %s", name, version, url)
+	}
+	if !strings.EqualFold(remote, digest) {
+		return fmt.Errorf("digest mismatch for %s-%s: repository has %s, local package is %s", name, version, remote, digest)
+	}
+	p.log.Info("digests match", "chart", name, "version", version, "digest", digest)
+	return nil
+}
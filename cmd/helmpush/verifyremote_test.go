@@ -0,0 +1,66 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/IxDay/helm-push-cloudflare-access/pkg/chartmuseumtest"
+)
+
+func TestVerifyRemoteCmd(t *testing.T) {
+	ts := chartmuseumtest.NewServer()
+	defer ts.Close()
+	chart, err := ioutil.ReadFile(testTarballPath)
+	if err != nil {
+		t.Fatal("unexpected error reading test tarball", err)
+	}
+	if _, err := ts.AddChart(chart, nil); err != nil {
+		t.Fatal("unexpected error storing test tarball", err)
+	}
+	os.Unsetenv("HELM_REPO_CONTEXT_PATH")
+
+	verify := func(args ...string) error {
+		args = append([]string{"verify-remote", testTarballPath, ts.URL}, args...)
+		cmd := newPushCmd(args)
+		cmd.SetArgs(args)
+		cmd.SetOut(ioutil.Discard)
+		cmd.SetErr(ioutil.Discard)
+		return cmd.Execute()
+	}
+
+	if err := verify(); err != nil {
+		t.Errorf("unexpected error verifying unmodified chart: %s", err)
+	}
+	if err := verify("--app-version", "9.9.9"); err == nil || !strings.Contains(err.Error(), "digest mismatch") {
+		t.Errorf("expected digest mismatch error, got %v", err)
+	}
+	if err := verify("--version", "2.0.0"); err == nil || !strings.Contains(err.Error(), `version "2.0.0" not found`) {
+		t.Errorf("expected version not found error, got %v", err)
+	}
+}
+
+func TestVerifyRemoteCmdSBOM(t *testing.T) {
+	ts := chartmuseumtest.NewServer()
+	defer ts.Close()
+	os.Unsetenv("HELM_REPO_CONTEXT_PATH")
+
+	args := []string{testTarballPath, ts.URL}
+	cmd := newPushCmd(args)
+	cmd.Flags().Set("context-path", "/")
+	cmd.Flags().Set("sbom", "spdx")
+	if err := cmd.RunE(cmd, args); err != nil {
+		t.Fatalf("unexpected error pushing chart: %s", err)
+	}
+
+	// the SBOM generated again is the one pushed
+	args = []string{"verify-remote", testTarballPath, ts.URL, "--sbom", "spdx"}
+	cmd = newPushCmd(args)
+	cmd.SetArgs(args)
+	cmd.SetOut(ioutil.Discard)
+	cmd.SetErr(ioutil.Discard)
+	if err := cmd.Execute(); err != nil {
+		t.Errorf("unexpected error verifying chart pushed with an sbom: %s", err)
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/IxDay/helm-push-cloudflare-access/pkg/watch"
+)
+
+// devVersion appends a dev prerelease identifier derived from t to
+// version, later pushes get higher versions
+func devVersion(version string, t time.Time) (string, error) {
+	return appendPrerelease(version, "dev."+t.UTC().Format("20060102150405"))
+}
+
+// watch pushes the chart directory every time it changes until ctx is
+// done or the command is interrupted, see --watch. Failed pushes are
+// logged and the next change is waited for.
+func (p *pushCmd) watch(ctx context.Context) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt)
+	defer stop()
+
+	if len(p.chartNames) != 1 {
+		return errors.New("--watch requires a single chart directory")
+	}
+	if fi, err := os.Stat(p.chartName); err != nil || !fi.IsDir() {
+		return fmt.Errorf("--watch requires a chart directory, %s is not one", p.chartName)
+	}
+	push := func() {
+		if err := p.publish(p.pushAll); err != nil {
+			p.log.Error("push failed", "chart", p.chartName, "error", err)
+		}
+	}
+	opts := watch.Options{Debounce: p.watchDebounce}
+	if p.dependencyUpdate {
+		// rewritten by each dependency update, the dependencies are
+		// declared in Chart.yaml or requirements.yaml
+		opts.Ignore = []string{"charts", "Chart.lock", "requirements.lock"}
+	}
+	push()
+	p.log.Info("watching chart for changes", "chart", p.chartName)
+	return watch.Watch(ctx, p.chartName, opts, push)
+}
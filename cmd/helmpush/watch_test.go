@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/IxDay/helm-push-cloudflare-access/pkg/chartmuseumtest"
+)
+
+func TestDevVersion(t *testing.T) {
+	now := time.Date(2021, 1, 5, 10, 12, 43, 0, time.UTC)
+	tests := map[string]string{
+		"0.3.2":       "0.3.2-dev.20210105101243",
+		"v1.0.0":      "v1.0.0-dev.20210105101243",
+		"1.0.0-rc.1":  "1.0.0-rc.1.dev.20210105101243",
+		"1.0.0+build": "1.0.0-dev.20210105101243+build",
+	}
+	for version, expected := range tests {
+		if v, err := devVersion(version, now); err != nil || v != expected {
+			t.Errorf("expected dev version of %s to be %s, got %s, %v", version, expected, v, err)
+		}
+	}
+	if _, err := devVersion("latest", now); err == nil {
+		t.Error("expected error with invalid version, instead got nil")
+	}
+}
+
+func TestPushCmdWatch(t *testing.T) {
+	ts := chartmuseumtest.NewServer()
+	defer ts.Close()
+
+	tmp, err := ioutil.TempDir("", "helm-push-test")
+	if err != nil {
+		t.Fatal("unexpected error creating temp test dir", err)
+	}
+	defer os.RemoveAll(tmp)
+	ioutil.WriteFile(filepath.Join(tmp, "Chart.yaml"), []byte("apiVersion: v2\nname: mychart\nversion: 0.1.0\n"), 0644)
+
+	args := []string{tmp, ts.URL, "--context-path", "/", "--watch", "--watch-debounce", "50ms"}
+	cmd := newPushCmd(args)
+	cmd.SetArgs(args)
+	cmd.SetOut(ioutil.Discard)
+	cmd.SetErr(ioutil.Discard)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- cmd.ExecuteContext(ctx) }()
+
+	// next waits for the nth push and returns the version pushed
+	next := func(n int) string {
+		for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+			if charts := ts.Charts(); len(charts) >= n {
+				return charts[n-1].Version
+			}
+		}
+		t.Fatal("expected chart to be pushed")
+		return ""
+	}
+	first := next(1)
+	if !strings.HasPrefix(first, "0.1.0-dev.") {
+		t.Errorf("expected dev version to be pushed, got %s", first)
+	}
+	time.Sleep(1100 * time.Millisecond)
+	ioutil.WriteFile(filepath.Join(tmp, "values.yaml"), []byte("replicaCount: 2\n"), 0644)
+	if second := next(2); second <= first {
+		t.Errorf("expected %s to be pushed with a higher version than %s", second, first)
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("unexpected error watching chart: %s", err)
+	}
+}
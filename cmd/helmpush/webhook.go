@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	neturl "net/url"
+	"time"
+
+	"github.com/IxDay/helm-push-cloudflare-access/pkg/redact"
+	"github.com/IxDay/helm-push-cloudflare-access/pkg/webhook"
+)
+
+// notifyWebhooks sends an event for each successfully pushed chart to the
+// configured webhooks, unchanged charts and the versions the repository
+// already had are not pushed. Failures are only logged.
+func (p *pushCmd) notifyWebhooks() {
+	if len(p.config.Webhooks) == 0 {
+		return
+	}
+	client := &http.Client{Timeout: 10 * time.Second}
+	for _, r := range p.results {
+		if r.err != nil || r.unchanged || r.exists {
+			continue
+		}
+		event := webhook.Event{
+			Type:    "chart.pushed",
+			Time:    time.Now().UTC(),
+			Chart:   r.name,
+			Version: r.version,
+			Digest:  r.digest,
+			Repo:    r.url,
+		}
+		for _, h := range p.config.Webhooks {
+			if err := h.Send(context.Background(), client, event); err != nil {
+				p.log.Warn("could not notify webhook", "host", webhookHost(h.URL), "chart", r.name, "error", err)
+			}
+		}
+	}
+}
+
+// webhookHost returns the host of the webhook url, the rest of it may be a
+// secret
+func webhookHost(url string) string {
+	u, err := neturl.Parse(url)
+	if err != nil {
+		return redact.Redacted
+	}
+	return u.Host
+}
@@ -0,0 +1,160 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+type (
+	// Record is an entry of the audit log. Records are chained: Prev holds
+	// the SHA-256 of the previous line so any edit or removal in the middle
+	// of the log is detectable. When a key is provided, Signature holds the
+	// HMAC-SHA256 of the record (Signature field excluded).
+	Record struct {
+		Time      time.Time `json:"time"`
+		Action    string    `json:"action"`
+		User      string    `json:"user,omitempty"`
+		Host      string    `json:"host,omitempty"`
+		ClientID  string    `json:"clientId,omitempty"`
+		Chart     string    `json:"chart,omitempty"`
+		Version   string    `json:"version,omitempty"`
+		Repo      string    `json:"repo"`
+		Digest    string    `json:"digest,omitempty"`
+		Result    string    `json:"result"`
+		Error     string    `json:"error,omitempty"`
+		Prev      string    `json:"prev,omitempty"`
+		Signature string    `json:"signature,omitempty"`
+	}
+)
+
+// Append adds the record at the end of the log located at path, creating
+// it if needed. The file is locked while the record is chained to the last
+// one and written, so that concurrent pushes sharing the log keep the chain
+// intact.
+func Append(path string, r Record, key []byte) error {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := lock(f); err != nil {
+		return fmt.Errorf("could not lock %s: %s", path, err)
+	}
+	defer unlock(f)
+
+	last, err := lastLine(f)
+	if err != nil {
+		return err
+	}
+	if last != nil {
+		r.Prev = hash(last)
+	}
+
+	r.Signature = ""
+	if len(key) > 0 {
+		r.Signature, err = sign(r, key)
+		if err != nil {
+			return err
+		}
+	}
+
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(append(b, '\n'))
+	return err
+}
+
+// Verify checks the chain of the log located at path and, when a key is
+// provided, the signature of each record
+func Verify(path string, key []byte) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var prev []byte
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		line := scanner.Bytes()
+		var r Record
+		if err := json.Unmarshal(line, &r); err != nil {
+			return fmt.Errorf("line %d: %s", n, err)
+		}
+		if prev != nil && r.Prev != hash(prev) {
+			return fmt.Errorf("line %d: chain broken, previous record was altered or removed", n)
+		}
+		if len(key) > 0 {
+			signature := r.Signature
+			r.Signature = ""
+			expected, err := sign(r, key)
+			if err != nil {
+				return err
+			}
+			if !hmac.Equal([]byte(signature), []byte(expected)) {
+				return fmt.Errorf("line %d: invalid signature", n)
+			}
+		}
+		prev = append(prev[:0], line...)
+	}
+	return scanner.Err()
+}
+
+// lastLineChunk is how many bytes lastLine reads at once
+const lastLineChunk = 4096
+
+// lastLine returns the last non empty line of f, or nil if it is empty.
+// The file is read backwards from its end, so that the cost of appending
+// does not grow with the log.
+func lastLine(f *os.File) ([]byte, error) {
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	var b []byte
+	for end := fi.Size(); end > 0; {
+		n := int64(lastLineChunk)
+		if n > end {
+			n = end
+		}
+		end -= n
+		chunk := make([]byte, n, n+int64(len(b)))
+		if _, err := f.ReadAt(chunk, end); err != nil {
+			return nil, err
+		}
+		b = append(chunk, b...)
+		if line := bytes.TrimRight(b, "\n"); bytes.IndexByte(line, '\n') >= 0 {
+			return line[bytes.LastIndexByte(line, '\n')+1:], nil
+		}
+	}
+	b = bytes.TrimRight(b, "\n")
+	if len(b) == 0 {
+		return nil, nil
+	}
+	return b, nil
+}
+
+func hash(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+func sign(r Record, key []byte) (string, error) {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return "", err
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write(b)
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
@@ -0,0 +1,109 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAppendAndVerify(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "helm-push-test")
+	if err != nil {
+		t.Fatal("unexpected error creating temp test dir", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	path := filepath.Join(tmp, "audit.log")
+	key := []byte("s3cr3t")
+
+	for _, version := range []string{"0.1.0", "0.2.0", "0.3.0"} {
+		r := Record{Action: "push", Chart: "mychart", Version: version, Repo: "https://my.chart.repo.com", Result: "success"}
+		if err := Append(path, r, key); err != nil {
+			t.Fatalf("unexpected error appending record: %s", err)
+		}
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal("unexpected error reading audit log", err)
+	}
+	lines := bytes.Split(bytes.TrimSpace(b), []byte("\n"))
+	if len(lines) != 3 {
+		t.Fatalf("expected 3 records, got %d", len(lines))
+	}
+	var first, second Record
+	json.Unmarshal(lines[0], &first)
+	json.Unmarshal(lines[1], &second)
+	if first.Prev != "" || second.Prev != hash(lines[0]) || second.Signature == "" {
+		t.Errorf("unexpected chaining: %+v %+v", first, second)
+	}
+
+	if err := Verify(path, key); err != nil {
+		t.Errorf("unexpected error verifying audit log: %s", err)
+	}
+	if err := Verify(path, []byte("wrong")); err == nil {
+		t.Error("expected error verifying with wrong key, instead got nil")
+	}
+
+	// Records longer than the chunks read to find the last line
+	long := Record{Action: "push", Repo: "https://my.chart.repo.com", Result: "failure", Error: strings.Repeat("x", 3*lastLineChunk)}
+	for i := 0; i < 2; i++ {
+		if err := Append(path, long, key); err != nil {
+			t.Fatalf("unexpected error appending record: %s", err)
+		}
+	}
+	if err := Verify(path, key); err != nil {
+		t.Errorf("unexpected error verifying audit log with long records: %s", err)
+	}
+	b, _ = ioutil.ReadFile(path)
+
+	// Tamper with the first record
+	tampered := bytes.Replace(b, []byte(`"0.1.0"`), []byte(`"6.6.6"`), 1)
+	if err := ioutil.WriteFile(path, tampered, 0600); err != nil {
+		t.Fatal("unexpected error rewriting audit log", err)
+	}
+	if err := Verify(path, nil); err == nil {
+		t.Error("expected error verifying tampered audit log, instead got nil")
+	}
+}
+
+func TestAppendLocked(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "helm-push-test")
+	if err != nil {
+		t.Fatal("unexpected error creating temp test dir", err)
+	}
+	defer os.RemoveAll(tmp)
+	path := filepath.Join(tmp, "audit.log")
+
+	// Another push holds the log
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		t.Fatal("unexpected error creating audit log", err)
+	}
+	defer f.Close()
+	if err := lock(f); err != nil {
+		t.Fatalf("unexpected error locking audit log: %s", err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- Append(path, Record{Action: "push", Repo: "https://my.chart.repo.com", Result: "success"}, nil)
+	}()
+	select {
+	case err := <-done:
+		t.Fatalf("expected append to wait for the lock, got %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+	f.Write([]byte(`{"action":"push","repo":"https://my.chart.repo.com","result":"success"}` + "\n"))
+	unlock(f)
+	if err := <-done; err != nil {
+		t.Fatalf("unexpected error appending record: %s", err)
+	}
+	if err := Verify(path, nil); err != nil {
+		t.Errorf("expected the record to be chained to the one written under lock: %s", err)
+	}
+}
@@ -0,0 +1,111 @@
+package changelog
+
+import (
+	"bufio"
+	"bytes"
+	"regexp"
+	"strings"
+
+	"github.com/ghodss/yaml"
+)
+
+const (
+	// Annotation is the Artifact Hub annotation listing the changes of a
+	// chart version
+	Annotation = "artifacthub.io/changes"
+	// FileName is the changelog looked for in charts
+	FileName = "CHANGELOG.md"
+)
+
+// Change is an entry of the changes annotation
+type Change struct {
+	Kind        string `json:"kind"`
+	Description string `json:"description"`
+}
+
+var (
+	// "## [1.2.0] - 2021-01-05", "## 1.2.0" or "## [Unreleased]"
+	versionHeading = regexp.MustCompile(`^##\s+\[?v?([^\]\s]+)\]?`)
+	// "### Added"
+	kindHeading = regexp.MustCompile(`^###\s+(.+?)\s*$`)
+	item        = regexp.MustCompile(`^[-*+]\s+(.*)$`)
+
+	// kinds maps keep-a-changelog sections to Artifact Hub kinds
+	kinds = map[string]string{
+		"added":      "added",
+		"changed":    "changed",
+		"deprecated": "deprecated",
+		"removed":    "removed",
+		"fixed":      "fixed",
+		"security":   "security",
+	}
+)
+
+// Changes returns the changes listed for version in a keep-a-changelog
+// formatted changelog. A pre-release without its own section gets the
+// changes of the Unreleased section. ok is false when no section matches.
+func Changes(data []byte, version string) (changes []Change, ok bool) {
+	sections := parse(data)
+	if changes, ok := sections[strings.TrimPrefix(version, "v")]; ok {
+		return changes, true
+	}
+	if strings.Contains(version, "-") {
+		changes, ok := sections["unreleased"]
+		return changes, ok
+	}
+	return nil, false
+}
+
+// Annotate returns the value of the changes annotation
+func Annotate(changes []Change) (string, error) {
+	b, err := yaml.Marshal(changes)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// parse returns the changes of each version section, keyed by version,
+// the Unreleased section being keyed by "unreleased"
+func parse(data []byte) map[string][]Change {
+	sections := map[string][]Change{}
+	var version, kind string
+	// index of the item wrapped lines are appended to, -1 if none
+	current := -1
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(line, "## "):
+			version, kind, current = "", "", -1
+			if m := versionHeading.FindStringSubmatch(line); m != nil {
+				version = strings.ToLower(m[1])
+				if version != "unreleased" {
+					version = m[1]
+				}
+				sections[version] = nil
+			}
+		case version == "":
+		case strings.HasPrefix(line, "### "):
+			current, kind = -1, ""
+			if m := kindHeading.FindStringSubmatch(line); m != nil {
+				kind = kinds[strings.ToLower(m[1])]
+			}
+			if kind == "" {
+				// Artifact Hub knows no other kind
+				kind = "changed"
+			}
+		case kind == "":
+		case item.MatchString(line):
+			sections[version] = append(sections[version], Change{Kind: kind, Description: item.FindStringSubmatch(line)[1]})
+			current = len(sections[version]) - 1
+		case trimmed == "":
+			current = -1
+		case current >= 0 && line != trimmed:
+			// Wrapped item
+			sections[version][current].Description += " " + trimmed
+		}
+	}
+	return sections
+}
@@ -0,0 +1,71 @@
+package changelog
+
+import (
+	"reflect"
+	"testing"
+)
+
+const testChangelog = `# Changelog
+
+All notable changes to this chart are documented in this file.
+
+## [Unreleased]
+### Added
+- Ingress support
+
+## [1.2.0] - 2021-01-05
+### Added
+- Liveness probe settings
+- Support for extra volumes, mounted
+  in every container
+### Fixed
+* Service port name
+### Miscellaneous
+- Bumped chart dependencies
+
+## [1.1.0] - 2020-12-01
+### Removed
+- Deprecated RBAC settings
+
+[Unreleased]: https://github.com/example/charts/compare/v1.2.0...HEAD
+[1.2.0]: https://github.com/example/charts/compare/v1.1.0...v1.2.0
+`
+
+func TestChanges(t *testing.T) {
+	changes, ok := Changes([]byte(testChangelog), "1.2.0")
+	expected := []Change{
+		{Kind: "added", Description: "Liveness probe settings"},
+		{Kind: "added", Description: "Support for extra volumes, mounted in every container"},
+		{Kind: "fixed", Description: "Service port name"},
+		{Kind: "changed", Description: "Bumped chart dependencies"},
+	}
+	if !ok || !reflect.DeepEqual(changes, expected) {
+		t.Errorf("expected %+v, got %+v", expected, changes)
+	}
+
+	changes, ok = Changes([]byte(testChangelog), "v1.1.0")
+	if !ok || !reflect.DeepEqual(changes, []Change{{Kind: "removed", Description: "Deprecated RBAC settings"}}) {
+		t.Errorf("unexpected changes for 1.1.0: %+v", changes)
+	}
+
+	// Pre-releases fall back to the Unreleased section
+	changes, ok = Changes([]byte(testChangelog), "1.3.0-g1a2b3c4")
+	if !ok || !reflect.DeepEqual(changes, []Change{{Kind: "added", Description: "Ingress support"}}) {
+		t.Errorf("unexpected changes for pre-release: %+v", changes)
+	}
+
+	if _, ok := Changes([]byte(testChangelog), "2.0.0"); ok {
+		t.Error("expected no section for 2.0.0")
+	}
+}
+
+func TestAnnotate(t *testing.T) {
+	value, err := Annotate([]Change{{Kind: "fixed", Description: "Service port name"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := "- description: Service port name\n  kind: fixed\n"
+	if value != expected {
+		t.Errorf("expected %q, got %q", expected, value)
+	}
+}
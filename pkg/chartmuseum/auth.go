@@ -0,0 +1,80 @@
+package chartmuseum
+
+import (
+	"fmt"
+	"net/http"
+)
+
+const (
+	cfHeaderId     = "CF-Access-Client-Id"
+	cfHeaderSecret = "CF-Access-Client-Secret"
+
+	// AuthAccess sends the client ID and secret in two headers, the
+	// Cloudflare Access service token form
+	AuthAccess = "access"
+	// AuthBearer sends the client secret as an Authorization: Bearer token
+	AuthBearer = "bearer"
+	// AuthBasic sends the client ID and secret as HTTP basic auth username
+	// and password
+	AuthBasic = "basic"
+)
+
+// Auth sets how the credentials are sent, the Cloudflare Access headers
+// by default
+type Auth struct {
+	// Scheme is AuthAccess (default), AuthBearer or AuthBasic
+	Scheme string `json:"scheme,omitempty"`
+	// HeaderID and HeaderSecret replace the CF-Access-Client-Id and
+	// CF-Access-Client-Secret header names of the access scheme
+	HeaderID     string `json:"header_id,omitempty"`
+	HeaderSecret string `json:"header_secret,omitempty"`
+}
+
+// Validate checks the scheme and the header names
+func (a Auth) Validate() error {
+	switch a.Scheme {
+	case "", AuthAccess:
+	case AuthBearer, AuthBasic:
+		if a.HeaderID != "" || a.HeaderSecret != "" {
+			return fmt.Errorf("auth: header names can't be set with the %s scheme", a.Scheme)
+		}
+	default:
+		return fmt.Errorf("auth: unknown scheme %q, expected %s, %s or %s", a.Scheme, AuthAccess, AuthBearer, AuthBasic)
+	}
+	return nil
+}
+
+// headers returns the names of the headers carrying the credentials
+func (a Auth) headers() []string {
+	if a.Scheme == AuthBearer || a.Scheme == AuthBasic {
+		return []string{"Authorization"}
+	}
+	id, secret := a.HeaderID, a.HeaderSecret
+	if id == "" {
+		id = cfHeaderId
+	}
+	if secret == "" {
+		secret = cfHeaderSecret
+	}
+	return []string{id, secret}
+}
+
+// setCredentials adds the credentials to req, according to the auth
+// settings of the client
+func (client *Client) setCredentials(req *http.Request) {
+	headers := client.opts.auth.headers()
+	if client.opts.auth.Scheme == AuthBearer {
+		if client.opts.clientSecret != "" {
+			req.Header.Set(headers[0], "Bearer "+client.opts.clientSecret)
+		}
+		return
+	}
+	if client.opts.auth.Scheme == AuthBasic {
+		if client.opts.clientID != "" || client.opts.clientSecret != "" {
+			req.SetBasicAuth(client.opts.clientID, client.opts.clientSecret)
+		}
+		return
+	}
+	req.Header.Set(headers[0], client.opts.clientID)
+	req.Header.Set(headers[1], client.opts.clientSecret)
+}
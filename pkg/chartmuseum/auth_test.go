@@ -0,0 +1,58 @@
+package chartmuseum
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAuthentication(t *testing.T) {
+	var got http.Header
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header
+	}))
+	defer ts.Close()
+
+	download := func(auth Auth) {
+		cmClient, err := NewClient(URL(ts.URL), ClientID("user"), ClientSecret("pass"), Authentication(auth))
+		if err != nil {
+			t.Fatalf("expect creating a client instance but met error: %s", err)
+		}
+		if _, err := cmClient.DownloadFile("index.yaml"); err != nil {
+			t.Fatal("error downloading index.yaml", err)
+		}
+	}
+
+	download(Auth{})
+	if got.Get(cfHeaderId) != "user" || got.Get(cfHeaderSecret) != "pass" {
+		t.Errorf("expected Access headers by default, got %v", got)
+	}
+
+	download(Auth{HeaderID: "X-Client-Id", HeaderSecret: "X-Client-Secret"})
+	if got.Get("X-Client-Id") != "user" || got.Get("X-Client-Secret") != "pass" || got.Get(cfHeaderId) != "" {
+		t.Errorf("expected custom headers, got %v", got)
+	}
+
+	download(Auth{Scheme: AuthBearer})
+	if got.Get("Authorization") != "Bearer pass" || got.Get(cfHeaderId) != "" || got.Get(cfHeaderSecret) != "" {
+		t.Errorf("expected bearer token only, got %v", got)
+	}
+
+	download(Auth{Scheme: AuthBasic})
+	if user, pass, ok := (&http.Request{Header: got}).BasicAuth(); !ok || user != "user" || pass != "pass" || got.Get(cfHeaderId) != "" {
+		t.Errorf("expected basic auth only, got %v", got)
+	}
+}
+
+func TestAuthValidate(t *testing.T) {
+	for _, auth := range []Auth{{}, {Scheme: AuthAccess, HeaderID: "X-Id"}, {Scheme: AuthBearer}, {Scheme: AuthBasic}} {
+		if err := auth.Validate(); err != nil {
+			t.Errorf("unexpected error validating %+v: %s", auth, err)
+		}
+	}
+	for _, auth := range []Auth{{Scheme: "digest"}, {Scheme: AuthBearer, HeaderSecret: "X-Secret"}, {Scheme: AuthBasic, HeaderID: "X-Id"}} {
+		if err := auth.Validate(); err == nil {
+			t.Errorf("expected error validating %+v, instead got nil", auth)
+		}
+	}
+}
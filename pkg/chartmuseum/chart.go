@@ -0,0 +1,25 @@
+package chartmuseum
+
+import (
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// GetChart fetches the versions of the chart name from the ChartMuseum
+// API (GET /api/charts/<name>), an alternative to downloading the whole
+// index
+func (client *Client) GetChart(name string) (*http.Response, error) {
+	u, err := url.Parse(client.opts.url)
+	if err != nil {
+		return nil, err
+	}
+	u.Path = path.Join(client.opts.contextPath, "api", strings.TrimPrefix(u.Path, client.opts.contextPath), "charts", name)
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	client.setCredentials(req)
+	return client.Do(req)
+}
@@ -3,7 +3,11 @@ package chartmuseum
 import (
 	"fmt"
 	"net/http"
+	"net/url"
+	"strings"
 
+	"github.com/IxDay/helm-push-cloudflare-access/pkg/fips"
+	"github.com/IxDay/helm-push-cloudflare-access/pkg/redact"
 	v2tlsutil "k8s.io/helm/pkg/tlsutil"
 )
 
@@ -26,7 +30,7 @@ func (client *Client) Option(opts ...Option) *Client {
 // NewClient creates a new client.
 func NewClient(opts ...Option) (*Client, error) {
 	var client Client
-	client.Client = &http.Client{}
+	client.Client = &http.Client{CheckRedirect: client.checkRedirect}
 	client.Option(Timeout(30))
 	client.Option(opts...)
 	client.Timeout = client.opts.timeout
@@ -41,8 +45,39 @@ func NewClient(opts ...Option) (*Client, error) {
 	if err != nil {
 		return nil, err
 	}
+	if len(client.opts.pins) > 0 {
+		if !strings.HasPrefix(client.opts.url, "https://") {
+			return nil, fmt.Errorf("certificate pinning requires an https:// URL, got %s", client.opts.url)
+		}
+		for _, pin := range client.opts.pins {
+			if _, err := ParsePin(pin); err != nil {
+				return nil, err
+			}
+		}
+		// Checked even with --insecure, the pin is then the only trust anchor
+		tr.TLSClientConfig.VerifyConnection = verifyPins(client.opts.pins)
+	}
 
 	client.Transport = tr
+	if client.opts.debugOut != nil {
+		client.Transport = &debugTransport{next: tr, out: redact.Writer(client.opts.debugOut), body: client.opts.debugBody}
+	}
+	if client.opts.signing.Key != "" {
+		if err := client.opts.signing.Validate(); err != nil {
+			return nil, err
+		}
+		u, err := url.Parse(client.opts.url)
+		if err != nil {
+			return nil, err
+		}
+		client.Transport = &signTransport{next: client.Transport, host: u.Host, signing: client.opts.signing}
+	}
+	if client.opts.retries > 0 {
+		client.Transport = &retryTransport{next: client.Transport, retries: client.opts.retries}
+	}
+	if client.opts.firstRoundTrip != nil {
+		client.Transport = &firstRoundTripTransport{next: client.Transport, fn: client.opts.firstRoundTrip}
+	}
 
 	return &client, nil
 }
@@ -56,9 +91,15 @@ func newTransport(certFile, keyFile, caFile string, insecureSkipVerify bool) (*h
 		return nil, fmt.Errorf("can't create TLS config: %s", err.Error())
 	}
 	tlsConf.InsecureSkipVerify = insecureSkipVerify
+	fips.Restrict(tlsConf)
 
 	transport.TLSClientConfig = tlsConf
 	transport.Proxy = http.ProxyFromEnvironment
 
 	return transport, nil
 }
+
+// URL returns the repository URL of the client
+func (client *Client) URL() string {
+	return client.opts.url
+}
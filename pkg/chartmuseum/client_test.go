@@ -1,6 +1,7 @@
 package chartmuseum
 
 import (
+	"net/http"
 	"testing"
 	"time"
 )
@@ -8,8 +9,8 @@ import (
 func TestNewClient(t *testing.T) {
 	cmClient, err := NewClient(
 		URL("http://localhost:8080"),
-		Username("user"),
-		Password("pass"),
+		ClientID("user"),
+		ClientSecret("pass"),
 		ContextPath("/my/context/path"),
 		Timeout(60),
 		CAFile("../../testdata/tls/server_ca.crt"),
@@ -26,12 +27,12 @@ func TestNewClient(t *testing.T) {
 		t.Errorf("expected url to be http://localhost:8080, got %v", cmClient.opts.url)
 	}
 
-	if cmClient.opts.username != "user" {
-		t.Errorf("expected username to be user, got %v", cmClient.opts.username)
+	if cmClient.opts.clientID != "user" {
+		t.Errorf("expected client id to be user, got %v", cmClient.opts.clientID)
 	}
 
-	if cmClient.opts.password != "pass" {
-		t.Errorf("expected password to be pass, got %v", cmClient.opts.password)
+	if cmClient.opts.clientSecret != "pass" {
+		t.Errorf("expected client secret to be pass, got %v", cmClient.opts.clientSecret)
 	}
 
 	if cmClient.opts.contextPath != "/my/context/path" {
@@ -58,3 +59,7 @@ func TestNewClient(t *testing.T) {
 		t.Errorf("expected insecure flag to be 'true' but got %v", cmClient.opts.insecureSkipVerify)
 	}
 }
+
+func hasAccessHeaders(r *http.Request, clientID, clientSecret string) bool {
+	return r.Header.Get(cfHeaderId) == clientID && r.Header.Get(cfHeaderSecret) == clientSecret
+}
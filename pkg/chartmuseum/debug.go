@@ -0,0 +1,95 @@
+package chartmuseum
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httputil"
+
+	"github.com/IxDay/helm-push-cloudflare-access/pkg/redact"
+)
+
+type (
+	// debugTransport dumps every request and response going through it
+	debugTransport struct {
+		next http.RoundTripper
+		out  io.Writer
+		body bool
+	}
+)
+
+// RoundTrip implements http.RoundTripper, req is left untouched as the
+// contract requires
+func (t *debugTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	sent, err := t.dumpRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := t.next.RoundTrip(sent)
+	if err != nil {
+		fmt.Fprintf(t.out, "<<< %s %s: %s\n\n", req.Method, redact.URL(req.URL), err)
+		return nil, err
+	}
+	resp.Request = req
+	if err := t.dumpResponse(resp); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	return resp, nil
+}
+
+// dumpRequest dumps a clone of req and returns the request to send: req
+// itself, or a clone of it when its body had to be read for the dump, the
+// body of req being then closed
+func (t *debugTransport) dumpRequest(req *http.Request) (*http.Request, error) {
+	sent := req
+	clone := req.Clone(req.Context())
+	clone.URL.User = nil
+	redact.Header(clone.Header)
+
+	if t.body && req.Body != nil && req.Body != http.NoBody {
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			clone.Body = body
+		} else {
+			b, err := ioutil.ReadAll(req.Body)
+			req.Body.Close()
+			if err != nil {
+				return nil, err
+			}
+			sent = req.Clone(req.Context())
+			sent.Body = ioutil.NopCloser(bytes.NewReader(b))
+			sent.GetBody = func() (io.ReadCloser, error) {
+				return ioutil.NopCloser(bytes.NewReader(b)), nil
+			}
+			clone.Body = ioutil.NopCloser(bytes.NewReader(b))
+		}
+	}
+
+	dump, err := httputil.DumpRequestOut(clone, t.body)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Fprintf(t.out, ">>> %s %s\n%s\n\n", req.Method, redact.URL(req.URL), bytes.TrimSpace(dump))
+	return sent, nil
+}
+
+func (t *debugTransport) dumpResponse(resp *http.Response) error {
+	clone := *resp
+	clone.Header = resp.Header.Clone()
+	redact.Header(clone.Header)
+
+	dump, err := httputil.DumpResponse(&clone, t.body)
+	if err != nil {
+		return err
+	}
+	// DumpResponse replaced the consumed body with an in-memory copy
+	resp.Body = clone.Body
+	fmt.Fprintf(t.out, "<<< %s %s\n%s\n\n", resp.Request.Method, redact.URL(resp.Request.URL), bytes.TrimSpace(dump))
+	return nil
+}
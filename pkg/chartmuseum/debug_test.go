@@ -0,0 +1,96 @@
+package chartmuseum
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDebugHTTP(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !hasAccessHeaders(r, "myid", "mysecret") {
+			w.WriteHeader(401)
+			return
+		}
+		http.SetCookie(w, &http.Cookie{Name: "CF_Authorization", Value: "jwtcookie"})
+		w.Write([]byte("hello world"))
+	}))
+	defer ts.Close()
+
+	var out bytes.Buffer
+	cmClient, err := NewClient(
+		URL(ts.URL),
+		ClientID("myid"),
+		ClientSecret("mysecret"),
+		DebugHTTP(&out, true),
+	)
+	if err != nil {
+		t.Fatalf("expect creating a client instance but met error: %s", err)
+	}
+
+	resp, err := cmClient.DownloadFile("testfile")
+	if err != nil {
+		t.Fatal("error downloading testfile", err)
+	}
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal("error reading response body", err)
+	}
+	if s := string(b); s != "hello world" {
+		t.Fatalf("expected body to survive the dump, got %q", s)
+	}
+
+	dump := out.String()
+	for _, secret := range []string{"mysecret", "jwtcookie"} {
+		if strings.Contains(dump, secret) {
+			t.Errorf("expected %q to be redacted from dump:\n%s", secret, dump)
+		}
+	}
+	for _, expected := range []string{">>> GET", "<<< GET", "Cf-Access-Client-Id: myid", "Cf-Access-Client-Secret: REDACTED", "hello world"} {
+		if !strings.Contains(dump, expected) {
+			t.Errorf("expected dump to contain %q:\n%s", expected, dump)
+		}
+	}
+}
+
+func TestDebugHTTPRequestBody(t *testing.T) {
+	var received []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		received = append(received, string(b))
+	}))
+	defer ts.Close()
+
+	var out bytes.Buffer
+	transport := &debugTransport{next: http.DefaultTransport, out: &out, body: true}
+	for _, body := range []io.Reader{strings.NewReader("replayable"), ioutil.NopCloser(strings.NewReader("streamed"))} {
+		req, err := http.NewRequest("POST", ts.URL, body)
+		if err != nil {
+			t.Fatalf("unexpected error creating request: %s", err)
+		}
+		original := req.Body
+		resp, err := transport.RoundTrip(req)
+		if err != nil {
+			t.Fatalf("unexpected error sending request: %s", err)
+		}
+		resp.Body.Close()
+		if req.Body != original {
+			t.Error("expected the body of the request to be left untouched")
+		}
+		if resp.Request != req {
+			t.Error("expected the response to refer to the request")
+		}
+	}
+	if len(received) != 2 || received[0] != "replayable" || received[1] != "streamed" {
+		t.Errorf("expected bodies to be sent whole, got %q", received)
+	}
+	for _, expected := range []string{"replayable", "streamed"} {
+		if c := strings.Count(out.String(), expected); c != 1 {
+			t.Errorf("expected %q to be dumped once, got %d times:\n%s", expected, c, out.String())
+		}
+	}
+}
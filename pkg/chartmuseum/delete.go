@@ -0,0 +1,27 @@
+package chartmuseum
+
+import (
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// DeleteChartVersion deletes a chart version from ChartMuseum
+// (DELETE /api/charts/<name>/<version>)
+func (client *Client) DeleteChartVersion(name, version string) (*http.Response, error) {
+	u, err := url.Parse(client.opts.url)
+	if err != nil {
+		return nil, err
+	}
+
+	u.Path = path.Join(client.opts.contextPath, "api", strings.TrimPrefix(u.Path, client.opts.contextPath), "charts", name, version)
+	req, err := http.NewRequest("DELETE", u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	client.setCredentials(req)
+
+	return client.Do(req)
+}
@@ -0,0 +1,37 @@
+package chartmuseum
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDeleteChartVersion(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !hasAccessHeaders(r, "user", "pass") {
+			w.WriteHeader(401)
+		} else if r.Method != "DELETE" || r.URL.Path != "/my/context/path/api/charts/mychart/0.1.0" {
+			w.WriteHeader(404)
+		} else {
+			w.WriteHeader(200)
+		}
+	}))
+	defer ts.Close()
+
+	cmClient, err := NewClient(
+		URL(ts.URL),
+		ClientID("user"),
+		ClientSecret("pass"),
+		ContextPath("/my/context/path"),
+	)
+	if err != nil {
+		t.Fatalf("expect creating a client instance but met error: %s", err)
+	}
+	resp, err := cmClient.DeleteChartVersion("mychart", "0.1.0")
+	if err != nil {
+		t.Fatal("error deleting chart version", err)
+	}
+	if resp.StatusCode != 200 {
+		t.Errorf("expecting 200 instead got %d", resp.StatusCode)
+	}
+}
@@ -20,8 +20,35 @@ func (client *Client) DownloadFile(filePath string) (*http.Response, error) {
 		return nil, err
 	}
 
-	req.Header.Set(cfHeaderId, client.opts.clientID)
-	req.Header.Set(cfHeaderSecret, client.opts.clientSecret)
+	client.setCredentials(req)
 
 	return client.Do(req)
 }
+
+// At returns a client downloading the files under u, the directory of a
+// chart package listed in the index. It keeps the settings of client when
+// u is on the repository host. An index can list packages anywhere, so the
+// client for another host sends no credentials and trusts the system
+// certificates only, like the client of storage services.
+func (client *Client) At(u string) (*Client, error) {
+	repoURL, err := url.Parse(client.opts.url)
+	if err != nil {
+		return nil, err
+	}
+	target, err := url.Parse(u)
+	if err != nil {
+		return nil, err
+	}
+	if target.Scheme == repoURL.Scheme && strings.EqualFold(target.Host, repoURL.Host) {
+		c := *client
+		c.opts.url = u
+		return &c, nil
+	}
+	storage, err := client.storageClient()
+	if err != nil {
+		return nil, err
+	}
+	c := &Client{Client: storage, opts: options{url: u, timeout: client.opts.timeout, fsys: client.opts.fsys}}
+	storage.CheckRedirect = c.checkRedirect
+	return c, nil
+}
@@ -2,7 +2,6 @@ package chartmuseum
 
 import (
 	"crypto/tls"
-	"encoding/base64"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
@@ -10,9 +9,8 @@ import (
 )
 
 func TestDownloadFile(t *testing.T) {
-	basicAuthHeader := "Basic " + base64.StdEncoding.EncodeToString([]byte("user:pass"))
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if r.Header.Get("Authorization") != basicAuthHeader {
+		if !hasAccessHeaders(r, "user", "pass") {
 			w.WriteHeader(401)
 		} else {
 			w.WriteHeader(200)
@@ -23,8 +21,8 @@ func TestDownloadFile(t *testing.T) {
 
 	cmClient, err := NewClient(
 		URL(ts.URL),
-		Username("user"),
-		Password("pass"),
+		ClientID("user"),
+		ClientSecret("pass"),
 	)
 	if err != nil {
 		t.Fatalf("expect creating a client instance but met error: %s", err)
@@ -54,9 +52,8 @@ func TestDownloadFile(t *testing.T) {
 }
 
 func TestDownloadFileFromTlsServer(t *testing.T) {
-	basicAuthHeader := "Basic " + base64.StdEncoding.EncodeToString([]byte("user:pass"))
 	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if r.Header.Get("Authorization") != basicAuthHeader {
+		if !hasAccessHeaders(r, "user", "pass") {
 			w.WriteHeader(401)
 		} else {
 			w.WriteHeader(200)
@@ -77,8 +74,8 @@ func TestDownloadFileFromTlsServer(t *testing.T) {
 	//without ca file
 	cmClient, err := NewClient(
 		URL(ts.URL),
-		Username("user"),
-		Password("pass"),
+		ClientID("user"),
+		ClientSecret("pass"),
 	)
 	if err != nil {
 		t.Fatalf("[without ca file] expect creating a client instance but met error: %s", err)
@@ -91,8 +88,8 @@ func TestDownloadFileFromTlsServer(t *testing.T) {
 	//with ca file
 	cmClient, err = NewClient(
 		URL(ts.URL),
-		Username("user"),
-		Password("pass"),
+		ClientID("user"),
+		ClientSecret("pass"),
 		CAFile(testServerCAPath),
 	)
 	if err != nil {
@@ -111,3 +108,66 @@ func TestDownloadFileFromTlsServer(t *testing.T) {
 		t.Fatalf("[with ca file] expected 'hello world' but got '%s'", s)
 	}
 }
+
+func TestDownloadFileAccessLoginRedirect(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "https://myteam.cloudflareaccess.com/cdn-cgi/access/login/my.chart.repo.com", http.StatusFound)
+	}))
+	defer ts.Close()
+
+	cmClient, err := NewClient(URL(ts.URL))
+	if err != nil {
+		t.Fatalf("expect creating a client instance but met error: %s", err)
+	}
+	resp, err := cmClient.DownloadFile("index.yaml")
+	if err != nil {
+		t.Fatalf("expected the login redirect not to be followed, got error: %s", err)
+	}
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("expected 302, got %d", resp.StatusCode)
+	}
+	if se := NewStatusError(OpIndex, resp, "redirected"); !se.AccessLogin {
+		t.Error("expected the redirect to be detected as an Access login")
+	}
+}
+
+func TestAt(t *testing.T) {
+	var repoHeaders, otherHeaders http.Header
+	repo := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		repoHeaders = r.Header
+	}))
+	defer repo.Close()
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		otherHeaders = r.Header
+	}))
+	defer other.Close()
+
+	client, err := NewClient(URL(repo.URL+"/helm"), ClientID("user"), ClientSecret("pass"), ContextPath("/helm"))
+	if err != nil {
+		t.Fatalf("unexpected error creating client: %s", err)
+	}
+	same, err := client.At(repo.URL + "/helm/charts/")
+	if err != nil {
+		t.Fatalf("unexpected error creating client: %s", err)
+	}
+	if _, err := same.DownloadFile("mychart-0.1.0.tgz"); err != nil {
+		t.Fatalf("unexpected error downloading file: %s", err)
+	}
+	if repoHeaders.Get("Cf-Access-Client-Id") != "user" || repoHeaders.Get("Cf-Access-Client-Secret") != "pass" {
+		t.Errorf("expected credentials to be sent to the repository host, got %v", repoHeaders)
+	}
+	if client.URL() != repo.URL+"/helm" {
+		t.Errorf("expected the repository client to be left as is, got %s", client.URL())
+	}
+
+	foreign, err := client.At(other.URL + "/charts/")
+	if err != nil {
+		t.Fatalf("unexpected error creating client: %s", err)
+	}
+	if _, err := foreign.DownloadFile("mychart-0.1.0.tgz"); err != nil {
+		t.Fatalf("unexpected error downloading file: %s", err)
+	}
+	if otherHeaders.Get("Cf-Access-Client-Id") != "" || otherHeaders.Get("Cf-Access-Client-Secret") != "" {
+		t.Errorf("expected no credentials to be sent to another host, got %v", otherHeaders)
+	}
+}
@@ -0,0 +1,68 @@
+package chartmuseum
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Operations reported by StatusError
+const (
+	OpUpload   = "upload"
+	OpDownload = "download"
+	OpIndex    = "index"
+	OpInfo     = "info"
+	OpDelete   = "delete"
+	OpChart    = "chart"
+)
+
+type (
+	// StatusError is returned when the server answers with an unexpected status
+	StatusError struct {
+		Op         string
+		StatusCode int
+		Message    string
+		// AccessLogin is set when Cloudflare Access redirected the request
+		// to its login page, meaning the credentials were not accepted
+		AccessLogin bool
+	}
+)
+
+// Error implements error
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%d: %s", e.StatusCode, e.Message)
+}
+
+// NewStatusError builds the error for resp, message being extracted from
+// its body
+func NewStatusError(op string, resp *http.Response, message string) *StatusError {
+	return &StatusError{
+		Op:          op,
+		StatusCode:  resp.StatusCode,
+		Message:     message,
+		AccessLogin: isAccessLogin(resp.Header.Get("Location")),
+	}
+}
+
+// isAccessLogin tells if location points to the Cloudflare Access login page
+func isAccessLogin(location string) bool {
+	return strings.Contains(location, ".cloudflareaccess.com/")
+}
+
+// checkRedirect stops at Cloudflare Access login redirects, following them
+// would turn a rejected request into a successful HTML response. The
+// Access credentials are not sent to other hosts.
+func (client *Client) checkRedirect(req *http.Request, via []*http.Request) error {
+	if isAccessLogin(req.URL.String()) {
+		return http.ErrUseLastResponse
+	}
+	if len(via) >= 10 {
+		return fmt.Errorf("stopped after 10 redirects")
+	}
+	if req.URL.Host != via[0].URL.Host {
+		for _, h := range client.opts.auth.headers() {
+			req.Header.Del(h)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,26 @@
+package chartmuseum
+
+import (
+	"net/http"
+	"net/url"
+	"path"
+)
+
+// GetInfo fetches the server information from ChartMuseum (GET /info)
+func (client *Client) GetInfo() (*http.Response, error) {
+	u, err := url.Parse(client.opts.url)
+	if err != nil {
+		return nil, err
+	}
+
+	// /info is served once per server, not per repository
+	u.Path = path.Join("/", client.opts.contextPath, "info")
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	client.setCredentials(req)
+
+	return client.Do(req)
+}
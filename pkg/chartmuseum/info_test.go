@@ -0,0 +1,41 @@
+package chartmuseum
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGetInfo(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !hasAccessHeaders(r, "user", "pass") {
+			w.WriteHeader(401)
+			return
+		}
+		if r.URL.Path != "/cm/info" {
+			w.WriteHeader(404)
+			return
+		}
+		w.Write([]byte(`{"version":"v0.13.1"}`))
+	}))
+	defer ts.Close()
+
+	cmClient, err := NewClient(
+		URL(ts.URL+"/cm/org/repo"),
+		ClientID("user"),
+		ClientSecret("pass"),
+		ContextPath("/cm"),
+	)
+	if err != nil {
+		t.Fatalf("expect creating a client instance but met error: %s", err)
+	}
+	resp, err := cmClient.GetInfo()
+	if err != nil {
+		t.Fatalf("unexpected error fetching info: %s", err)
+	}
+	b, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode != 200 || string(b) != `{"version":"v0.13.1"}` {
+		t.Errorf("unexpected response %d: %s", resp.StatusCode, b)
+	}
+}
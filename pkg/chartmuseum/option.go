@@ -1,7 +1,10 @@
 package chartmuseum
 
 import (
+	"io"
 	"time"
+
+	"github.com/IxDay/helm-push-cloudflare-access/pkg/vfs"
 )
 
 type (
@@ -13,12 +16,21 @@ type (
 		url                string
 		clientID           string
 		clientSecret       string
+		auth               Auth
+		signing            Signing
 		contextPath        string
 		timeout            time.Duration
 		caFile             string
 		certFile           string
 		keyFile            string
 		insecureSkipVerify bool
+		pins               []string
+		debugOut           io.Writer
+		debugBody          bool
+		progress           ProgressFunc
+		retries            int
+		fsys               vfs.FS
+		firstRoundTrip     FirstRoundTripFunc
 	}
 )
 
@@ -43,6 +55,20 @@ func ClientSecret(clientSecret string) Option {
 	}
 }
 
+// Authentication sets how the client ID and secret are sent
+func Authentication(auth Auth) Option {
+	return func(opts *options) {
+		opts.auth = auth
+	}
+}
+
+// RequestSigning signs the requests sent to the repository, see Signing
+func RequestSigning(signing Signing) Option {
+	return func(opts *options) {
+		opts.signing = signing
+	}
+}
+
 // ContextPath is the URL prefix for ChartMuseum installation
 func ContextPath(contextPath string) Option {
 	return func(opts *options) {
@@ -84,3 +110,52 @@ func InsecureSkipVerify(insecureSkipVerify bool) Option {
 		opts.insecureSkipVerify = insecureSkipVerify
 	}
 }
+
+// PinSHA256 restricts TLS connections to servers presenting one of the
+// public keys, given as base64 encoded SHA-256 hashes of their SPKI
+func PinSHA256(pins ...string) Option {
+	return func(opts *options) {
+		opts.pins = pins
+	}
+}
+
+// DebugHTTP dumps request and response headers (and bodies if requested)
+// to out, credentials and cookies are redacted
+func DebugHTTP(out io.Writer, body bool) Option {
+	return func(opts *options) {
+		opts.debugOut = out
+		opts.debugBody = body
+	}
+}
+
+// Progress reports the progress of chart uploads
+func Progress(progress ProgressFunc) Option {
+	return func(opts *options) {
+		opts.progress = progress
+	}
+}
+
+// Retries retries the requests failing with a network error or a 429,
+// 502, 503 or 504 status up to retries times, with an exponential backoff.
+// Only idempotent requests and chart uploads are retried.
+func Retries(retries int) Option {
+	return func(opts *options) {
+		opts.retries = retries
+	}
+}
+
+// FileSystem reads the uploaded files from fsys rather than from the
+// host filesystem
+func FileSystem(fsys vfs.FS) Option {
+	return func(opts *options) {
+		opts.fsys = fsys
+	}
+}
+
+// FirstRoundTrip calls fn once the first request of the client is
+// answered, to time the authentication to the repository
+func FirstRoundTrip(fn FirstRoundTripFunc) Option {
+	return func(opts *options) {
+		opts.firstRoundTrip = fn
+	}
+}
@@ -0,0 +1,56 @@
+package chartmuseum
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"strings"
+)
+
+type (
+	// PinError is returned when none of the server certificates matches
+	// the pinned public keys
+	PinError struct {
+		Host string
+		// Got holds the SPKI hashes of the certificates presented
+		Got []string
+	}
+)
+
+// Error implements error
+func (e *PinError) Error() string {
+	return fmt.Sprintf("certificate pinning failed for %s: no certificate matches the pinned public keys, got sha256//%s", e.Host, strings.Join(e.Got, ", sha256//"))
+}
+
+// ParsePin parses a base64 encoded SHA-256 hash of a SubjectPublicKeyInfo,
+// optionally prefixed with "sha256//" as curl does
+func ParsePin(pin string) (string, error) {
+	pin = strings.TrimPrefix(strings.TrimSpace(pin), "sha256//")
+	b, err := base64.StdEncoding.DecodeString(pin)
+	if err != nil || len(b) != sha256.Size {
+		return "", fmt.Errorf("invalid pin %q, must be the base64 encoded SHA-256 hash of a public key", pin)
+	}
+	return pin, nil
+}
+
+// verifyPins returns a tls.Config.VerifyConnection function accepting the
+// connection only if a certificate of the chain has one of the pinned keys
+func verifyPins(pins []string) func(tls.ConnectionState) error {
+	pinned := map[string]bool{}
+	for _, pin := range pins {
+		pinned[strings.TrimPrefix(pin, "sha256//")] = true
+	}
+	return func(cs tls.ConnectionState) error {
+		got := make([]string, 0, len(cs.PeerCertificates))
+		for _, cert := range cs.PeerCertificates {
+			sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+			hash := base64.StdEncoding.EncodeToString(sum[:])
+			if pinned[hash] {
+				return nil
+			}
+			got = append(got, hash)
+		}
+		return &PinError{Host: cs.ServerName, Got: got}
+	}
+}
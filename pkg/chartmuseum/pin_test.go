@@ -0,0 +1,54 @@
+package chartmuseum
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPinSHA256(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello world"))
+	}))
+	defer ts.Close()
+
+	sum := sha256.Sum256(ts.Certificate().RawSubjectPublicKeyInfo)
+	pin := base64.StdEncoding.EncodeToString(sum[:])
+	other := "47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU="
+
+	// Matching pin, the self-signed certificate is trusted through it
+	cmClient, err := NewClient(URL(ts.URL), InsecureSkipVerify(true), PinSHA256(other, "sha256//"+pin))
+	if err != nil {
+		t.Fatalf("expect creating a client instance but met error: %s", err)
+	}
+	resp, err := cmClient.DownloadFile("testfile")
+	if err != nil {
+		t.Fatal("unexpected error with matching pin", err)
+	}
+	resp.Body.Close()
+
+	// Mismatching pin
+	cmClient, err = NewClient(URL(ts.URL), InsecureSkipVerify(true), PinSHA256(other))
+	if err != nil {
+		t.Fatalf("expect creating a client instance but met error: %s", err)
+	}
+	_, err = cmClient.DownloadFile("testfile")
+	var pe *PinError
+	if !errors.As(err, &pe) {
+		t.Fatalf("expected pin error, got %v", err)
+	}
+	if len(pe.Got) != 1 || pe.Got[0] != pin {
+		t.Errorf("expected pin error to report the server key %s, got %v", pin, pe.Got)
+	}
+
+	// Invalid pin and plain HTTP
+	if _, err := NewClient(URL(ts.URL), PinSHA256("abc")); err == nil {
+		t.Error("expected error with invalid pin, instead got nil")
+	}
+	if _, err := NewClient(URL("http://localhost:8080"), PinSHA256(pin)); err == nil {
+		t.Error("expected error pinning a plain HTTP URL, instead got nil")
+	}
+}
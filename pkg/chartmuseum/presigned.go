@@ -0,0 +1,119 @@
+package chartmuseum
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+
+	"github.com/IxDay/helm-push-cloudflare-access/pkg/redact"
+	"github.com/IxDay/helm-push-cloudflare-access/pkg/vfs"
+)
+
+type (
+	// presignedUpload is the body of the 202 Accepted answer of gateways
+	// delegating uploads to a storage service: the file must be sent to
+	// UploadURL, then CompleteURL, if any, is notified
+	presignedUpload struct {
+		UploadURL   string            `json:"upload_url"`
+		Method      string            `json:"method,omitempty"`
+		Headers     map[string]string `json:"headers,omitempty"`
+		CompleteURL string            `json:"complete_url,omitempty"`
+	}
+)
+
+// followPresigned performs the second step of a presigned upload when the
+// server answered the upload request of filePath with one, other
+// responses are returned as is. The storage service never receives the
+// Access credentials, nor the client certificate. Without a completion
+// URL, a successful storage upload is reported as 201 Created.
+func (client *Client) followPresigned(resp *http.Response, filePath string) (*http.Response, error) {
+	if resp.StatusCode != http.StatusAccepted {
+		return resp, nil
+	}
+	b, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	var upload presignedUpload
+	if json.Unmarshal(b, &upload) != nil || upload.UploadURL == "" {
+		resp.Body = ioutil.NopCloser(bytes.NewReader(b))
+		return resp, nil
+	}
+	storageURL, err := url.Parse(upload.UploadURL)
+	if err != nil || !storageURL.IsAbs() {
+		return nil, fmt.Errorf("invalid presigned upload URL")
+	}
+	// The query holds the signature granting write access
+	redact.Secret(storageURL.RawQuery)
+
+	data, err := vfs.ReadFile(client.filesystem(), filePath)
+	if err != nil {
+		return nil, err
+	}
+	method := upload.Method
+	if method == "" {
+		method = http.MethodPut
+	}
+	req, err := http.NewRequest(method, storageURL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range upload.Headers {
+		req.Header.Set(k, v)
+	}
+	req.ContentLength = int64(len(data))
+	if client.opts.progress != nil {
+		req.Body = ioutil.NopCloser(&progressReader{r: bytes.NewReader(data), total: req.ContentLength, progress: client.opts.progress})
+	} else {
+		req.Body = ioutil.NopCloser(bytes.NewReader(data))
+	}
+	storage, err := client.storageClient()
+	if err != nil {
+		return nil, err
+	}
+	storageResp, err := storage.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if storageResp.StatusCode < 200 || storageResp.StatusCode > 299 || upload.CompleteURL == "" {
+		if storageResp.StatusCode >= 200 && storageResp.StatusCode <= 299 {
+			storageResp.StatusCode = http.StatusCreated
+		}
+		return storageResp, nil
+	}
+	storageResp.Body.Close()
+
+	// The completion is confirmed to the gateway, with the credentials
+	completeURL, err := resp.Request.URL.Parse(upload.CompleteURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid presigned upload completion URL: %s", err)
+	}
+	if completeURL.Host != resp.Request.URL.Host {
+		return nil, fmt.Errorf("presigned upload completion URL must be on %s, got %s", resp.Request.URL.Host, completeURL.Host)
+	}
+	req, err = http.NewRequest(http.MethodPost, completeURL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	client.setCredentials(req)
+	return client.Do(req)
+}
+
+// storageClient returns a client for storage services: trusting the
+// system certificates only and sending neither the client certificate
+// nor cookies
+func (client *Client) storageClient() (*http.Client, error) {
+	tr, err := newTransport("", "", "", false)
+	if err != nil {
+		return nil, err
+	}
+	c := &http.Client{Timeout: client.Timeout, Transport: tr}
+	if client.opts.debugOut != nil {
+		c.Transport = &debugTransport{next: tr, out: redact.Writer(client.opts.debugOut), body: client.opts.debugBody}
+	}
+	return c, nil
+}
@@ -0,0 +1,99 @@
+package chartmuseum
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestUploadChartPackagePresigned(t *testing.T) {
+	expected, _ := ioutil.ReadFile(testTarballPath)
+	var stored []byte
+	storage := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(cfHeaderId) != "" || r.Header.Get(cfHeaderSecret) != "" {
+			t.Error("expected Access credentials not to be sent to the storage")
+		}
+		if r.Method != "PUT" || r.URL.Query().Get("X-Amz-Signature") != "abc" || r.Header.Get("Content-Type") != "application/gzip" {
+			w.WriteHeader(403)
+			return
+		}
+		stored, _ = ioutil.ReadAll(r.Body)
+		w.WriteHeader(200)
+	}))
+	defer storage.Close()
+
+	completeURL := "/api/charts/complete"
+	completed := false
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !hasAccessHeaders(r, "user", "pass") {
+			w.WriteHeader(401)
+			return
+		}
+		if r.URL.Path == "/api/charts/complete" {
+			completed = true
+			w.WriteHeader(201)
+			return
+		}
+		w.WriteHeader(202)
+		fmt.Fprintf(w, `{"upload_url": %q, "headers": {"Content-Type": "application/gzip"}, "complete_url": %q}`,
+			storage.URL+"/bucket/mychart-0.1.0.tgz?X-Amz-Signature=abc", completeURL)
+	}))
+	defer gateway.Close()
+
+	client, err := NewClient(URL(gateway.URL), ClientID("user"), ClientSecret("pass"))
+	if err != nil {
+		t.Fatalf("unexpected error creating client: %s", err)
+	}
+	resp, err := client.UploadChartPackage(testTarballPath, false)
+	if err != nil {
+		t.Fatalf("unexpected error uploading chart package: %s", err)
+	}
+	if resp.StatusCode != 201 || !completed {
+		t.Errorf("expected upload to be completed, got %d", resp.StatusCode)
+	}
+	if string(stored) != string(expected) {
+		t.Error("expected the chart package to be sent as is to the storage")
+	}
+
+	// Without completion
+	completeURL, completed = "", false
+	resp, err = client.UploadChartPackage(testTarballPath, false)
+	if err != nil || resp.StatusCode != 201 || completed {
+		t.Errorf("expected storage upload to be reported as created, got %v, %v", resp, err)
+	}
+
+	// Completion on another host
+	completeURL = storage.URL + "/complete"
+	if _, err := client.UploadChartPackage(testTarballPath, false); err == nil {
+		t.Error("expected error with completion URL on another host, instead got nil")
+	}
+}
+
+func TestRedirectDropsAccessHeaders(t *testing.T) {
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(cfHeaderId) != "" || r.Header.Get(cfHeaderSecret) != "" {
+			w.WriteHeader(400)
+			return
+		}
+		w.WriteHeader(200)
+	}))
+	defer other.Close()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, other.URL+"/index.yaml", http.StatusFound)
+	}))
+	defer ts.Close()
+
+	client, err := NewClient(URL(ts.URL), ClientID("user"), ClientSecret("pass"))
+	if err != nil {
+		t.Fatalf("unexpected error creating client: %s", err)
+	}
+	resp, err := client.DownloadFile("index.yaml")
+	if err != nil {
+		t.Fatalf("unexpected error downloading file: %s", err)
+	}
+	if resp.StatusCode != 200 {
+		t.Errorf("expected Access credentials not to follow redirects to other hosts, got %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,27 @@
+package chartmuseum
+
+import (
+	"io"
+)
+
+type (
+	// ProgressFunc is called while a request body is being sent with the
+	// number of bytes sent so far and the total size
+	ProgressFunc func(sent, total int64)
+
+	progressReader struct {
+		r        io.Reader
+		sent     int64
+		total    int64
+		progress ProgressFunc
+	}
+)
+
+func (pr *progressReader) Read(p []byte) (int, error) {
+	n, err := pr.r.Read(p)
+	if n > 0 {
+		pr.sent += int64(n)
+		pr.progress(pr.sent, pr.total)
+	}
+	return n, err
+}
@@ -0,0 +1,87 @@
+package chartmuseum
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// retryBackoff is the delay before the first retry, doubled for each of
+// the next ones
+var retryBackoff = time.Second
+
+// retryTransport retries requests failing with a network error or a
+// transient status. Only idempotent requests and chart uploads are
+// retried, and only when their body can be replayed.
+type retryTransport struct {
+	next    http.RoundTripper
+	retries int
+}
+
+type (
+	// uploadKey marks the chart upload requests, retried although not
+	// idempotent, see Retried
+	uploadKey struct{}
+	// attemptKey holds the attempt number of a retried request
+	attemptKey struct{}
+)
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	delay := retryBackoff
+	for attempt := 0; ; attempt++ {
+		resp, err := t.next.RoundTrip(req)
+		replayable := req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+		if attempt >= t.retries || !replayable || !retryable(req) || !isTransient(resp, err) || req.Context().Err() != nil {
+			return resp, err
+		}
+		if resp != nil {
+			io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		select {
+		case <-time.After(delay):
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+		delay *= 2
+
+		req = req.Clone(context.WithValue(req.Context(), attemptKey{}, attempt+1))
+		if req.GetBody != nil {
+			if req.Body, err = req.GetBody(); err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+// retryable tells if req may be sent again: sending an idempotent request
+// twice has the effect of sending it once. An upload stored by an attempt
+// whose answer is lost is refused with a conflict by the next one, see
+// Retried.
+func retryable(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut:
+		return true
+	}
+	return req.Context().Value(uploadKey{}) != nil
+}
+
+// Retried tells if resp answers a request sent again after a failed
+// attempt, the failed attempts may have been processed by the server
+func Retried(resp *http.Response) bool {
+	return resp != nil && resp.Request != nil && resp.Request.Context().Value(attemptKey{}) != nil
+}
+
+// isTransient tells if the outcome of a request may change when retried
+func isTransient(resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
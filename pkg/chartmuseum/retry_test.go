@@ -0,0 +1,95 @@
+package chartmuseum
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRetries(t *testing.T) {
+	defer func(d time.Duration) { retryBackoff = d }(retryBackoff)
+	retryBackoff = time.Millisecond
+
+	attempts := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if r.URL.Path == "/api/charts" {
+			// the body must be sent again on each attempt
+			if _, _, err := r.FormFile("chart"); err != nil {
+				t.Errorf("expected chart in attempt %d: %s", attempts, err)
+			}
+		}
+		if attempts < 3 {
+			w.WriteHeader(503)
+			return
+		}
+		w.WriteHeader(201)
+	}))
+	defer ts.Close()
+
+	cmClient, err := NewClient(URL(ts.URL), Retries(2))
+	if err != nil {
+		t.Fatalf("expect creating a client instance but met error: %s", err)
+	}
+	resp, err := cmClient.UploadChartPackage(testTarballPath, false)
+	if err != nil {
+		t.Fatal("error uploading chart package", err)
+	}
+	if resp.StatusCode != 201 || attempts != 3 {
+		t.Errorf("expected success after 3 attempts, got %d after %d", resp.StatusCode, attempts)
+	}
+
+	attempts = -10
+	resp, err = cmClient.DownloadFile("index.yaml")
+	if err != nil {
+		t.Fatal("error downloading index", err)
+	}
+	ioutil.ReadAll(resp.Body)
+	if resp.StatusCode != 503 || attempts != -7 {
+		t.Errorf("expected 503 after 3 attempts, got %d after %d", resp.StatusCode, attempts+10)
+	}
+
+	// without retries the first answer is returned
+	attempts = 0
+	if cmClient, err = NewClient(URL(ts.URL)); err != nil {
+		t.Fatalf("expect creating a client instance but met error: %s", err)
+	}
+	if resp, err = cmClient.DownloadFile("index.yaml"); err != nil || resp.StatusCode != 503 || attempts != 1 {
+		t.Errorf("expected a single attempt, got %v, %v after %d", resp, err, attempts)
+	}
+}
+
+func TestRetriesIdempotent(t *testing.T) {
+	defer func(d time.Duration) { retryBackoff = d }(retryBackoff)
+	retryBackoff = time.Millisecond
+
+	attempts := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.WriteHeader(503)
+	}))
+	defer ts.Close()
+
+	cmClient, err := NewClient(URL(ts.URL), Retries(2))
+	if err != nil {
+		t.Fatalf("expect creating a client instance but met error: %s", err)
+	}
+	// a deletion is not idempotent, ChartMuseum answers 404 once deleted
+	resp, err := cmClient.DeleteChartVersion("mychart", "0.1.0")
+	if err != nil {
+		t.Fatal("error deleting chart version", err)
+	}
+	if attempts != 1 || Retried(resp) {
+		t.Errorf("expected a single attempt, got %d", attempts)
+	}
+
+	attempts = 0
+	if resp, err = cmClient.UploadChartPackage(testTarballPath, false); err != nil {
+		t.Fatal("error uploading chart package", err)
+	}
+	if attempts != 3 || !Retried(resp) {
+		t.Errorf("expected the upload to be retried, got %d attempts", attempts)
+	}
+}
@@ -0,0 +1,121 @@
+package chartmuseum
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultSignatureHeader carries the request signature when no other
+	// header is configured
+	DefaultSignatureHeader = "X-Signature"
+	// ContentHashHeader carries the hex encoded SHA-256 hash of the body
+	// of signed requests
+	ContentHashHeader = "X-Content-SHA256"
+)
+
+// Signing signs the requests with an HMAC-SHA256 key, for gateways
+// requiring signed requests, see Signature
+type Signing struct {
+	// Key is the HMAC key, requests are only signed when it is set
+	Key string `json:"key,omitempty"`
+	// Header replaces the X-Signature header name
+	Header string `json:"header,omitempty"`
+}
+
+// Validate checks the header name
+func (s Signing) Validate() error {
+	if strings.ContainsAny(s.Header, " \t\r\n:") {
+		return fmt.Errorf("signing: invalid header name %q", s.Header)
+	}
+	switch http.CanonicalHeaderKey(s.Header) {
+	case "Date", "Authorization", http.CanonicalHeaderKey(ContentHashHeader):
+		return fmt.Errorf("signing: header %s is reserved", s.Header)
+	}
+	return nil
+}
+
+// header returns the name of the header carrying the signature
+func (s Signing) header() string {
+	if s.Header == "" {
+		return DefaultSignatureHeader
+	}
+	return s.Header
+}
+
+// Signature returns the hex encoded HMAC-SHA256 of a request with key,
+// computed over its method, request URI (path and query), Date header and
+// the hex encoded SHA-256 hash of its body, separated by newlines
+func Signature(key, method, requestURI, date, contentHash string) string {
+	mac := hmac.New(sha256.New, []byte(key))
+	fmt.Fprintf(mac, "%s\n%s\n%s\n%s", method, requestURI, date, contentHash)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// signTransport signs the requests sent to host, each attempt and
+// redirect is signed with its own date
+type signTransport struct {
+	next    http.RoundTripper
+	host    string
+	signing Signing
+}
+
+func (t *signTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Host != t.host {
+		return t.next.RoundTrip(req)
+	}
+	req = req.Clone(req.Context())
+	contentHash, err := hashBody(req)
+	if err != nil {
+		return nil, err
+	}
+	date := time.Now().UTC().Format(http.TimeFormat)
+	req.Header.Set("Date", date)
+	req.Header.Set(ContentHashHeader, contentHash)
+	req.Header.Set(t.signing.header(), Signature(t.signing.Key, req.Method, req.URL.RequestURI(), date, contentHash))
+	return t.next.RoundTrip(req)
+}
+
+// hashBody returns the hex encoded SHA-256 hash of the body of req. Upload
+// bodies are hashed from their content, others are read and replaced.
+func hashBody(req *http.Request) (string, error) {
+	var data []byte
+	switch body := req.Body.(type) {
+	case nil:
+	case *uploadBody:
+		data = body.data
+	default:
+		if body == http.NoBody {
+			break
+		}
+		b, err := ioutil.ReadAll(body)
+		body.Close()
+		if err != nil {
+			return "", err
+		}
+		data = b
+		req.Body = ioutil.NopCloser(bytes.NewReader(b))
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// uploadBody is the body of upload requests, its content is kept so that
+// it can be hashed without reading the body and reporting progress
+type uploadBody struct {
+	io.Reader
+	data []byte
+}
+
+// Close implements io.Closer
+func (*uploadBody) Close() error {
+	return nil
+}
@@ -0,0 +1,100 @@
+package chartmuseum
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequestSigning(t *testing.T) {
+	var signed []string
+	verify := func(w http.ResponseWriter, r *http.Request) bool {
+		body, _ := ioutil.ReadAll(r.Body)
+		sum := sha256.Sum256(body)
+		contentHash := hex.EncodeToString(sum[:])
+		if r.Header.Get(ContentHashHeader) != contentHash {
+			t.Errorf("expected body hash %s for %s, got %q", contentHash, r.URL, r.Header.Get(ContentHashHeader))
+		}
+		if r.Header.Get("X-Gateway-Signature") != Signature("key", r.Method, r.RequestURI, r.Header.Get("Date"), contentHash) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return false
+		}
+		signed = append(signed, r.Method+" "+r.RequestURI)
+		return true
+	}
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Gateway-Signature") != "" || r.Header.Get(ContentHashHeader) != "" {
+			t.Errorf("expected no signature sent to another host, got %v", r.Header)
+		}
+	}))
+	defer other.Close()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !verify(w, r) {
+			return
+		}
+		switch r.URL.Path {
+		case "/moved":
+			http.Redirect(w, r, "/index.yaml", http.StatusFound)
+		case "/elsewhere":
+			http.Redirect(w, r, other.URL+"/index.yaml", http.StatusFound)
+		case "/api/charts":
+			w.WriteHeader(http.StatusCreated)
+		}
+	}))
+	defer ts.Close()
+
+	progress := 0
+	cmClient, err := NewClient(URL(ts.URL), RequestSigning(Signing{Key: "key", Header: "X-Gateway-Signature"}), Progress(func(sent, total int64) { progress++ }))
+	if err != nil {
+		t.Fatalf("expect creating a client instance but met error: %s", err)
+	}
+	resp, err := cmClient.UploadChartPackage(testTarballPath, true)
+	if err != nil || resp.StatusCode != http.StatusCreated {
+		t.Fatalf("expected signed upload to succeed, got %v, %v", resp, err)
+	}
+	if progress == 0 {
+		t.Error("expected upload progress to be reported")
+	}
+	for _, file := range []string{"index.yaml", "moved", "elsewhere"} {
+		resp, err := cmClient.DownloadFile(file)
+		if err != nil || resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected signed download of %s to succeed, got %v, %v", file, resp, err)
+		}
+		resp.Body.Close()
+	}
+	expected := []string{"POST /api/charts?force", "GET /index.yaml", "GET /moved", "GET /index.yaml", "GET /elsewhere"}
+	if len(signed) != len(expected) {
+		t.Fatalf("expected signed requests %v, got %v", expected, signed)
+	}
+	for i := range expected {
+		if signed[i] != expected[i] {
+			t.Errorf("expected signed requests %v, got %v", expected, signed)
+			break
+		}
+	}
+
+	cmClient, _ = NewClient(URL(ts.URL), RequestSigning(Signing{Key: "other", Header: "X-Gateway-Signature"}))
+	resp, err = cmClient.DownloadFile("index.yaml")
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected request signed with another key to be rejected, got %v, %v", resp, err)
+	}
+}
+
+func TestSigningValidate(t *testing.T) {
+	for _, s := range []Signing{{}, {Header: "X-Gateway-Signature"}} {
+		if err := s.Validate(); err != nil {
+			t.Errorf("unexpected error validating %+v: %s", s, err)
+		}
+	}
+	for _, s := range []Signing{{Header: "X Signature"}, {Header: "date"}, {Header: ContentHashHeader}} {
+		if err := s.Validate(); err == nil {
+			t.Errorf("expected error validating %+v, instead got nil", s)
+		}
+	}
+	if _, err := NewClient(URL("https://charts.example.com"), RequestSigning(Signing{Key: "key", Header: "Authorization"})); err == nil {
+		t.Error("expected error creating client with invalid signing header, instead got nil")
+	}
+}
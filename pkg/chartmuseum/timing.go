@@ -0,0 +1,27 @@
+package chartmuseum
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// FirstRoundTripFunc receives the start and duration of the first round
+// trip of a client
+type FirstRoundTripFunc func(start time.Time, duration time.Duration)
+
+// firstRoundTripTransport reports the first round trip, retries included.
+// It pays for the connection, the TLS handshake and the Cloudflare Access
+// check of the credentials, the next requests reuse the connection.
+type firstRoundTripTransport struct {
+	next http.RoundTripper
+	fn   FirstRoundTripFunc
+	once sync.Once
+}
+
+func (t *firstRoundTripTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	t.once.Do(func() { t.fn(start, time.Since(start)) })
+	return resp, err
+}
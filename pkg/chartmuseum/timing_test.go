@@ -0,0 +1,35 @@
+package chartmuseum
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestFirstRoundTrip(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(10 * time.Millisecond)
+	}))
+	defer ts.Close()
+
+	calls := 0
+	var took time.Duration
+	cmClient, err := NewClient(URL(ts.URL), FirstRoundTrip(func(start time.Time, d time.Duration) {
+		calls++
+		took = d
+	}))
+	if err != nil {
+		t.Fatalf("expect creating a client instance but met error: %s", err)
+	}
+	for i := 0; i < 2; i++ {
+		resp, err := cmClient.DownloadFile("index.yaml")
+		if err != nil {
+			t.Fatal("error downloading index", err)
+		}
+		resp.Body.Close()
+	}
+	if calls != 1 || took < 10*time.Millisecond {
+		t.Errorf("expected the first round trip only, got %d calls, %s", calls, took)
+	}
+}
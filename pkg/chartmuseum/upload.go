@@ -2,30 +2,60 @@ package chartmuseum
 
 import (
 	"bytes"
+	"context"
 	"io"
-	"io/ioutil"
 	"mime/multipart"
 	"net/http"
 	"net/url"
-	"os"
 	"path"
 	"strings"
+
+	"github.com/IxDay/helm-push-cloudflare-access/pkg/vfs"
 )
 
-const (
-	cfHeaderId     = "CF-Access-Client-Id"
-	cfHeaderSecret = "CF-Access-Client-Secret"
+type (
+	// formFile is a file field of an upload request
+	formFile struct {
+		field string
+		path  string
+	}
 )
 
 // UploadChartPackage uploads a chart package to ChartMuseum (POST /api/charts)
 func (client *Client) UploadChartPackage(chartPackagePath string, force bool) (*http.Response, error) {
+	resp, err := client.uploadChart(force, formFile{"chart", chartPackagePath})
+	if err != nil {
+		return nil, err
+	}
+	return client.followPresigned(resp, chartPackagePath)
+}
+
+// UploadChartWithProvenance uploads a chart package and its provenance
+// file in a single request (POST /api/charts), ChartMuseum stores both or
+// none. Presigned uploads only cover the package, the provenance file is
+// then uploaded once the package is stored.
+func (client *Client) UploadChartWithProvenance(chartPackagePath, provPath string, force bool) (*http.Response, error) {
+	resp, err := client.uploadChart(force, formFile{"chart", chartPackagePath}, formFile{"prov", provPath})
+	if err != nil {
+		return nil, err
+	}
+	accepted := resp.StatusCode == http.StatusAccepted
+	if resp, err = client.followPresigned(resp, chartPackagePath); err != nil || !accepted || resp.StatusCode != http.StatusCreated {
+		return resp, err
+	}
+	resp.Body.Close()
+	return client.UploadProvenanceFile(provPath, force)
+}
+
+// uploadChart posts files to the chart upload API
+func (client *Client) uploadChart(force bool, files ...formFile) (*http.Response, error) {
 	u, err := url.Parse(client.opts.url)
 	if err != nil {
 		return nil, err
 	}
 
 	u.Path = path.Join(client.opts.contextPath, "api", strings.TrimPrefix(u.Path, client.opts.contextPath), "charts")
-	req, err := http.NewRequest("POST", u.String(), nil)
+	req, err := http.NewRequestWithContext(context.WithValue(context.Background(), uploadKey{}, true), "POST", u.String(), nil)
 	if err != nil {
 		return nil, err
 	}
@@ -35,35 +65,89 @@ func (client *Client) UploadChartPackage(chartPackagePath string, force bool) (*
 		req.URL.RawQuery = "force"
 	}
 
-	err = setUploadChartPackageRequestBody(req, chartPackagePath)
+	err = setUploadRequestBody(req, client.filesystem(), client.opts.progress, files...)
 	if err != nil {
 		return nil, err
 	}
 
-	req.Header.Set(cfHeaderId, client.opts.clientID)
-	req.Header.Set(cfHeaderSecret, client.opts.clientSecret)
+	client.setCredentials(req)
 	return client.Do(req)
 }
 
-func setUploadChartPackageRequestBody(req *http.Request, chartPackagePath string) error {
+// UploadProvenanceFile uploads the provenance file of a chart package to
+// ChartMuseum (POST /api/prov)
+func (client *Client) UploadProvenanceFile(provPath string, force bool) (*http.Response, error) {
+	u, err := url.Parse(client.opts.url)
+	if err != nil {
+		return nil, err
+	}
+
+	u.Path = path.Join(client.opts.contextPath, "api", strings.TrimPrefix(u.Path, client.opts.contextPath), "prov")
+	req, err := http.NewRequest("POST", u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if force {
+		req.URL.RawQuery = "force"
+	}
+	if err := setUploadRequestBody(req, client.filesystem(), nil, formFile{"prov", provPath}); err != nil {
+		return nil, err
+	}
+
+	client.setCredentials(req)
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	return client.followPresigned(resp, provPath)
+}
+
+// filesystem returns the filesystem the uploaded files are read from
+func (client *Client) filesystem() vfs.FS {
+	if client.opts.fsys == nil {
+		return vfs.OS
+	}
+	return client.opts.fsys
+}
+
+// setUploadRequestBody sets a multipart body with files read from fsys
+func setUploadRequestBody(req *http.Request, fsys vfs.FS, progress ProgressFunc, files ...formFile) error {
 	var body bytes.Buffer
 	w := multipart.NewWriter(&body)
-	defer w.Close()
-	fw, err := w.CreateFormFile("chart", chartPackagePath)
-	if err != nil {
+	for _, f := range files {
+		if err := writeFormFile(w, fsys, f); err != nil {
+			return err
+		}
+	}
+	if err := w.Close(); err != nil {
 		return err
 	}
-	w.FormDataContentType()
-	fd, err := os.Open(chartPackagePath)
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	req.ContentLength = int64(body.Len())
+	// GetBody lets the body be sent again on retries and redirects
+	data := body.Bytes()
+	req.GetBody = func() (io.ReadCloser, error) {
+		var r io.Reader = bytes.NewReader(data)
+		if progress != nil {
+			r = &progressReader{r: r, total: int64(len(data)), progress: progress}
+		}
+		return &uploadBody{Reader: r, data: data}, nil
+	}
+	req.Body, _ = req.GetBody()
+	return nil
+}
+
+// writeFormFile adds the file f of fsys to the multipart body of w
+func writeFormFile(w *multipart.Writer, fsys vfs.FS, f formFile) error {
+	fw, err := w.CreateFormFile(f.field, f.path)
 	if err != nil {
 		return err
 	}
-	defer fd.Close()
-	_, err = io.Copy(fw, fd)
+	fd, err := fsys.Open(f.path)
 	if err != nil {
 		return err
 	}
-	req.Header.Set("Content-Type", w.FormDataContentType())
-	req.Body = ioutil.NopCloser(&body)
-	return nil
+	defer fd.Close()
+	_, err = io.Copy(fw, fd)
+	return err
 }
@@ -3,9 +3,12 @@ package chartmuseum
 import (
 	"crypto/rand"
 	"crypto/tls"
-	"encoding/base64"
+	"fmt"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
@@ -25,11 +28,10 @@ var (
 func TestUploadChartPackage(t *testing.T) {
 	chartUploaded := false
 
-	basicAuthHeader := "Basic " + base64.StdEncoding.EncodeToString([]byte("user:pass"))
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if !strings.HasPrefix(r.URL.String(), "/my/context/path") {
 			w.WriteHeader(404)
-		} else if r.Header.Get("Authorization") != basicAuthHeader {
+		} else if !hasAccessHeaders(r, "user", "pass") {
 			w.WriteHeader(401)
 		} else if chartUploaded {
 			if _, ok := r.URL.Query()["force"]; ok {
@@ -47,8 +49,8 @@ func TestUploadChartPackage(t *testing.T) {
 	// Happy path
 	cmClient, err := NewClient(
 		URL(ts.URL),
-		Username("user"),
-		Password("pass"),
+		ClientID("user"),
+		ClientSecret("pass"),
 		ContextPath("/my/context/path"),
 	)
 	if err != nil {
@@ -96,8 +98,8 @@ func TestUploadChartPackage(t *testing.T) {
 	// Bad context path
 	cmClient, err = NewClient(
 		URL(ts.URL),
-		Username("user"),
-		Password("pass"),
+		ClientID("user"),
+		ClientSecret("pass"),
 		ContextPath("/my/crappy/context/path"),
 		Timeout(5),
 	)
@@ -113,35 +115,35 @@ func TestUploadChartPackage(t *testing.T) {
 		t.Errorf("expecting 404 instead got %d", resp.StatusCode)
 	}
 
-	// Unauthorized, invalid user/pass combo (basic auth)
+	// Unauthorized, invalid client id/secret combo (access headers)
 	cmClient, err = NewClient(
 		URL(ts.URL),
-		Username("baduser"),
-		Password("badpass"),
+		ClientID("baduser"),
+		ClientSecret("badpass"),
 		ContextPath("/my/context/path"),
 	)
 	if err != nil {
-		t.Fatalf("[unauthorized: invalid user/pass] expect creating a client instance but met error: %s", err)
+		t.Fatalf("[unauthorized: invalid client id/secret] expect creating a client instance but met error: %s", err)
 	}
 	resp, err = cmClient.UploadChartPackage(testTarballPath, false)
 	if err != nil {
-		t.Error("unexpected error with invalid user/pass combo (basic auth)", err)
+		t.Error("unexpected error with invalid client id/secret combo (access headers)", err)
 	}
 	if resp.StatusCode != 401 {
 		t.Errorf("expecting 401 instead got %d", resp.StatusCode)
 	}
 
-	// Unauthorized, missing user/pass combo (basic auth)
+	// Unauthorized, missing client id/secret combo (access headers)
 	cmClient, err = NewClient(
 		URL(ts.URL),
 		ContextPath("/my/context/path"),
 	)
 	if err != nil {
-		t.Fatalf("[unauthorized: missing user/pass] expect creating a client instance but met error: %s", err)
+		t.Fatalf("[unauthorized: missing client id/secret] expect creating a client instance but met error: %s", err)
 	}
 	resp, err = cmClient.UploadChartPackage(testTarballPath, false)
 	if err != nil {
-		t.Error("unexpected error with missing user/pass combo (basic auth)", err)
+		t.Error("unexpected error with missing client id/secret combo (access headers)", err)
 	}
 	if resp.StatusCode != 401 {
 		t.Errorf("expecting 401 instead got %d", resp.StatusCode)
@@ -149,11 +151,10 @@ func TestUploadChartPackage(t *testing.T) {
 }
 
 func TestUploadChartPackageWithTlsServer(t *testing.T) {
-	basicAuthHeader := "Basic " + base64.StdEncoding.EncodeToString([]byte("user:pass"))
 	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if !strings.HasPrefix(r.URL.String(), "/my/context/path") {
 			w.WriteHeader(404)
-		} else if r.Header.Get("Authorization") != basicAuthHeader {
+		} else if !hasAccessHeaders(r, "user", "pass") {
 			w.WriteHeader(401)
 		} else {
 			w.WriteHeader(201)
@@ -174,8 +175,8 @@ func TestUploadChartPackageWithTlsServer(t *testing.T) {
 	//Without certificate
 	cmClient, err := NewClient(
 		URL(ts.URL),
-		Username("user"),
-		Password("pass"),
+		ClientID("user"),
+		ClientSecret("pass"),
 		ContextPath("/my/context/path"),
 	)
 	if err != nil {
@@ -190,8 +191,8 @@ func TestUploadChartPackageWithTlsServer(t *testing.T) {
 	//Enable insecure flag
 	cmClient, err = NewClient(
 		URL(ts.URL),
-		Username("user"),
-		Password("pass"),
+		ClientID("user"),
+		ClientSecret("pass"),
 		ContextPath("/my/context/path"),
 		InsecureSkipVerify(true),
 	)
@@ -210,8 +211,8 @@ func TestUploadChartPackageWithTlsServer(t *testing.T) {
 	//Upload with ca file
 	cmClient, err = NewClient(
 		URL(ts.URL),
-		Username("user"),
-		Password("pass"),
+		ClientID("user"),
+		ClientSecret("pass"),
 		ContextPath("/my/context/path"),
 		CAFile(testServerCAPath),
 	)
@@ -229,11 +230,10 @@ func TestUploadChartPackageWithTlsServer(t *testing.T) {
 }
 
 func TestUploadChartPackageWithVerifyingClientCert(t *testing.T) {
-	basicAuthHeader := "Basic " + base64.StdEncoding.EncodeToString([]byte("user:pass"))
 	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if !strings.HasPrefix(r.URL.String(), "/my/context/path") {
 			w.WriteHeader(404)
-		} else if r.Header.Get("Authorization") != basicAuthHeader {
+		} else if !hasAccessHeaders(r, "user", "pass") {
 			w.WriteHeader(401)
 		} else {
 			w.WriteHeader(201)
@@ -262,8 +262,8 @@ func TestUploadChartPackageWithVerifyingClientCert(t *testing.T) {
 	//Upload with cert and key files
 	cmClient, err := NewClient(
 		URL(ts.URL),
-		Username("user"),
-		Password("pass"),
+		ClientID("user"),
+		ClientSecret("pass"),
 		ContextPath("/my/context/path"),
 		KeyFile(testClientKeyPath),
 		CertFile(testClientCertPath),
@@ -281,3 +281,88 @@ func TestUploadChartPackageWithVerifyingClientCert(t *testing.T) {
 		t.Fatalf("[upload with cert and key files] expect status code 201 but got %d", resp.StatusCode)
 	}
 }
+
+func TestUploadChartPackageProgress(t *testing.T) {
+	var received int64
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.ContentLength
+		w.WriteHeader(201)
+	}))
+	defer ts.Close()
+
+	var sent, total int64
+	cmClient, err := NewClient(URL(ts.URL), Progress(func(s, t int64) { sent, total = s, t }))
+	if err != nil {
+		t.Fatalf("expect creating a client instance but met error: %s", err)
+	}
+	resp, err := cmClient.UploadChartPackage(testTarballPath, false)
+	if err != nil {
+		t.Fatal("error uploading chart package", err)
+	}
+	if resp.StatusCode != 201 {
+		t.Errorf("expecting 201 instead got %d", resp.StatusCode)
+	}
+	if total == 0 || sent != total || received != total {
+		t.Errorf("expected whole body to be reported, got sent=%d total=%d received=%d", sent, total, received)
+	}
+}
+
+func TestUploadChartWithProvenance(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "helm-push-test")
+	if err != nil {
+		t.Fatal("unexpected error creating temp test dir", err)
+	}
+	defer os.RemoveAll(tmp)
+	provPath := filepath.Join(tmp, "mychart-0.1.0.tgz.prov")
+	ioutil.WriteFile(provPath, []byte("signature"), 0644)
+
+	storage := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(200)
+	}))
+	defer storage.Close()
+
+	presigned := false
+	var requests []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			w.WriteHeader(400)
+			return
+		}
+		fields := []string{r.URL.Path}
+		for _, field := range []string{"chart", "prov"} {
+			if _, _, err := r.FormFile(field); err == nil {
+				fields = append(fields, field)
+			}
+		}
+		requests = append(requests, strings.Join(fields, " "))
+		if presigned && r.URL.Path == "/api/charts" {
+			w.WriteHeader(202)
+			fmt.Fprintf(w, `{"upload_url": %q}`, storage.URL+"/bucket/mychart-0.1.0.tgz")
+			return
+		}
+		w.WriteHeader(201)
+	}))
+	defer ts.Close()
+
+	cmClient, err := NewClient(URL(ts.URL))
+	if err != nil {
+		t.Fatalf("expect creating a client instance but met error: %s", err)
+	}
+	resp, err := cmClient.UploadChartWithProvenance(testTarballPath, provPath, false)
+	if err != nil || resp.StatusCode != 201 {
+		t.Fatalf("expected chart and provenance file to be uploaded, got %v, %v", resp, err)
+	}
+	if strings.Join(requests, ", ") != "/api/charts chart prov" {
+		t.Errorf("expected a single request with both files, got %q", requests)
+	}
+
+	// Presigned uploads only hold the package
+	presigned, requests = true, nil
+	resp, err = cmClient.UploadChartWithProvenance(testTarballPath, provPath, false)
+	if err != nil || resp.StatusCode != 201 {
+		t.Fatalf("expected chart and provenance file to be uploaded, got %v, %v", resp, err)
+	}
+	if strings.Join(requests, ", ") != "/api/charts chart prov, /api/prov prov" {
+		t.Errorf("expected provenance file to be uploaded after the package, got %q", requests)
+	}
+}
@@ -0,0 +1,46 @@
+package chartmuseumtest
+
+import "strings"
+
+type (
+	// Option allows specifying various settings
+	Option func(*options)
+
+	// options specify optional settings
+	options struct {
+		contextPath    string
+		clientID       string
+		clientSecret   string
+		allowOverwrite bool
+	}
+)
+
+// ContextPath serves the repository under contextPath, which is then
+// advertised in the serverInfo of the index, as ChartMuseum's --context-path
+func ContextPath(contextPath string) Option {
+	return func(opts *options) {
+		opts.contextPath = "/" + strings.Trim(contextPath, "/")
+		if opts.contextPath == "/" {
+			opts.contextPath = ""
+		}
+	}
+}
+
+// RequireAccess rejects the requests without the Cloudflare Access
+// service token clientID and clientSecret, as Cloudflare Access would:
+// requests without token are redirected to the Access login page, requests
+// with another token are forbidden
+func RequireAccess(clientID, clientSecret string) Option {
+	return func(opts *options) {
+		opts.clientID = clientID
+		opts.clientSecret = clientSecret
+	}
+}
+
+// AllowOverwrite lets uploads replace existing chart versions without
+// ?force, as ChartMuseum's --allow-overwrite
+func AllowOverwrite(allow bool) Option {
+	return func(opts *options) {
+		opts.allowOverwrite = allow
+	}
+}
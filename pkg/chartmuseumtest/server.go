@@ -0,0 +1,478 @@
+// Package chartmuseumtest provides an in-process fake ChartMuseum server,
+// to test chart publishing flows without a real ChartMuseum behind
+// Cloudflare Access
+package chartmuseumtest
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ghodss/yaml"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/repo"
+)
+
+const (
+	cfHeaderId     = "CF-Access-Client-Id"
+	cfHeaderSecret = "CF-Access-Client-Secret"
+
+	// AccessLoginURL is where requests without Access token are redirected
+	// with RequireAccess
+	AccessLoginURL = "https://chartmuseumtest.cloudflareaccess.com/cdn-cgi/access/login"
+)
+
+type (
+	// Server is a fake ChartMuseum serving the index, packages and
+	// provenance files, and the upload, delete and chart API. It is safe
+	// for concurrent use.
+	Server struct {
+		*httptest.Server
+		opts     options
+		mu       sync.Mutex
+		charts   map[string]*Chart
+		faults   []*Fault
+		requests []Request
+	}
+
+	// Chart is a chart version stored by the server
+	Chart struct {
+		Name    string
+		Version string
+		// Package is the .tgz package, Provenance the provenance file, nil
+		// when there is none
+		Package    []byte
+		Provenance []byte
+		entry      *repo.ChartVersion
+	}
+
+	// Request is a request received by the server
+	Request struct {
+		Method string
+		// Path is relative to the context path
+		Path     string
+		RawQuery string
+		Header   http.Header
+	}
+
+	// Fault makes the server fail the matching requests, before checking
+	// the Access token
+	Fault struct {
+		// Method and Path select the requests, all of them when empty. Path
+		// is relative to the context path, a path.Match pattern.
+		Method string
+		Path   string
+		// Status is the status of the response, with a ChartMuseum error
+		Status int
+		// Drop closes the connection without response, as a network error
+		Drop bool
+		// Lost serves the request before failing it with Status or Drop,
+		// as when the response is lost on its way back
+		Lost bool
+		// Corrupt serves the request with a body altered in transit, when
+		// neither Status nor Drop is set
+		Corrupt bool
+		// Delay is waited before failing, or before serving the request
+		// when neither Status nor Drop is set
+		Delay time.Duration
+		// Times is the number of requests failed, all of them when 0
+		Times int
+	}
+)
+
+// NewServer starts a fake ChartMuseum with an empty repository, it must
+// be closed once done
+func NewServer(opts ...Option) *Server {
+	s := &Server{charts: map[string]*Chart{}}
+	for _, opt := range opts {
+		opt(&s.opts)
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// RepoURL returns the URL of the repository, with the context path
+func (s *Server) RepoURL() string {
+	return s.URL + s.opts.contextPath
+}
+
+// AddChart stores the chart package pkg and its provenance file prov, nil
+// when there is none, replacing the chart version if it exists
+func (s *Server) AddChart(pkg, prov []byte) (*Chart, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.store(pkg, prov, true)
+}
+
+// Chart returns the chart version name stored by the server
+func (s *Server) Chart(name, version string) (*Chart, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.charts[packageName(name, version)]
+	if !ok {
+		return nil, false
+	}
+	cc := *c
+	return &cc, true
+}
+
+// Charts returns the chart versions stored by the server, sorted by name
+// and version
+func (s *Server) Charts() []Chart {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var charts []Chart
+	for _, c := range s.charts {
+		charts = append(charts, *c)
+	}
+	sort.Slice(charts, func(i, j int) bool {
+		if charts[i].Name != charts[j].Name {
+			return charts[i].Name < charts[j].Name
+		}
+		return charts[i].Version < charts[j].Version
+	})
+	return charts
+}
+
+// InjectFault makes the server fail the requests matching f
+func (s *Server) InjectFault(f Fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = append(s.faults, &f)
+}
+
+// ClearFaults removes the injected faults
+func (s *Server) ClearFaults() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = nil
+}
+
+// Requests returns the requests received so far, rejected ones included
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Request{}, s.requests...)
+}
+
+// Unauthenticated returns the requests received without the Access token
+// set with RequireAccess, or without any Access token otherwise
+func (s *Server) Unauthenticated() []Request {
+	var requests []Request
+	for _, r := range s.Requests() {
+		if !s.authenticated(r.Header) {
+			requests = append(requests, r)
+		}
+	}
+	return requests
+}
+
+// authenticated tells if header carries the expected Access token
+func (s *Server) authenticated(header http.Header) bool {
+	if s.opts.clientID == "" && s.opts.clientSecret == "" {
+		return header.Get(cfHeaderId) != "" && header.Get(cfHeaderSecret) != ""
+	}
+	return header.Get(cfHeaderId) == s.opts.clientID && header.Get(cfHeaderSecret) == s.opts.clientSecret
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	rel, inRepo := r.URL.Path, true
+	if s.opts.contextPath != "" {
+		inRepo = strings.HasPrefix(rel, s.opts.contextPath+"/")
+		rel = strings.TrimPrefix(rel, s.opts.contextPath)
+	}
+	s.mu.Lock()
+	s.requests = append(s.requests, Request{Method: r.Method, Path: rel, RawQuery: r.URL.RawQuery, Header: r.Header.Clone()})
+	fault := s.fault(r.Method, rel)
+	s.mu.Unlock()
+
+	if fault != nil {
+		time.Sleep(fault.Delay)
+		if fault.Lost {
+			s.serve(httptest.NewRecorder(), r, rel, inRepo)
+		}
+		if fault.Drop {
+			if hj, ok := w.(http.Hijacker); ok {
+				if conn, _, err := hj.Hijack(); err == nil {
+					conn.Close()
+					return
+				}
+			}
+		}
+		if fault.Status != 0 {
+			writeError(w, fault.Status, "injected fault")
+			return
+		}
+		if fault.Corrupt {
+			rec := httptest.NewRecorder()
+			s.serve(rec, r, rel, inRepo)
+			body := rec.Body.Bytes()
+			if len(body) > 0 {
+				body[len(body)-1] ^= 0xff
+			}
+			for k, v := range rec.Header() {
+				w.Header()[k] = v
+			}
+			w.WriteHeader(rec.Code)
+			w.Write(body)
+			return
+		}
+	}
+	s.serve(w, r, rel, inRepo)
+}
+
+// serve checks the Access token and serves the request for the path rel
+func (s *Server) serve(w http.ResponseWriter, r *http.Request, rel string, inRepo bool) {
+	if s.opts.clientID != "" || s.opts.clientSecret != "" {
+		if r.Header.Get(cfHeaderId) == "" && r.Header.Get(cfHeaderSecret) == "" {
+			http.Redirect(w, r, AccessLoginURL+"/"+r.Host, http.StatusFound)
+			return
+		}
+		if !s.authenticated(r.Header) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+	}
+	if !inRepo {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+	s.route(w, r, rel)
+}
+
+// fault returns the first fault matching the request and counts it, s.mu
+// must be held
+func (s *Server) fault(method, rel string) *Fault {
+	for i, f := range s.faults {
+		if f.Method != "" && f.Method != method {
+			continue
+		}
+		if ok, _ := path.Match(f.Path, rel); f.Path != "" && !ok {
+			continue
+		}
+		if f.Times > 0 {
+			if f.Times--; f.Times == 0 {
+				s.faults = append(s.faults[:i:i], s.faults[i+1:]...)
+			}
+		}
+		return f
+	}
+	return nil
+}
+
+// route serves the request for the path rel, relative to the context path
+func (s *Server) route(w http.ResponseWriter, r *http.Request, rel string) {
+	parts := strings.Split(strings.Trim(rel, "/"), "/")
+	switch {
+	case rel == "/index.yaml" && r.Method == http.MethodGet:
+		s.serveIndex(w)
+	case rel == "/health" && r.Method == http.MethodGet:
+		writeJSON(w, http.StatusOK, map[string]bool{"healthy": true})
+	case rel == "/info" && r.Method == http.MethodGet:
+		writeJSON(w, http.StatusOK, map[string]string{"version": "chartmuseumtest"})
+	case len(parts) == 2 && parts[0] == "charts" && r.Method == http.MethodGet:
+		s.serveFile(w, parts[1])
+	case rel == "/api/charts" && r.Method == http.MethodPost:
+		s.upload(w, r, "chart")
+	case rel == "/api/prov" && r.Method == http.MethodPost:
+		s.upload(w, r, "prov")
+	case len(parts) >= 2 && len(parts) <= 4 && parts[0] == "api" && parts[1] == "charts" && r.Method == http.MethodGet:
+		s.serveAPI(w, parts[2:])
+	case len(parts) == 4 && parts[0] == "api" && parts[1] == "charts" && r.Method == http.MethodDelete:
+		s.delete(w, parts[2], parts[3])
+	default:
+		writeError(w, http.StatusNotFound, "not found")
+	}
+}
+
+// serveIndex serves the index of the stored chart versions
+func (s *Server) serveIndex(w http.ResponseWriter) {
+	index := repo.NewIndexFile()
+	s.mu.Lock()
+	for _, c := range s.charts {
+		index.Entries[c.Name] = append(index.Entries[c.Name], c.entry)
+	}
+	s.mu.Unlock()
+	index.SortEntries()
+	if s.opts.contextPath != "" {
+		index.ServerInfo = map[string]interface{}{"contextPath": s.opts.contextPath}
+	}
+	b, err := yaml.Marshal(index)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-yaml")
+	w.Write(b)
+}
+
+// serveFile serves a package or provenance file
+func (s *Server) serveFile(w http.ResponseWriter, file string) {
+	s.mu.Lock()
+	var data []byte
+	if c, ok := s.charts[strings.TrimSuffix(file, ".prov")]; ok {
+		data = c.Package
+		if strings.HasSuffix(file, ".prov") {
+			data = c.Provenance
+		}
+	}
+	s.mu.Unlock()
+	if data == nil {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+	w.Write(data)
+}
+
+// serveAPI serves the chart API, args being the chart name and version
+func (s *Server) serveAPI(w http.ResponseWriter, args []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entries := map[string][]*repo.ChartVersion{}
+	for _, c := range s.charts {
+		entries[c.Name] = append(entries[c.Name], c.entry)
+	}
+	for _, versions := range entries {
+		sort.Sort(sort.Reverse(repo.ChartVersions(versions)))
+	}
+	switch len(args) {
+	case 0:
+		writeJSON(w, http.StatusOK, entries)
+	case 1:
+		if versions, ok := entries[args[0]]; ok {
+			writeJSON(w, http.StatusOK, versions)
+			return
+		}
+		writeError(w, http.StatusNotFound, "chart not found")
+	default:
+		if c, ok := s.charts[packageName(args[0], args[1])]; ok {
+			writeJSON(w, http.StatusOK, c.entry)
+			return
+		}
+		writeError(w, http.StatusNotFound, "improper constraint: "+args[1])
+	}
+}
+
+// upload stores the files of an upload request, field is the form field
+// of the main file, chart or prov
+func (s *Server) upload(w http.ResponseWriter, r *http.Request, field string) {
+	files, filenames := map[string][]byte{}, map[string]string{}
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		for _, name := range []string{"chart", "prov"} {
+			f, fh, err := r.FormFile(name)
+			if err != nil {
+				continue
+			}
+			filenames[name] = path.Base(strings.ReplaceAll(fh.Filename, "\\", "/"))
+			files[name], err = ioutil.ReadAll(f)
+			f.Close()
+			if err != nil {
+				writeError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+		}
+	} else if b, err := ioutil.ReadAll(r.Body); err == nil && len(b) > 0 && field == "chart" {
+		files[field] = b
+	}
+	if files[field] == nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("no %s file in request", field))
+		return
+	}
+	_, force := r.URL.Query()["force"]
+	force = force || s.opts.allowOverwrite
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if field == "prov" {
+		c, ok := s.charts[strings.TrimSuffix(filenames["prov"], ".prov")]
+		if !ok {
+			writeError(w, http.StatusNotFound, fmt.Sprintf("no chart package for %s", filenames["prov"]))
+			return
+		}
+		if c.Provenance != nil && !force {
+			writeError(w, http.StatusConflict, "file already exists")
+			return
+		}
+		c.Provenance = files["prov"]
+		writeJSON(w, http.StatusCreated, map[string]bool{"saved": true})
+		return
+	}
+	if _, err := s.store(files["chart"], files["prov"], force); err != nil {
+		status := http.StatusBadRequest
+		if err == errExists {
+			status = http.StatusConflict
+		}
+		writeError(w, status, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusCreated, map[string]bool{"saved": true})
+}
+
+var errExists = fmt.Errorf("file already exists")
+
+// store adds a chart version, s.mu must be held
+func (s *Server) store(pkg, prov []byte, force bool) (*Chart, error) {
+	ch, err := loader.LoadArchive(bytes.NewReader(pkg))
+	if err != nil {
+		return nil, err
+	}
+	name := packageName(ch.Name(), ch.Metadata.Version)
+	if _, ok := s.charts[name]; ok && !force {
+		return nil, errExists
+	}
+	sum := sha256.Sum256(pkg)
+	c := &Chart{
+		Name:       ch.Name(),
+		Version:    ch.Metadata.Version,
+		Package:    pkg,
+		Provenance: prov,
+		entry: &repo.ChartVersion{
+			Metadata: ch.Metadata,
+			URLs:     []string{"charts/" + name},
+			Created:  time.Now(),
+			Digest:   hex.EncodeToString(sum[:]),
+		},
+	}
+	s.charts[name] = c
+	return c, nil
+}
+
+// delete removes a chart version and its provenance file
+func (s *Server) delete(w http.ResponseWriter, name, version string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	file := packageName(name, version)
+	if _, ok := s.charts[file]; !ok {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("remove %s: no such file or directory", file))
+		return
+	}
+	delete(s.charts, file)
+	writeJSON(w, http.StatusOK, map[string]bool{"deleted": true})
+}
+
+// packageName returns the file name of the package of a chart version
+func packageName(name, version string) string {
+	return fmt.Sprintf("%s-%s.tgz", name, version)
+}
+
+// writeError writes a ChartMuseum JSON error
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
+
+// writeJSON writes v as the JSON response body
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,146 @@
+package chartmuseumtest
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	cm "github.com/IxDay/helm-push-cloudflare-access/pkg/chartmuseum"
+	"github.com/IxDay/helm-push-cloudflare-access/pkg/push"
+	"github.com/IxDay/helm-push-cloudflare-access/pkg/vfs"
+	"helm.sh/helm/v3/pkg/repo"
+)
+
+var testTarballPath = "../../testdata/charts/helm3/my-v3-chart/my-v3-chart-0.1.0.tgz"
+
+func TestServer(t *testing.T) {
+	s := NewServer(ContextPath("/helm/v1/"), RequireAccess("my-id", "my-secret"))
+	defer s.Close()
+
+	anonymous, err := cm.NewClient(cm.URL(s.RepoURL()))
+	if err != nil {
+		t.Fatalf("unexpected error creating client: %s", err)
+	}
+	resp, err := anonymous.DownloadFile("index.yaml")
+	if err != nil || resp.StatusCode != http.StatusFound || !strings.HasPrefix(resp.Header.Get("Location"), AccessLoginURL) {
+		t.Fatalf("expected redirect to the Access login page, got %v, %v", resp, err)
+	}
+	if r := s.Unauthenticated(); len(r) != 1 || r[0].Path != "/index.yaml" {
+		t.Errorf("expected the anonymous request to be recorded, got %+v", r)
+	}
+
+	data, err := ioutil.ReadFile(testTarballPath)
+	if err != nil {
+		t.Fatal("unexpected error reading test tarball", err)
+	}
+	mem := vfs.NewMem()
+	mem.WriteFile("my-v3-chart-0.1.0.tgz", data, 0644)
+	mem.WriteFile("my-v3-chart-0.1.0.tgz.prov", []byte("provenance"), 0644)
+	client, err := cm.NewClient(cm.URL(s.RepoURL()), cm.ClientID("my-id"), cm.ClientSecret("my-secret"), cm.FileSystem(mem))
+	if err != nil {
+		t.Fatalf("unexpected error creating client: %s", err)
+	}
+	pusher := push.New(client, push.FileSystem(mem), push.DiscoverContextPath(true))
+	if err := pusher.Upload("my-v3-chart-0.1.0.tgz", "my-v3-chart-0.1.0.tgz.prov"); err != nil {
+		t.Fatalf("unexpected error uploading chart: %s", err)
+	}
+	if c, ok := s.Chart("my-v3-chart", "0.1.0"); !ok || string(c.Package) != string(data) || string(c.Provenance) != "provenance" {
+		t.Fatalf("expected chart and provenance file to be stored, got %+v", c)
+	}
+	index, err := pusher.Index()
+	if err != nil || index.ServerInfo.ContextPath != "/helm/v1" || len(index.Entries["my-v3-chart"]) != 1 {
+		t.Fatalf("unexpected index %+v, %v", index, err)
+	}
+	chart, err := pusher.Fetch(index.Entries["my-v3-chart"][0])
+	if err != nil || string(chart.Data) != string(data) {
+		t.Errorf("expected package to be downloaded, got %v", err)
+	}
+
+	err = pusher.Upload("my-v3-chart-0.1.0.tgz", "")
+	var se *cm.StatusError
+	if !errors.As(err, &se) || se.StatusCode != http.StatusConflict {
+		t.Errorf("expected conflict error, got %v", err)
+	}
+
+	resp, err = client.DownloadFile("api/charts/my-v3-chart")
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected chart API response %v, %v", resp, err)
+	}
+	var versions []*repo.ChartVersion
+	json.NewDecoder(resp.Body).Decode(&versions)
+	resp.Body.Close()
+	if len(versions) != 1 || versions[0].Version != "0.1.0" || versions[0].Digest != index.Entries["my-v3-chart"][0].Digest {
+		t.Errorf("unexpected chart versions %+v", versions)
+	}
+
+	// Faults
+	s.InjectFault(Fault{Method: http.MethodPost, Path: "/api/*", Status: http.StatusServiceUnavailable, Times: 1})
+	forced := push.New(client, push.FileSystem(mem), push.Force(true))
+	if err := forced.Upload("my-v3-chart-0.1.0.tgz", ""); !errors.As(err, &se) || se.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("expected injected 503 error, got %v", err)
+	}
+	if err := forced.Upload("my-v3-chart-0.1.0.tgz", ""); err != nil {
+		t.Errorf("expected upload to succeed once the fault is over, got %v", err)
+	}
+	s.InjectFault(Fault{Path: "/index.yaml", Drop: true})
+	if _, err := pusher.Index(); err == nil {
+		t.Error("expected error with dropped connections, instead got nil")
+	}
+	s.ClearFaults()
+	s.InjectFault(Fault{Path: "/charts/*", Corrupt: true, Times: 1})
+	if chart, err := pusher.Fetch(index.Entries["my-v3-chart"][0]); err == nil && string(chart.Data) == string(data) {
+		t.Error("expected the package to be corrupted")
+	}
+	s.InjectFault(Fault{Delay: 10 * time.Millisecond, Times: 1})
+	if _, err := pusher.Index(); err != nil {
+		t.Errorf("unexpected error with delayed response: %s", err)
+	}
+
+	resp, err = client.DeleteChartVersion("my-v3-chart", "0.1.0")
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected delete response %v, %v", resp, err)
+	}
+	if _, ok := s.Chart("my-v3-chart", "0.1.0"); ok || len(s.Charts()) != 0 {
+		t.Error("expected chart version to be deleted")
+	}
+	if resp, _ := client.DeleteChartVersion("my-v3-chart", "0.1.0"); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404 deleting a missing chart, got %d", resp.StatusCode)
+	}
+	if r := s.Unauthenticated(); len(r) != 1 {
+		t.Errorf("expected only the anonymous request to be unauthenticated, got %+v", r)
+	}
+}
+
+func TestServerAddChart(t *testing.T) {
+	s := NewServer(AllowOverwrite(true))
+	defer s.Close()
+
+	data, err := ioutil.ReadFile(testTarballPath)
+	if err != nil {
+		t.Fatal("unexpected error reading test tarball", err)
+	}
+	if _, err := s.AddChart([]byte("not a chart"), nil); err == nil {
+		t.Error("expected error adding an invalid package, instead got nil")
+	}
+	if c, err := s.AddChart(data, nil); err != nil || c.Name != "my-v3-chart" || c.Version != "0.1.0" {
+		t.Fatalf("unexpected chart %+v, %v", c, err)
+	}
+
+	client, err := cm.NewClient(cm.URL(s.RepoURL()))
+	if err != nil {
+		t.Fatalf("unexpected error creating client: %s", err)
+	}
+	if err := push.New(client).Upload(testTarballPath, ""); err != nil {
+		t.Errorf("expected overwrite to be allowed, got %v", err)
+	}
+	if r := s.Requests(); len(r) != 1 || r[0].Method != http.MethodPost || r[0].Path != "/api/charts" {
+		t.Errorf("unexpected requests %+v", r)
+	}
+	if len(s.Unauthenticated()) != 1 {
+		t.Error("expected requests without Access token to be reported")
+	}
+}
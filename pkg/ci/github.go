@@ -0,0 +1,79 @@
+package ci
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+type (
+	// GitHub emits GitHub Actions workflow commands, see
+	// https://docs.github.com/en/actions/using-workflows/workflow-commands-for-github-actions
+	GitHub struct {
+		out         io.Writer
+		outputPath  string
+		summaryPath string
+	}
+)
+
+// NewGitHub creates a GitHub Actions integration writing commands to out,
+// step outputs and job summary files are read from the runner environment
+func NewGitHub(out io.Writer) *GitHub {
+	return &GitHub{
+		out:         out,
+		outputPath:  os.Getenv("GITHUB_OUTPUT"),
+		summaryPath: os.Getenv("GITHUB_STEP_SUMMARY"),
+	}
+}
+
+// SetOutput sets a step output
+func (g *GitHub) SetOutput(name, value string) error {
+	if g.outputPath == "" {
+		return fmt.Errorf("GITHUB_OUTPUT is not set, cannot set output %q", name)
+	}
+	if strings.ContainsAny(value, "\r\n") {
+		delimiter := "ghadelimiter_" + randomSuffix()
+		return appendFile(g.outputPath, fmt.Sprintf("%s<<%s\n%s\n%s\n", name, delimiter, value, delimiter))
+	}
+	return appendFile(g.outputPath, fmt.Sprintf("%s=%s\n", name, value))
+}
+
+// Error emits an error annotation
+func (g *GitHub) Error(title, message string) {
+	fmt.Fprintf(g.out, "::error title=%s::%s\n", escapeProperty(title), escapeData(message))
+}
+
+// AppendSummary adds markdown to the job summary
+func (g *GitHub) AppendSummary(markdown string) error {
+	if g.summaryPath == "" {
+		return fmt.Errorf("GITHUB_STEP_SUMMARY is not set, cannot write job summary")
+	}
+	return appendFile(g.summaryPath, markdown)
+}
+
+func escapeData(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A").Replace(s)
+}
+
+func escapeProperty(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C").Replace(s)
+}
+
+func appendFile(path, content string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.WriteString(content)
+	return err
+}
+
+func randomSuffix() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
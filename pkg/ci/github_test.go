@@ -0,0 +1,58 @@
+package ci
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGitHub(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "helm-push-test")
+	if err != nil {
+		t.Fatal("unexpected error creating temp test dir", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	var out bytes.Buffer
+	gh := &GitHub{out: &out}
+
+	// Not running on GitHub Actions
+	if err := gh.SetOutput("chart", "mychart"); err == nil {
+		t.Error("expected error without GITHUB_OUTPUT, instead got nil")
+	}
+	if err := gh.AppendSummary("# summary"); err == nil {
+		t.Error("expected error without GITHUB_STEP_SUMMARY, instead got nil")
+	}
+
+	gh.outputPath = filepath.Join(tmp, "output")
+	gh.summaryPath = filepath.Join(tmp, "summary")
+
+	if err := gh.SetOutput("chart", "mychart"); err != nil {
+		t.Fatalf("unexpected error setting output: %s", err)
+	}
+	if err := gh.SetOutput("notes", "line1\nline2"); err != nil {
+		t.Fatalf("unexpected error setting multiline output: %s", err)
+	}
+	b, _ := ioutil.ReadFile(gh.outputPath)
+	if !strings.HasPrefix(string(b), "chart=mychart\nnotes<<ghadelimiter_") || !strings.Contains(string(b), "\nline1\nline2\nghadelimiter_") {
+		t.Errorf("unexpected outputs file content:\n%s", b)
+	}
+
+	if err := gh.AppendSummary("| a |\n"); err != nil {
+		t.Fatalf("unexpected error appending summary: %s", err)
+	}
+	if err := gh.AppendSummary("| b |\n"); err != nil {
+		t.Fatalf("unexpected error appending summary: %s", err)
+	}
+	if b, _ := ioutil.ReadFile(gh.summaryPath); string(b) != "| a |\n| b |\n" {
+		t.Errorf("unexpected summary file content:\n%s", b)
+	}
+
+	gh.Error("helm push: failed, really", "409: package already exists\n100%")
+	if s := out.String(); s != "::error title=helm push%3A failed%2C really::409: package already exists%0A100%25\n" {
+		t.Errorf("unexpected error annotation %q", s)
+	}
+}
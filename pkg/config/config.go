@@ -0,0 +1,266 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	cm "github.com/IxDay/helm-push-cloudflare-access/pkg/chartmuseum"
+	"github.com/IxDay/helm-push-cloudflare-access/pkg/cosign"
+	"github.com/IxDay/helm-push-cloudflare-access/pkg/policy"
+	"github.com/IxDay/helm-push-cloudflare-access/pkg/push"
+	"github.com/IxDay/helm-push-cloudflare-access/pkg/vfs"
+	"github.com/IxDay/helm-push-cloudflare-access/pkg/webhook"
+	"github.com/ghodss/yaml"
+	"helm.sh/helm/v3/pkg/helmpath"
+)
+
+type (
+	// Config is the plugin configuration file
+	Config struct {
+		AuditLog string         `json:"audit_log,omitempty"`
+		Webhooks []webhook.Hook `json:"webhooks,omitempty"`
+		// Verify enables the verification of charts fetched by the cm://
+		// downloader, "provenance" checks their .prov file against Keyring
+		// while "cosign" checks their .sig file according to Cosign
+		Verify  string        `json:"verify,omitempty"`
+		Keyring string        `json:"keyring,omitempty"`
+		Cosign  cosign.Policy `json:"cosign,omitempty"`
+		// Policy holds the rules charts must follow to be pushed
+		Policy policy.Policy `json:"policy,omitempty"`
+		// Helmfile is a helmfile.yaml whose repositories are used as if
+		// they were in the local repository list
+		Helmfile string `json:"helmfile,omitempty"`
+		// Repositories holds per repository settings, keyed by repository
+		// name or URL
+		Repositories map[string]Repository `json:"repositories,omitempty"`
+		// Channels maps release channel names, such as dev or stable, to
+		// where their charts are published, see --channel
+		Channels map[string]Channel `json:"channels,omitempty"`
+	}
+
+	// Channel is a release channel, a repository or a context path of a
+	// repository shared with other channels
+	Channel struct {
+		// Repo is the name or URL of the repository
+		Repo        string `json:"repo"`
+		ContextPath string `json:"context_path,omitempty"`
+	}
+
+	// Repository holds the settings of a single repository
+	Repository struct {
+		// ClientID and ClientSecret are the Cloudflare Access service
+		// token credentials, see --client-id and --client-secret
+		ClientID     string `json:"client_id,omitempty"`
+		ClientSecret string `json:"client_secret,omitempty"`
+		// Auth sets how the credentials are sent, for gateways expecting
+		// other header names or a bearer token
+		Auth cm.Auth `json:"auth,omitempty"`
+		// Signing signs the requests with an HMAC key, for gateways
+		// requiring signed requests, see $HELM_REPO_SIGNING_KEY
+		Signing cm.Signing `json:"signing,omitempty"`
+		// RequireSignature refuses to push charts without a valid
+		// provenance file, see --sign
+		RequireSignature bool `json:"require_signature,omitempty"`
+		// ChartAPI looks up chart versions with the ChartMuseum chart API,
+		// see --chart-api
+		ChartAPI bool `json:"chart_api,omitempty"`
+		// OnConflict is what to do when the repository already has the
+		// chart version, see --on-conflict
+		OnConflict push.Conflict `json:"on_conflict,omitempty"`
+		// PinSHA256 lists the accepted server public keys, see --pin-sha256
+		PinSHA256 []string `json:"pin_sha256,omitempty"`
+		// Policy replaces the global policy for this repository
+		Policy *policy.Policy `json:"policy,omitempty"`
+	}
+)
+
+// DefaultPath returns the location of the configuration file, either
+// $HELM_PUSH_CONFIG or push.yaml in the Helm configuration directory
+func DefaultPath() string {
+	if v, ok := os.LookupEnv("HELM_PUSH_CONFIG"); ok {
+		return v
+	}
+	return helmpath.ConfigPath("push.yaml")
+}
+
+// LoadDefault reads the configuration file at DefaultPath, a missing file
+// results in an empty configuration
+func LoadDefault() (*Config, error) {
+	c, err := Load(DefaultPath())
+	if os.IsNotExist(err) {
+		return &Config{}, nil
+	}
+	return c, err
+}
+
+// Load reads the configuration file at path, decrypting it if it was
+// encrypted with SOPS or age
+func Load(path string) (*Config, error) {
+	return LoadFS(vfs.OS, path)
+}
+
+// LoadFS reads the configuration file at path of fsys, see Load. Files
+// encrypted with SOPS must be on the host filesystem, sops reads them
+// itself.
+func LoadFS(fsys vfs.FS, path string) (*Config, error) {
+	b, err := vfs.ReadFile(fsys, path)
+	if err != nil {
+		return nil, err
+	}
+	if isSOPS(b) && !vfs.IsOS(fsys) {
+		return nil, fmt.Errorf("%s is encrypted with SOPS: only files of the host filesystem can be decrypted", path)
+	}
+	if b, err = decrypt(path, b); err != nil {
+		return nil, err
+	}
+	return Parse(b)
+}
+
+// Parse parses and validates a configuration
+func Parse(data []byte) (*Config, error) {
+	c := &Config{}
+	if err := yaml.Unmarshal(data, c); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %s", err)
+	}
+	for i, h := range c.Webhooks {
+		if err := h.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid configuration: webhooks[%d]: %s", i, err)
+		}
+	}
+	if err := c.Policy.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %s", err)
+	}
+	for name, ch := range c.Channels {
+		if ch.Repo == "" {
+			return nil, fmt.Errorf("invalid configuration: channels[%s]: missing repo", name)
+		}
+	}
+	for name, r := range c.Repositories {
+		if err := r.Auth.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid configuration: repositories[%s]: %s", name, err)
+		}
+		if err := r.Signing.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid configuration: repositories[%s]: %s", name, err)
+		}
+		if err := r.OnConflict.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid configuration: repositories[%s]: %s", name, err)
+		}
+		for _, pin := range r.PinSHA256 {
+			if _, err := cm.ParsePin(pin); err != nil {
+				return nil, fmt.Errorf("invalid configuration: repositories[%s]: %s", name, err)
+			}
+		}
+		if r.Policy != nil {
+			if err := r.Policy.Validate(); err != nil {
+				return nil, fmt.Errorf("invalid configuration: repositories[%s]: %s", name, err)
+			}
+		}
+	}
+	return c, nil
+}
+
+// SetCredentials stores the Cloudflare Access credentials of the
+// repository name in the configuration file at path, creating it if
+// needed. Other settings are kept, encrypted files are refused as they
+// can't be written back.
+func SetCredentials(path, name, clientID, clientSecret string) error {
+	return SetCredentialsFS(vfs.OS, path, name, clientID, clientSecret)
+}
+
+// SetCredentialsFS stores the Cloudflare Access credentials of the
+// repository name in the configuration file at path of fsys, see
+// SetCredentials
+func SetCredentialsFS(fsys vfs.FS, path, name, clientID, clientSecret string) error {
+	doc := map[string]interface{}{}
+	b, err := vfs.ReadFile(fsys, path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if isAge(b) || isSOPS(b) {
+		return fmt.Errorf("%s is encrypted: add the credentials of repository %s manually", path, name)
+	}
+	if err := yaml.Unmarshal(b, &doc); err != nil {
+		return fmt.Errorf("invalid configuration: %s", err)
+	}
+	if doc == nil {
+		doc = map[string]interface{}{}
+	}
+	repos, _ := doc["repositories"].(map[string]interface{})
+	if repos == nil {
+		repos = map[string]interface{}{}
+	}
+	repo, _ := repos[name].(map[string]interface{})
+	if repo == nil {
+		repo = map[string]interface{}{}
+	}
+	repo["client_id"] = clientID
+	repo["client_secret"] = clientSecret
+	repos[name] = repo
+	doc["repositories"] = repos
+
+	if b, err = yaml.Marshal(doc); err != nil {
+		return err
+	}
+	if err := fsys.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return fsys.WriteFile(path, b, 0600)
+}
+
+// Repository returns the settings of the first repository matching one of
+// keys, URLs are compared regardless of their scheme (cm://, http:// or
+// https://) and trailing slash
+func (c *Config) Repository(keys ...string) Repository {
+	r, _ := c.repository(keys)
+	return r
+}
+
+// HasRepository tells if the configuration has settings for one of keys,
+// see Repository
+func (c *Config) HasRepository(keys ...string) bool {
+	_, ok := c.repository(keys)
+	return ok
+}
+
+func (c *Config) repository(keys []string) (Repository, bool) {
+	if c == nil {
+		return Repository{}, false
+	}
+	for _, key := range keys {
+		if r, ok := c.Repositories[key]; ok {
+			return r, true
+		}
+		for name, r := range c.Repositories {
+			if strings.Contains(key, "://") && normalizeURL(name) == normalizeURL(key) {
+				return r, true
+			}
+		}
+	}
+	return Repository{}, false
+}
+
+// Channel returns the release channel name
+func (c *Config) Channel(name string) (Channel, error) {
+	if ch, ok := c.Channels[name]; ok {
+		return ch, nil
+	}
+	if len(c.Channels) == 0 {
+		return Channel{}, fmt.Errorf("unknown channel %q: no channels in the configuration", name)
+	}
+	var names []string
+	for n := range c.Channels {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return Channel{}, fmt.Errorf("unknown channel %q, must be one of: %s", name, strings.Join(names, ", "))
+}
+
+func normalizeURL(u string) string {
+	if i := strings.Index(u, "://"); i >= 0 {
+		u = u[i+3:]
+	}
+	return strings.TrimSuffix(u, "/")
+}
@@ -0,0 +1,252 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/IxDay/helm-push-cloudflare-access/pkg/push"
+	"github.com/IxDay/helm-push-cloudflare-access/pkg/vfs"
+)
+
+func TestLoad(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "helm-push-test")
+	if err != nil {
+		t.Fatal("unexpected error creating temp test dir", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	// Missing file
+	path := filepath.Join(tmp, "push.yaml")
+	if _, err := Load(path); !os.IsNotExist(err) {
+		t.Errorf("expected not exist error, got %v", err)
+	}
+	os.Setenv("HELM_PUSH_CONFIG", path)
+	defer os.Unsetenv("HELM_PUSH_CONFIG")
+	c, err := LoadDefault()
+	if err != nil || c == nil {
+		t.Fatalf("expected empty configuration for missing default file, got %v, %v", c, err)
+	}
+
+	// Valid file
+	data := `
+audit_log: /var/log/helm-push.log
+webhooks:
+- url: https://hooks.slack.com/services/T000/B000/XXX
+  format: slack
+- url: https://releases.example.com/hook
+  headers:
+    Authorization: Bearer token
+`
+	if err := ioutil.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatal("unexpected error writing config", err)
+	}
+	c, err = LoadDefault()
+	if err != nil {
+		t.Fatalf("unexpected error loading config: %s", err)
+	}
+	if c.AuditLog != "/var/log/helm-push.log" {
+		t.Errorf("unexpected audit log %q", c.AuditLog)
+	}
+	if len(c.Webhooks) != 2 || c.Webhooks[0].Format != "slack" || c.Webhooks[1].Headers["Authorization"] != "Bearer token" {
+		t.Errorf("unexpected webhooks %+v", c.Webhooks)
+	}
+
+	// Invalid webhook
+	if _, err := Parse([]byte("webhooks:\n- url: https://example.com\n  format: xml\n")); err == nil {
+		t.Error("expected error with invalid webhook format, instead got nil")
+	}
+	if _, err := Parse([]byte("webhooks: [{}]")); err == nil {
+		t.Error("expected error with missing webhook url, instead got nil")
+	}
+
+	// Repository auth
+	c, err = Parse([]byte("repositories:\n  gateway:\n    auth:\n      header_id: X-Client-Id\n      header_secret: X-Client-Secret\n"))
+	if err != nil {
+		t.Fatalf("unexpected error parsing auth: %s", err)
+	}
+	if auth := c.Repositories["gateway"].Auth; auth.HeaderID != "X-Client-Id" || auth.HeaderSecret != "X-Client-Secret" {
+		t.Errorf("unexpected auth %+v", auth)
+	}
+	if _, err := Parse([]byte("repositories:\n  gateway:\n    auth: {scheme: digest}\n")); err == nil {
+		t.Error("expected error with unknown auth scheme, instead got nil")
+	}
+
+	// Request signing
+	c, err = Parse([]byte("repositories:\n  gateway:\n    signing: {key: secret, header: X-Gateway-Signature}\n"))
+	if err != nil {
+		t.Fatalf("unexpected error parsing signing: %s", err)
+	}
+	if s := c.Repositories["gateway"].Signing; s.Key != "secret" || s.Header != "X-Gateway-Signature" {
+		t.Errorf("unexpected signing %+v", s)
+	}
+	if _, err := Parse([]byte("repositories:\n  gateway:\n    signing: {key: secret, header: Date}\n")); err == nil {
+		t.Error("expected error with reserved signing header, instead got nil")
+	}
+
+	// Conflict strategy
+	c, err = Parse([]byte("repositories:\n  dev:\n    on_conflict: bump\n"))
+	if err != nil || c.Repositories["dev"].OnConflict != push.ConflictBump {
+		t.Errorf("unexpected conflict strategy %+v, %v", c, err)
+	}
+	if _, err := Parse([]byte("repositories:\n  dev:\n    on_conflict: retry\n")); err == nil {
+		t.Error("expected error with unknown conflict strategy, instead got nil")
+	}
+}
+
+func TestChannel(t *testing.T) {
+	c, err := Parse([]byte(`
+channels:
+  dev: {repo: https://charts.example.com, context_path: /dev}
+  stable: {repo: chartmuseum}
+`))
+	if err != nil {
+		t.Fatalf("unexpected error parsing channels: %s", err)
+	}
+	if ch, err := c.Channel("dev"); err != nil || ch.Repo != "https://charts.example.com" || ch.ContextPath != "/dev" {
+		t.Errorf("unexpected channel %+v, %v", ch, err)
+	}
+	if _, err := c.Channel("staging"); err == nil || err.Error() != `unknown channel "staging", must be one of: dev, stable` {
+		t.Errorf("expected unknown channel error, got %v", err)
+	}
+	if _, err := (&Config{}).Channel("dev"); err == nil {
+		t.Error("expected error without channels, instead got nil")
+	}
+	if _, err := Parse([]byte("channels:\n  dev: {context_path: /dev}\n")); err == nil {
+		t.Error("expected error with missing channel repo, instead got nil")
+	}
+}
+
+func TestRepository(t *testing.T) {
+	data := `
+repositories:
+  chartmuseum:
+    pin_sha256: ["sha256//YLh1dUR9y6Kja30RrAn7JKnbQG/uEtLMkBgFF2Fuihg="]
+  cm://charts.example.com/stable/:
+    pin_sha256: ["47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU="]
+`
+	c, err := Parse([]byte(data))
+	if err != nil {
+		t.Fatalf("unexpected error parsing config: %s", err)
+	}
+	if r := c.Repository("chartmuseum", "https://other.example.com"); len(r.PinSHA256) != 1 || r.PinSHA256[0] != "sha256//YLh1dUR9y6Kja30RrAn7JKnbQG/uEtLMkBgFF2Fuihg=" {
+		t.Errorf("unexpected repository settings by name %+v", r)
+	}
+	if r := c.Repository("stable", "https://charts.example.com/stable"); len(r.PinSHA256) != 1 || r.PinSHA256[0] != "47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU=" {
+		t.Errorf("unexpected repository settings by URL %+v", r)
+	}
+	if r := c.Repository("unknown", "https://unknown.example.com"); r.PinSHA256 != nil {
+		t.Errorf("expected empty settings for unknown repository, got %+v", r)
+	}
+	var missing *Config
+	if r := missing.Repository("chartmuseum"); r.PinSHA256 != nil {
+		t.Errorf("expected empty settings from nil config, got %+v", r)
+	}
+
+	// Invalid pin
+	if _, err := Parse([]byte("repositories:\n  chartmuseum:\n    pin_sha256: [abc]\n")); err == nil {
+		t.Error("expected error with invalid pin, instead got nil")
+	}
+}
+
+func TestSetCredentials(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "helm-push-test")
+	if err != nil {
+		t.Fatal("unexpected error creating temp test dir", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	// Missing file
+	path := filepath.Join(tmp, "helm", "push.yaml")
+	if err := SetCredentials(path, "chartmuseum", "my-id", "my-secret"); err != nil {
+		t.Fatalf("unexpected error setting credentials: %s", err)
+	}
+
+	// Existing settings are kept
+	data := `
+audit_log: /var/log/helm-push.log
+repositories:
+  chartmuseum:
+    client_id: old-id
+    require_signature: true
+`
+	ioutil.WriteFile(path, []byte(data), 0600)
+	if err := SetCredentials(path, "chartmuseum", "my-id", "my-secret"); err != nil {
+		t.Fatalf("unexpected error setting credentials: %s", err)
+	}
+	if err := SetCredentials(path, "other", "other-id", "other-secret"); err != nil {
+		t.Fatalf("unexpected error setting credentials: %s", err)
+	}
+	c, err := Load(path)
+	if err != nil {
+		t.Fatalf("unexpected error loading config: %s", err)
+	}
+	if c.AuditLog != "/var/log/helm-push.log" {
+		t.Errorf("unexpected audit log %q", c.AuditLog)
+	}
+	r := c.Repository("chartmuseum")
+	if r.ClientID != "my-id" || r.ClientSecret != "my-secret" || !r.RequireSignature {
+		t.Errorf("unexpected repository settings %+v", r)
+	}
+	if r := c.Repository("other"); r.ClientID != "other-id" || r.ClientSecret != "other-secret" {
+		t.Errorf("unexpected repository settings %+v", r)
+	}
+
+	// Encrypted file
+	ioutil.WriteFile(path, []byte(ageArmorHeader+"\nYWdl\n"), 0600)
+	if err := SetCredentials(path, "chartmuseum", "my-id", "my-secret"); err == nil {
+		t.Error("expected error with encrypted file, instead got nil")
+	}
+}
+
+func TestPolicy(t *testing.T) {
+	data := `
+policy:
+  name_pattern: ^company-
+  required_annotations: [team]
+repositories:
+  sandbox:
+    policy: {}
+`
+	c, err := Parse([]byte(data))
+	if err != nil {
+		t.Fatalf("unexpected error parsing config: %s", err)
+	}
+	if c.Policy.NamePattern != "^company-" || len(c.Policy.RequiredAnnotations) != 1 {
+		t.Errorf("unexpected policy %+v", c.Policy)
+	}
+	if r := c.Repository("sandbox"); r.Policy == nil || !r.Policy.Empty() {
+		t.Errorf("expected empty policy override, got %+v", r.Policy)
+	}
+
+	// Invalid policies
+	if _, err := Parse([]byte("policy:\n  name_pattern: '(['\n")); err == nil {
+		t.Error("expected error with invalid name pattern, instead got nil")
+	}
+	if _, err := Parse([]byte("repositories:\n  sandbox:\n    policy:\n      max_size: -1\n")); err == nil {
+		t.Error("expected error with invalid repository policy, instead got nil")
+	}
+}
+
+func TestLoadFS(t *testing.T) {
+	mem := vfs.NewMem()
+	if err := SetCredentialsFS(mem, "/helm/push.yaml", "chartmuseum", "my-id", "my-secret"); err != nil {
+		t.Fatalf("unexpected error setting credentials: %s", err)
+	}
+	c, err := LoadFS(mem, "/helm/push.yaml")
+	if err != nil {
+		t.Fatalf("unexpected error loading config: %s", err)
+	}
+	if r := c.Repository("chartmuseum"); r.ClientID != "my-id" || r.ClientSecret != "my-secret" {
+		t.Errorf("unexpected repository settings %+v", r)
+	}
+	if _, err := LoadFS(mem, "/missing.yaml"); !os.IsNotExist(err) {
+		t.Errorf("expected not exist error, got %v", err)
+	}
+	mem.WriteFile("/sops.yaml", []byte("audit_log: ENC[AES256_GCM,data:abc]\nsops:\n  mac: ENC[AES256_GCM,data:def]\n"), 0600)
+	if _, err := LoadFS(mem, "/sops.yaml"); err == nil || !strings.Contains(err.Error(), "host filesystem") {
+		t.Errorf("expected SOPS error, got %v", err)
+	}
+}
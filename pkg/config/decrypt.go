@@ -0,0 +1,73 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/ghodss/yaml"
+)
+
+const (
+	ageArmorHeader  = "-----BEGIN AGE ENCRYPTED FILE-----"
+	ageBinaryHeader = "age-encryption.org/v1"
+)
+
+// decrypt returns the clear text of the configuration file at path, files
+// encrypted with SOPS or age are decrypted with their respective binary,
+// other files are returned as is
+func decrypt(path string, data []byte) ([]byte, error) {
+	switch {
+	case isAge(data):
+		identity := os.Getenv("HELM_PUSH_AGE_IDENTITY")
+		if identity == "" {
+			return nil, fmt.Errorf("%s is encrypted with age: set HELM_PUSH_AGE_IDENTITY to the identity file able to decrypt it", path)
+		}
+		return run("age", "AGE_BIN", data, "--decrypt", "--identity", identity)
+	case isSOPS(data):
+		// sops finds its keys on its own (SOPS_AGE_KEY_FILE, GnuPG, KMS...)
+		return run("sops", "SOPS_BIN", nil, "--decrypt", "--input-type", "yaml", "--output-type", "yaml", path)
+	default:
+		return data, nil
+	}
+}
+
+func isAge(data []byte) bool {
+	data = bytes.TrimSpace(data)
+	return bytes.HasPrefix(data, []byte(ageArmorHeader)) || bytes.HasPrefix(data, []byte(ageBinaryHeader))
+}
+
+// isSOPS tells if data is a YAML document with SOPS metadata
+func isSOPS(data []byte) bool {
+	var doc struct {
+		SOPS *struct {
+			MAC string `json:"mac"`
+		} `json:"sops"`
+	}
+	return yaml.Unmarshal(data, &doc) == nil && doc.SOPS != nil && doc.SOPS.MAC != ""
+}
+
+// run executes name, or the binary set in env, with stdin and returns its
+// output
+func run(name, env string, stdin []byte, args ...string) ([]byte, error) {
+	bin, ok := os.LookupEnv(env)
+	if !ok {
+		bin = name
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(bin, args...)
+	if stdin != nil {
+		cmd.Stdin = bytes.NewReader(stdin)
+	}
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("decrypting configuration with %s: %s", name, msg)
+		}
+		return nil, fmt.Errorf("decrypting configuration with %s: %s", name, err)
+	}
+	return stdout.Bytes(), nil
+}
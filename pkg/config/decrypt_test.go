@@ -0,0 +1,82 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const clearConfig = `
+repositories:
+  chartmuseum:
+    client_id: myid.access
+    client_secret: mysecret
+`
+
+func writeScript(t *testing.T, path, script string) {
+	if err := ioutil.WriteFile(path, []byte("#!/bin/sh\n"+script), 0755); err != nil {
+		t.Fatal("unexpected error writing script", err)
+	}
+}
+
+func TestLoadEncrypted(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "helm-push-test")
+	if err != nil {
+		t.Fatal("unexpected error creating temp test dir", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	clear := filepath.Join(tmp, "clear.yaml")
+	if err := ioutil.WriteFile(clear, []byte(clearConfig), 0600); err != nil {
+		t.Fatal("unexpected error writing config", err)
+	}
+	// Fake binaries checking their arguments and printing the clear config
+	writeScript(t, filepath.Join(tmp, "age"), `[ "$1 $2 $3" = "--decrypt --identity `+tmp+`/key.txt" ] || exit 1
+grep -q "BEGIN AGE ENCRYPTED FILE" || exit 1
+cat `+clear+`
+`)
+	writeScript(t, filepath.Join(tmp, "sops"), `[ "$1" = "--decrypt" ] || exit 1
+grep -q "mac: ENC" "$6" || { echo "Failed to get the data key required to decrypt the SOPS file." >&2; exit 128; }
+cat `+clear+`
+`)
+	os.Setenv("AGE_BIN", filepath.Join(tmp, "age"))
+	os.Setenv("SOPS_BIN", filepath.Join(tmp, "sops"))
+	defer os.Unsetenv("AGE_BIN")
+	defer os.Unsetenv("SOPS_BIN")
+
+	check := func(c *Config, err error) {
+		t.Helper()
+		if err != nil {
+			t.Fatalf("unexpected error loading config: %s", err)
+		}
+		if r := c.Repository("chartmuseum"); r.ClientID != "myid.access" || r.ClientSecret != "mysecret" {
+			t.Errorf("unexpected repository settings %+v", r)
+		}
+	}
+
+	// Clear text
+	check(Load(clear))
+
+	// age
+	agePath := filepath.Join(tmp, "age.yaml")
+	ioutil.WriteFile(agePath, []byte("-----BEGIN AGE ENCRYPTED FILE-----\nYWdlLWVuY3J5cHRpb24ub3JnL3YxCg==\n-----END AGE ENCRYPTED FILE-----\n"), 0600)
+	if _, err := Load(agePath); err == nil || !strings.Contains(err.Error(), "HELM_PUSH_AGE_IDENTITY") {
+		t.Errorf("expected error asking for an identity, got %v", err)
+	}
+	os.Setenv("HELM_PUSH_AGE_IDENTITY", filepath.Join(tmp, "key.txt"))
+	defer os.Unsetenv("HELM_PUSH_AGE_IDENTITY")
+	check(Load(agePath))
+
+	// SOPS
+	sopsPath := filepath.Join(tmp, "sops.yaml")
+	ioutil.WriteFile(sopsPath, []byte("repositories:\n  chartmuseum:\n    client_secret: ENC[AES256_GCM,data:abc,type:str]\nsops:\n  mac: ENC[AES256_GCM,data:def,type:str]\n  version: 3.8.1\n"), 0600)
+	check(Load(sopsPath))
+
+	// SOPS failure
+	ioutil.WriteFile(sopsPath, []byte("sops:\n  mac: broken\n"), 0600)
+	if _, err := Load(sopsPath); err == nil || !strings.Contains(err.Error(), "Failed to get the data key") {
+		t.Errorf("expected sops error, got %v", err)
+	}
+}
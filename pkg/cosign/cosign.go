@@ -0,0 +1,100 @@
+package cosign
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/IxDay/helm-push-cloudflare-access/pkg/tmpdir"
+)
+
+type (
+	// Policy describes which cosign signatures are accepted, either made
+	// with Key or, keyless, with a certificate matching the identity and
+	// issuer constraints
+	Policy struct {
+		Key                         string `json:"key,omitempty"`
+		CertificateIdentity         string `json:"certificate_identity,omitempty"`
+		CertificateIdentityRegexp   string `json:"certificate_identity_regexp,omitempty"`
+		CertificateOIDCIssuer       string `json:"certificate_oidc_issuer,omitempty"`
+		CertificateOIDCIssuerRegexp string `json:"certificate_oidc_issuer_regexp,omitempty"`
+	}
+)
+
+// Validate checks the policy is either key based or fully constrains the
+// keyless identity
+func (p Policy) Validate() error {
+	if p.Key != "" {
+		return nil
+	}
+	if p.CertificateIdentity == "" && p.CertificateIdentityRegexp == "" {
+		return fmt.Errorf("cosign policy requires a key or a certificate identity")
+	}
+	if p.CertificateOIDCIssuer == "" && p.CertificateOIDCIssuerRegexp == "" {
+		return fmt.Errorf("cosign policy requires a certificate OIDC issuer for keyless verification")
+	}
+	return nil
+}
+
+// Keyless tells if signatures are verified against a certificate
+func (p Policy) Keyless() bool {
+	return p.Key == ""
+}
+
+// VerifyBlob verifies that signature (and certificate when keyless) are
+// valid for blob according to the policy. Verification is delegated to
+// the cosign binary, $COSIGN_BIN or cosign from $PATH.
+func (p Policy) VerifyBlob(blob, signature, certificate []byte) error {
+	tmp, err := tmpdir.New("helm-push-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+
+	files := map[string][]byte{"blob": blob, "blob.sig": signature}
+	if certificate != nil {
+		files["blob.pem"] = certificate
+	}
+	for name, data := range files {
+		if err := ioutil.WriteFile(filepath.Join(tmp, name), data, 0600); err != nil {
+			return err
+		}
+	}
+
+	args := []string{"verify-blob", "--signature", filepath.Join(tmp, "blob.sig")}
+	if certificate != nil {
+		args = append(args, "--certificate", filepath.Join(tmp, "blob.pem"))
+	}
+	flags := []struct{ name, value string }{
+		{"--key", p.Key},
+		{"--certificate-identity", p.CertificateIdentity},
+		{"--certificate-identity-regexp", p.CertificateIdentityRegexp},
+		{"--certificate-oidc-issuer", p.CertificateOIDCIssuer},
+		{"--certificate-oidc-issuer-regexp", p.CertificateOIDCIssuerRegexp},
+	}
+	for _, f := range flags {
+		if f.value != "" {
+			args = append(args, f.name, f.value)
+		}
+	}
+	args = append(args, filepath.Join(tmp, "blob"))
+
+	bin, ok := os.LookupEnv("COSIGN_BIN")
+	if !ok {
+		bin = "cosign"
+	}
+	var stderr bytes.Buffer
+	cmd := exec.Command(bin, args...)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return fmt.Errorf("cosign verification failed: %s", msg)
+		}
+		return fmt.Errorf("cosign verification failed: %s", err)
+	}
+	return nil
+}
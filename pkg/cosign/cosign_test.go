@@ -0,0 +1,92 @@
+package cosign
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakeCosign accepts the signature "good" and records its arguments
+const fakeCosign = `#!/bin/sh
+echo "$@" > "$(dirname "$0")/args"
+while [ $# -gt 1 ]; do
+  if [ "$1" = "--signature" ]; then sig="$2"; fi
+  shift
+done
+[ -f "$1" ] || { echo "missing blob" >&2; exit 1; }
+[ "$(cat "$sig")" = "good" ] || { echo "Error: invalid signature when validating ASN.1 encoded signature" >&2; exit 1; }
+`
+
+func TestValidate(t *testing.T) {
+	valid := []Policy{
+		{Key: "cosign.pub"},
+		{CertificateIdentity: "https://github.com/org/repo/.github/workflows/release.yml@refs/heads/main", CertificateOIDCIssuer: "https://token.actions.githubusercontent.com"},
+		{CertificateIdentityRegexp: "@example.com$", CertificateOIDCIssuerRegexp: ".*"},
+	}
+	for _, p := range valid {
+		if err := p.Validate(); err != nil {
+			t.Errorf("unexpected error validating %+v: %s", p, err)
+		}
+	}
+	invalid := []Policy{
+		{},
+		{CertificateIdentity: "me@example.com"},
+		{CertificateOIDCIssuer: "https://accounts.google.com"},
+	}
+	for _, p := range invalid {
+		if err := p.Validate(); err == nil {
+			t.Errorf("expected error validating %+v, instead got nil", p)
+		}
+	}
+}
+
+func TestVerifyBlob(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "helm-push-test")
+	if err != nil {
+		t.Fatal("unexpected error creating temp test dir", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	bin := filepath.Join(tmp, "cosign")
+	if err := ioutil.WriteFile(bin, []byte(fakeCosign), 0755); err != nil {
+		t.Fatal("unexpected error writing fake cosign", err)
+	}
+	os.Setenv("COSIGN_BIN", bin)
+	defer os.Unsetenv("COSIGN_BIN")
+
+	// Key based
+	p := Policy{Key: "cosign.pub"}
+	if err := p.VerifyBlob([]byte("chart"), []byte("good"), nil); err != nil {
+		t.Fatalf("unexpected error verifying blob: %s", err)
+	}
+	args, _ := ioutil.ReadFile(filepath.Join(tmp, "args"))
+	if !strings.HasPrefix(string(args), "verify-blob --signature ") || !strings.Contains(string(args), "--key cosign.pub") || strings.Contains(string(args), "--certificate") {
+		t.Errorf("unexpected cosign arguments %s", args)
+	}
+
+	// Keyless
+	p = Policy{CertificateIdentity: "me@example.com", CertificateOIDCIssuer: "https://accounts.google.com"}
+	if err := p.VerifyBlob([]byte("chart"), []byte("good"), []byte("cert")); err != nil {
+		t.Fatalf("unexpected error verifying blob: %s", err)
+	}
+	args, _ = ioutil.ReadFile(filepath.Join(tmp, "args"))
+	for _, expected := range []string{"--certificate ", "--certificate-identity me@example.com", "--certificate-oidc-issuer https://accounts.google.com"} {
+		if !strings.Contains(string(args), expected) {
+			t.Errorf("expected cosign arguments to contain %q, got %s", expected, args)
+		}
+	}
+
+	// Bad signature
+	err = p.VerifyBlob([]byte("chart"), []byte("bad"), []byte("cert"))
+	if err == nil || !strings.Contains(err.Error(), "invalid signature") {
+		t.Errorf("expected invalid signature error, got %v", err)
+	}
+
+	// Missing binary
+	os.Setenv("COSIGN_BIN", filepath.Join(tmp, "missing"))
+	if err := p.VerifyBlob([]byte("chart"), []byte("good"), nil); err == nil {
+		t.Error("expected error with missing cosign binary, instead got nil")
+	}
+}
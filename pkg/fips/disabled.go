@@ -0,0 +1,7 @@
+//go:build !boringcrypto
+
+package fips
+
+// Enabled tells if the plugin was built with GOEXPERIMENT=boringcrypto,
+// using the FIPS 140 validated BoringCrypto module
+const Enabled = false
@@ -0,0 +1,10 @@
+//go:build boringcrypto
+
+package fips
+
+// Forbids non FIPS approved TLS settings process wide
+import _ "crypto/tls/fipsonly"
+
+// Enabled tells if the plugin was built with GOEXPERIMENT=boringcrypto,
+// using the FIPS 140 validated BoringCrypto module
+const Enabled = true
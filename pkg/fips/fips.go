@@ -0,0 +1,20 @@
+package fips
+
+import "crypto/tls"
+
+// Restrict limits c to the TLS versions, cipher suites and curves approved
+// by FIPS 140, it does nothing unless the build is Enabled
+func Restrict(c *tls.Config) {
+	if !Enabled {
+		return
+	}
+	c.MinVersion = tls.VersionTLS12
+	// Only used by TLS 1.2, TLS 1.3 suites are AES-GCM when FIPS-only
+	c.CipherSuites = []uint16{
+		tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+		tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+		tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+		tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+	}
+	c.CurvePreferences = []tls.CurveID{tls.CurveP256, tls.CurveP384}
+}
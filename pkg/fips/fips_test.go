@@ -0,0 +1,26 @@
+package fips
+
+import (
+	"crypto/tls"
+	"strings"
+	"testing"
+)
+
+func TestRestrict(t *testing.T) {
+	c := &tls.Config{}
+	Restrict(c)
+	if !Enabled {
+		if c.MinVersion != 0 || c.CipherSuites != nil || c.CurvePreferences != nil {
+			t.Errorf("expected config to be untouched without FIPS, got %+v", c)
+		}
+		return
+	}
+	if c.MinVersion != tls.VersionTLS12 {
+		t.Errorf("expected TLS 1.2 minimum, got %x", c.MinVersion)
+	}
+	for _, id := range c.CipherSuites {
+		if s := tls.CipherSuiteName(id); s == "" || !strings.Contains(s, "_GCM_") {
+			t.Errorf("unexpected cipher suite %s", s)
+		}
+	}
+}
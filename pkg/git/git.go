@@ -0,0 +1,54 @@
+package git
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Revision returns the abbreviated commit checked out in dir
+func Revision(dir string) (string, error) {
+	return run(dir, "rev-parse", "--short", "HEAD")
+}
+
+// ChangedFiles returns the absolute paths of the files of the repository
+// holding dir that changed since ref, uncommitted and untracked changes
+// included
+func ChangedFiles(dir, ref string) ([]string, error) {
+	top, err := run(dir, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return nil, err
+	}
+	changed, err := run(dir, "diff", "--name-only", ref, "--")
+	if err != nil {
+		return nil, err
+	}
+	untracked, err := run(top, "ls-files", "--others", "--exclude-standard")
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, name := range strings.Split(changed+"\n"+untracked, "\n") {
+		if name != "" {
+			files = append(files, filepath.Join(top, filepath.FromSlash(name)))
+		}
+	}
+	return files, nil
+}
+
+// run executes git in dir and returns its trimmed output
+func run(dir string, args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("git %s: %s", args[0], msg)
+		}
+		return "", fmt.Errorf("git %s: %s", args[0], err)
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
@@ -0,0 +1,81 @@
+package git
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+// testRepo creates a repository with a first commit, returning its
+// directory and a function running git in it
+func testRepo(t *testing.T) (string, func(...string)) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	tmp, err := ioutil.TempDir("", "helm-push-test")
+	if err != nil {
+		t.Fatal("unexpected error creating temp test dir", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(tmp) })
+	if tmp, err = filepath.EvalSymlinks(tmp); err != nil {
+		t.Fatal(err)
+	}
+	git := func(args ...string) {
+		cmd := exec.Command("git", append([]string{"-C", tmp, "-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %s", args, out)
+		}
+	}
+	git("init", "-q")
+	os.MkdirAll(filepath.Join(tmp, "charts", "api"), 0755)
+	os.MkdirAll(filepath.Join(tmp, "charts", "web"), 0755)
+	ioutil.WriteFile(filepath.Join(tmp, "charts", "api", "Chart.yaml"), []byte("name: api"), 0644)
+	ioutil.WriteFile(filepath.Join(tmp, "charts", "web", "Chart.yaml"), []byte("name: web"), 0644)
+	git("add", "-A")
+	git("commit", "-q", "-m", "init")
+	return tmp, git
+}
+
+func TestRevision(t *testing.T) {
+	dir, _ := testRepo(t)
+	rev, err := Revision(filepath.Join(dir, "charts"))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !regexp.MustCompile(`^[0-9a-f]{7,}$`).MatchString(rev) {
+		t.Errorf("unexpected revision %q", rev)
+	}
+	if _, err := Revision(os.TempDir()); err == nil {
+		t.Error("expected error outside of a repository, instead got nil")
+	}
+}
+
+func TestChangedFiles(t *testing.T) {
+	dir, git := testRepo(t)
+	git("tag", "v1")
+	ioutil.WriteFile(filepath.Join(dir, "charts", "api", "values.yaml"), []byte("replicas: 1"), 0644)
+	git("add", "-A")
+	git("commit", "-q", "-m", "api values")
+	ioutil.WriteFile(filepath.Join(dir, "charts", "web", "Chart.yaml"), []byte("name: web\nversion: 1.0.0"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "charts", "web", "values.yaml"), []byte("replicas: 2"), 0644)
+
+	files, err := ChangedFiles(filepath.Join(dir, "charts", "api"), "v1")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := []string{
+		filepath.Join(dir, "charts", "api", "values.yaml"),
+		filepath.Join(dir, "charts", "web", "Chart.yaml"),
+		filepath.Join(dir, "charts", "web", "values.yaml"),
+	}
+	if !reflect.DeepEqual(files, expected) {
+		t.Errorf("expected %v, got %v", expected, files)
+	}
+	if _, err := ChangedFiles(dir, "unknown-ref"); err == nil {
+		t.Error("expected error with unknown ref, instead got nil")
+	}
+}
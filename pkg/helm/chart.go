@@ -1,9 +1,18 @@
 package helm
 
 import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/semver/v3"
 	"helm.sh/helm/v3/pkg/chart"
 	"helm.sh/helm/v3/pkg/chart/loader"
-	"helm.sh/helm/v3/pkg/chartutil"
 )
 
 type (
@@ -23,6 +32,110 @@ func (c *Chart) SetAppVersion(appVersion string) {
 	c.Metadata.AppVersion = appVersion
 }
 
+// SetAnnotations adds annotations to the chart, overriding existing ones
+func (c *Chart) SetAnnotations(annotations map[string]string) {
+	if len(annotations) == 0 {
+		return
+	}
+	if c.Metadata.Annotations == nil {
+		c.Metadata.Annotations = map[string]string{}
+	}
+	for k, v := range annotations {
+		c.Metadata.Annotations[k] = v
+	}
+}
+
+// Exclude removes the templates and files matching one of patterns, it
+// returns the names of the removed ones. Patterns without a slash match
+// the name of a file or of any directory above it, the others match the
+// path of a file or directory relative to the chart root, as path.Match.
+func (c *Chart) Exclude(patterns []string) ([]string, error) {
+	var removed []string
+	filter := func(files []*chart.File) ([]*chart.File, error) {
+		kept := files[:0]
+		for _, f := range files {
+			ok, err := excluded(f.Name, patterns)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				removed = append(removed, f.Name)
+				continue
+			}
+			kept = append(kept, f)
+		}
+		return kept, nil
+	}
+	var err error
+	if c.Templates, err = filter(c.Templates); err != nil {
+		return nil, err
+	}
+	if c.Files, err = filter(c.Files); err != nil {
+		return nil, err
+	}
+	return removed, nil
+}
+
+// excluded tells if the slash separated name matches one of patterns,
+// see Exclude
+func excluded(name string, patterns []string) (bool, error) {
+	elems := strings.Split(name, "/")
+	for _, pattern := range patterns {
+		pattern = strings.Trim(pattern, "/")
+		for i := range elems {
+			subject := strings.Join(elems[:i+1], "/")
+			if !strings.Contains(pattern, "/") {
+				subject = elems[i]
+			}
+			ok, err := path.Match(pattern, subject)
+			if err != nil {
+				return false, fmt.Errorf("invalid exclude pattern %q: %s", pattern, err)
+			}
+			if ok {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// placeholder matches ${NAME} references to environment variables
+var placeholder = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// ExpandEnv replaces the ${NAME} placeholders of the version, app version
+// and annotations with the value of the NAME environment variable, it
+// tells whether anything was replaced. Referencing an undefined variable
+// is an error.
+func (c *Chart) ExpandEnv() (bool, error) {
+	expanded := false
+	expand := func(field, value string) (string, error) {
+		var err error
+		result := placeholder.ReplaceAllStringFunc(value, func(ref string) string {
+			name := placeholder.FindStringSubmatch(ref)[1]
+			v, ok := os.LookupEnv(name)
+			if !ok && err == nil {
+				err = fmt.Errorf("Chart.yaml: %s references undefined variable %s", field, name)
+			}
+			expanded = true
+			return v
+		})
+		return result, err
+	}
+	var err error
+	if c.Metadata.Version, err = expand("version", c.Metadata.Version); err != nil {
+		return false, err
+	}
+	if c.Metadata.AppVersion, err = expand("appVersion", c.Metadata.AppVersion); err != nil {
+		return false, err
+	}
+	for k, v := range c.Metadata.Annotations {
+		if c.Metadata.Annotations[k], err = expand("annotations."+k, v); err != nil {
+			return false, err
+		}
+	}
+	return expanded, nil
+}
+
 // GetChartByName returns a chart by "name", which can be
 // either a directory or .tgz package
 func GetChartByName(name string) (*Chart, error) {
@@ -33,7 +146,125 @@ func GetChartByName(name string) (*Chart, error) {
 	return &Chart{cc}, nil
 }
 
-// CreateChartPackage creates a new .tgz package in directory
-func CreateChartPackage(c *Chart, outDir string) (string, error) {
-	return chartutil.Save(c.Chart, outDir)
+// LocalDependencies returns the directories of the dependencies of the
+// chart at dir which are stored on disk (file:// repositories)
+func LocalDependencies(dir string) ([]string, error) {
+	c, err := loader.Load(dir)
+	if err != nil {
+		return nil, err
+	}
+	var deps []string
+	for _, d := range c.Metadata.Dependencies {
+		if path, ok := localPath(dir, d); ok {
+			deps = append(deps, path)
+		}
+	}
+	return deps, nil
+}
+
+// VendorLocalDependencies packages the dependencies stored on disk (file://
+// repositories) into the chart, replacing the copies found in charts/ if
+// any, so that the chart is self-contained once pushed. Relative paths are
+// resolved from dir, the chart directory, and the dependencies are
+// vendored recursively. It returns the names of the dependencies vendored,
+// or an error when the dependencies form a cycle.
+func (c *Chart) VendorLocalDependencies(dir string) ([]string, error) {
+	return c.vendorLocalDependencies(dir, nil)
+}
+
+// vendorLocalDependencies vendors the local dependencies of the chart at
+// dir, parents holding the directories of the charts depending on it
+func (c *Chart) vendorLocalDependencies(dir string, parents []string) ([]string, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	if resolved, err := filepath.EvalSymlinks(abs); err == nil {
+		abs = resolved
+	}
+	for i, parent := range parents {
+		if parent == abs {
+			return nil, fmt.Errorf("dependency cycle: %s", strings.Join(append(parents[i:], abs), " -> "))
+		}
+	}
+	parents = append(parents[:len(parents):len(parents)], abs)
+
+	var vendored []string
+	for _, d := range c.Metadata.Dependencies {
+		path, ok := localPath(dir, d)
+		if !ok {
+			continue
+		}
+		dep, err := GetChartByName(path)
+		if err != nil {
+			return nil, fmt.Errorf("dependency %s: %s", d.Name, err)
+		}
+		if dep.Metadata.Name != d.Name {
+			return nil, fmt.Errorf("dependency %s: %s holds chart %s", d.Name, d.Repository, dep.Metadata.Name)
+		}
+		if err := checkVersion(d, dep.Metadata.Version); err != nil {
+			return nil, err
+		}
+		if _, err := dep.vendorLocalDependencies(path, parents); err != nil {
+			return nil, err
+		}
+
+		var subcharts []*chart.Chart
+		for _, sc := range c.Dependencies() {
+			if sc.Name() != d.Name {
+				subcharts = append(subcharts, sc)
+			}
+		}
+		c.SetDependencies(append(subcharts, dep.Chart)...)
+		vendored = append(vendored, d.Name+"-"+dep.Metadata.Version)
+	}
+	return vendored, nil
+}
+
+// localPath returns the directory of the dependency d of the chart at dir
+// if it is stored on disk
+func localPath(dir string, d *chart.Dependency) (string, bool) {
+	if !strings.HasPrefix(d.Repository, "file://") {
+		return "", false
+	}
+	path := filepath.FromSlash(strings.TrimPrefix(d.Repository, "file://"))
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+	return path, true
+}
+
+// checkVersion checks that version satisfies the version constraint of the
+// dependency d
+func checkVersion(d *chart.Dependency, version string) error {
+	if d.Version == "" {
+		return nil
+	}
+	constraint, err := semver.NewConstraint(d.Version)
+	if err != nil {
+		return fmt.Errorf("dependency %s: invalid version %q: %s", d.Name, d.Version, err)
+	}
+	v, err := semver.NewVersion(version)
+	if err != nil {
+		return fmt.Errorf("dependency %s: invalid chart version %q: %s", d.Name, version, err)
+	}
+	if !constraint.Check(v) {
+		return fmt.Errorf("dependency %s: version %s of %s does not match %s", d.Name, version, d.Repository, d.Version)
+	}
+	return nil
+}
+
+// SourceDate returns the modification time of the files of the packages,
+// $SOURCE_DATE_EPOCH or the Unix epoch, see
+// https://reproducible-builds.org/docs/source-date-epoch/
+func SourceDate() (time.Time, error) {
+	v, ok := os.LookupEnv("SOURCE_DATE_EPOCH")
+	if !ok || v == "" {
+		return time.Unix(0, 0), nil
+	}
+	epoch, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid SOURCE_DATE_EPOCH %q: %s", v, err)
+	}
+	return time.Unix(epoch, 0), nil
 }
@@ -4,7 +4,14 @@ import (
 	"io/ioutil"
 	"os"
 	"path"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
+
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/provenance"
 )
 
 var testTarballPath = "../../testdata/charts/helm2/mychart/mychart-0.1.0.tgz"
@@ -62,3 +69,165 @@ func TestCreateChartPackage(t *testing.T) {
 		t.Errorf("expected chart path to be %s, but was %s", expectedPath, chartPackagePath)
 	}
 }
+
+func TestExpandEnv(t *testing.T) {
+	c, err := GetChartByName(testTarballPath)
+	if err != nil {
+		t.Fatal("unexpected error getting test tarball chart", err)
+	}
+	os.Setenv("TEST_GIT_SHA", "1a2b3c4")
+	os.Setenv("TEST_BUILD_NUMBER", "42")
+	defer os.Unsetenv("TEST_GIT_SHA")
+	defer os.Unsetenv("TEST_BUILD_NUMBER")
+
+	expanded, err := c.ExpandEnv()
+	if err != nil || expanded {
+		t.Errorf("expected chart without placeholders to be left as is, got %v, %v", expanded, err)
+	}
+
+	c.SetVersion("0.1.0-${TEST_BUILD_NUMBER}")
+	c.SetAppVersion("${TEST_GIT_SHA}")
+	c.SetAnnotations(map[string]string{"build": "$TEST_BUILD_NUMBER ${TEST_BUILD_NUMBER}"})
+	expanded, err = c.ExpandEnv()
+	if err != nil || !expanded {
+		t.Fatalf("expected chart to be expanded, got %v, %v", expanded, err)
+	}
+	if c.Metadata.Version != "0.1.0-42" || c.Metadata.AppVersion != "1a2b3c4" || c.Metadata.Annotations["build"] != "$TEST_BUILD_NUMBER 42" {
+		t.Errorf("unexpected metadata %+v", c.Metadata)
+	}
+
+	c.SetVersion("0.1.0-${TEST_UNDEFINED}")
+	if _, err := c.ExpandEnv(); err == nil {
+		t.Error("expected error with undefined variable, instead got nil")
+	}
+}
+
+func TestVendorLocalDependencies(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "helm-push-test")
+	if err != nil {
+		t.Fatal("unexpected error creating temp test dir", err)
+	}
+	defer os.RemoveAll(tmp)
+	write := func(name, data string) {
+		os.MkdirAll(filepath.Dir(filepath.Join(tmp, name)), 0755)
+		ioutil.WriteFile(filepath.Join(tmp, name), []byte(data), 0644)
+	}
+	write("app/Chart.yaml", `apiVersion: v2
+name: app
+version: 0.1.0
+dependencies:
+- name: lib
+  version: ^1.0.0
+  repository: file://../lib
+- name: mariadb
+  version: 5.11.3
+  repository: https://charts.example.com
+`)
+	write("app/charts/lib/Chart.yaml", "apiVersion: v2\nname: lib\nversion: 0.9.0\n")
+	write("lib/Chart.yaml", "apiVersion: v2\nname: lib\nversion: 1.2.0\ndependencies:\n- name: common\n  repository: file://../common\n")
+	write("common/Chart.yaml", "apiVersion: v2\nname: common\nversion: 0.3.0\n")
+
+	dir := filepath.Join(tmp, "app")
+	c, err := GetChartByName(dir)
+	if err != nil {
+		t.Fatalf("unexpected error getting chart: %s", err)
+	}
+	vendored, err := c.VendorLocalDependencies(dir)
+	if err != nil {
+		t.Fatalf("unexpected error vendoring dependencies: %s", err)
+	}
+	if len(vendored) != 1 || vendored[0] != "lib-1.2.0" {
+		t.Errorf("expected lib-1.2.0 to be vendored, got %v", vendored)
+	}
+	deps := c.Dependencies()
+	if len(deps) != 1 || deps[0].Metadata.Version != "1.2.0" {
+		t.Fatalf("expected stale lib subchart to be replaced, got %+v", deps)
+	}
+	if sub := deps[0].Dependencies(); len(sub) != 1 || sub[0].Name() != "common" {
+		t.Errorf("expected common to be vendored in lib, got %+v", sub)
+	}
+
+	// Version mismatch
+	write("lib/Chart.yaml", "apiVersion: v2\nname: lib\nversion: 2.0.0\n")
+	c, _ = GetChartByName(dir)
+	if _, err := c.VendorLocalDependencies(dir); err == nil {
+		t.Error("expected error with mismatching version, instead got nil")
+	}
+
+	// Dependency cycle
+	write("lib/Chart.yaml", "apiVersion: v2\nname: lib\nversion: 1.2.0\ndependencies:\n- name: common\n  repository: file://../common\n")
+	write("common/Chart.yaml", "apiVersion: v2\nname: common\nversion: 0.3.0\ndependencies:\n- name: lib\n  repository: file://../lib\n")
+	c, _ = GetChartByName(dir)
+	if _, err := c.VendorLocalDependencies(dir); err == nil || !strings.Contains(err.Error(), "dependency cycle") {
+		t.Errorf("expected dependency cycle error, got %v", err)
+	}
+}
+
+func TestCreateChartPackageReproducible(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "helm-push-test")
+	if err != nil {
+		t.Fatal("unexpected error creating temp test dir", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	digest := func(dir string) string {
+		c, err := GetChartByName("../../testdata/charts/helm3/my-v3-chart")
+		if err != nil {
+			t.Fatalf("unexpected error getting chart: %s", err)
+		}
+		path, err := CreateChartPackage(c, filepath.Join(tmp, dir))
+		if err != nil {
+			t.Fatalf("unexpected error creating chart package: %s", err)
+		}
+		d, err := provenance.DigestFile(path)
+		if err != nil {
+			t.Fatalf("unexpected error computing digest: %s", err)
+		}
+		return d
+	}
+	first := digest("first")
+	time.Sleep(1100 * time.Millisecond)
+	if second := digest("second"); second != first {
+		t.Errorf("expected identical packages, got digests %s and %s", first, second)
+	}
+
+	os.Setenv("SOURCE_DATE_EPOCH", "1609841563")
+	defer os.Unsetenv("SOURCE_DATE_EPOCH")
+	if d := digest("dated"); d == first {
+		t.Error("expected SOURCE_DATE_EPOCH to change the package")
+	}
+	os.Setenv("SOURCE_DATE_EPOCH", "yesterday")
+	if _, err := SourceDate(); err == nil {
+		t.Error("expected error with invalid SOURCE_DATE_EPOCH, instead got nil")
+	}
+}
+
+func TestExclude(t *testing.T) {
+	c := &Chart{&chart.Chart{
+		Metadata: &chart.Metadata{Name: "mychart", Version: "0.1.0"},
+		Templates: []*chart.File{
+			{Name: "templates/deployment.yaml"},
+			{Name: "templates/tests/test-connection.yaml"},
+		},
+		Files: []*chart.File{
+			{Name: "README.md"},
+			{Name: "docs/usage.md"},
+			{Name: "ci/values.yaml"},
+			{Name: "files/config.json"},
+		},
+	}}
+	removed, err := c.Exclude([]string{"*.md", "ci/", "templates/tests"})
+	if err != nil {
+		t.Fatalf("unexpected error excluding files: %s", err)
+	}
+	expected := []string{"templates/tests/test-connection.yaml", "README.md", "docs/usage.md", "ci/values.yaml"}
+	if !reflect.DeepEqual(removed, expected) {
+		t.Errorf("expected %v to be removed, got %v", expected, removed)
+	}
+	if len(c.Templates) != 1 || len(c.Files) != 1 || c.Files[0].Name != "files/config.json" {
+		t.Errorf("unexpected files left: %v %v", c.Templates, c.Files)
+	}
+	if _, err := c.Exclude([]string{"["}); err == nil {
+		t.Error("expected error with an invalid pattern, instead got nil")
+	}
+}
@@ -0,0 +1,197 @@
+package helm
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"helm.sh/helm/v3/pkg/repo"
+)
+
+// DecodeIndex reads an index file from r. The entries of each chart are
+// parsed on their own rather than with the whole document, so that memory
+// stays bounded with repositories of thousands of charts. Only the
+// entries of the charts keep returns true for are kept, the others are
+// skipped without being parsed, all of them are kept when keep is nil.
+//
+// Entries are expected in the block style of Helm and ChartMuseum indexes,
+// other styles are parsed with the rest of the document.
+func DecodeIndex(r io.Reader, keep func(name string) bool) (*Index, error) {
+	if keep == nil {
+		keep = func(string) bool { return true }
+	}
+	d := &indexDecoder{entries: map[string]repo.ChartVersions{}, keep: keep, indent: -1}
+	br := bufio.NewReader(r)
+	for n := 1; ; n++ {
+		line, err := br.ReadString('\n')
+		if line != "" {
+			if perr := d.line(line); perr != nil {
+				return nil, fmt.Errorf("line %d: %s", n, perr)
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := d.flush(); err != nil {
+		return nil, err
+	}
+
+	i := &Index{}
+	if err := yaml.Unmarshal(d.header.Bytes(), i); err != nil {
+		return nil, err
+	}
+	if !d.blockEntries {
+		if i.IndexFile != nil {
+			for name := range i.Entries {
+				if !keep(name) {
+					delete(i.Entries, name)
+				}
+			}
+		}
+	} else {
+		if i.IndexFile == nil {
+			i.IndexFile = &repo.IndexFile{}
+		}
+		i.Entries = d.entries
+	}
+	if i.IndexFile != nil {
+		i.SortEntries()
+	}
+	return i, nil
+}
+
+// indexDecoder splits an index file into the top level document and the
+// blocks of the charts of the entries mapping
+type indexDecoder struct {
+	header  bytes.Buffer
+	entries map[string]repo.ChartVersions
+	keep    func(name string) bool
+
+	// blockEntries tells if an entries mapping in block style was found,
+	// inEntries if the current line belongs to it
+	blockEntries bool
+	inEntries    bool
+	// indent is the indentation of the chart names in entries
+	indent int
+	// block holds the lines of the current chart, without the entries
+	// indentation, skip tells if the chart is left out
+	block bytes.Buffer
+	skip  bool
+}
+
+// line handles the next line of the document
+func (d *indexDecoder) line(line string) error {
+	content := strings.TrimLeft(line, " ")
+	indent := len(line) - len(content)
+	content = strings.TrimRight(content, "\r\n")
+	blank := strings.TrimSpace(content) == ""
+	comment := strings.HasPrefix(content, "#")
+
+	if d.inEntries {
+		switch {
+		case blank:
+			if d.block.Len() > 0 && !d.skip {
+				d.block.WriteString("\n")
+			}
+			return nil
+		case indent == 0 && !comment:
+			// Back to the top level
+			if err := d.flush(); err != nil {
+				return err
+			}
+			d.inEntries = false
+		case comment && (d.indent < 0 || indent <= d.indent):
+			return nil
+		case d.indent < 0 || indent == d.indent && !isSequenceItem(content):
+			if err := d.flush(); err != nil {
+				return err
+			}
+			d.indent = indent
+			d.skip = !d.keep(chartName(content))
+			if !d.skip {
+				d.block.WriteString(line[indent:])
+			}
+			return nil
+		case indent < d.indent:
+			return fmt.Errorf("unexpected indentation in entries")
+		default:
+			if !d.skip {
+				d.block.WriteString(line[d.indent:])
+			}
+			return nil
+		}
+	}
+
+	if indent == 0 && isEntriesKey(content) {
+		d.blockEntries, d.inEntries, d.indent = true, true, -1
+		return nil
+	}
+	d.header.WriteString(line)
+	return nil
+}
+
+// flush parses the block of the current chart
+func (d *indexDecoder) flush() error {
+	defer d.block.Reset()
+	if d.skip || d.block.Len() == 0 {
+		return nil
+	}
+	var entries map[string]repo.ChartVersions
+	if err := yaml.Unmarshal(d.block.Bytes(), &entries); err != nil {
+		return err
+	}
+	for name, versions := range entries {
+		if d.keep(name) {
+			d.entries[name] = append(d.entries[name], versions...)
+		}
+	}
+	return nil
+}
+
+// Charts returns a DecodeIndex filter keeping the charts names, or all of
+// them when there is none
+func Charts(names ...string) func(name string) bool {
+	if len(names) == 0 {
+		return nil
+	}
+	return func(name string) bool {
+		for _, n := range names {
+			if n == name {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// isEntriesKey tells if content starts the entries mapping in block style
+func isEntriesKey(content string) bool {
+	if !strings.HasPrefix(content, "entries:") {
+		return false
+	}
+	rest := strings.TrimSpace(strings.TrimPrefix(content, "entries:"))
+	return rest == "" || strings.HasPrefix(rest, "#")
+}
+
+// isSequenceItem tells if content is an item of a block sequence
+func isSequenceItem(content string) bool {
+	return content == "-" || strings.HasPrefix(content, "- ")
+}
+
+// chartName returns the key of the mapping entry starting with content
+func chartName(content string) string {
+	if i := strings.Index(content, " #"); i >= 0 {
+		content = content[:i]
+	}
+	if i := strings.Index(content, ": "); i >= 0 {
+		content = content[:i]
+	}
+	return strings.Trim(strings.TrimSuffix(strings.TrimSpace(content), ":"), `"'`)
+}
@@ -0,0 +1,133 @@
+package helm
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ghodss/yaml"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/repo"
+)
+
+// testIndex returns an index of charts charts with versions versions each,
+// marshalled as Helm and ChartMuseum do
+func testIndex(t testing.TB, charts, versions int) []byte {
+	index := repo.NewIndexFile()
+	index.ServerInfo = map[string]interface{}{"contextPath": "/helm/v1"}
+	for c := 0; c < charts; c++ {
+		for v := 0; v < versions; v++ {
+			md := &chart.Metadata{
+				APIVersion:  chart.APIVersionV2,
+				Name:        fmt.Sprintf("chart-%d", c),
+				Version:     fmt.Sprintf("1.%d.0", v),
+				Description: "A chart\n\nspanning several lines\n",
+				Annotations: map[string]string{"example.com/owner": "team-" + fmt.Sprint(c%7)},
+				Dependencies: []*chart.Dependency{
+					{Name: "common", Version: "1.x", Repository: "https://charts.example.com"},
+				},
+			}
+			name := fmt.Sprintf("%s-%s.tgz", md.Name, md.Version)
+			index.Add(md, "charts/"+name, "", "sha256:0123")
+		}
+	}
+	b, err := yaml.Marshal(index)
+	if err != nil {
+		t.Fatalf("unexpected error marshalling index: %s", err)
+	}
+	return b
+}
+
+func TestDecodeIndex(t *testing.T) {
+	data := testIndex(t, 20, 3)
+	expected := &Index{}
+	if err := yaml.Unmarshal(data, expected); err != nil {
+		t.Fatalf("unexpected error unmarshalling index: %s", err)
+	}
+	expected.SortEntries()
+
+	index, err := DecodeIndex(bytes.NewReader(data), nil)
+	if err != nil {
+		t.Fatalf("unexpected error decoding index: %s", err)
+	}
+	if !reflect.DeepEqual(index, expected) {
+		t.Errorf("expected decoded index to be the unmarshalled one")
+	}
+	if !strings.Contains(index.Entries["chart-3"][0].Description, "\n\nspanning") {
+		t.Errorf("expected block scalars to be kept, got %q", index.Entries["chart-3"][0].Description)
+	}
+
+	index, err = DecodeIndex(bytes.NewReader(data), Charts("chart-3", "chart-missing"))
+	if err != nil {
+		t.Fatalf("unexpected error decoding index: %s", err)
+	}
+	if len(index.Entries) != 1 || !reflect.DeepEqual(index.Entries["chart-3"], expected.Entries["chart-3"]) {
+		t.Errorf("expected only chart-3 to be decoded, got %v", index.Entries)
+	}
+	if index.ServerInfo.ContextPath != "/helm/v1" || index.APIVersion != "v1" {
+		t.Errorf("expected the rest of the document to be decoded, got %+v", index)
+	}
+	if index, err = DecodeIndex(bytes.NewReader(data), func(string) bool { return false }); err != nil || len(index.Entries) != 0 {
+		t.Errorf("expected no entries, got %v, %v", index, err)
+	}
+
+	// Entries out of the block style, hand written or with comments
+	for _, doc := range []string{
+		"apiVersion: v1\nentries: {mychart: [{name: mychart, version: 0.1.0}], other: []}\n",
+		"apiVersion: v1\nentries:\n  mychart:\n  - {name: mychart, version: 0.1.0}\n  other: []\n",
+		"apiVersion: v1\r\nentries: # charts\r\n    # first chart\r\n    \"mychart\":\r\n        - name: mychart\r\n\r\n          version: 0.1.0\r\n    other: []\r\n",
+	} {
+		index, err := LoadIndex([]byte(doc), "mychart")
+		if err != nil {
+			t.Errorf("unexpected error loading %q: %s", doc, err)
+			continue
+		}
+		if len(index.Entries) != 1 || len(index.Entries["mychart"]) != 1 || index.Entries["mychart"][0].Version != "0.1.0" {
+			t.Errorf("unexpected entries of %q: %v", doc, index.Entries)
+		}
+	}
+
+	if index, err := LoadIndex(nil); err != nil || index.IndexFile != nil {
+		t.Errorf("expected empty index, got %+v, %v", index, err)
+	}
+	for _, doc := range []string{
+		"entries:\n    mychart:\n    - name: mychart\n  other: []\n",
+		"entries:\n  mychart: [\n",
+		"apiVersion: [\n",
+	} {
+		if _, err := LoadIndex([]byte(doc)); err == nil {
+			t.Errorf("expected error loading %q, instead got nil", doc)
+		}
+	}
+}
+
+func BenchmarkDecodeIndex(b *testing.B) {
+	data := testIndex(b, 10000, 3)
+	b.Run("unmarshal", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			var index Index
+			if err := yaml.Unmarshal(data, &index); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("decode", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := DecodeIndex(bytes.NewReader(data), nil); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("decode one chart", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := DecodeIndex(bytes.NewReader(data), Charts("chart-5000")); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -0,0 +1,75 @@
+package helm
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"path"
+	"strings"
+)
+
+// helmignore is the file listing the files left out of a chart package
+const helmignore = ".helmignore"
+
+// ignoreRule is a pattern of a .helmignore file, matched as Helm does
+type ignoreRule struct {
+	pattern string
+	negate  bool
+	// dir rules only match directories
+	dir bool
+	// full rules match the whole path rather than the file name
+	full bool
+}
+
+// parseIgnoreRules parses the .helmignore data, Helm always leaves hidden
+// templates out
+func parseIgnoreRules(data []byte) ([]ignoreRule, error) {
+	rules := []ignoreRule{}
+	s := bufio.NewScanner(bytes.NewReader(bytes.TrimPrefix(data, []byte("\xEF\xBB\xBF"))))
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.Contains(line, "**") {
+			return nil, errors.New("double-star (**) syntax is not supported")
+		}
+		if _, err := path.Match(line, "abc"); err != nil {
+			return nil, err
+		}
+		r := ignoreRule{}
+		if strings.HasPrefix(line, "!") {
+			r.negate, line = true, line[1:]
+		}
+		if strings.HasSuffix(line, "/") {
+			r.dir, line = true, strings.TrimSuffix(line, "/")
+		}
+		r.full = strings.Contains(line, "/")
+		r.pattern = strings.TrimPrefix(line, "/")
+		rules = append(rules, r)
+	}
+	return append(rules, ignoreRule{pattern: "templates/.?*", full: true}), s.Err()
+}
+
+// ignored tells if the rules leave out the file or directory name, a slash
+// separated path relative to the chart root. Like Helm, negated rules
+// leave out everything they don't match.
+func ignored(rules []ignoreRule, name string, dir bool) bool {
+	for _, r := range rules {
+		subject := name
+		if !r.full {
+			subject = path.Base(name)
+		}
+		ok, _ := path.Match(r.pattern, subject)
+		if r.negate {
+			if (r.dir && !dir) || !ok {
+				return true
+			}
+			continue
+		}
+		if ok && (dir || !r.dir) {
+			return true
+		}
+	}
+	return false
+}
@@ -1,11 +1,11 @@
 package helm
 
 import (
+	"bytes"
 	"fmt"
-	"io/ioutil"
+	"os"
 	"path/filepath"
 
-	"github.com/ghodss/yaml"
 	"helm.sh/helm/v3/pkg/repo"
 )
 
@@ -20,31 +20,32 @@ type (
 	IndexDownloader func() ([]byte, error)
 )
 
-// GetIndexByRepo returns index by repository
-func GetIndexByRepo(repo *Repo, downloadIndex IndexDownloader) (*Index, error) {
+// GetIndexByRepo returns index by repository, only the entries of the
+// charts names are kept when given
+func GetIndexByRepo(repo *Repo, downloadIndex IndexDownloader, names ...string) (*Index, error) {
 	if repo.Config.Name != "" {
-		return GetIndexByDownloader(func() ([]byte, error) {
-			return ioutil.ReadFile(filepath.Join(repo.CachePath, fmt.Sprintf("%s-index.yaml", repo.Config.Name)))
-		})
+		f, err := os.Open(filepath.Join(repo.CachePath, fmt.Sprintf("%s-index.yaml", repo.Config.Name)))
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		return DecodeIndex(f, Charts(names...))
 	}
-	return GetIndexByDownloader(downloadIndex)
+	return GetIndexByDownloader(downloadIndex, names...)
 }
 
-// GetIndexByDownloader takes binary data from IndexDownloader and returns an Index object
-func GetIndexByDownloader(downloadIndex IndexDownloader) (*Index, error) {
+// GetIndexByDownloader takes binary data from IndexDownloader and returns
+// an Index object, see LoadIndex
+func GetIndexByDownloader(downloadIndex IndexDownloader, names ...string) (*Index, error) {
 	b, err := downloadIndex()
 	if err != nil {
 		return nil, err
 	}
-	return LoadIndex(b)
+	return LoadIndex(b, names...)
 }
 
-// LoadIndex loads an index file
-func LoadIndex(data []byte) (*Index, error) {
-	i := &Index{}
-	if err := yaml.Unmarshal(data, i); err != nil {
-		return i, err
-	}
-	i.SortEntries()
-	return i, nil
+// LoadIndex loads an index file, only the entries of the charts names are
+// kept when given, see DecodeIndex
+func LoadIndex(data []byte, names ...string) (*Index, error) {
+	return DecodeIndex(bytes.NewReader(data), Charts(names...))
 }
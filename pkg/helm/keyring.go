@@ -0,0 +1,196 @@
+package helm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/IxDay/helm-push-cloudflare-access/pkg/tmpdir"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/provenance"
+	"sigs.k8s.io/yaml"
+)
+
+// Keybox blob types, see https://github.com/gpg/gnupg/blob/master/kbx/keybox-blob.c
+const (
+	keyboxBlobHeader  = 1
+	keyboxBlobOpenPGP = 2
+	keyboxMagic       = "KBXf"
+)
+
+// IsKeybox tells if the file at path is a GnuPG 2.1+ keybox (pubring.kbx)
+// rather than a legacy OpenPGP keyring (pubring.gpg)
+func IsKeybox(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	header := make([]byte, 12)
+	if _, err := io.ReadFull(f, header); err != nil {
+		return false
+	}
+	return header[4] == keyboxBlobHeader && string(header[8:12]) == keyboxMagic
+}
+
+// ReadKeybox extracts the OpenPGP keyblocks of a keybox, the result is
+// a keyring in the legacy format
+func ReadKeybox(data []byte) ([]byte, error) {
+	var keyring bytes.Buffer
+	for len(data) > 0 {
+		if len(data) < 16 {
+			return nil, errors.New("invalid keybox: truncated blob")
+		}
+		size := binary.BigEndian.Uint32(data[0:4])
+		if size < 16 || uint64(size) > uint64(len(data)) {
+			return nil, fmt.Errorf("invalid keybox: blob size %d out of bounds", size)
+		}
+		blob := data[:size]
+		data = data[size:]
+
+		if blob[4] != keyboxBlobOpenPGP {
+			continue
+		}
+		offset := binary.BigEndian.Uint32(blob[8:12])
+		length := binary.BigEndian.Uint32(blob[12:16])
+		if uint64(offset)+uint64(length) > uint64(len(blob)) {
+			return nil, errors.New("invalid keybox: keyblock out of bounds")
+		}
+		keyring.Write(blob[offset : offset+length])
+	}
+	return keyring.Bytes(), nil
+}
+
+// openKeyring returns the path of a legacy keyring with the keys of the
+// keyring at path, keyboxes are converted to a temporary file removed by
+// the returned function
+func openKeyring(path string) (string, func(), error) {
+	if !IsKeybox(path) {
+		return path, func() {}, nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", nil, err
+	}
+	keyring, err := ReadKeybox(data)
+	if err != nil {
+		return "", nil, fmt.Errorf("%s: %s", path, err)
+	}
+	f, err := tmpdir.NewFile("helm-push-keyring-")
+	if err != nil {
+		return "", nil, err
+	}
+	defer f.Close()
+	cleanup := func() { os.Remove(f.Name()) }
+	if _, err := f.Write(keyring); err != nil {
+		cleanup()
+		return "", nil, err
+	}
+	return f.Name(), cleanup, nil
+}
+
+// SignChartPackageWithGPG signs the chart package at chartPath with the gpg
+// binary ($GPG_BIN or gpg), the secret key being held by gpg-agent. The
+// provenance file is written next to the package and its path returned.
+func SignChartPackageWithGPG(chartPath, keyring, key, passphraseFile string) (string, error) {
+	message, err := provenanceMessage(chartPath)
+	if err != nil {
+		return "", err
+	}
+
+	args := []string{"--batch", "--yes", "--armor", "--clearsign", "--digest-algo", "SHA512"}
+	// gpg refuses to register its own keybox twice
+	if keyring != "" && !samePath(filepath.Dir(filepath.Clean(keyring)), gnupgHome()) {
+		args = append(args, "--keyring", keyring)
+	}
+	if key != "" {
+		args = append(args, "--local-user", key)
+	}
+	if passphraseFile != "" {
+		args = append(args, "--pinentry-mode", "loopback", "--passphrase-file", passphraseFile)
+	}
+
+	bin, ok := os.LookupEnv("GPG_BIN")
+	if !ok {
+		bin = "gpg"
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(bin, args...)
+	cmd.Stdin = bytes.NewReader(message)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("signing chart with gpg: %s", msg)
+		}
+		return "", fmt.Errorf("signing chart with gpg: %s", err)
+	}
+
+	provPath := chartPath + ".prov"
+	return provPath, ioutil.WriteFile(provPath, stdout.Bytes(), 0644)
+}
+
+// DefaultKeyring returns the GnuPG public keyring, the keybox of GnuPG 2.1+
+// is used when there is no legacy pubring.gpg
+func DefaultKeyring() string {
+	keyring := filepath.Join(gnupgHome(), "pubring.gpg")
+	if _, err := os.Stat(keyring); os.IsNotExist(err) {
+		if keybox := filepath.Join(gnupgHome(), "pubring.kbx"); IsKeybox(keybox) {
+			return keybox
+		}
+	}
+	return keyring
+}
+
+func gnupgHome() string {
+	if home := os.Getenv("GNUPGHOME"); home != "" {
+		return filepath.Clean(home)
+	}
+	// Gpg4win keeps its home in the roaming application data
+	if appData := os.Getenv("APPDATA"); runtime.GOOS == "windows" && appData != "" {
+		return filepath.Join(appData, "gnupg")
+	}
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".gnupg")
+}
+
+// samePath compares cleaned paths, case insensitively on Windows
+func samePath(a, b string) bool {
+	if runtime.GOOS == "windows" {
+		return strings.EqualFold(a, b)
+	}
+	return a == b
+}
+
+// provenanceMessage builds the message signed in a provenance file: the
+// chart metadata and the checksum of the package, as Helm does
+func provenanceMessage(chartPath string) ([]byte, error) {
+	digest, err := provenance.DigestFile(chartPath)
+	if err != nil {
+		return nil, err
+	}
+	chart, err := loader.LoadFile(chartPath)
+	if err != nil {
+		return nil, err
+	}
+	metadata, err := yaml.Marshal(chart.Metadata)
+	if err != nil {
+		return nil, err
+	}
+	sums, err := yaml.Marshal(&provenance.SumCollection{
+		Files: map[string]string{filepath.Base(chartPath): "sha256:" + digest},
+	})
+	if err != nil {
+		return nil, err
+	}
+	// YAML document end marker, "---" is not legal in a clearsigned message
+	return append(append(metadata, "\n...\n"...), sums...), nil
+}
@@ -0,0 +1,112 @@
+package helm
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"helm.sh/helm/v3/pkg/provenance"
+)
+
+var testKeyboxPath = "../../testdata/pgp/helm-test-key.kbx"
+
+func TestReadKeybox(t *testing.T) {
+	if !IsKeybox(testKeyboxPath) {
+		t.Error("expected keybox to be detected")
+	}
+	if IsKeybox(testPublicKeyringPath) || IsKeybox("/non/existant/pubring.kbx") {
+		t.Error("expected legacy keyring not to be detected as a keybox")
+	}
+
+	data, err := ioutil.ReadFile(testKeyboxPath)
+	if err != nil {
+		t.Fatal("unexpected error reading keybox", err)
+	}
+	keyring, err := ReadKeybox(data)
+	if err != nil {
+		t.Fatalf("unexpected error reading keybox: %s", err)
+	}
+	if len(keyring) == 0 {
+		t.Fatal("expected keyblocks to be extracted")
+	}
+
+	if _, err := ReadKeybox(data[:len(data)-1]); err == nil {
+		t.Error("expected error reading truncated keybox, instead got nil")
+	}
+}
+
+func signTestChart(t *testing.T, tmp string) (string, string) {
+	chart, err := ioutil.ReadFile(testTarballPath)
+	if err != nil {
+		t.Fatal("unexpected error reading test tarball", err)
+	}
+	chartPath := filepath.Join(tmp, "mychart-0.1.0.tgz")
+	if err := ioutil.WriteFile(chartPath, chart, 0600); err != nil {
+		t.Fatal("unexpected error copying test tarball", err)
+	}
+	signer, err := provenance.NewFromKeyring(testSecretKeyringPath, "helm-test")
+	if err != nil {
+		t.Fatal("unexpected error loading test key", err)
+	}
+	prov, err := signer.ClearSign(chartPath)
+	if err != nil {
+		t.Fatal("unexpected error signing test tarball", err)
+	}
+	return chartPath, prov
+}
+
+func TestVerifyWithKeybox(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "helm-push-test")
+	if err != nil {
+		t.Fatal("unexpected error creating temp test dir", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	chartPath, prov := signTestChart(t, tmp)
+	chart, _ := ioutil.ReadFile(chartPath)
+	if _, err := VerifyChartData("mychart-0.1.0.tgz", chart, []byte(prov), testKeyboxPath); err != nil {
+		t.Errorf("unexpected error verifying chart with keybox: %s", err)
+	}
+}
+
+func TestSignChartPackageWithGPG(t *testing.T) {
+	if _, err := exec.LookPath("gpg"); err != nil {
+		t.Skip("gpg is not installed")
+	}
+	tmp, err := ioutil.TempDir("", "helm-push-test")
+	if err != nil {
+		t.Fatal("unexpected error creating temp test dir", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	// Isolated GnuPG home holding the test secret key in its agent
+	home := filepath.Join(tmp, "gnupg")
+	os.Mkdir(home, 0700)
+	os.Setenv("GNUPGHOME", home)
+	defer os.Unsetenv("GNUPGHOME")
+	defer exec.Command("gpgconf", "--kill", "gpg-agent").Run()
+	if out, err := exec.Command("gpg", "--batch", "--import", testSecretKeyringPath).CombinedOutput(); err != nil {
+		t.Fatalf("unexpected error importing test key: %s", out)
+	}
+	keybox := filepath.Join(home, "pubring.kbx")
+
+	chartPath, _ := signTestChart(t, tmp)
+	provPath, err := SignChartPackageWithGPG(chartPath, keybox, "helm-testing@helm.sh", "")
+	if err != nil {
+		t.Fatalf("unexpected error signing with gpg: %s", err)
+	}
+	v, err := VerifyChartPackage(chartPath, provPath, keybox)
+	if err != nil {
+		t.Fatalf("unexpected error verifying gpg signature: %s", err)
+	}
+	if v.FileName != "mychart-0.1.0.tgz" {
+		t.Errorf("unexpected verified file name %s", v.FileName)
+	}
+
+	// Unknown key
+	if _, err := SignChartPackageWithGPG(chartPath, keybox, "nobody@example.com", ""); err == nil {
+		t.Error("expected error signing with unknown key, instead got nil")
+	}
+}
@@ -0,0 +1,195 @@
+package helm
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/IxDay/helm-push-cloudflare-access/pkg/vfs"
+	"github.com/ghodss/yaml"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
+)
+
+// packageHeader is the gzip extra header of Helm packages
+var packageHeader = []byte("+aHR0cHM6Ly95b3V0dS5iZS96OVV6MWljandyTQo=")
+
+// LoadChart loads the chart directory or .tgz package name of fsys. Charts
+// of the host filesystem are loaded as GetChartByName does.
+func LoadChart(fsys vfs.FS, name string) (*Chart, error) {
+	if vfs.IsOS(fsys) {
+		return GetChartByName(name)
+	}
+	fi, err := fs.Stat(fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	if !fi.IsDir() {
+		f, err := fsys.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		cc, err := loader.LoadArchive(f)
+		if err != nil {
+			return nil, err
+		}
+		return &Chart{cc}, nil
+	}
+
+	b, err := fs.ReadFile(fsys, path.Join(name, helmignore))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	rules, err := parseIgnoreRules(b)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", helmignore, err)
+	}
+	var files []*loader.BufferedFile
+	err = fs.WalkDir(fsys, name, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || p == name {
+			return err
+		}
+		rel := strings.TrimPrefix(strings.TrimPrefix(p, name), "/")
+		if ignored(rules, rel, d.IsDir()) {
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			return nil
+		}
+		data, err := fs.ReadFile(fsys, p)
+		if err != nil {
+			return err
+		}
+		files = append(files, &loader.BufferedFile{Name: rel, Data: data})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	cc, err := loader.LoadFiles(files)
+	if err != nil {
+		return nil, err
+	}
+	return &Chart{cc}, nil
+}
+
+// CreateChartPackage creates a new .tgz package in directory. Packages are
+// reproducible, the same chart always results in the same package, see
+// SourceDate.
+func CreateChartPackage(c *Chart, outDir string) (string, error) {
+	return SaveChartPackage(vfs.OS, c, outDir)
+}
+
+// SaveChartPackage creates a new .tgz package in the directory outDir of
+// fsys, see CreateChartPackage
+func SaveChartPackage(fsys vfs.FS, c *Chart, outDir string) (string, error) {
+	var buf bytes.Buffer
+	if err := WritePackage(&buf, c); err != nil {
+		return "", err
+	}
+	if err := fsys.MkdirAll(outDir, 0755); err != nil {
+		return "", err
+	}
+	path := filepath.Join(outDir, fmt.Sprintf("%s-%s.tgz", c.Name(), c.Metadata.Version))
+	return path, fsys.WriteFile(path, buf.Bytes(), 0644)
+}
+
+// WritePackage writes the .tgz package of the chart to w, as helm package
+// would but with every file modified at SourceDate
+func WritePackage(w io.Writer, c *Chart) error {
+	if err := c.Validate(); err != nil {
+		return fmt.Errorf("chart validation: %s", err)
+	}
+	mtime, err := SourceDate()
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(w)
+	zw.Header.Extra = packageHeader
+	zw.Header.Comment = "Helm"
+	tw := tar.NewWriter(zw)
+	if err := writeChart(tw, c.Chart, "", mtime); err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// writeChart adds the files of c to the package in the directory prefix,
+// the layout is the one of chartutil.Save
+func writeChart(tw *tar.Writer, c *chart.Chart, prefix string, mtime time.Time) error {
+	base := path.Join(prefix, c.Name())
+	write := func(name string, data []byte) error {
+		hdr := &tar.Header{Name: path.Join(base, name), Mode: 0644, Size: int64(len(data)), ModTime: mtime}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		_, err := tw.Write(data)
+		return err
+	}
+
+	// Dependencies of v1 charts are stored in requirements.yaml
+	metadata := *c.Metadata
+	if metadata.APIVersion == chart.APIVersionV1 {
+		metadata.Dependencies = nil
+	}
+	b, err := yaml.Marshal(metadata)
+	if err != nil {
+		return err
+	}
+	if err := write(chartutil.ChartfileName, b); err != nil {
+		return err
+	}
+	if c.Metadata.APIVersion == chart.APIVersionV2 && c.Lock != nil {
+		if b, err = yaml.Marshal(c.Lock); err != nil {
+			return err
+		}
+		if err := write("Chart.lock", b); err != nil {
+			return err
+		}
+	}
+	for _, f := range c.Raw {
+		if f.Name == chartutil.ValuesfileName {
+			if err := write(chartutil.ValuesfileName, f.Data); err != nil {
+				return err
+			}
+		}
+	}
+	if c.Schema != nil {
+		if !json.Valid(c.Schema) {
+			return errors.New("invalid JSON in " + chartutil.SchemafileName)
+		}
+		if err := write(chartutil.SchemafileName, c.Schema); err != nil {
+			return err
+		}
+	}
+	for _, files := range [][]*chart.File{c.Templates, c.Files} {
+		for _, f := range files {
+			if err := write(filepath.ToSlash(f.Name), f.Data); err != nil {
+				return err
+			}
+		}
+	}
+	for _, dep := range c.Dependencies() {
+		if err := writeChart(tw, dep, path.Join(base, chartutil.ChartsDir), mtime); err != nil {
+			return err
+		}
+	}
+	return nil
+}
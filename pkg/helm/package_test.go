@@ -0,0 +1,88 @@
+package helm
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/IxDay/helm-push-cloudflare-access/pkg/vfs"
+)
+
+func TestLoadChart(t *testing.T) {
+	dir := "../../testdata/charts/helm3/my-v3-chart"
+	mem := vfs.NewMem()
+	err := filepath.Walk(dir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil || fi.IsDir() {
+			return err
+		}
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(dir, path)
+		return mem.WriteFile(filepath.Join("/charts/my-v3-chart", rel), b, 0644)
+	})
+	if err != nil {
+		t.Fatal("unexpected error copying test chart", err)
+	}
+
+	c, err := LoadChart(mem, "/charts/my-v3-chart")
+	if err != nil {
+		t.Fatalf("unexpected error loading chart: %s", err)
+	}
+	packaged, err := SaveChartPackage(mem, c, "/out")
+	if err != nil {
+		t.Fatalf("unexpected error creating chart package: %s", err)
+	}
+	if packaged != filepath.Join("/out", "my-v3-chart-0.1.0.tgz") {
+		t.Errorf("unexpected package path %s", packaged)
+	}
+	actual, _ := mem.ReadFile(packaged)
+
+	// Same package as from the host filesystem
+	tmp, err := ioutil.TempDir("", "helm-push-test")
+	if err != nil {
+		t.Fatal("unexpected error creating temp test dir", err)
+	}
+	defer os.RemoveAll(tmp)
+	c, err = LoadChart(vfs.OS, dir)
+	if err != nil {
+		t.Fatalf("unexpected error loading chart: %s", err)
+	}
+	path, err := CreateChartPackage(c, tmp)
+	if err != nil {
+		t.Fatalf("unexpected error creating chart package: %s", err)
+	}
+	expected, _ := ioutil.ReadFile(path)
+	if !bytes.Equal(actual, expected) {
+		t.Error("expected the same package from memory and from the host filesystem")
+	}
+
+	if c, err := LoadChart(mem, packaged); err != nil || c.Metadata.Name != "my-v3-chart" {
+		t.Errorf("expected package to be loaded, got %v", err)
+	}
+	mem.WriteFile("/charts/my-v3-chart/.helmignore", []byte("# comment\n*.tgz\ntemplates/tests/\n/values.*.json\n"), 0644)
+	mem.WriteFile("/charts/my-v3-chart/templates/.hidden.yaml", []byte("kind: Secret\n"), 0644)
+	c, err = LoadChart(mem, "/charts/my-v3-chart")
+	if err != nil {
+		t.Fatalf("unexpected error loading chart: %s", err)
+	}
+	for _, f := range append(c.Templates, c.Files...) {
+		if strings.HasSuffix(f.Name, ".tgz") || strings.HasPrefix(f.Name, "templates/tests/") || f.Name == "templates/.hidden.yaml" {
+			t.Errorf("expected %s to be ignored", f.Name)
+		}
+	}
+	if c.Schema != nil || len(c.Templates) == 0 {
+		t.Errorf("expected values.schema.json only to be ignored, got %d templates", len(c.Templates))
+	}
+	mem.WriteFile("/charts/my-v3-chart/.helmignore", []byte("charts/**\n"), 0644)
+	if _, err := LoadChart(mem, "/charts/my-v3-chart"); err == nil || !strings.Contains(err.Error(), ".helmignore") {
+		t.Errorf("expected .helmignore error, got %v", err)
+	}
+	if _, err := LoadChart(mem, "/charts/missing"); err == nil {
+		t.Error("expected error loading missing chart, instead got nil")
+	}
+}
@@ -0,0 +1,106 @@
+package helm
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"sigs.k8s.io/yaml"
+)
+
+type (
+	// Patch holds changes to apply to Chart.yaml and values.yaml before
+	// packaging, as JSON merge patches (RFC 7386): maps are merged, null
+	// removes a key and any other value, lists included, replaces the
+	// original one
+	Patch struct {
+		Chart  map[string]interface{} `json:"chart,omitempty"`
+		Values map[string]interface{} `json:"values,omitempty"`
+	}
+)
+
+// LoadPatch reads the patch file at path
+func LoadPatch(path string) (*Patch, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	p := &Patch{}
+	if err := yaml.UnmarshalStrict(b, p); err != nil {
+		return nil, fmt.Errorf("%s: invalid patch: %s", path, err)
+	}
+	return p, nil
+}
+
+// Apply patches the chart metadata and values, it tells whether anything
+// was patched. values.yaml is rewritten when patched, losing its comments.
+func (c *Chart) Apply(p *Patch) (bool, error) {
+	if len(p.Chart) > 0 {
+		b, err := json.Marshal(c.Metadata)
+		if err != nil {
+			return false, err
+		}
+		doc := map[string]interface{}{}
+		if err := json.Unmarshal(b, &doc); err != nil {
+			return false, err
+		}
+		if b, err = json.Marshal(mergePatch(doc, p.Chart)); err != nil {
+			return false, err
+		}
+		metadata := &chart.Metadata{}
+		if err := json.Unmarshal(b, metadata); err != nil {
+			return false, fmt.Errorf("Chart.yaml: invalid patch: %s", err)
+		}
+		if err := metadata.Validate(); err != nil {
+			return false, fmt.Errorf("Chart.yaml: invalid patch: %s", err)
+		}
+		c.Metadata = metadata
+	}
+	if len(p.Values) > 0 {
+		if c.Values == nil {
+			c.Values = map[string]interface{}{}
+		}
+		c.Values = mergePatch(c.Values, p.Values)
+		b, err := yaml.Marshal(c.Values)
+		if err != nil {
+			return false, err
+		}
+		c.setRaw(chartutil.ValuesfileName, b)
+	}
+	return len(p.Chart) > 0 || len(p.Values) > 0, nil
+}
+
+// setRaw replaces the content of the raw file name, packages are written
+// from raw values.yaml
+func (c *Chart) setRaw(name string, data []byte) {
+	for _, f := range c.Raw {
+		if f.Name == name {
+			f.Data = data
+			return
+		}
+	}
+	c.Raw = append(c.Raw, &chart.File{Name: name, Data: data})
+}
+
+// mergePatch applies the JSON merge patch to target
+func mergePatch(target, patch map[string]interface{}) map[string]interface{} {
+	for k, v := range patch {
+		if v == nil {
+			delete(target, k)
+			continue
+		}
+		pm, ok := v.(map[string]interface{})
+		if !ok {
+			target[k] = v
+			continue
+		}
+		tm, ok := target[k].(map[string]interface{})
+		if !ok {
+			tm = map[string]interface{}{}
+		}
+		target[k] = mergePatch(tm, pm)
+	}
+	return target
+}
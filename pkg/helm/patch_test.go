@@ -0,0 +1,73 @@
+package helm
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"helm.sh/helm/v3/pkg/chart/loader"
+)
+
+func TestApplyPatch(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "helm-push-test")
+	if err != nil {
+		t.Fatal("unexpected error creating temp test dir", err)
+	}
+	defer os.RemoveAll(tmp)
+	path := filepath.Join(tmp, "patch.yaml")
+	ioutil.WriteFile(path, []byte(`
+chart:
+  home: https://charts.example.com
+  maintainers:
+  - name: platform
+    email: platform@example.com
+  description: null
+values:
+  image:
+    repository: registry.example.com/nginx
+  service: null
+`), 0644)
+	p, err := LoadPatch(path)
+	if err != nil {
+		t.Fatalf("unexpected error loading patch: %s", err)
+	}
+
+	c, err := GetChartByName("../../testdata/charts/helm3/my-v3-chart")
+	if err != nil {
+		t.Fatalf("unexpected error getting chart: %s", err)
+	}
+	pullPolicy := c.Values["image"].(map[string]interface{})["pullPolicy"]
+	patched, err := c.Apply(p)
+	if err != nil || !patched {
+		t.Fatalf("expected chart to be patched, got %v, %v", patched, err)
+	}
+	if c.Metadata.Home != "https://charts.example.com" || len(c.Metadata.Maintainers) != 1 || c.Metadata.Description != "" || c.Metadata.Name != "my-v3-chart" {
+		t.Errorf("unexpected metadata %+v", c.Metadata)
+	}
+
+	pkg, err := CreateChartPackage(c, tmp)
+	if err != nil {
+		t.Fatalf("unexpected error creating chart package: %s", err)
+	}
+	pushed, err := loader.Load(pkg)
+	if err != nil {
+		t.Fatalf("unexpected error loading chart package: %s", err)
+	}
+	image := pushed.Values["image"].(map[string]interface{})
+	if image["repository"] != "registry.example.com/nginx" || image["pullPolicy"] != pullPolicy {
+		t.Errorf("unexpected image values %+v", image)
+	}
+	if _, ok := pushed.Values["service"]; ok {
+		t.Errorf("expected service values to be removed, got %+v", pushed.Values["service"])
+	}
+
+	// Invalid patches
+	if _, err := c.Apply(&Patch{Chart: map[string]interface{}{"name": nil}}); err == nil {
+		t.Error("expected error removing the chart name, instead got nil")
+	}
+	ioutil.WriteFile(path, []byte("chart: {}\nreadme: {}\n"), 0644)
+	if _, err := LoadPatch(path); err == nil {
+		t.Error("expected error with unknown patch section, instead got nil")
+	}
+}
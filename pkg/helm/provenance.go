@@ -0,0 +1,77 @@
+package helm
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/IxDay/helm-push-cloudflare-access/pkg/tmpdir"
+	"helm.sh/helm/v3/pkg/provenance"
+)
+
+// VerifyChartData checks that prov is a valid provenance file for the chart
+// package data named name, signed by a key of keyring
+func VerifyChartData(name string, chart, prov []byte, keyring string) (*provenance.Verification, error) {
+	keyring, cleanup, err := openKeyring(keyring)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+	sig, err := provenance.NewFromKeyring(keyring, "")
+	if err != nil {
+		return nil, err
+	}
+
+	tmp, err := tmpdir.New("helm-push-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmp)
+
+	// the provenance file references the package by name
+	chartPath := filepath.Join(tmp, filepath.Base(name))
+	if err := ioutil.WriteFile(chartPath, chart, 0600); err != nil {
+		return nil, err
+	}
+	provPath := chartPath + ".prov"
+	if err := ioutil.WriteFile(provPath, prov, 0600); err != nil {
+		return nil, err
+	}
+	return sig.Verify(chartPath, provPath)
+}
+
+// VerifyChartPackage checks that the provenance file at provPath is valid
+// for the chart package at chartPath, signed by a key of keyring
+func VerifyChartPackage(chartPath, provPath, keyring string) (*provenance.Verification, error) {
+	keyring, cleanup, err := openKeyring(keyring)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+	sig, err := provenance.NewFromKeyring(keyring, "")
+	if err != nil {
+		return nil, err
+	}
+	return sig.Verify(chartPath, provPath)
+}
+
+// SignChartPackage signs the chart package at chartPath with the key named
+// key from keyring, the provenance file is written next to the package and
+// its path returned. Keyboxes only hold public keys, use
+// SignChartPackageWithGPG to sign with their secret keys.
+func SignChartPackage(chartPath, keyring, key string, passphrase provenance.PassphraseFetcher) (string, error) {
+	signer, err := provenance.NewFromKeyring(keyring, key)
+	if err != nil {
+		return "", fmt.Errorf("loading signing key: %s", err)
+	}
+	if err := signer.DecryptKey(passphrase); err != nil {
+		return "", fmt.Errorf("decrypting signing key: %s", err)
+	}
+	sig, err := signer.ClearSign(chartPath)
+	if err != nil {
+		return "", fmt.Errorf("signing chart: %s", err)
+	}
+	provPath := chartPath + ".prov"
+	return provPath, ioutil.WriteFile(provPath, []byte(sig), 0644)
+}
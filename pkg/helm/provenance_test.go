@@ -0,0 +1,96 @@
+package helm
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"helm.sh/helm/v3/pkg/provenance"
+)
+
+var (
+	testSecretKeyringPath = "../../testdata/pgp/helm-test-key.secret"
+	testPublicKeyringPath = "../../testdata/pgp/helm-test-key.pub"
+)
+
+func TestVerifyChartData(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "helm-push-test")
+	if err != nil {
+		t.Fatal("unexpected error creating temp test dir", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	chart, err := ioutil.ReadFile(testTarballPath)
+	if err != nil {
+		t.Fatal("unexpected error reading test tarball", err)
+	}
+	chartPath := filepath.Join(tmp, "mychart-0.1.0.tgz")
+	if err := ioutil.WriteFile(chartPath, chart, 0600); err != nil {
+		t.Fatal("unexpected error copying test tarball", err)
+	}
+
+	signer, err := provenance.NewFromKeyring(testSecretKeyringPath, "helm-test")
+	if err != nil {
+		t.Fatal("unexpected error loading test key", err)
+	}
+	prov, err := signer.ClearSign(chartPath)
+	if err != nil {
+		t.Fatal("unexpected error signing test tarball", err)
+	}
+
+	// Valid signature
+	v, err := VerifyChartData("mychart-0.1.0.tgz", chart, []byte(prov), testPublicKeyringPath)
+	if err != nil {
+		t.Fatalf("unexpected error verifying chart: %s", err)
+	}
+	if v.FileName != "mychart-0.1.0.tgz" {
+		t.Errorf("unexpected verified file name %s", v.FileName)
+	}
+
+	// Tampered chart
+	tampered := append(bytes.Repeat([]byte{0}, 1), chart...)
+	if _, err := VerifyChartData("mychart-0.1.0.tgz", tampered, []byte(prov), testPublicKeyringPath); err == nil {
+		t.Error("expected error verifying tampered chart, instead got nil")
+	}
+
+	// Unknown key
+	if _, err := VerifyChartData("mychart-0.1.0.tgz", chart, []byte(prov), "/non/existant/pubring.gpg"); err == nil {
+		t.Error("expected error verifying with missing keyring, instead got nil")
+	}
+}
+
+func TestSignChartPackage(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "helm-push-test")
+	if err != nil {
+		t.Fatal("unexpected error creating temp test dir", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	chart, err := ioutil.ReadFile(testTarballPath)
+	if err != nil {
+		t.Fatal("unexpected error reading test tarball", err)
+	}
+	chartPath := filepath.Join(tmp, "mychart-0.1.0.tgz")
+	if err := ioutil.WriteFile(chartPath, chart, 0600); err != nil {
+		t.Fatal("unexpected error copying test tarball", err)
+	}
+
+	noPassphrase := func(string) ([]byte, error) { return nil, nil }
+	provPath, err := SignChartPackage(chartPath, testSecretKeyringPath, "helm-test", noPassphrase)
+	if err != nil {
+		t.Fatalf("unexpected error signing chart: %s", err)
+	}
+	if provPath != chartPath+".prov" {
+		t.Errorf("unexpected provenance path %s", provPath)
+	}
+	if _, err := VerifyChartPackage(chartPath, provPath, testPublicKeyringPath); err != nil {
+		t.Errorf("unexpected error verifying signed chart: %s", err)
+	}
+
+	// Unknown key
+	if _, err := SignChartPackage(chartPath, testSecretKeyringPath, "nobody", noPassphrase); err == nil {
+		t.Error("expected error signing with unknown key, instead got nil")
+	}
+}
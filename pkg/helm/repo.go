@@ -1,6 +1,7 @@
 package helm
 
 import (
+	"errors"
 	"fmt"
 	urllib "net/url"
 	"os"
@@ -19,17 +20,30 @@ type (
 	Repo struct {
 		*repo.ChartRepository
 	}
+
+	// RepoNotFoundError is returned when the local repository list has no
+	// repository of the name, or does not exist
+	RepoNotFoundError struct {
+		Name string
+	}
 )
 
+func (e *RepoNotFoundError) Error() string {
+	return fmt.Sprintf("no repo named %q found", e.Name)
+}
+
 // GetRepoByName returns repository by name
 func GetRepoByName(name string) (*Repo, error) {
 	r, err := repoFile()
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, &RepoNotFoundError{Name: name}
+	}
 	if err != nil {
 		return nil, err
 	}
 	entry, exists := findRepoEntry(name, r)
 	if !exists {
-		return nil, fmt.Errorf("no repo named %q found", name)
+		return nil, &RepoNotFoundError{Name: name}
 	}
 
 	settings := cli.New()
@@ -70,17 +84,40 @@ func TempRepoFromURL(url string) (*Repo, error) {
 	return &Repo{cr}, nil
 }
 
+// AddRepo adds the repository name to the local repository list, or
+// updates its URL if it is already listed
+func AddRepo(name, url string) error {
+	path := repoFilePath()
+	r := repo.NewFile()
+	if _, err := os.Stat(path); err == nil {
+		if r, err = repo.LoadFile(path); err != nil {
+			return err
+		}
+	}
+	entry, exists := findRepoEntry(name, r)
+	if !exists {
+		entry = &repo.Entry{Name: name}
+	}
+	entry.URL = url
+	r.Update(entry)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return r.WriteFile(path, 0644)
+}
+
 func repoFile() (*repo.File, error) {
-	var repoFilePath string
+	repoFile, err := repo.LoadFile(repoFilePath())
+	return repoFile, err
+}
+
+func repoFilePath() string {
 	if HelmMajorVersionCurrent() == HelmMajorVersion2 {
 		home := v2helmHome()
-		repoFilePath = home.RepositoryFile()
-	} else {
-		settings := cli.New()
-		repoFilePath = settings.RepositoryConfig
+		return home.RepositoryFile()
 	}
-	repoFile, err := repo.LoadFile(repoFilePath)
-	return repoFile, err
+	settings := cli.New()
+	return settings.RepositoryConfig
 }
 
 func v2helmHome() v2helmpath.Home {
@@ -1,6 +1,7 @@
 package helm
 
 import (
+	"errors"
 	"io/ioutil"
 	"os"
 	"testing"
@@ -53,11 +54,16 @@ func TestGetRepoByName(t *testing.T) {
 		t.Error("unexpected error getting test repo", err)
 	}
 
+	var notFound *RepoNotFoundError
+	if _, err = GetRepoByName("nonexistantrepo"); !errors.As(err, &notFound) {
+		t.Errorf("expected not found error with bad repo name, got %v", err)
+	}
+
 	// Err, missing repofile
 	os.RemoveAll(tmp)
 	_, err = GetRepoByName("helm-push-test")
-	if err == nil {
-		t.Error("expecting error getting test repo after removed, instead got nil")
+	if !errors.As(err, &notFound) {
+		t.Errorf("expected not found error getting test repo after removed, got %v", err)
 	}
 
 }
@@ -87,3 +93,35 @@ func TestTempRepoFromURL(t *testing.T) {
 		t.Error("expecting repo password to be extracted from URL")
 	}
 }
+
+func TestAddRepo(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "helm-push-test")
+	if err != nil {
+		t.Fatal("unexpected error creating temp test dir", err)
+	}
+	defer os.RemoveAll(tmp)
+	home := helmpath.Home(tmp)
+	os.Setenv("HELM_HOME", home.String())
+
+	// The repository list does not exist yet
+	if err := AddRepo("helm-push-test", "cm://my.chart.repo.com"); err != nil {
+		t.Fatalf("unexpected error adding repo: %s", err)
+	}
+	if err := AddRepo("other", "cm://other.chart.repo.com"); err != nil {
+		t.Fatalf("unexpected error adding repo: %s", err)
+	}
+	if err := AddRepo("helm-push-test", "cm://my.chart.repo.com/charts"); err != nil {
+		t.Fatalf("unexpected error updating repo: %s", err)
+	}
+
+	f, err := repo.LoadRepositoriesFile(home.RepositoryFile())
+	if err != nil {
+		t.Fatalf("unexpected error loading repository list: %s", err)
+	}
+	if len(f.Repositories) != 2 {
+		t.Fatalf("expected 2 repositories, got %d", len(f.Repositories))
+	}
+	if u := f.Repositories[0].URL; u != "cm://my.chart.repo.com/charts" {
+		t.Errorf("expected repo URL to be updated, got %s", u)
+	}
+}
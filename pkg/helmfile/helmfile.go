@@ -0,0 +1,105 @@
+package helmfile
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"text/template"
+
+	"github.com/ghodss/yaml"
+)
+
+type (
+	// Repository is a chart repository declared in a helmfile, only the
+	// settings relevant to the plugin are read
+	Repository struct {
+		Name     string `json:"name"`
+		URL      string `json:"url"`
+		CAFile   string `json:"caFile,omitempty"`
+		CertFile string `json:"certFile,omitempty"`
+		KeyFile  string `json:"keyFile,omitempty"`
+		OCI      bool   `json:"oci,omitempty"`
+	}
+
+	// environment is the .Environment of helmfile templates
+	environment struct {
+		Name string
+	}
+)
+
+// separator splits the YAML documents of a helmfile
+var separator = regexp.MustCompile(`(?m)^---[ \t]*$`)
+
+// Load reads the repositories declared in the helmfile at path, from all
+// of its documents. The helmfile is rendered as a template first, with
+// the env, requiredEnv and quote functions only; .Environment.Name is
+// taken from $HELMFILE_ENVIRONMENT.
+func Load(path string) ([]Repository, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	rendered, err := render(path, b)
+	if err != nil {
+		return nil, err
+	}
+	var repos []Repository
+	for _, doc := range separator.Split(string(rendered), -1) {
+		var state struct {
+			Repositories []Repository `json:"repositories"`
+		}
+		if err := yaml.Unmarshal([]byte(doc), &state); err != nil {
+			return nil, fmt.Errorf("%s: %s", path, err)
+		}
+		for _, r := range state.Repositories {
+			if r.Name == "" || r.URL == "" {
+				return nil, fmt.Errorf("%s: repositories must have a name and a url", path)
+			}
+			repos = append(repos, r)
+		}
+	}
+	return repos, nil
+}
+
+// Find returns the repository named name, later declarations override
+// earlier ones like helmfile does
+func Find(repos []Repository, name string) (Repository, bool) {
+	for i := len(repos) - 1; i >= 0; i-- {
+		if repos[i].Name == name {
+			return repos[i], true
+		}
+	}
+	return Repository{}, false
+}
+
+func render(path string, data []byte) ([]byte, error) {
+	funcs := template.FuncMap{
+		"env":   os.Getenv,
+		"quote": func(s string) string { return fmt.Sprintf("%q", s) },
+		"requiredEnv": func(name string) (string, error) {
+			if v := os.Getenv(name); v != "" {
+				return v, nil
+			}
+			return "", fmt.Errorf("required env var `%s` is not set", name)
+		},
+	}
+	t, err := template.New(path).Funcs(funcs).Option("missingkey=zero").Parse(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	name := os.Getenv("HELMFILE_ENVIRONMENT")
+	if name == "" {
+		name = "default"
+	}
+	vars := map[string]interface{}{
+		"Environment": environment{Name: name},
+		"Values":      map[string]interface{}{},
+	}
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, vars); err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	return buf.Bytes(), nil
+}
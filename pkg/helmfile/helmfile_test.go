@@ -0,0 +1,73 @@
+package helmfile
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoad(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "helm-push-test")
+	if err != nil {
+		t.Fatal("unexpected error creating temp test dir", err)
+	}
+	defer os.RemoveAll(tmp)
+	path := filepath.Join(tmp, "helmfile.yaml")
+	data := `
+repositories:
+- name: internal
+  url: https://charts.example.com/{{ .Environment.Name }}
+  caFile: {{ requiredEnv "TEST_HELMFILE_CA" }}
+  keyFile: {{ env "TEST_HELMFILE_KEY" | quote }}
+- name: bitnami
+  url: https://charts.bitnami.com/bitnami
+---
+repositories:
+- name: bitnami
+  url: https://mirror.example.com/bitnami
+
+releases:
+- name: app
+  chart: internal/app
+`
+	ioutil.WriteFile(path, []byte(data), 0644)
+
+	// Missing required variable
+	if _, err := Load(path); err == nil {
+		t.Error("expected error with missing required variable, instead got nil")
+	}
+
+	os.Setenv("TEST_HELMFILE_CA", "/etc/ssl/ca.crt")
+	defer os.Unsetenv("TEST_HELMFILE_CA")
+	os.Setenv("HELMFILE_ENVIRONMENT", "staging")
+	defer os.Unsetenv("HELMFILE_ENVIRONMENT")
+	repos, err := Load(path)
+	if err != nil {
+		t.Fatalf("unexpected error loading helmfile: %s", err)
+	}
+	if len(repos) != 3 {
+		t.Fatalf("expected 3 repositories, got %+v", repos)
+	}
+	r, ok := Find(repos, "internal")
+	if !ok || r.URL != "https://charts.example.com/staging" || r.CAFile != "/etc/ssl/ca.crt" || r.KeyFile != "" {
+		t.Errorf("unexpected internal repository %+v", r)
+	}
+	if r, _ := Find(repos, "bitnami"); r.URL != "https://mirror.example.com/bitnami" {
+		t.Errorf("expected last declaration to win, got %+v", r)
+	}
+	if _, ok := Find(repos, "unknown"); ok {
+		t.Error("expected unknown repository not to be found")
+	}
+
+	// Unsupported template function
+	ioutil.WriteFile(path, []byte(`repositories: {{ readFile "repos.yaml" }}`), 0644)
+	if _, err := Load(path); err == nil {
+		t.Error("expected error with unsupported function, instead got nil")
+	}
+	// Missing url
+	ioutil.WriteFile(path, []byte("repositories:\n- name: internal\n"), 0644)
+	if _, err := Load(path); err == nil {
+		t.Error("expected error with missing url, instead got nil")
+	}
+}
@@ -0,0 +1,132 @@
+package hints
+
+import (
+	"crypto/x509"
+	"errors"
+	"net/http"
+
+	cm "github.com/IxDay/helm-push-cloudflare-access/pkg/chartmuseum"
+	"github.com/IxDay/helm-push-cloudflare-access/pkg/push"
+)
+
+type (
+	// rule maps a class of failures to a remediation hint
+	rule struct {
+		match func(error) bool
+		hint  string
+	}
+
+	// hintedError is an error with a remediation hint appended
+	hintedError struct {
+		err  error
+		hint string
+	}
+)
+
+// rules are evaluated in order, the first match wins
+var rules = []rule{
+	{
+		match: func(err error) bool {
+			se := statusError(err)
+			return se != nil && (se.AccessLogin || se.StatusCode == http.StatusUnauthorized || se.StatusCode == http.StatusForbidden)
+		},
+		hint: "Cloudflare Access rejected the request: check --client-id/--client-secret ($HELM_REPO_CLIENT_ID/$HELM_REPO_CLIENT_SECRET) and that the service token is allowed by the Access application policy",
+	},
+	{
+		match: push.IsConflict,
+		hint:  "this chart version already exists in the repository: bump the version (e.g. --version or --on-conflict bump), use --on-conflict skip to leave it as is or --force to overwrite it",
+	},
+	{
+		match: func(err error) bool {
+			var le *push.LockedError
+			return errors.As(err, &le)
+		},
+		hint: "another job holds the lock of this chart version: retry once it is done, a lock older than --lock-ttl is taken over",
+	},
+	{
+		match: func(err error) bool {
+			se := statusError(err)
+			return se != nil && se.Op == cm.OpIndex && se.StatusCode == http.StatusNotFound
+		},
+		hint: "index.yaml was not found: check the repository URL, ChartMuseum may be served under a path prefix that must be part of the URL",
+	},
+	{
+		match: func(err error) bool {
+			se := statusError(err)
+			return se != nil && se.Op == cm.OpUpload && (se.StatusCode == http.StatusNotFound || se.StatusCode == http.StatusMethodNotAllowed)
+		},
+		hint: "the upload API was not found: set --context-path ($HELM_REPO_CONTEXT_PATH) if ChartMuseum is served under a path prefix, and make sure the server does not run with DISABLE_API",
+	},
+	{
+		match: func(err error) bool {
+			se := statusError(err)
+			return se != nil && se.Op == cm.OpChart && (se.StatusCode == http.StatusNotFound || se.StatusCode == http.StatusMethodNotAllowed)
+		},
+		hint: "the chart API was not found: drop --chart-api ($HELM_PUSH_CHART_API) if the server is not ChartMuseum or runs with DISABLE_API",
+	},
+	{
+		match: func(err error) bool {
+			return errors.Is(err, push.ErrIndexTooLarge)
+		},
+		hint: "the index is larger than --max-index-size ($HELM_PUSH_MAX_INDEX_SIZE): raise the limit, or use --chart-api so that single chart operations skip the index",
+	},
+	{
+		match: func(err error) bool {
+			se := statusError(err)
+			return se != nil && se.StatusCode == http.StatusRequestEntityTooLarge
+		},
+		hint: "the chart package is larger than what the server or a proxy in front of it accepts (see ChartMuseum MAX_UPLOAD_SIZE)",
+	},
+	{
+		match: func(err error) bool {
+			var pe *cm.PinError
+			return errors.As(err, &pe)
+		},
+		hint: "the server public key does not match --pin-sha256: update the pins if the server key was rotated, otherwise a TLS-intercepting proxy may be in the way",
+	},
+	{
+		match: func(err error) bool {
+			var unknownAuthority x509.UnknownAuthorityError
+			var invalid x509.CertificateInvalidError
+			var hostname x509.HostnameError
+			return errors.As(err, &unknownAuthority) || errors.As(err, &invalid) || errors.As(err, &hostname)
+		},
+		hint: "the server certificate could not be verified: pass the CA bundle with --ca-file ($HELM_REPO_CA_FILE), or use --insecure to skip verification",
+	},
+}
+
+// Annotate appends a remediation hint to err when it matches a known
+// class of failures, other errors are returned unchanged
+func Annotate(err error) error {
+	if err == nil {
+		return nil
+	}
+	var he *hintedError
+	if errors.As(err, &he) {
+		return err
+	}
+	for _, r := range rules {
+		if r.match(err) {
+			return &hintedError{err: err, hint: r.hint}
+		}
+	}
+	return err
+}
+
+// Error implements error
+func (e *hintedError) Error() string {
+	return e.err.Error() + "\nhint: " + e.hint
+}
+
+// Unwrap returns the original error
+func (e *hintedError) Unwrap() error {
+	return e.err
+}
+
+func statusError(err error) *cm.StatusError {
+	var se *cm.StatusError
+	if errors.As(err, &se) {
+		return se
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package hints
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"testing"
+
+	cm "github.com/IxDay/helm-push-cloudflare-access/pkg/chartmuseum"
+	"github.com/IxDay/helm-push-cloudflare-access/pkg/push"
+)
+
+func TestAnnotate(t *testing.T) {
+	if Annotate(nil) != nil {
+		t.Error("expected nil error to stay nil")
+	}
+
+	unknown := errors.New("boom")
+	if err := Annotate(unknown); err != unknown {
+		t.Errorf("expected unknown error to be returned unchanged, got %v", err)
+	}
+
+	tests := []struct {
+		err  error
+		hint string
+	}{
+		{&cm.StatusError{Op: cm.OpUpload, StatusCode: 403}, "Cloudflare Access rejected"},
+		{&cm.StatusError{Op: cm.OpIndex, StatusCode: 302, AccessLogin: true}, "Cloudflare Access rejected"},
+		{&cm.StatusError{Op: cm.OpUpload, StatusCode: 409}, "--force"},
+		{&cm.StatusError{Op: cm.OpIndex, StatusCode: 404}, "index.yaml was not found"},
+		{&cm.StatusError{Op: cm.OpUpload, StatusCode: 404}, "--context-path"},
+		{&cm.StatusError{Op: cm.OpUpload, StatusCode: 413}, "MAX_UPLOAD_SIZE"},
+		{&cm.StatusError{Op: cm.OpChart, StatusCode: 404}, "--chart-api"},
+		{fmt.Errorf("%w: larger than 1 bytes", push.ErrIndexTooLarge), "--max-index-size"},
+		{&url.Error{Op: "Get", URL: "https://localhost", Err: &cm.PinError{Host: "localhost"}}, "--pin-sha256"},
+		{
+			&url.Error{Op: "Post", URL: "https://localhost", Err: &tls.CertificateVerificationError{Err: x509.UnknownAuthorityError{}}},
+			"--ca-file",
+		},
+	}
+	for _, test := range tests {
+		err := Annotate(fmt.Errorf("pushing: %w", test.err))
+		if !strings.Contains(err.Error(), "\nhint: ") || !strings.Contains(err.Error(), test.hint) {
+			t.Errorf("expected hint containing %q for %v, got %q", test.hint, test.err, err)
+		}
+		if !errors.Is(err, test.err) {
+			t.Errorf("expected annotated error to wrap %v", test.err)
+		}
+		if again := Annotate(err); again != err {
+			t.Errorf("expected already annotated error to be returned unchanged, got %q", again)
+		}
+	}
+
+	// A 409 while downloading is not a version conflict
+	if err := Annotate(&cm.StatusError{Op: cm.OpDownload, StatusCode: 409}); strings.Contains(err.Error(), "hint") {
+		t.Errorf("unexpected hint for download conflict: %q", err)
+	}
+}
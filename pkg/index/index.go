@@ -0,0 +1,183 @@
+package index
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"helm.sh/helm/v3/pkg/repo"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// FileName is the index of a chart repository
+	FileName = "index.yaml"
+
+	defaultLockTimeout = 30 * time.Second
+	// lockStaleAfter is the age after which a lock is considered left over
+	// by a crashed writer
+	lockStaleAfter = 10 * time.Minute
+)
+
+// ErrLocked is returned when the index stays locked by another writer
+var ErrLocked = errors.New("index is locked by another writer")
+
+// Options of Update
+type Options struct {
+	// URL is the base URL of the chart packages, URLs are relative to the
+	// index when empty
+	URL string
+	// Prune drops the entries whose package is not in the directory
+	Prune bool
+	// LockTimeout bounds the wait for concurrent writers, 30s by default
+	LockTimeout time.Duration
+}
+
+// Merge adds the entries of generated to existing: new versions are added,
+// versions already listed keep their creation time unless their digest
+// changed. Versions missing from generated are kept, unless prune is set.
+// Entries are sorted, newest version first.
+func Merge(existing, generated *repo.IndexFile, prune bool) *repo.IndexFile {
+	merged := repo.NewIndexFile()
+	merged.ServerInfo = existing.ServerInfo
+	merged.PublicKeys = existing.PublicKeys
+	merged.Annotations = existing.Annotations
+	merged.Generated = generated.Generated
+
+	if !prune {
+		for name, versions := range existing.Entries {
+			merged.Entries[name] = append(repo.ChartVersions(nil), versions...)
+		}
+	}
+	for name, versions := range generated.Entries {
+		for _, cv := range versions {
+			if old := find(existing, name, cv.Version); old != nil && old.Digest == cv.Digest {
+				// Same package, the creation time must not move
+				cv.Created = old.Created
+			}
+			merged.Entries[name] = replace(merged.Entries[name], cv)
+		}
+	}
+	merged.SortEntries()
+	return merged
+}
+
+// find returns the version of the chart name listed in index, if any
+func find(index *repo.IndexFile, name, version string) *repo.ChartVersion {
+	for _, cv := range index.Entries[name] {
+		if cv.Version == version {
+			return cv
+		}
+	}
+	return nil
+}
+
+// replace sets cv in versions, replacing the same version if listed
+func replace(versions repo.ChartVersions, cv *repo.ChartVersion) repo.ChartVersions {
+	for i, v := range versions {
+		if v.Version == cv.Version {
+			versions[i] = cv
+			return versions
+		}
+	}
+	return append(versions, cv)
+}
+
+// Load reads the index at path, a missing file results in an empty index
+func Load(path string) (*repo.IndexFile, error) {
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return repo.NewIndexFile(), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	i := &repo.IndexFile{}
+	if err := yaml.Unmarshal(b, i); err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	if i.Entries == nil {
+		i.Entries = map[string]repo.ChartVersions{}
+	}
+	return i, nil
+}
+
+// Update indexes the chart packages of dir and merges them into its
+// index.yaml. Concurrent writers are serialized with a lock file and the
+// index is replaced atomically, readers never see a partial index.
+func Update(dir string, opts Options) (*repo.IndexFile, error) {
+	path := filepath.Join(dir, FileName)
+	timeout := opts.LockTimeout
+	if timeout == 0 {
+		timeout = defaultLockTimeout
+	}
+	unlock, err := lock(path+".lock", timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	existing, err := Load(path)
+	if err != nil {
+		return nil, err
+	}
+	generated, err := repo.IndexDirectory(dir, opts.URL)
+	if err != nil {
+		return nil, err
+	}
+	merged := Merge(existing, generated, opts.Prune)
+	return merged, write(path, merged)
+}
+
+// write replaces the file at path with index
+func write(path string, index *repo.IndexFile) error {
+	b, err := yaml.Marshal(index)
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+FileName+"-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// lock creates the lock file at path, waiting up to timeout for another
+// writer to release it. Locks older than lockStaleAfter are broken.
+func lock(path string, timeout time.Duration) (func(), error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err == nil {
+			f.WriteString(strconv.Itoa(os.Getpid()))
+			f.Close()
+			return func() { os.Remove(path) }, nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+		if fi, err := os.Stat(path); err == nil && time.Since(fi.ModTime()) > lockStaleAfter {
+			os.Remove(path)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("%s: %w", path, ErrLocked)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
@@ -0,0 +1,123 @@
+package index
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/repo"
+)
+
+var (
+	testTarballPath   = "../../testdata/charts/helm2/mychart/mychart-0.1.0.tgz"
+	testV3TarballPath = "../../testdata/charts/helm3/my-v3-chart/my-v3-chart-0.1.0.tgz"
+)
+
+func testIndex(created time.Time, versions ...[2]string) *repo.IndexFile {
+	i := repo.NewIndexFile()
+	for _, v := range versions {
+		i.Add(&chart.Metadata{APIVersion: "v1", Name: "mychart", Version: v[0]}, "mychart-"+v[0]+".tgz", "", v[1])
+	}
+	for _, cv := range i.Entries["mychart"] {
+		cv.Created = created
+	}
+	return i
+}
+
+func TestMerge(t *testing.T) {
+	old := time.Date(2021, 1, 5, 0, 0, 0, 0, time.UTC)
+	existing := testIndex(old, [2]string{"0.1.0", "aaa"}, [2]string{"0.2.0", "bbb"})
+	existing.ServerInfo = map[string]interface{}{"contextPath": "/cm"}
+	generated := testIndex(time.Now(), [2]string{"0.2.0", "ccc"}, [2]string{"0.3.0", "ddd"}, [2]string{"0.1.0", "aaa"})
+
+	merged := Merge(existing, generated, false)
+	versions := merged.Entries["mychart"]
+	if len(versions) != 3 || versions[0].Version != "0.3.0" || versions[2].Version != "0.1.0" {
+		t.Fatalf("expected 3 versions sorted newest first, got %+v", versions)
+	}
+	if !versions[2].Created.Equal(old) {
+		t.Errorf("expected unchanged package to keep its creation time, got %s", versions[2].Created)
+	}
+	if versions[1].Digest != "ccc" || versions[1].Created.Equal(old) {
+		t.Errorf("expected changed package to be replaced, got %+v", versions[1])
+	}
+	if merged.ServerInfo["contextPath"] != "/cm" {
+		t.Errorf("expected server info to be preserved, got %v", merged.ServerInfo)
+	}
+
+	// Versions missing from the directory are kept unless pruned
+	generated = testIndex(time.Now(), [2]string{"0.3.0", "ddd"})
+	if n := len(Merge(existing, generated, false).Entries["mychart"]); n != 3 {
+		t.Errorf("expected 3 versions, got %d", n)
+	}
+	if n := len(Merge(existing, generated, true).Entries["mychart"]); n != 1 {
+		t.Errorf("expected 1 version once pruned, got %d", n)
+	}
+}
+
+func copyFile(t *testing.T, src, dst string) {
+	b, err := ioutil.ReadFile(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(dst, b, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "helm-push-test")
+	if err != nil {
+		t.Fatal("unexpected error creating temp test dir", err)
+	}
+	defer os.RemoveAll(tmp)
+	copyFile(t, testTarballPath, filepath.Join(tmp, "mychart-0.1.0.tgz"))
+
+	i, err := Update(tmp, Options{URL: "https://charts.example.com"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	cv := i.Entries["mychart"][0]
+	if cv.URLs[0] != "https://charts.example.com/mychart-0.1.0.tgz" || cv.Digest == "" {
+		t.Errorf("unexpected entry %+v", cv)
+	}
+	created := cv.Created
+
+	// Concurrent writers adding packages each see the other's work
+	copyFile(t, testV3TarballPath, filepath.Join(tmp, "my-v3-chart-0.1.0.tgz"))
+	var wg sync.WaitGroup
+	for n := 0; n < 4; n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := Update(tmp, Options{URL: "https://charts.example.com"}); err != nil {
+				t.Errorf("unexpected error: %s", err)
+			}
+		}()
+	}
+	wg.Wait()
+	i, err = Load(filepath.Join(tmp, FileName))
+	if err != nil {
+		t.Fatalf("unexpected error loading index: %s", err)
+	}
+	if len(i.Entries) != 2 {
+		t.Errorf("expected 2 charts, got %d", len(i.Entries))
+	}
+	if !i.Entries["mychart"][0].Created.Equal(created) {
+		t.Errorf("expected creation time %s to be kept, got %s", created, i.Entries["mychart"][0].Created)
+	}
+	if _, err := os.Stat(filepath.Join(tmp, FileName+".lock")); !os.IsNotExist(err) {
+		t.Error("expected lock to be released")
+	}
+
+	// Held lock
+	ioutil.WriteFile(filepath.Join(tmp, FileName+".lock"), nil, 0644)
+	if _, err := Update(tmp, Options{LockTimeout: 200 * time.Millisecond}); !errors.Is(err, ErrLocked) {
+		t.Errorf("expected lock error, got %v", err)
+	}
+}
@@ -0,0 +1,163 @@
+package manifest
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/IxDay/helm-push-cloudflare-access/pkg/git"
+	"github.com/ghodss/yaml"
+)
+
+// Version strategies, deciding the version a chart is published at
+const (
+	// StrategyChart publishes the version found in Chart.yaml
+	StrategyChart = "chart"
+	// StrategyFixed publishes the version set in the manifest
+	StrategyFixed = "fixed"
+	// StrategyTimestamp appends the UTC time as a pre-release
+	StrategyTimestamp = "timestamp"
+	// StrategyGit appends the abbreviated commit of the chart directory as
+	// a pre-release
+	StrategyGit = "git"
+)
+
+type (
+	// Manifest lists the charts to publish, such as charts.yaml
+	Manifest struct {
+		// Repo and Force are the defaults of the charts not setting them
+		Repo   string  `json:"repo,omitempty"`
+		Force  bool    `json:"force,omitempty"`
+		Charts []Chart `json:"charts"`
+	}
+
+	// Chart describes how to publish a single chart
+	Chart struct {
+		// Path is the chart directory or package, relative to the manifest
+		Path string `json:"path"`
+		// Repo is the name or URL of the target repository
+		Repo string `json:"repo,omitempty"`
+		// VersionStrategy is one of the Strategy constants, it defaults to
+		// fixed when Version is set and to chart otherwise
+		VersionStrategy string            `json:"version_strategy,omitempty"`
+		Version         string            `json:"version,omitempty"`
+		AppVersion      string            `json:"app_version,omitempty"`
+		Annotations     map[string]string `json:"annotations,omitempty"`
+		Force           bool              `json:"force,omitempty"`
+	}
+)
+
+// now is replaced in tests
+var now = time.Now
+
+// Load reads the manifest at path, chart paths are made relative to its
+// directory
+func Load(path string) (*Manifest, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	m, err := Parse(b)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	dir := filepath.Dir(path)
+	for i := range m.Charts {
+		if !filepath.IsAbs(m.Charts[i].Path) {
+			m.Charts[i].Path = filepath.Join(dir, m.Charts[i].Path)
+		}
+	}
+	return m, nil
+}
+
+// Parse parses and validates a manifest, filling the charts with the
+// manifest defaults
+func Parse(data []byte) (*Manifest, error) {
+	m := &Manifest{}
+	if err := yaml.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("invalid manifest: %s", err)
+	}
+	if len(m.Charts) == 0 {
+		return nil, fmt.Errorf("invalid manifest: no charts")
+	}
+	for i := range m.Charts {
+		c := &m.Charts[i]
+		if c.Repo == "" {
+			c.Repo = m.Repo
+		}
+		c.Force = c.Force || m.Force
+		if c.VersionStrategy == "" {
+			c.VersionStrategy = StrategyChart
+			if c.Version != "" {
+				c.VersionStrategy = StrategyFixed
+			}
+		}
+		if err := c.validate(); err != nil {
+			return nil, fmt.Errorf("invalid manifest: charts[%d]: %s", i, err)
+		}
+	}
+	return m, nil
+}
+
+func (c *Chart) validate() error {
+	if c.Path == "" {
+		return fmt.Errorf("missing path")
+	}
+	if c.Repo == "" {
+		return fmt.Errorf("missing repo and no default repo set")
+	}
+	switch c.VersionStrategy {
+	case StrategyFixed:
+		if c.Version == "" {
+			return fmt.Errorf("version strategy %q requires a version", StrategyFixed)
+		}
+	case StrategyChart, StrategyTimestamp, StrategyGit:
+		if c.Version != "" {
+			return fmt.Errorf("version is only used with version strategy %q", StrategyFixed)
+		}
+	default:
+		return fmt.Errorf("invalid version strategy %q, must be one of: %s, %s, %s, %s",
+			c.VersionStrategy, StrategyChart, StrategyFixed, StrategyTimestamp, StrategyGit)
+	}
+	return nil
+}
+
+// Modifies tells if publishing the chart changes its metadata, a nil
+// *Chart modifies nothing
+func (c *Chart) Modifies() bool {
+	return c != nil && (c.VersionStrategy != StrategyChart || c.AppVersion != "" || len(c.Annotations) > 0)
+}
+
+// ResolveVersion returns the version to publish the chart at, version
+// being the one found in its Chart.yaml
+func (c *Chart) ResolveVersion(version string) (string, error) {
+	switch c.VersionStrategy {
+	case StrategyFixed:
+		return c.Version, nil
+	case StrategyTimestamp:
+		return prerelease(version, now().UTC().Format("20060102150405")), nil
+	case StrategyGit:
+		dir := c.Path
+		if filepath.Ext(dir) == ".tgz" {
+			dir = filepath.Dir(dir)
+		}
+		rev, err := git.Revision(dir)
+		if err != nil {
+			return "", fmt.Errorf("resolving git revision of %s: %s", c.Path, err)
+		}
+		// Prefixed like git describe, a numeric identifier can't start
+		// with 0 in semver
+		return prerelease(version, "g"+rev), nil
+	}
+	return version, nil
+}
+
+// prerelease appends id to the pre-release part of version
+func prerelease(version, id string) string {
+	if strings.Contains(version, "-") {
+		return version + "." + id
+	}
+	return version + "-" + id
+}
@@ -0,0 +1,124 @@
+package manifest
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestLoad(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "helm-push-test")
+	if err != nil {
+		t.Fatal("unexpected error creating temp test dir", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	data := `
+repo: chartmuseum
+charts:
+- path: charts/api
+  annotations:
+    team: payments
+- path: /srv/web-1.0.0.tgz
+  repo: https://charts.example.com
+  version: 2.0.0
+  force: true
+- path: charts/worker
+  version_strategy: timestamp
+`
+	path := filepath.Join(tmp, "charts.yaml")
+	ioutil.WriteFile(path, []byte(data), 0600)
+	m, err := Load(path)
+	if err != nil {
+		t.Fatalf("unexpected error loading manifest: %s", err)
+	}
+	if len(m.Charts) != 3 {
+		t.Fatalf("expected 3 charts, got %d", len(m.Charts))
+	}
+	api, web, worker := m.Charts[0], m.Charts[1], m.Charts[2]
+	if api.Path != filepath.Join(tmp, "charts/api") || api.Repo != "chartmuseum" || api.VersionStrategy != StrategyChart {
+		t.Errorf("unexpected chart %+v", api)
+	}
+	if web.Path != "/srv/web-1.0.0.tgz" || web.Repo != "https://charts.example.com" || web.VersionStrategy != StrategyFixed || !web.Force {
+		t.Errorf("unexpected chart %+v", web)
+	}
+	if worker.VersionStrategy != StrategyTimestamp || worker.Force {
+		t.Errorf("unexpected chart %+v", worker)
+	}
+	if !api.Modifies() || !web.Modifies() || (&Chart{VersionStrategy: StrategyChart}).Modifies() || (*Chart)(nil).Modifies() {
+		t.Error("unexpected Modifies result")
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, data := range []string{
+		"charts: []",
+		"charts: [{repo: chartmuseum}]",
+		"charts: [{path: mychart}]",
+		"charts: [{path: mychart, repo: cm, version_strategy: fixed}]",
+		"charts: [{path: mychart, repo: cm, version_strategy: git, version: 1.0.0}]",
+		"charts: [{path: mychart, repo: cm, version_strategy: semver}]",
+	} {
+		if _, err := Parse([]byte(data)); err == nil {
+			t.Errorf("expected error parsing %q, instead got nil", data)
+		}
+	}
+}
+
+func TestResolveVersion(t *testing.T) {
+	defer func() { now = time.Now }()
+	now = func() time.Time { return time.Date(2021, 1, 5, 10, 12, 43, 0, time.UTC) }
+
+	c := &Chart{VersionStrategy: StrategyTimestamp}
+	for version, expected := range map[string]string{
+		"1.0.0":      "1.0.0-20210105101243",
+		"1.0.0-rc.1": "1.0.0-rc.1.20210105101243",
+	} {
+		if v, _ := c.ResolveVersion(version); v != expected {
+			t.Errorf("expected version %s, got %s", expected, v)
+		}
+	}
+	c = &Chart{VersionStrategy: StrategyFixed, Version: "2.0.0"}
+	if v, _ := c.ResolveVersion("1.0.0"); v != "2.0.0" {
+		t.Errorf("expected version 2.0.0, got %s", v)
+	}
+	c = &Chart{VersionStrategy: StrategyChart}
+	if v, _ := c.ResolveVersion("1.0.0"); v != "1.0.0" {
+		t.Errorf("expected version 1.0.0, got %s", v)
+	}
+}
+
+func TestResolveVersionGit(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	tmp, err := ioutil.TempDir("", "helm-push-test")
+	if err != nil {
+		t.Fatal("unexpected error creating temp test dir", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	c := &Chart{Path: tmp, VersionStrategy: StrategyGit}
+	if _, err := c.ResolveVersion("1.0.0"); err == nil {
+		t.Error("expected error outside of a git repository, instead got nil")
+	}
+	git := func(args ...string) {
+		cmd := exec.Command("git", append([]string{"-C", tmp, "-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %s", args, out)
+		}
+	}
+	git("init", "-q")
+	git("commit", "-q", "--allow-empty", "-m", "init")
+	v, err := c.ResolveVersion("1.0.0")
+	if err != nil {
+		t.Fatalf("unexpected error resolving version: %s", err)
+	}
+	if !regexp.MustCompile(`^1\.0\.0-g[0-9a-f]{7,}$`).MatchString(v) {
+		t.Errorf("unexpected version %s", v)
+	}
+}
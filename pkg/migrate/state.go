@@ -0,0 +1,169 @@
+// Package migrate keeps track of the progress of chart migrations between
+// repositories, so that interrupted migrations resume where they stopped
+package migrate
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+)
+
+const (
+	// StatusPending is the status of the chart versions left to migrate
+	StatusPending = "pending"
+	// StatusDone is the status of the chart versions in the target
+	// repository
+	StatusDone = "done"
+	// StatusFailed is the status of the chart versions whose migration
+	// failed, they are tried again on resume
+	StatusFailed = "failed"
+)
+
+type (
+	// State is the progress of a migration, saved to a file after every
+	// chart version
+	State struct {
+		Source string   `json:"source"`
+		Target string   `json:"target"`
+		Charts []*Chart `json:"charts"`
+
+		path  string
+		index map[string]*Chart
+	}
+
+	// Chart is the migration status of a chart version
+	Chart struct {
+		Name    string `json:"name"`
+		Version string `json:"version"`
+		Status  string `json:"status"`
+		// Error is why the last attempt failed
+		Error string `json:"error,omitempty"`
+	}
+
+	// Filter selects the charts to migrate by name, as path.Match patterns
+	Filter struct {
+		// Include lists the charts to migrate, all of them when empty
+		Include []string
+		// Exclude lists the charts left out, it wins over Include
+		Exclude []string
+	}
+)
+
+// Load reads the state file at path, a new state is returned when there is
+// none. The file must record a migration from source to target, so that a
+// state file is not resumed against other repositories by mistake.
+func Load(path, source, target string) (*State, error) {
+	s := &State{Source: source, Target: target, path: path, index: map[string]*Chart{}}
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, s); err != nil {
+		return nil, fmt.Errorf("%s: invalid migration state: %s", path, err)
+	}
+	if s.Source != source || s.Target != target {
+		return nil, fmt.Errorf("%s records a migration from %s to %s, remove it to start a new one", path, s.Source, s.Target)
+	}
+	for _, c := range s.Charts {
+		s.index[key(c.Name, c.Version)] = c
+	}
+	return s, nil
+}
+
+// key identifies a chart version in the state
+func key(name, version string) string {
+	return name + "@" + version
+}
+
+// Add returns the status of the chart version, it is added as pending
+// when not in the state yet
+func (s *State) Add(name, version string) *Chart {
+	if c, ok := s.index[key(name, version)]; ok {
+		return c
+	}
+	c := &Chart{Name: name, Version: version, Status: StatusPending}
+	s.Charts = append(s.Charts, c)
+	s.index[key(name, version)] = c
+	return c
+}
+
+// Mark records the result of the migration of c and saves the state, c is
+// done when err is nil
+func (s *State) Mark(c *Chart, err error) error {
+	c.Status, c.Error = StatusDone, ""
+	if err != nil {
+		c.Status, c.Error = StatusFailed, err.Error()
+	}
+	return s.Save()
+}
+
+// Count returns the number of chart versions with status
+func (s *State) Count(status string) int {
+	n := 0
+	for _, c := range s.Charts {
+		if c.Status == status {
+			n++
+		}
+	}
+	return n
+}
+
+// Save writes the state to its file, which is replaced atomically so that
+// an interrupted migration never leaves a partial state
+func (s *State) Save() error {
+	sort.SliceStable(s.Charts, func(i, j int) bool {
+		return s.Charts[i].Name < s.Charts[j].Name
+	})
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(s.path), "."+filepath.Base(s.path)+"-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(append(b, '\n')); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
+
+// Validate checks the patterns of the filter
+func (f Filter) Validate() error {
+	for _, pattern := range append(append([]string{}, f.Include...), f.Exclude...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid chart pattern %q", pattern)
+		}
+	}
+	return nil
+}
+
+// Match tells if the chart name is selected by the filter
+func (f Filter) Match(name string) bool {
+	if matchAny(f.Exclude, name) {
+		return false
+	}
+	return len(f.Include) == 0 || matchAny(f.Include, name)
+}
+
+// matchAny tells if name matches one of patterns
+func matchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
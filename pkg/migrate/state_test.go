@@ -0,0 +1,83 @@
+package migrate
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestState(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "helm-push-test")
+	if err != nil {
+		t.Fatal("unexpected error creating temp test dir", err)
+	}
+	defer os.RemoveAll(tmp)
+	path := filepath.Join(tmp, "migrate.json")
+
+	s, err := Load(path, "old", "new")
+	if err != nil || len(s.Charts) != 0 {
+		t.Fatalf("expected a new state, got %v, %v", s, err)
+	}
+	api := s.Add("api", "0.1.0")
+	web := s.Add("web", "1.0.0")
+	s.Add("api", "0.2.0")
+	if s.Add("api", "0.1.0") != api || s.Count(StatusPending) != 3 {
+		t.Errorf("expected chart versions to be added once, got %+v", s.Charts)
+	}
+	if err := s.Mark(api, nil); err != nil {
+		t.Fatalf("unexpected error saving state: %s", err)
+	}
+	if err := s.Mark(web, errors.New("409 conflict")); err != nil {
+		t.Fatalf("unexpected error saving state: %s", err)
+	}
+
+	// Resume
+	s, err = Load(path, "old", "new")
+	if err != nil {
+		t.Fatalf("unexpected error loading state: %s", err)
+	}
+	if s.Count(StatusDone) != 1 || s.Count(StatusFailed) != 1 || s.Count(StatusPending) != 1 {
+		t.Errorf("unexpected state %+v", s.Charts)
+	}
+	if c := s.Add("web", "1.0.0"); c.Status != StatusFailed || c.Error != "409 conflict" {
+		t.Errorf("expected failure to be recorded, got %+v", c)
+	}
+	if err := s.Mark(s.Add("web", "1.0.0"), nil); err != nil || s.Add("web", "1.0.0").Error != "" {
+		t.Errorf("expected error to be cleared once done, got %v", err)
+	}
+
+	if _, err := Load(path, "old", "other"); err == nil || !strings.Contains(err.Error(), "from old to new") {
+		t.Errorf("expected error resuming against another repository, got %v", err)
+	}
+	ioutil.WriteFile(path, []byte("{"), 0644)
+	if _, err := Load(path, "old", "new"); err == nil {
+		t.Error("expected error loading invalid state, instead got nil")
+	}
+}
+
+func TestFilter(t *testing.T) {
+	f := Filter{Include: []string{"api*", "web"}, Exclude: []string{"*-legacy"}}
+	for name, expected := range map[string]bool{
+		"api":        true,
+		"api-gw":     true,
+		"web":        true,
+		"api-legacy": false,
+		"worker":     false,
+	} {
+		if f.Match(name) != expected {
+			t.Errorf("expected match of %s to be %t", name, expected)
+		}
+	}
+	if !(Filter{Exclude: []string{"api"}}).Match("web") {
+		t.Error("expected charts to be included by default")
+	}
+	if err := f.Validate(); err != nil {
+		t.Errorf("unexpected error validating filter: %s", err)
+	}
+	if err := (Filter{Exclude: []string{"["}}).Validate(); err == nil {
+		t.Error("expected error validating invalid pattern, instead got nil")
+	}
+}
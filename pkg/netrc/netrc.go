@@ -0,0 +1,142 @@
+// Package netrc reads the credentials of .netrc files, the format used by
+// curl, git and many CI images to store per host logins
+package netrc
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+type (
+	// Machine is an entry of a .netrc file
+	Machine struct {
+		// Name is the host, empty for the default entry
+		Name     string
+		Login    string
+		Password string
+	}
+
+	// File is a parsed .netrc file
+	File struct {
+		Machines []Machine
+	}
+)
+
+// Path returns the location of the .netrc file, $NETRC or .netrc in the
+// home directory, _netrc on Windows
+func Path() string {
+	if v := os.Getenv("NETRC"); v != "" {
+		return v
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	if runtime.GOOS == "windows" {
+		return filepath.Join(home, "_netrc")
+	}
+	return filepath.Join(home, ".netrc")
+}
+
+// Load reads the .netrc file at path, a missing file has no entry
+func Load(path string) (*File, error) {
+	if path == "" {
+		return &File{}, nil
+	}
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return &File{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	f, err := Parse(b)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	return f, nil
+}
+
+// Parse parses the content of a .netrc file, macros are skipped
+func Parse(data []byte) (*File, error) {
+	// Tokens may span lines, but macros end with an empty line
+	var tokens []string
+	lines := bufio.NewScanner(bytes.NewReader(data))
+	inMacro := false
+	for lines.Scan() {
+		line := strings.TrimSpace(lines.Text())
+		if inMacro {
+			inMacro = line != ""
+			continue
+		}
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		for _, token := range strings.Fields(line) {
+			if token == "macdef" {
+				inMacro = true
+				break
+			}
+			tokens = append(tokens, token)
+		}
+	}
+	if err := lines.Err(); err != nil {
+		return nil, err
+	}
+
+	f := &File{}
+	var m *Machine
+	for i := 0; i < len(tokens); i++ {
+		keyword := tokens[i]
+		if keyword == "default" {
+			f.Machines = append(f.Machines, Machine{})
+			m = &f.Machines[len(f.Machines)-1]
+			continue
+		}
+		if i+1 >= len(tokens) {
+			return nil, fmt.Errorf("missing value of %s", keyword)
+		}
+		i++
+		switch keyword {
+		case "machine":
+			f.Machines = append(f.Machines, Machine{Name: tokens[i]})
+			m = &f.Machines[len(f.Machines)-1]
+		case "login", "password", "account":
+			if m == nil {
+				return nil, fmt.Errorf("%s outside of a machine entry", keyword)
+			}
+			if keyword == "login" {
+				m.Login = tokens[i]
+			} else if keyword == "password" {
+				m.Password = tokens[i]
+			}
+		default:
+			return nil, fmt.Errorf("unknown token %q", keyword)
+		}
+	}
+	return f, nil
+}
+
+// Machine returns the entry of host, a host name without port, or the
+// default entry when there is none
+func (f *File) Machine(host string) (Machine, bool) {
+	var def *Machine
+	for i, m := range f.Machines {
+		if m.Name == "" && def == nil {
+			def = &f.Machines[i]
+		}
+		if m.Name != "" && strings.EqualFold(m.Name, host) {
+			return m, true
+		}
+	}
+	if def != nil {
+		return *def, true
+	}
+	return Machine{}, false
+}
@@ -0,0 +1,77 @@
+package netrc
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	f, err := Parse([]byte(`
+# Cloudflare Access service token
+machine charts.example.com login 0123456789abcdef.access password s3cr3t
+
+machine nexus.example.com
+  login deploy
+  password hunter2
+macdef init
+  cd /pub
+  machine ignored.example.com login nobody
+
+default login anonymous password guest
+`))
+	if err != nil {
+		t.Fatalf("unexpected error parsing .netrc: %s", err)
+	}
+	for host, expected := range map[string]Machine{
+		"charts.example.com": {Name: "charts.example.com", Login: "0123456789abcdef.access", Password: "s3cr3t"},
+		"NEXUS.example.com":  {Name: "nexus.example.com", Login: "deploy", Password: "hunter2"},
+		"other.example.com":  {Login: "anonymous", Password: "guest"},
+	} {
+		if m, ok := f.Machine(host); !ok || m != expected {
+			t.Errorf("expected %+v for %s, got %+v", expected, host, m)
+		}
+	}
+	if _, ok := f.Machine("ignored.example.com"); !ok || len(f.Machines) != 3 {
+		t.Errorf("expected macros to be skipped, got %+v", f.Machines)
+	}
+
+	f, _ = Parse([]byte("machine charts.example.com login id password secret\n"))
+	if _, ok := f.Machine("other.example.com"); ok {
+		t.Error("expected no entry without default")
+	}
+
+	for _, data := range []string{
+		"machine",
+		"login id",
+		"machine charts.example.com user id",
+	} {
+		if _, err := Parse([]byte(data)); err == nil {
+			t.Errorf("expected error parsing %q, instead got nil", data)
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "helm-push-test")
+	if err != nil {
+		t.Fatal("unexpected error creating temp test dir", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	path := filepath.Join(tmp, ".netrc")
+	if f, err := Load(path); err != nil || len(f.Machines) != 0 {
+		t.Errorf("expected no entry for a missing file, got %v", err)
+	}
+	ioutil.WriteFile(path, []byte("machine charts.example.com login id password secret\n"), 0600)
+	if f, err := Load(path); err != nil || len(f.Machines) != 1 {
+		t.Errorf("expected one entry, got %v", err)
+	}
+
+	os.Setenv("NETRC", path)
+	defer os.Unsetenv("NETRC")
+	if Path() != path {
+		t.Errorf("expected $NETRC to be used, got %s", Path())
+	}
+}
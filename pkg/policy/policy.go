@@ -0,0 +1,193 @@
+package policy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/IxDay/helm-push-cloudflare-access/pkg/sbom"
+	"github.com/IxDay/helm-push-cloudflare-access/pkg/tmpdir"
+	"helm.sh/helm/v3/pkg/chart"
+)
+
+// Query is the Rego rule evaluated by Rego policies, the set of messages
+// explaining why the chart is refused
+const Query = "data.helm_push.deny"
+
+type (
+	// Policy holds the rules a chart must follow to be pushed
+	Policy struct {
+		// NamePattern is a regular expression chart names must match
+		NamePattern        string `json:"name_pattern,omitempty"`
+		RequireMaintainers bool   `json:"require_maintainers,omitempty"`
+		// RequiredAnnotations lists the Chart.yaml annotations which must
+		// be set
+		RequiredAnnotations []string `json:"required_annotations,omitempty"`
+		// ForbiddenRegistries lists the registries, or registry paths, the
+		// images referenced in the chart values must not come from
+		ForbiddenRegistries []string `json:"forbidden_registries,omitempty"`
+		// MaxSize is the maximum size of the chart package in bytes
+		MaxSize int64 `json:"max_size,omitempty"`
+		// Rego lists Rego policy files evaluated against Input by the opa
+		// binary, every message of Query refuses the chart
+		Rego []string `json:"rego,omitempty"`
+	}
+
+	// Input is the document Rego policies are evaluated against
+	Input struct {
+		Chart  *chart.Metadata `json:"chart"`
+		Images []string        `json:"images"`
+		Size   int64           `json:"size"`
+	}
+
+	// Violations is the error returned for a chart not following the
+	// policy, one message per broken rule
+	Violations []string
+)
+
+func (v Violations) Error() string {
+	return "chart refused by policy: " + strings.Join(v, "; ")
+}
+
+// Empty tells if the policy has no rule
+func (p Policy) Empty() bool {
+	return p.NamePattern == "" && !p.RequireMaintainers && len(p.RequiredAnnotations) == 0 &&
+		len(p.ForbiddenRegistries) == 0 && p.MaxSize == 0 && len(p.Rego) == 0
+}
+
+// Validate checks the rules are well formed
+func (p Policy) Validate() error {
+	if _, err := regexp.Compile(p.NamePattern); err != nil {
+		return fmt.Errorf("invalid policy name pattern: %s", err)
+	}
+	if p.MaxSize < 0 {
+		return fmt.Errorf("invalid policy max size %d", p.MaxSize)
+	}
+	return nil
+}
+
+// Check evaluates the policy against the chart c, packaged in size bytes.
+// Broken rules are reported as Violations, other errors are returned as
+// is.
+func (p Policy) Check(c *chart.Chart, size int64) error {
+	var v Violations
+	name := c.Metadata.Name
+	if p.NamePattern != "" && !regexp.MustCompile(p.NamePattern).MatchString(name) {
+		v = append(v, fmt.Sprintf("name %s does not match %s", name, p.NamePattern))
+	}
+	if p.RequireMaintainers && len(c.Metadata.Maintainers) == 0 {
+		v = append(v, "no maintainers")
+	}
+	for _, a := range p.RequiredAnnotations {
+		if c.Metadata.Annotations[a] == "" {
+			v = append(v, fmt.Sprintf("missing annotation %s", a))
+		}
+	}
+	images := Images(c)
+	for _, image := range images {
+		for _, r := range p.ForbiddenRegistries {
+			if Forbidden(image, r) {
+				v = append(v, fmt.Sprintf("image %s comes from forbidden registry %s", image, r))
+			}
+		}
+	}
+	if p.MaxSize > 0 && size > p.MaxSize {
+		v = append(v, fmt.Sprintf("package size %d exceeds %d bytes", size, p.MaxSize))
+	}
+	if len(p.Rego) > 0 {
+		denied, err := evalRego(p.Rego, Input{Chart: c.Metadata, Images: images, Size: size})
+		if err != nil {
+			return err
+		}
+		v = append(v, denied...)
+	}
+	if len(v) > 0 {
+		return v
+	}
+	return nil
+}
+
+// Images returns the image references found in the values of the chart
+// and its subcharts
+func Images(c *chart.Chart) []string {
+	images := sbom.Images(c.Values)
+	for _, dep := range c.Dependencies() {
+		images = append(images, Images(dep)...)
+	}
+	return images
+}
+
+// Forbidden tells if image is pulled from registry, either a registry host
+// or a path within it. Images without registry come from docker.io.
+func Forbidden(image, registry string) bool {
+	ref := image
+	if i := strings.Index(ref, "/"); i < 0 || (!strings.ContainsAny(ref[:i], ".:") && ref[:i] != "localhost") {
+		ref = "docker.io/" + ref
+	}
+	registry = strings.TrimSuffix(registry, "/")
+	return strings.HasPrefix(ref, registry+"/")
+}
+
+// evalRego evaluates Query against input with the opa binary, $OPA_BIN or
+// opa from $PATH, and returns the messages of the chart denials
+func evalRego(files []string, input Input) ([]string, error) {
+	tmp, err := tmpdir.New("helm-push-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmp)
+	b, err := json.Marshal(input)
+	if err != nil {
+		return nil, err
+	}
+	inputPath := filepath.Join(tmp, "input.json")
+	if err := ioutil.WriteFile(inputPath, b, 0600); err != nil {
+		return nil, err
+	}
+
+	args := []string{"eval", "--format", "json", "--input", inputPath}
+	for _, f := range files {
+		args = append(args, "--data", f)
+	}
+	args = append(args, Query)
+	bin, ok := os.LookupEnv("OPA_BIN")
+	if !ok {
+		bin = "opa"
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(bin, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("opa evaluation failed: %s", msg)
+		}
+		return nil, fmt.Errorf("opa evaluation failed: %s", err)
+	}
+
+	var output struct {
+		Result []struct {
+			Expressions []struct {
+				Value []interface{} `json:"value"`
+			} `json:"expressions"`
+		} `json:"result"`
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &output); err != nil {
+		return nil, fmt.Errorf("invalid opa output: %s", err)
+	}
+	var denied []string
+	for _, r := range output.Result {
+		for _, e := range r.Expressions {
+			for _, msg := range e.Value {
+				denied = append(denied, fmt.Sprint(msg))
+			}
+		}
+	}
+	return denied, nil
+}
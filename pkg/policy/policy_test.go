@@ -0,0 +1,147 @@
+package policy
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"helm.sh/helm/v3/pkg/chart"
+)
+
+// fakeOPA denies charts named "legacy" and records its arguments
+const fakeOPA = `#!/bin/sh
+echo "$@" > "$(dirname "$0")/args"
+while [ $# -gt 1 ]; do
+  if [ "$1" = "--input" ]; then input="$2"; fi
+  shift
+done
+if grep -q '"name":"legacy"' "$input"; then
+  echo '{"result":[{"expressions":[{"value":["legacy charts are frozen"]}]}]}'
+else
+  echo '{"result":[{"expressions":[{"value":[]}]}]}'
+fi
+`
+
+func testChart() *chart.Chart {
+	c := &chart.Chart{
+		Metadata: &chart.Metadata{
+			Name:        "mychart",
+			Version:     "0.1.0",
+			Annotations: map[string]string{"team": "platform"},
+		},
+		Values: map[string]interface{}{"image": "nginx:1.19"},
+	}
+	c.AddDependency(&chart.Chart{
+		Metadata: &chart.Metadata{Name: "redis", Version: "12.0.0"},
+		Values:   map[string]interface{}{"image": map[string]interface{}{"registry": "quay.io", "repository": "bitnami/redis", "tag": "6.0"}},
+	})
+	return c
+}
+
+func TestValidate(t *testing.T) {
+	if err := (Policy{NamePattern: "^[a-z-]+$", MaxSize: 1024}).Validate(); err != nil {
+		t.Errorf("unexpected error validating policy: %s", err)
+	}
+	if err := (Policy{NamePattern: "(["}).Validate(); err == nil {
+		t.Error("expected error with invalid name pattern, instead got nil")
+	}
+	if err := (Policy{MaxSize: -1}).Validate(); err == nil {
+		t.Error("expected error with negative max size, instead got nil")
+	}
+}
+
+func TestCheck(t *testing.T) {
+	c := testChart()
+	p := Policy{
+		NamePattern:         "^my",
+		RequiredAnnotations: []string{"team"},
+		ForbiddenRegistries: []string{"gcr.io"},
+		MaxSize:             1024,
+	}
+	if err := p.Check(c, 512); err != nil {
+		t.Errorf("unexpected error checking compliant chart: %s", err)
+	}
+
+	p = Policy{
+		NamePattern:         "^company-",
+		RequireMaintainers:  true,
+		RequiredAnnotations: []string{"team", "artifacthub.io/license"},
+		ForbiddenRegistries: []string{"docker.io", "quay.io/bitnami"},
+		MaxSize:             1024,
+	}
+	err := p.Check(c, 2048)
+	v, ok := err.(Violations)
+	if !ok {
+		t.Fatalf("expected violations, got %v", err)
+	}
+	expected := []string{
+		"name mychart does not match ^company-",
+		"no maintainers",
+		"missing annotation artifacthub.io/license",
+		"image nginx:1.19 comes from forbidden registry docker.io",
+		"image quay.io/bitnami/redis:6.0 comes from forbidden registry quay.io/bitnami",
+		"package size 2048 exceeds 1024 bytes",
+	}
+	if strings.Join(v, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("unexpected violations:\n%s", strings.Join(v, "\n"))
+	}
+}
+
+func TestForbidden(t *testing.T) {
+	tests := []struct {
+		image, registry string
+		forbidden       bool
+	}{
+		{"nginx", "docker.io", true},
+		{"bitnami/redis:6.0", "docker.io/bitnami", true},
+		{"localhost/nginx", "docker.io", false},
+		{"localhost:5000/nginx", "localhost:5000", true},
+		{"gcr.io/project/app", "gcr.io/", true},
+		{"gcr.io/project/app", "gcr.io/other", false},
+		{"quay.io/app", "quay.i", false},
+	}
+	for _, test := range tests {
+		if f := Forbidden(test.image, test.registry); f != test.forbidden {
+			t.Errorf("expected Forbidden(%q, %q) to be %v", test.image, test.registry, test.forbidden)
+		}
+	}
+}
+
+func TestCheckRego(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "helm-push-test")
+	if err != nil {
+		t.Fatal("unexpected error creating temp test dir", err)
+	}
+	defer os.RemoveAll(tmp)
+	bin := filepath.Join(tmp, "opa")
+	if err := ioutil.WriteFile(bin, []byte(fakeOPA), 0755); err != nil {
+		t.Fatal("unexpected error writing fake opa", err)
+	}
+	os.Setenv("OPA_BIN", bin)
+	defer os.Unsetenv("OPA_BIN")
+
+	c := testChart()
+	p := Policy{Rego: []string{"charts.rego"}}
+	if err := p.Check(c, 512); err != nil {
+		t.Errorf("unexpected error checking compliant chart: %s", err)
+	}
+	args, _ := ioutil.ReadFile(filepath.Join(tmp, "args"))
+	if !strings.HasPrefix(string(args), "eval --format json --input ") || !strings.HasSuffix(strings.TrimSpace(string(args)), "--data charts.rego "+Query) {
+		t.Errorf("unexpected opa arguments %s", args)
+	}
+
+	c.Metadata.Name = "legacy"
+	err = p.Check(c, 512)
+	if v, ok := err.(Violations); !ok || len(v) != 1 || v[0] != "legacy charts are frozen" {
+		t.Errorf("expected rego violation, got %v", err)
+	}
+
+	os.Setenv("OPA_BIN", filepath.Join(tmp, "missing"))
+	if err := p.Check(c, 512); err == nil {
+		t.Error("expected error with missing opa binary, instead got nil")
+	} else if _, ok := err.(Violations); ok {
+		t.Errorf("expected evaluation error, got violations %v", err)
+	}
+}
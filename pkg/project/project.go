@@ -0,0 +1,106 @@
+// Package project reads the .helmpush.yaml files holding the publishing
+// conventions of a project, next to its charts
+package project
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/IxDay/helm-push-cloudflare-access/pkg/manifest"
+	"github.com/ghodss/yaml"
+)
+
+// FileName is the name of the project configuration file
+const FileName = ".helmpush.yaml"
+
+type (
+	// Config holds the project defaults, flags take precedence over them
+	Config struct {
+		// Repo is the name or URL of the repository charts are pushed to
+		// when none is given on the command line
+		Repo string `json:"repo,omitempty"`
+		// VersionStrategy is one of the manifest strategies but fixed, the
+		// version is then set in Chart.yaml
+		VersionStrategy string            `json:"version_strategy,omitempty"`
+		Annotations     map[string]string `json:"annotations,omitempty"`
+		// Exclude lists the files left out of the packages, as slash
+		// separated patterns relative to the chart directory, see
+		// helm.Chart.Exclude
+		Exclude []string `json:"exclude,omitempty"`
+	}
+)
+
+// Find returns the path of the project configuration file applying to
+// the chart directory or package at chart, looking up from its directory
+// to the root. An empty path is returned when there is none.
+func Find(chart string) (string, error) {
+	dir, err := filepath.Abs(chart)
+	if err != nil {
+		return "", err
+	}
+	if fi, err := os.Stat(dir); err != nil || !fi.IsDir() {
+		dir = filepath.Dir(dir)
+	}
+	for {
+		path := filepath.Join(dir, FileName)
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		} else if !os.IsNotExist(err) {
+			return "", err
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", nil
+		}
+		dir = parent
+	}
+}
+
+// Load reads the project configuration file at path
+func Load(path string) (*Config, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	c, err := Parse(b)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	return c, nil
+}
+
+// Parse parses and validates a project configuration
+func Parse(data []byte) (*Config, error) {
+	c := &Config{}
+	if err := yaml.Unmarshal(data, c); err != nil {
+		return nil, fmt.Errorf("invalid project configuration: %s", err)
+	}
+	switch c.VersionStrategy {
+	case "", manifest.StrategyChart, manifest.StrategyTimestamp, manifest.StrategyGit:
+	default:
+		return nil, fmt.Errorf("invalid project configuration: invalid version strategy %q, must be one of: %s, %s, %s",
+			c.VersionStrategy, manifest.StrategyChart, manifest.StrategyTimestamp, manifest.StrategyGit)
+	}
+	for i, pattern := range c.Exclude {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid project configuration: exclude[%d]: invalid pattern %q", i, pattern)
+		}
+	}
+	return c, nil
+}
+
+// Chart returns the publishing settings of the chart at path, as if it
+// were listed in a manifest, a nil *Config modifies nothing
+func (c *Config) Chart(path string) *manifest.Chart {
+	if c == nil || (c.VersionStrategy == "" && len(c.Annotations) == 0) {
+		return nil
+	}
+	strategy := c.VersionStrategy
+	if strategy == "" {
+		strategy = manifest.StrategyChart
+	}
+	return &manifest.Chart{Path: path, Repo: c.Repo, VersionStrategy: strategy, Annotations: c.Annotations}
+}
@@ -0,0 +1,80 @@
+package project
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/IxDay/helm-push-cloudflare-access/pkg/manifest"
+)
+
+func TestFind(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "helm-push-test")
+	if err != nil {
+		t.Fatal("unexpected error creating temp test dir", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	chart := filepath.Join(tmp, "charts", "api")
+	os.MkdirAll(chart, 0755)
+	if path, err := Find(chart); err != nil || path != "" {
+		t.Errorf("expected no project configuration, got %q, %v", path, err)
+	}
+
+	expected := filepath.Join(tmp, FileName)
+	ioutil.WriteFile(expected, []byte("repo: chartmuseum\n"), 0600)
+	if path, err := Find(chart); err != nil || path != expected {
+		t.Errorf("expected %s, got %q, %v", expected, path, err)
+	}
+	if path, err := Find(filepath.Join(chart, "api-0.1.0.tgz")); err != nil || path != expected {
+		t.Errorf("expected %s for a package, got %q, %v", expected, path, err)
+	}
+
+	// The closest file wins
+	expected = filepath.Join(chart, FileName)
+	ioutil.WriteFile(expected, []byte("repo: chartmuseum\n"), 0600)
+	if path, err := Find(chart); err != nil || path != expected {
+		t.Errorf("expected %s, got %q, %v", expected, path, err)
+	}
+}
+
+func TestParse(t *testing.T) {
+	c, err := Parse([]byte(`
+repo: chartmuseum
+version_strategy: git
+annotations:
+  team: payments
+exclude:
+- "*.md"
+- ci/
+`))
+	if err != nil {
+		t.Fatalf("unexpected error parsing project configuration: %s", err)
+	}
+	if c.Repo != "chartmuseum" || c.VersionStrategy != manifest.StrategyGit || c.Annotations["team"] != "payments" || len(c.Exclude) != 2 {
+		t.Errorf("unexpected project configuration %+v", c)
+	}
+	entry := c.Chart("charts/api")
+	if entry == nil || entry.Path != "charts/api" || entry.VersionStrategy != manifest.StrategyGit || !entry.Modifies() {
+		t.Errorf("unexpected chart %+v", entry)
+	}
+
+	for _, data := range []string{
+		"version_strategy: fixed",
+		"exclude: ['[']",
+		"repo: [",
+	} {
+		if _, err := Parse([]byte(data)); err == nil {
+			t.Errorf("expected error parsing %q, instead got nil", data)
+		}
+	}
+
+	if c, err := Parse([]byte("repo: chartmuseum")); err != nil || c.Chart("charts/api") != nil {
+		t.Errorf("expected no chart settings, got %v", err)
+	}
+	var none *Config
+	if none.Chart("charts/api") != nil {
+		t.Error("expected no chart settings from a nil configuration")
+	}
+}
@@ -0,0 +1,111 @@
+package push
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	cm "github.com/IxDay/helm-push-cloudflare-access/pkg/chartmuseum"
+	"github.com/IxDay/helm-push-cloudflare-access/pkg/helm"
+	"github.com/Masterminds/semver/v3"
+)
+
+// Conflict is what to do when the repository already has the chart
+// version being uploaded
+type Conflict string
+
+// Conflict strategies, ConflictFail by default
+const (
+	// ConflictFail fails the upload
+	ConflictFail Conflict = "fail"
+	// ConflictSkip leaves the chart version of the repository as is
+	ConflictSkip Conflict = "skip"
+	// ConflictForce overwrites the chart version of the repository
+	ConflictForce Conflict = "force"
+	// ConflictBump bumps the chart version with BumpVersion and uploads
+	// it again, until a free version is found
+	ConflictBump Conflict = "bump"
+)
+
+// MaxBumps is the number of times a chart version is bumped before giving
+// up with ConflictBump
+const MaxBumps = 20
+
+// Validate checks that c is a known strategy, empty being ConflictFail
+func (c Conflict) Validate() error {
+	switch c {
+	case "", ConflictFail, ConflictSkip, ConflictForce, ConflictBump:
+		return nil
+	}
+	return fmt.Errorf("invalid conflict strategy %q, must be one of: %s, %s, %s, %s", string(c), ConflictFail, ConflictSkip, ConflictForce, ConflictBump)
+}
+
+// OnConflict sets what to do when the repository already has the chart
+// version, see Conflict. ConflictForce is equivalent to Force, Upload
+// fails otherwise, Push skips or bumps.
+func OnConflict(c Conflict) Option {
+	return func(opts *options) {
+		opts.onConflict = c
+	}
+}
+
+// IsConflict tells if err is the repository refusing an upload because it
+// already has the chart version
+func IsConflict(err error) bool {
+	var se *cm.StatusError
+	return errors.As(err, &se) && se.Op == cm.OpUpload && se.StatusCode == http.StatusConflict
+}
+
+// UploadBumping calls upload until it does not fail with a conflict, the
+// version of chart being bumped with BumpVersion in between, up to MaxBumps
+// times. Without ConflictBump, it calls upload once. upload sees the bumped
+// version in chart and must regenerate what depends on it.
+func UploadBumping(chart *helm.Chart, onConflict Conflict, upload func() error) error {
+	for bumps := 0; ; bumps++ {
+		err := upload()
+		switch {
+		case onConflict != ConflictBump || !IsConflict(err):
+			return err
+		case bumps == MaxBumps:
+			return fmt.Errorf("no free version after %d bumps: %w", MaxBumps, err)
+		}
+		version, err := BumpVersion(chart.Metadata.Version)
+		if err != nil {
+			return err
+		}
+		chart.SetVersion(version)
+	}
+}
+
+// BumpVersion returns the version following version: the last numeric
+// identifier of its pre-release is incremented, ".1" is appended to a
+// pre-release without one, the patch is incremented for a release. Build
+// metadata is kept.
+func BumpVersion(version string) (string, error) {
+	v, err := semver.NewVersion(version)
+	if err != nil {
+		return "", fmt.Errorf("invalid chart version %q: %s", version, err)
+	}
+	if v.Prerelease() == "" {
+		bumped := v.IncPatch()
+		if bumped, err = bumped.SetMetadata(v.Metadata()); err != nil {
+			return "", err
+		}
+		return bumped.Original(), nil
+	}
+
+	ids := strings.Split(v.Prerelease(), ".")
+	last := ids[len(ids)-1]
+	if n, err := strconv.ParseUint(last, 10, 64); err == nil {
+		ids[len(ids)-1] = strconv.FormatUint(n+1, 10)
+	} else {
+		ids = append(ids, "1")
+	}
+	bumped, err := v.SetPrerelease(strings.Join(ids, "."))
+	if err != nil {
+		return "", err
+	}
+	return bumped.Original(), nil
+}
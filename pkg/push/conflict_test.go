@@ -0,0 +1,90 @@
+package push
+
+import (
+	"io/ioutil"
+	"testing"
+
+	cm "github.com/IxDay/helm-push-cloudflare-access/pkg/chartmuseum"
+	"github.com/IxDay/helm-push-cloudflare-access/pkg/chartmuseumtest"
+)
+
+func TestBumpVersion(t *testing.T) {
+	for version, expected := range map[string]string{
+		"0.1.0":            "0.1.1",
+		"v1.2.3":           "v1.2.4",
+		"1.2.3+build.7":    "1.2.4+build.7",
+		"1.0.0-rc":         "1.0.0-rc.1",
+		"1.0.0-rc.1":       "1.0.0-rc.2",
+		"1.0.0-dev.9":      "1.0.0-dev.10",
+		"1.0.0-g1a2b3c4":   "1.0.0-g1a2b3c4.1",
+		"1.0.0-rc.1+linux": "1.0.0-rc.2+linux",
+	} {
+		if bumped, err := BumpVersion(version); err != nil || bumped != expected {
+			t.Errorf("expected %s bumped to %s, got %q, %v", version, expected, bumped, err)
+		}
+	}
+	if _, err := BumpVersion("latest"); err == nil {
+		t.Error("expected error with invalid version, instead got nil")
+	}
+}
+
+func TestPushOnConflict(t *testing.T) {
+	ts := chartmuseumtest.NewServer()
+	defer ts.Close()
+
+	data, err := ioutil.ReadFile(testTarballPath)
+	if err != nil {
+		t.Fatal("unexpected error reading test tarball", err)
+	}
+	if _, err := ts.AddChart(data, nil); err != nil {
+		t.Fatalf("unexpected error adding chart: %s", err)
+	}
+	client, err := cm.NewClient(cm.URL(ts.URL))
+	if err != nil {
+		t.Fatalf("unexpected error creating client: %s", err)
+	}
+	if _, err := New(client, Version("0.1.1")).Push(testTarballPath); err != nil {
+		t.Fatalf("unexpected error pushing chart: %s", err)
+	}
+
+	if _, err := New(client).Push(testTarballPath); !IsConflict(err) {
+		t.Errorf("expected conflict error, got %v", err)
+	}
+	if _, err := New(client, OnConflict(ConflictFail)).Push(testTarballPath); !IsConflict(err) {
+		t.Errorf("expected conflict error, got %v", err)
+	}
+
+	result, err := New(client, OnConflict(ConflictSkip)).Push(testTarballPath)
+	if err != nil || !result.Skipped || result.Version != "0.1.0" {
+		t.Errorf("expected push to be skipped, got %+v, %v", result, err)
+	}
+	if c, _ := ts.Chart("my-v3-chart", "0.1.0"); string(c.Package) != string(data) {
+		t.Error("expected the chart version to be left as is")
+	}
+
+	result, err = New(client, OnConflict(ConflictBump)).Push(testTarballPath)
+	if err != nil || result.Skipped || result.Version != "0.1.2" || result.Package != "my-v3-chart-0.1.2.tgz" {
+		t.Errorf("expected version 0.1.2 to be pushed, got %+v, %v", result, err)
+	}
+	if _, ok := ts.Chart("my-v3-chart", "0.1.2"); !ok {
+		t.Error("expected the bumped version to be stored")
+	}
+
+	if _, err := New(client, OnConflict(ConflictForce)).Push(testTarballPath); err != nil {
+		t.Errorf("expected overwrite to succeed, got %v", err)
+	}
+	if c, _ := ts.Chart("my-v3-chart", "0.1.0"); string(c.Package) == string(data) {
+		t.Error("expected the chart version to be overwritten")
+	}
+}
+
+func TestConflictValidate(t *testing.T) {
+	for _, c := range []Conflict{"", ConflictFail, ConflictSkip, ConflictForce, ConflictBump} {
+		if err := c.Validate(); err != nil {
+			t.Errorf("unexpected error validating %q: %s", c, err)
+		}
+	}
+	if err := Conflict("retry").Validate(); err == nil {
+		t.Error("expected error with unknown strategy, instead got nil")
+	}
+}
@@ -0,0 +1,121 @@
+package push
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+
+	cm "github.com/IxDay/helm-push-cloudflare-access/pkg/chartmuseum"
+	"github.com/IxDay/helm-push-cloudflare-access/pkg/helm"
+	"helm.sh/helm/v3/pkg/repo"
+)
+
+// ErrIndexTooLarge is returned when the index is larger than MaxIndexSize
+var ErrIndexTooLarge = errors.New("index too large")
+
+// Versions returns the versions of the chart name in the repository, the
+// latest first, none when the chart is not there. The ChartMuseum chart
+// API is queried with ChartAPI, otherwise only the entries of the chart
+// are decoded from the index.
+func (p *Pusher) Versions(name string) (repo.ChartVersions, error) {
+	if !p.opts.chartAPI {
+		index, err := p.index(helm.Charts(name))
+		if err != nil || index.IndexFile == nil {
+			return nil, err
+		}
+		return index.Entries[name], nil
+	}
+
+	resp, err := p.client.GetChart(name)
+	if err != nil {
+		return nil, err
+	}
+	b, err := ReadResponse(cm.OpChart, resp)
+	var se *cm.StatusError
+	if errors.As(err, &se) && se.StatusCode == http.StatusNotFound && se.Message == "chart not found" {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var versions repo.ChartVersions
+	if err := json.Unmarshal(b, &versions); err != nil {
+		return nil, fmt.Errorf("could not parse versions of chart %q: %s", name, err)
+	}
+	sort.Sort(sort.Reverse(versions))
+	return versions, nil
+}
+
+// DownloadIndex downloads the index of the repository, see MaxIndexSize.
+// It is a helm.IndexDownloader.
+func (p *Pusher) DownloadIndex() ([]byte, error) {
+	body, err := p.openIndex()
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	return ioutil.ReadAll(body)
+}
+
+// index downloads and decodes the index of the repository, keeping the
+// entries of the charts keep returns true for, see helm.DecodeIndex
+func (p *Pusher) index(keep func(name string) bool) (*helm.Index, error) {
+	body, err := p.openIndex()
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	index, err := helm.DecodeIndex(body, keep)
+	if err != nil {
+		return nil, err
+	}
+	// Drain the body so that the connection can be reused
+	_, err = io.Copy(ioutil.Discard, body)
+	return index, err
+}
+
+// openIndex requests the index of the repository and returns its body,
+// limited to MaxIndexSize
+func (p *Pusher) openIndex() (io.ReadCloser, error) {
+	resp, err := p.client.DownloadFile("index.yaml")
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		_, err := ReadResponse(cm.OpIndex, resp)
+		return nil, err
+	}
+	max := p.opts.maxIndexSize
+	if max <= 0 {
+		return resp.Body, nil
+	}
+	if resp.ContentLength > max {
+		resp.Body.Close()
+		return nil, indexTooLarge(max)
+	}
+	return &limitedReader{ReadCloser: resp.Body, max: max}, nil
+}
+
+// indexTooLarge returns the error of an index larger than max bytes
+func indexTooLarge(max int64) error {
+	return fmt.Errorf("%w: larger than %d bytes", ErrIndexTooLarge, max)
+}
+
+// limitedReader fails once more than max bytes are read
+type limitedReader struct {
+	io.ReadCloser
+	max  int64
+	read int64
+}
+
+func (l *limitedReader) Read(b []byte) (int, error) {
+	n, err := l.ReadCloser.Read(b)
+	if l.read += int64(n); l.read > l.max {
+		return n, indexTooLarge(l.max)
+	}
+	return n, err
+}
@@ -0,0 +1,89 @@
+package push
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	cm "github.com/IxDay/helm-push-cloudflare-access/pkg/chartmuseum"
+	"github.com/IxDay/helm-push-cloudflare-access/pkg/chartmuseumtest"
+)
+
+func TestVersions(t *testing.T) {
+	ts := chartmuseumtest.NewServer()
+	defer ts.Close()
+	data, err := ioutil.ReadFile(testTarballPath)
+	if err != nil {
+		t.Fatal("unexpected error reading test tarball", err)
+	}
+	if _, err := ts.AddChart(data, nil); err != nil {
+		t.Fatalf("unexpected error adding chart: %s", err)
+	}
+	client, err := cm.NewClient(cm.URL(ts.RepoURL()))
+	if err != nil {
+		t.Fatalf("unexpected error creating client: %s", err)
+	}
+
+	for _, chartAPI := range []bool{false, true} {
+		pusher := New(client, ChartAPI(chartAPI))
+		versions, err := pusher.Versions("my-v3-chart")
+		if err != nil || len(versions) != 1 || versions[0].Version != "0.1.0" || versions[0].Digest == "" {
+			t.Errorf("unexpected versions with chart API %t: %v, %v", chartAPI, versions, err)
+		}
+		if versions, err := pusher.Versions("missing"); err != nil || len(versions) != 0 {
+			t.Errorf("expected no versions of a missing chart with chart API %t, got %v, %v", chartAPI, versions, err)
+		}
+		if published, err := pusher.Published("my-v3-chart", "0.1.0", versions[0].Digest); err != nil || !published {
+			t.Errorf("expected chart to be published with chart API %t, got %v", chartAPI, err)
+		}
+	}
+	var index, api int
+	for _, r := range ts.Requests() {
+		switch r.Path {
+		case "/index.yaml":
+			index++
+		case "/api/charts/my-v3-chart", "/api/charts/missing":
+			api++
+		}
+	}
+	if index != 3 || api != 3 {
+		t.Errorf("expected the chart API to replace index downloads, got %d index and %d API requests", index, api)
+	}
+
+	// A server without the chart API
+	ts.InjectFault(chartmuseumtest.Fault{Path: "/api/charts/*", Status: http.StatusNotFound})
+	if _, err := New(client, ChartAPI(true)).Versions("my-v3-chart"); err == nil {
+		t.Error("expected error without chart API, instead got nil")
+	}
+}
+
+func TestMaxIndexSize(t *testing.T) {
+	ts := chartmuseumtest.NewServer()
+	defer ts.Close()
+	data, err := ioutil.ReadFile(testTarballPath)
+	if err != nil {
+		t.Fatal("unexpected error reading test tarball", err)
+	}
+	ts.AddChart(data, nil)
+	client, err := cm.NewClient(cm.URL(ts.RepoURL()))
+	if err != nil {
+		t.Fatalf("unexpected error creating client: %s", err)
+	}
+
+	b, err := New(client).DownloadIndex()
+	if err != nil {
+		t.Fatalf("unexpected error downloading index: %s", err)
+	}
+	// The size of the index varies with its generation time
+	size := int64(len(b))
+	if _, err := New(client, MaxIndexSize(size+64)).Index(); err != nil {
+		t.Errorf("unexpected error with an index under the maximum size: %s", err)
+	}
+	if _, err := New(client, MaxIndexSize(size/2)).Index(); !errors.Is(err, ErrIndexTooLarge) {
+		t.Errorf("expected index to be too large, got %v", err)
+	}
+	if _, err := New(client, MaxIndexSize(size/2)).DownloadIndex(); !errors.Is(err, ErrIndexTooLarge) {
+		t.Errorf("expected index to be too large, got %v", err)
+	}
+}
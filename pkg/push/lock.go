@@ -0,0 +1,213 @@
+package push
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	cm "github.com/IxDay/helm-push-cloudflare-access/pkg/chartmuseum"
+	"github.com/IxDay/helm-push-cloudflare-access/pkg/helm"
+	"helm.sh/helm/v3/pkg/chart"
+)
+
+const (
+	// LockPrefix is prepended to the chart name to get the name of its
+	// lock packages
+	LockPrefix = "helm-push-lock-"
+	// lockedAt is the annotation of the lock packages holding when they
+	// were acquired, lockID the one identifying the publisher holding them
+	lockedAt = "helm-push/locked-at"
+	lockID   = "helm-push/lock-id"
+)
+
+// ErrLockUnsupported is returned by Pusher.Lock when the repository
+// overwrites chart versions, as ChartMuseum does with ALLOW_OVERWRITE=true:
+// the lock package would never be refused
+var ErrLockUnsupported = errors.New("the repository overwrites existing chart versions, locks cannot work")
+
+type (
+	// Lock is a sentinel package uploaded to the repository while a chart
+	// version is published, see Pusher.Lock
+	Lock struct {
+		pusher  *Pusher
+		name    string
+		version string
+		holder  lockHolder
+	}
+
+	// lockHolder identifies the publisher holding a lock, the zero value
+	// when the lock is not held
+	lockHolder struct {
+		since string
+		id    string
+	}
+
+	// LockedError is returned when another publisher holds the lock of a
+	// chart version
+	LockedError struct {
+		Name    string
+		Version string
+		// Since is when the lock was acquired, zero if unknown
+		Since time.Time
+	}
+)
+
+// Error implements error
+func (e *LockedError) Error() string {
+	msg := fmt.Sprintf("chart %s version %s is already being published", e.Name, e.Version)
+	if !e.Since.IsZero() {
+		msg += fmt.Sprintf(" (locked at %s)", e.Since.Format(time.RFC3339))
+	}
+	return msg
+}
+
+// Lock acquires the lock of the chart version by uploading a sentinel
+// package, which ChartMuseum refuses while it exists. Locks older than ttl
+// are left by crashed publishers, they are deleted and acquired again.
+// The lock packages show in the index until released.
+//
+// ChartMuseum has no conditional delete: a stale lock is only deleted if
+// it is still the one found stale, and the lock is checked again once
+// taken over, which leaves a window of a request for two publishers taking
+// over the same stale lock at once.
+func (p *Pusher) Lock(name, version string, ttl time.Duration) (*Lock, error) {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	l := &Lock{pusher: p, name: LockPrefix + name, version: version, holder: lockHolder{
+		since: time.Now().UTC().Format(time.RFC3339),
+		id:    hex.EncodeToString(id),
+	}}
+	err := l.acquire()
+	if !IsConflict(err) {
+		if err != nil {
+			return nil, err
+		}
+		return l, l.checkExclusive()
+	}
+
+	holder, err := l.current()
+	if err != nil {
+		return nil, err
+	}
+	since, _ := time.Parse(time.RFC3339, holder.since)
+	locked := &LockedError{Name: name, Version: version, Since: since}
+	if since.IsZero() || time.Since(since) < ttl {
+		return nil, locked
+	}
+	// Another publisher may take over the stale lock first
+	if taken, err := l.delete(holder); err != nil {
+		return nil, err
+	} else if !taken {
+		return nil, locked
+	}
+	l.holder.since = time.Now().UTC().Format(time.RFC3339)
+	if err := l.acquire(); IsConflict(err) {
+		return nil, locked
+	} else if err != nil {
+		return nil, err
+	}
+	// Another publisher taking over the same stale lock may have deleted
+	// the lock just acquired
+	if holder, err := l.current(); err != nil {
+		return nil, err
+	} else if holder != l.holder {
+		return nil, locked
+	}
+	return l, nil
+}
+
+// checkExclusive uploads the lock package just acquired again, which must
+// be refused, and releases it otherwise with ErrLockUnsupported
+func (l *Lock) checkExclusive() error {
+	err := l.acquire()
+	if IsConflict(err) {
+		return nil
+	}
+	if rerr := l.Release(); rerr != nil {
+		return rerr
+	}
+	if err != nil {
+		return err
+	}
+	return ErrLockUnsupported
+}
+
+// current returns the holder of the lock in the repository
+func (l *Lock) current() (lockHolder, error) {
+	versions, err := l.pusher.Versions(l.name)
+	if err != nil {
+		return lockHolder{}, err
+	}
+	for _, entry := range versions {
+		if entry.Version == l.version {
+			return lockHolder{since: entry.Annotations[lockedAt], id: entry.Annotations[lockID]}, nil
+		}
+	}
+	return lockHolder{}, nil
+}
+
+// delete deletes the lock package if held by holder, and tells whether
+// the lock is free
+func (l *Lock) delete(holder lockHolder) (bool, error) {
+	current, err := l.current()
+	if err != nil || current == (lockHolder{}) {
+		return err == nil, err
+	}
+	if current != holder {
+		return false, nil
+	}
+	resp, err := l.pusher.client.DeleteChartVersion(l.name, l.version)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusNotFound {
+		return true, nil
+	}
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return false, err
+	}
+	return false, responseError(cm.OpDelete, resp, b)
+}
+
+// acquire uploads the lock package, without overwriting an existing one
+func (l *Lock) acquire() error {
+	fsys := l.pusher.opts.fsys
+	tmp, err := tempDir(fsys)
+	if err != nil {
+		return err
+	}
+	defer fsys.RemoveAll(tmp)
+	sentinel := &helm.Chart{Chart: &chart.Chart{Metadata: &chart.Metadata{
+		APIVersion:  chart.APIVersionV2,
+		Name:        l.name,
+		Version:     l.version,
+		Description: "helm push lock, deleted once the chart is published",
+		Type:        "library",
+		Deprecated:  true,
+		Annotations: map[string]string{lockedAt: l.holder.since, lockID: l.holder.id},
+	}}}
+	path, err := helm.SaveChartPackage(fsys, sentinel, tmp)
+	if err != nil {
+		return err
+	}
+	resp, err := l.pusher.client.UploadChartPackage(path, false)
+	if err != nil {
+		return err
+	}
+	return checkUpload(resp)
+}
+
+// Release deletes the lock package, unless another publisher took it
+// over. A lock already gone is released.
+func (l *Lock) Release() error {
+	_, err := l.delete(l.holder)
+	return err
+}
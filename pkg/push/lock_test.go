@@ -0,0 +1,96 @@
+package push
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	cm "github.com/IxDay/helm-push-cloudflare-access/pkg/chartmuseum"
+	"github.com/IxDay/helm-push-cloudflare-access/pkg/chartmuseumtest"
+)
+
+func TestLock(t *testing.T) {
+	ts := chartmuseumtest.NewServer()
+	defer ts.Close()
+	client, err := cm.NewClient(cm.URL(ts.URL))
+	if err != nil {
+		t.Fatalf("unexpected error creating client: %s", err)
+	}
+	pusher := New(client)
+	lock, err := pusher.Lock("mychart", "0.1.0", time.Minute)
+	if err != nil {
+		t.Fatalf("unexpected error acquiring lock: %s", err)
+	}
+	if _, ok := ts.Chart(LockPrefix+"mychart", "0.1.0"); !ok {
+		t.Errorf("expected lock package to be uploaded, got %+v", ts.Charts())
+	}
+
+	// Another version is locked independently
+	other, err := pusher.Lock("mychart", "0.2.0", time.Minute)
+	if err != nil {
+		t.Fatalf("unexpected error acquiring lock of another version: %s", err)
+	}
+	other.Release()
+
+	_, err = pusher.Lock("mychart", "0.1.0", time.Minute)
+	var le *LockedError
+	if !errors.As(err, &le) || le.Since.IsZero() || !strings.Contains(err.Error(), "already being published") {
+		t.Errorf("expected locked error, got %v", err)
+	}
+
+	if err := lock.Release(); err != nil {
+		t.Fatalf("unexpected error releasing lock: %s", err)
+	}
+	if err := lock.Release(); err != nil {
+		t.Errorf("unexpected error releasing lock twice: %s", err)
+	}
+	if lock, err = pusher.Lock("mychart", "0.1.0", time.Minute); err != nil {
+		t.Fatalf("unexpected error acquiring released lock: %s", err)
+	}
+
+	// A lock taken over by another publisher is not released
+	lock.Release()
+	stale := &Lock{pusher: pusher, name: LockPrefix + "mychart", version: "0.1.0", holder: lockHolder{
+		since: time.Now().Add(-time.Hour).UTC().Format(time.RFC3339),
+		id:    "other",
+	}}
+	if err := stale.acquire(); err != nil {
+		t.Fatalf("unexpected error acquiring stale lock: %s", err)
+	}
+	if err := lock.Release(); err != nil {
+		t.Fatalf("unexpected error releasing lock: %s", err)
+	}
+	if holder, _ := stale.current(); holder != stale.holder {
+		t.Errorf("expected the lock of another publisher to be kept, got %+v", holder)
+	}
+
+	// Stale locks are taken over, once
+	if lock, err = pusher.Lock("mychart", "0.1.0", time.Minute); err != nil {
+		t.Fatalf("unexpected error taking over stale lock: %s", err)
+	}
+	if holder, _ := lock.current(); holder != lock.holder {
+		t.Errorf("expected the stale lock to be taken over, got %+v", holder)
+	}
+	if taken, err := stale.delete(stale.holder); taken || err != nil {
+		t.Errorf("expected the lock taken over not to be deleted again, got %t, %v", taken, err)
+	}
+	if _, err := pusher.Lock("mychart", "0.1.0", time.Minute); !errors.As(err, &le) {
+		t.Errorf("expected locked error, got %v", err)
+	}
+}
+
+func TestLockOverwrite(t *testing.T) {
+	ts := chartmuseumtest.NewServer(chartmuseumtest.AllowOverwrite(true))
+	defer ts.Close()
+	client, err := cm.NewClient(cm.URL(ts.URL))
+	if err != nil {
+		t.Fatalf("unexpected error creating client: %s", err)
+	}
+	if _, err := New(client).Lock("mychart", "0.1.0", time.Minute); !errors.Is(err, ErrLockUnsupported) {
+		t.Errorf("expected unsupported lock error, got %v", err)
+	}
+	if charts := ts.Charts(); len(charts) != 0 {
+		t.Errorf("expected the lock package to be deleted, got %+v", charts)
+	}
+}
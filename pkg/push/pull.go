@@ -0,0 +1,163 @@
+package push
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	neturl "net/url"
+	"path"
+	"path/filepath"
+	"strings"
+
+	cm "github.com/IxDay/helm-push-cloudflare-access/pkg/chartmuseum"
+	"helm.sh/helm/v3/pkg/repo"
+)
+
+// Download is a chart package downloaded from the repository
+type Download struct {
+	// Name and Version of the chart
+	Name    string
+	Version string
+	// Digest is the SHA-256 of the package listed in the index, the
+	// package was checked against it unless empty
+	Digest string
+	// URL of the package, the provenance file is next to it
+	URL  string
+	Data []byte
+}
+
+// Pull downloads the chart name from the repository, version is a version
+// or a constraint, the latest version is downloaded when empty. The
+// versions are always fetched from the server, a cached index could miss
+// the version asked for.
+func (p *Pusher) Pull(name, version string) (*Download, error) {
+	repoURL := p.client.URL()
+	versions, err := p.Versions(name)
+	if err != nil {
+		return nil, err
+	}
+	index := &repo.IndexFile{Entries: map[string]repo.ChartVersions{name: versions}}
+	entry, err := index.Get(name, version)
+	if err != nil {
+		if version != "" {
+			return nil, fmt.Errorf("chart %q version %q not found in %s", name, version, repoURL)
+		}
+		return nil, fmt.Errorf("chart %q not found in %s", name, repoURL)
+	}
+	return p.Fetch(entry)
+}
+
+// Fetch downloads the chart package of the index entry, checking it
+// against the digest of the entry
+func (p *Pusher) Fetch(entry *repo.ChartVersion) (*Download, error) {
+	if len(entry.URLs) == 0 {
+		return nil, fmt.Errorf("chart %q version %q has no URL in the index", entry.Name, entry.Version)
+	}
+
+	// Chart URLs are relative to the repository, unless absolute
+	base, err := neturl.Parse(strings.TrimSuffix(p.client.URL(), "/") + "/")
+	if err != nil {
+		return nil, err
+	}
+	ref, err := neturl.Parse(entry.URLs[0])
+	if err != nil {
+		return nil, err
+	}
+	chartURL := base.ResolveReference(ref)
+	dir, file := path.Split(chartURL.Path)
+	dirURL := *chartURL
+	dirURL.Path = dir
+
+	// The package is not always stored next to the index, credentials
+	// are only sent to the repository host
+	client, err := p.client.At(dirURL.String())
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.DownloadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	data, err := ReadResponse(cm.OpDownload, resp)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkDigest(file, data, entry.Digest); err != nil {
+		return nil, err
+	}
+	return &Download{
+		Name:    entry.Name,
+		Version: entry.Version,
+		Digest:  entry.Digest,
+		URL:     chartURL.String(),
+		Data:    data,
+	}, nil
+}
+
+// Provenance downloads the provenance file stored next to the package of
+// d, nil when there is none. As for the package, credentials are only
+// sent to the repository host.
+func (p *Pusher) Provenance(d *Download) ([]byte, error) {
+	chartURL, err := neturl.Parse(d.URL)
+	if err != nil {
+		return nil, err
+	}
+	dir, file := path.Split(chartURL.Path)
+	chartURL.Path = dir
+	client, err := p.client.At(chartURL.String())
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.DownloadFile(file + ".prov")
+	if err == nil {
+		var data []byte
+		data, err = ReadResponse(cm.OpDownload, resp)
+		if err == nil {
+			return data, nil
+		}
+	}
+	var se *cm.StatusError
+	if errors.As(err, &se) && se.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	return nil, fmt.Errorf("fetching provenance file of %s: %w", file, err)
+}
+
+// Save writes the package of d to dir, along with its provenance file when
+// the repository has one, and returns their paths, provPath being empty
+// without provenance file
+func (p *Pusher) Save(d *Download, dir string) (chartPath, provPath string, err error) {
+	prov, err := p.Provenance(d)
+	if err != nil {
+		return "", "", err
+	}
+	chartURL, err := neturl.Parse(d.URL)
+	if err != nil {
+		return "", "", err
+	}
+	chartPath = filepath.Join(dir, path.Base(chartURL.Path))
+	if err := ioutil.WriteFile(chartPath, d.Data, 0644); err != nil {
+		return "", "", err
+	}
+	if prov == nil {
+		return chartPath, "", nil
+	}
+	provPath = chartPath + ".prov"
+	return chartPath, provPath, ioutil.WriteFile(provPath, prov, 0644)
+}
+
+// checkDigest compares the SHA-256 of the chart package data with the
+// digest listed in the index, an empty digest is not checked
+func checkDigest(file string, data []byte, digest string) error {
+	if digest == "" {
+		return nil
+	}
+	sum := sha256.Sum256(data)
+	if actual := hex.EncodeToString(sum[:]); !strings.EqualFold(actual, strings.TrimPrefix(digest, "sha256:")) {
+		return fmt.Errorf("digest mismatch for %s: index lists %s, downloaded package is %s", file, digest, actual)
+	}
+	return nil
+}
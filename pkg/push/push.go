@@ -0,0 +1,331 @@
+// Package push publishes Helm charts to ChartMuseum repositories behind
+// Cloudflare Access, it is the engine of the helm push plugin for programs
+// embedding chart publishing
+package push
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	cm "github.com/IxDay/helm-push-cloudflare-access/pkg/chartmuseum"
+	"github.com/IxDay/helm-push-cloudflare-access/pkg/helm"
+	"github.com/IxDay/helm-push-cloudflare-access/pkg/tmpdir"
+	"github.com/IxDay/helm-push-cloudflare-access/pkg/vfs"
+	"helm.sh/helm/v3/pkg/provenance"
+)
+
+type (
+	// Pusher publishes charts to the repository of its client
+	Pusher struct {
+		client *cm.Client
+		opts   options
+	}
+
+	// Option configures a Pusher
+	Option func(*options)
+
+	options struct {
+		version      string
+		appVersion   string
+		force        bool
+		keyring      string
+		key          string
+		passphrase   provenance.PassphraseFetcher
+		contextPath  bool
+		progress     cm.ProgressFunc
+		fsys         vfs.FS
+		chartAPI     bool
+		maxIndexSize int64
+		onConflict   Conflict
+	}
+
+	// Result describes a pushed chart
+	Result struct {
+		// Name and Version of the chart, after overrides
+		Name    string
+		Version string
+		// Digest is the SHA-256 of the package, as listed in the index
+		Digest string
+		// Package and Provenance are the file names uploaded, Provenance
+		// is empty for unsigned charts
+		Package    string
+		Provenance string
+		// Skipped is set when the repository had the chart version and it
+		// was left as is, see ConflictSkip
+		Skipped bool
+	}
+)
+
+// Version overrides the chart version
+func Version(version string) Option {
+	return func(opts *options) {
+		opts.version = version
+	}
+}
+
+// AppVersion overrides the chart app version
+func AppVersion(appVersion string) Option {
+	return func(opts *options) {
+		opts.appVersion = appVersion
+	}
+}
+
+// Force overwrites the chart version if it already exists
+func Force(force bool) Option {
+	return func(opts *options) {
+		opts.force = force
+	}
+}
+
+// Sign signs the packages with key from keyring and uploads their
+// provenance file, passphrase unlocks the key when it is protected
+func Sign(keyring, key string, passphrase provenance.PassphraseFetcher) Option {
+	return func(opts *options) {
+		opts.keyring = keyring
+		opts.key = key
+		opts.passphrase = passphrase
+	}
+}
+
+// DiscoverContextPath reads the context path of the repository from its
+// index before the first upload, when the client has none. It is ignored
+// with ChartAPI.
+func DiscoverContextPath(discover bool) Option {
+	return func(opts *options) {
+		opts.contextPath = discover
+	}
+}
+
+// Progress reports the progress of chart package uploads
+func Progress(progress cm.ProgressFunc) Option {
+	return func(opts *options) {
+		opts.progress = progress
+	}
+}
+
+// ChartAPI looks up the versions of a chart with the ChartMuseum chart
+// API (GET /api/charts/<name>) rather than in the index, which is then
+// never downloaded: the context path must be set on the client
+func ChartAPI(chartAPI bool) Option {
+	return func(opts *options) {
+		opts.chartAPI = chartAPI
+	}
+}
+
+// MaxIndexSize refuses indexes larger than size bytes with
+// ErrIndexTooLarge, there is no limit when 0
+func MaxIndexSize(size int64) Option {
+	return func(opts *options) {
+		opts.maxIndexSize = size
+	}
+}
+
+// FileSystem reads the charts from fsys and packages them there rather
+// than on the host filesystem, charts can't be signed then
+func FileSystem(fsys vfs.FS) Option {
+	return func(opts *options) {
+		opts.fsys = fsys
+	}
+}
+
+// New creates a Pusher uploading with client, which holds the repository
+// URL, credentials and TLS settings
+func New(client *cm.Client, opts ...Option) *Pusher {
+	p := &Pusher{client: client}
+	for _, opt := range opts {
+		opt(&p.opts)
+	}
+	if p.opts.progress != nil {
+		client.Option(cm.Progress(p.opts.progress))
+	}
+	if p.opts.fsys != nil {
+		client.Option(cm.FileSystem(p.opts.fsys))
+	} else {
+		p.opts.fsys = vfs.OS
+	}
+	return p
+}
+
+// Push packages the chart at path, a directory or a .tgz package, with the
+// overrides of the Pusher and uploads it. When the repository already has
+// the chart version, it is skipped or bumped according to OnConflict.
+func (p *Pusher) Push(path string) (*Result, error) {
+	chart, err := helm.LoadChart(p.opts.fsys, path)
+	if err != nil {
+		return nil, err
+	}
+	if p.opts.version != "" {
+		chart.SetVersion(p.opts.version)
+	}
+	if p.opts.appVersion != "" {
+		chart.SetAppVersion(p.opts.appVersion)
+	}
+
+	var result *Result
+	err = UploadBumping(chart, p.opts.onConflict, func() error {
+		result, err = p.push(chart)
+		return err
+	})
+	switch {
+	case IsConflict(err) && p.opts.onConflict == ConflictSkip:
+		result.Skipped = true
+		return result, nil
+	case err != nil:
+		return nil, err
+	}
+	return result, nil
+}
+
+// push packages and uploads chart, the result is returned along with
+// conflict errors
+func (p *Pusher) push(chart *helm.Chart) (*Result, error) {
+	tmp, err := tempDir(p.opts.fsys)
+	if err != nil {
+		return nil, err
+	}
+	defer p.opts.fsys.RemoveAll(tmp)
+	packaged, err := helm.SaveChartPackage(p.opts.fsys, chart, tmp)
+	if err != nil {
+		return nil, err
+	}
+	prov := ""
+	if p.opts.key != "" {
+		if !vfs.IsOS(p.opts.fsys) {
+			return nil, errors.New("charts can only be signed on the host filesystem")
+		}
+		if prov, err = helm.SignChartPackage(packaged, p.opts.keyring, p.opts.key, p.opts.passphrase); err != nil {
+			return nil, err
+		}
+	}
+	data, err := vfs.ReadFile(p.opts.fsys, packaged)
+	if err != nil {
+		return nil, err
+	}
+	digest, err := provenance.Digest(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	result := &Result{
+		Name:    chart.Metadata.Name,
+		Version: chart.Metadata.Version,
+		Digest:  digest,
+		Package: filepath.Base(packaged),
+	}
+	if prov != "" {
+		result.Provenance = filepath.Base(prov)
+	}
+	if err := p.Upload(packaged, prov); err != nil {
+		if IsConflict(err) {
+			return result, err
+		}
+		return nil, err
+	}
+	return result, nil
+}
+
+// Upload uploads a chart package, and its provenance file unless provPath
+// is empty. Both are sent in a single request, so that the chart is never
+// published without its provenance file.
+func (p *Pusher) Upload(packagePath, provPath string) error {
+	if p.opts.contextPath && !p.opts.chartAPI {
+		index, err := p.index(func(string) bool { return false })
+		if err != nil {
+			return err
+		}
+		p.client.Option(cm.ContextPath(index.ServerInfo.ContextPath))
+		p.opts.contextPath = false
+	}
+	force := p.opts.force || p.opts.onConflict == ConflictForce
+	var resp *http.Response
+	var err error
+	if provPath != "" {
+		resp, err = p.client.UploadChartWithProvenance(packagePath, provPath, force)
+	} else {
+		resp, err = p.client.UploadChartPackage(packagePath, force)
+	}
+	if err != nil {
+		return err
+	}
+	err = checkUpload(resp)
+	if IsConflict(err) && cm.Retried(resp) {
+		// an attempt may have been stored with its answer lost, the
+		// repository then has this very package
+		if stored, serr := p.stored(packagePath); serr == nil && stored {
+			return nil
+		}
+	}
+	return err
+}
+
+// stored tells if the repository has the chart package at path
+func (p *Pusher) stored(path string) (bool, error) {
+	chart, err := helm.LoadChart(p.opts.fsys, path)
+	if err != nil {
+		return false, err
+	}
+	data, err := vfs.ReadFile(p.opts.fsys, path)
+	if err != nil {
+		return false, err
+	}
+	digest, err := provenance.Digest(bytes.NewReader(data))
+	if err != nil {
+		return false, err
+	}
+	return p.Published(chart.Metadata.Name, chart.Metadata.Version, digest)
+}
+
+// Published tells if the repository has the chart version with digest,
+// uploading its package again would change nothing. The versions are
+// always fetched from the server, a cached index could be stale.
+func (p *Pusher) Published(name, version, digest string) (bool, error) {
+	versions, err := p.Versions(name)
+	if err != nil {
+		return false, err
+	}
+	for _, entry := range versions {
+		if entry.Version == version {
+			remote := strings.TrimPrefix(entry.Digest, "sha256:")
+			return remote != "" && strings.EqualFold(remote, strings.TrimPrefix(digest, "sha256:")), nil
+		}
+	}
+	return false, nil
+}
+
+// pollInterval is the delay between two index lookups of WaitPublished
+var pollInterval = time.Second
+
+// WaitPublished polls the repository until it lists the chart version
+// with digest, servers and caches may serve an outdated index for a while
+// after an upload. It gives up after timeout.
+func (p *Pusher) WaitPublished(name, version, digest string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		published, err := p.Published(name, version, digest)
+		if err != nil || published {
+			return err
+		}
+		if time.Now().Add(pollInterval).After(deadline) {
+			return fmt.Errorf("%s-%s not listed by the repository after %s", name, version, timeout)
+		}
+		time.Sleep(pollInterval)
+	}
+}
+
+// tempDir creates a temporary directory in fsys, in the plugin temporary
+// directory for the host filesystem
+func tempDir(fsys vfs.FS) (string, error) {
+	if vfs.IsOS(fsys) {
+		return tmpdir.New("helm-push-")
+	}
+	return fsys.MkdirTemp("", "helm-push-")
+}
+
+// Index fetches the index of the repository, see MaxIndexSize
+func (p *Pusher) Index() (*helm.Index, error) {
+	return p.index(nil)
+}
@@ -0,0 +1,343 @@
+package push
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	cm "github.com/IxDay/helm-push-cloudflare-access/pkg/chartmuseum"
+	"github.com/IxDay/helm-push-cloudflare-access/pkg/chartmuseumtest"
+	"github.com/IxDay/helm-push-cloudflare-access/pkg/vfs"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/repo"
+)
+
+var testTarballPath = "../../testdata/charts/helm3/my-v3-chart/my-v3-chart-0.1.0.tgz"
+
+func TestPush(t *testing.T) {
+	var uploaded string
+	var progress int64
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("CF-Access-Client-Id") != "my-id" {
+			w.WriteHeader(401)
+			w.Write([]byte(`{"error": "unauthorized"}`))
+			return
+		}
+		switch r.URL.Path {
+		case "/index.yaml":
+			w.Write([]byte("apiVersion: v1\nentries: {}\nserverInfo:\n  contextPath: /helm/v1\n"))
+		case "/helm/v1/api/charts":
+			if r.URL.RawQuery != "force" {
+				w.WriteHeader(409)
+				w.Write([]byte(`{"error": "file already exists"}`))
+				return
+			}
+			file, _, err := r.FormFile("chart")
+			if err != nil {
+				t.Fatalf("unexpected error reading chart: %s", err)
+			}
+			chart, err := loader.LoadArchive(file)
+			if err != nil {
+				t.Fatalf("unexpected error loading chart: %s", err)
+			}
+			uploaded = chart.Metadata.Version
+			w.WriteHeader(201)
+		default:
+			w.WriteHeader(404)
+			w.Write([]byte(`{"error": "not found"}`))
+		}
+	}))
+	defer ts.Close()
+
+	client, err := cm.NewClient(cm.URL(ts.URL), cm.ClientID("my-id"))
+	if err != nil {
+		t.Fatalf("unexpected error creating client: %s", err)
+	}
+	pusher := New(client,
+		Version("1.2.3"),
+		Force(true),
+		DiscoverContextPath(true),
+		Progress(func(sent, total int64) { progress = sent }),
+	)
+	result, err := pusher.Push(testTarballPath)
+	if err != nil {
+		t.Fatalf("unexpected error pushing chart: %s", err)
+	}
+	if uploaded != "1.2.3" {
+		t.Errorf("expected version 1.2.3 to be uploaded, got %q", uploaded)
+	}
+	if result.Name != "my-v3-chart" || result.Version != "1.2.3" || result.Package != "my-v3-chart-1.2.3.tgz" || result.Digest == "" || result.Provenance != "" {
+		t.Errorf("unexpected result %+v", result)
+	}
+	if progress == 0 {
+		t.Error("expected upload progress to be reported")
+	}
+
+	_, err = New(client).Push(testTarballPath)
+	var se *cm.StatusError
+	if !errors.As(err, &se) || se.StatusCode != 409 || !strings.Contains(err.Error(), "file already exists") {
+		t.Errorf("expected conflict error, got %v", err)
+	}
+}
+
+func TestPushFileSystem(t *testing.T) {
+	ts := chartmuseumtest.NewServer()
+	defer ts.Close()
+
+	data, err := ioutil.ReadFile(testTarballPath)
+	if err != nil {
+		t.Fatal("unexpected error reading test tarball", err)
+	}
+	mem := vfs.NewMem()
+	mem.WriteFile("/charts/my-v3-chart-0.1.0.tgz", data, 0644)
+	client, err := cm.NewClient(cm.URL(ts.URL))
+	if err != nil {
+		t.Fatalf("unexpected error creating client: %s", err)
+	}
+	result, err := New(client, FileSystem(mem), Version("2.0.0")).Push("/charts/my-v3-chart-0.1.0.tgz")
+	if err != nil {
+		t.Fatalf("unexpected error pushing chart: %s", err)
+	}
+	if _, ok := ts.Chart("my-v3-chart", "2.0.0"); !ok || result.Package != "my-v3-chart-2.0.0.tgz" {
+		t.Errorf("expected version 2.0.0 to be uploaded, got %+v", result)
+	}
+	if entries, _ := fs.ReadDir(mem, "."); len(entries) != 1 {
+		t.Errorf("expected temporary files to be removed, got %v", entries)
+	}
+
+	_, err = New(client, FileSystem(mem), Sign("pubring.gpg", "key", nil)).Push("/charts/my-v3-chart-0.1.0.tgz")
+	if err == nil || !strings.Contains(err.Error(), "host filesystem") {
+		t.Errorf("expected signing error, got %v", err)
+	}
+}
+
+func TestPull(t *testing.T) {
+	chart, err := ioutil.ReadFile(testTarballPath)
+	if err != nil {
+		t.Fatal("unexpected error reading test tarball", err)
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/index.yaml":
+			w.Write([]byte(`apiVersion: v1
+entries:
+  my-v3-chart:
+  - name: my-v3-chart
+    version: 0.1.0
+    urls: [charts/my-v3-chart-0.1.0.tgz]
+  - name: my-v3-chart
+    version: 0.0.1
+    digest: "0000"
+    urls: [charts/my-v3-chart-0.1.0.tgz]
+`))
+		case "/charts/my-v3-chart-0.1.0.tgz":
+			w.Write(chart)
+		default:
+			w.WriteHeader(404)
+			w.Write([]byte(`{"error": "not found"}`))
+		}
+	}))
+	defer ts.Close()
+
+	client, err := cm.NewClient(cm.URL(ts.URL))
+	if err != nil {
+		t.Fatalf("unexpected error creating client: %s", err)
+	}
+	pusher := New(client)
+	download, err := pusher.Pull("my-v3-chart", "")
+	if err != nil {
+		t.Fatalf("unexpected error pulling chart: %s", err)
+	}
+	if download.Version != "0.1.0" || download.URL != ts.URL+"/charts/my-v3-chart-0.1.0.tgz" || len(download.Data) != len(chart) {
+		t.Errorf("unexpected download %+v", download)
+	}
+	if _, err := pusher.Pull("my-v3-chart", "0.0.1"); err == nil || !strings.Contains(err.Error(), "digest mismatch") {
+		t.Errorf("expected digest mismatch error, got %v", err)
+	}
+	if _, err := pusher.Pull("other", ""); err == nil || !strings.Contains(err.Error(), `chart "other" not found`) {
+		t.Errorf("expected chart not found error, got %v", err)
+	}
+}
+
+func TestSave(t *testing.T) {
+	data, err := ioutil.ReadFile(testTarballPath)
+	if err != nil {
+		t.Fatal("unexpected error reading test tarball", err)
+	}
+	var leaked []string
+	storage := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("CF-Access-Client-Id") != "" || r.Header.Get("CF-Access-Client-Secret") != "" {
+			leaked = append(leaked, r.URL.Path)
+		}
+		switch r.URL.Path {
+		case "/signed/my-v3-chart-0.1.0.tgz", "/unsigned/my-v3-chart-0.1.0.tgz":
+			w.Write(data)
+		case "/signed/my-v3-chart-0.1.0.tgz.prov":
+			w.Write([]byte("provenance"))
+		default:
+			w.WriteHeader(404)
+		}
+	}))
+	defer storage.Close()
+	ts := chartmuseumtest.NewServer()
+	defer ts.Close()
+	client, err := cm.NewClient(cm.URL(ts.URL), cm.ClientID("my-id"), cm.ClientSecret("my-secret"))
+	if err != nil {
+		t.Fatalf("unexpected error creating client: %s", err)
+	}
+	pusher := New(client)
+
+	tmp, err := ioutil.TempDir("", "helm-push-test")
+	if err != nil {
+		t.Fatal("unexpected error creating temp test dir", err)
+	}
+	defer os.RemoveAll(tmp)
+	for dir, prov := range map[string]string{"signed": "provenance", "unsigned": ""} {
+		download, err := pusher.Fetch(&repo.ChartVersion{
+			Metadata: &chart.Metadata{Name: "my-v3-chart", Version: "0.1.0"},
+			URLs:     []string{storage.URL + "/" + dir + "/my-v3-chart-0.1.0.tgz"},
+		})
+		if err != nil {
+			t.Fatalf("unexpected error fetching chart: %s", err)
+		}
+		out := filepath.Join(tmp, dir)
+		os.Mkdir(out, 0755)
+		chartPath, provPath, err := pusher.Save(download, out)
+		if err != nil {
+			t.Fatalf("unexpected error saving chart: %s", err)
+		}
+		if b, _ := ioutil.ReadFile(chartPath); chartPath != filepath.Join(out, "my-v3-chart-0.1.0.tgz") || len(b) != len(data) {
+			t.Errorf("unexpected package saved to %s", chartPath)
+		}
+		if b, _ := ioutil.ReadFile(provPath); string(b) != prov || (prov == "") != (provPath == "") {
+			t.Errorf("unexpected provenance file saved to %q: %q", provPath, b)
+		}
+	}
+	if len(leaked) != 0 {
+		t.Errorf("expected no credentials to be sent to the package host, got requests %v", leaked)
+	}
+}
+
+func TestUploadRetried(t *testing.T) {
+	ts := chartmuseumtest.NewServer()
+	defer ts.Close()
+	client, err := cm.NewClient(cm.URL(ts.URL), cm.ClientID("my-id"), cm.ClientSecret("my-secret"), cm.Retries(1))
+	if err != nil {
+		t.Fatalf("unexpected error creating client: %s", err)
+	}
+
+	// the package is stored but the answer is lost, the retry conflicts
+	// with it
+	ts.InjectFault(chartmuseumtest.Fault{Method: "POST", Path: "/api/charts", Status: 503, Lost: true, Times: 1})
+	if err := New(client, ChartAPI(true)).Upload(testTarballPath, ""); err != nil {
+		t.Fatalf("expected the upload stored by the lost attempt to succeed, got %s", err)
+	}
+	if len(ts.Charts()) != 1 {
+		t.Errorf("expected the chart to be stored once, got %v", ts.Charts())
+	}
+
+	// the conflict is kept when the repository has another package
+	ts.InjectFault(chartmuseumtest.Fault{Method: "POST", Path: "/api/charts", Status: 503, Times: 1})
+	other, err := ioutil.ReadFile(testTarballPath)
+	if err != nil {
+		t.Fatalf("unexpected error reading chart: %s", err)
+	}
+	tmp, err := ioutil.TempDir("", "helm-push-test")
+	if err != nil {
+		t.Fatal("unexpected error creating temp test dir", err)
+	}
+	defer os.RemoveAll(tmp)
+	c, err := loader.LoadArchive(bytes.NewReader(other))
+	if err != nil {
+		t.Fatalf("unexpected error loading chart: %s", err)
+	}
+	c.Metadata.Description = "changed"
+	changed, err := chartutil.Save(c, tmp)
+	if err != nil {
+		t.Fatalf("unexpected error saving chart: %s", err)
+	}
+	if err := New(client, ChartAPI(true)).Upload(changed, ""); !IsConflict(err) {
+		t.Errorf("expected a conflict, got %v", err)
+	}
+}
+
+func TestPublished(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`apiVersion: v1
+entries:
+  mychart:
+  - name: mychart
+    version: 0.1.0
+    digest: sha256:8D2C
+  - name: mychart
+    version: 0.2.0
+`))
+	}))
+	defer ts.Close()
+
+	client, err := cm.NewClient(cm.URL(ts.URL))
+	if err != nil {
+		t.Fatalf("unexpected error creating client: %s", err)
+	}
+	tests := []struct {
+		name, version, digest string
+		published             bool
+	}{
+		{"mychart", "0.1.0", "8d2c", true},
+		{"mychart", "0.1.0", "ffff", false},
+		{"mychart", "0.2.0", "8d2c", false},
+		{"mychart", "0.3.0", "8d2c", false},
+		{"other", "0.1.0", "8d2c", false},
+	}
+	for _, tt := range tests {
+		published, err := New(client).Published(tt.name, tt.version, tt.digest)
+		if err != nil || published != tt.published {
+			t.Errorf("expected %s-%s with digest %s published to be %t, got %t, %v", tt.name, tt.version, tt.digest, tt.published, published, err)
+		}
+	}
+}
+
+func TestWaitPublished(t *testing.T) {
+	defer func(d time.Duration) { pollInterval = d }(pollInterval)
+	pollInterval = time.Millisecond
+
+	// the index lists the version from the third lookup on
+	lookups := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lookups++
+		if lookups < 3 {
+			w.Write([]byte("apiVersion: v1\nentries: {}\n"))
+			return
+		}
+		w.Write([]byte(`apiVersion: v1
+entries:
+  mychart:
+  - name: mychart
+    version: 0.1.0
+    digest: sha256:8d2c
+`))
+	}))
+	defer ts.Close()
+
+	client, err := cm.NewClient(cm.URL(ts.URL))
+	if err != nil {
+		t.Fatalf("unexpected error creating client: %s", err)
+	}
+	if err := New(client).WaitPublished("mychart", "0.1.0", "8d2c", time.Second); err != nil || lookups != 3 {
+		t.Errorf("expected the version listed after 3 lookups, got %v after %d", err, lookups)
+	}
+	err = New(client).WaitPublished("mychart", "0.2.0", "8d2c", 10*time.Millisecond)
+	if err == nil || !strings.Contains(err.Error(), "not listed") {
+		t.Errorf("expected a timeout error, got %v", err)
+	}
+}
@@ -0,0 +1,58 @@
+package push
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	cm "github.com/IxDay/helm-push-cloudflare-access/pkg/chartmuseum"
+	"github.com/IxDay/helm-push-cloudflare-access/pkg/helm"
+)
+
+// ReadResponse returns the body of a successful download response, other
+// statuses are turned into a *chartmuseum.StatusError for operation op
+func ReadResponse(op string, resp *http.Response) ([]byte, error) {
+	b, err := ioutil.ReadAll(resp.Body)
+	defer resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != 200 {
+		return nil, responseError(op, resp, b)
+	}
+	return b, nil
+}
+
+// IndexDownloader returns a downloader fetching the index of the
+// repository of client
+func IndexDownloader(client *cm.Client) helm.IndexDownloader {
+	return New(client).DownloadIndex
+}
+
+// checkUpload returns the error of an upload response, ChartMuseum
+// answers 201 on success
+func checkUpload(resp *http.Response) error {
+	defer resp.Body.Close()
+	if resp.StatusCode != 201 {
+		b, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return err
+		}
+		return responseError(cm.OpUpload, resp, b)
+	}
+	return nil
+}
+
+// responseError builds the error of a failed request from the ChartMuseum
+// JSON error body b
+func responseError(op string, resp *http.Response, b []byte) error {
+	var er struct {
+		Error string `json:"error"`
+	}
+	err := json.Unmarshal(b, &er)
+	if err != nil || er.Error == "" {
+		return cm.NewStatusError(op, resp, fmt.Sprintf("could not properly parse response JSON: %s", string(b)))
+	}
+	return cm.NewStatusError(op, resp, er.Error)
+}
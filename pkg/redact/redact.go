@@ -0,0 +1,166 @@
+package redact
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"runtime/debug"
+	"strings"
+	"sync"
+)
+
+// Redacted replaces sensitive values
+const Redacted = "REDACTED"
+
+// SensitiveHeaders are the HTTP headers whose value is always redacted
+var SensitiveHeaders = []string{
+	"Cf-Access-Client-Secret",
+	"Cf-Access-Jwt-Assertion",
+	"Authorization",
+	"Proxy-Authorization",
+	"Cookie",
+	"Set-Cookie",
+}
+
+type (
+	// pattern matches a sensitive value within free text
+	pattern struct {
+		re   *regexp.Regexp
+		repl string
+	}
+
+	// redactedError keeps the original error reachable through errors.Is
+	// and errors.As while only exposing the redacted message
+	redactedError struct {
+		err error
+		msg string
+	}
+
+	writer struct {
+		w io.Writer
+	}
+)
+
+var (
+	patterns = []pattern{
+		// Header lines, as found in request dumps
+		{regexp.MustCompile(`(?im)\b(` + strings.Join(SensitiveHeaders, "|") + `)(\s*:\s*)[^\r\n]+`), "${1}${2}" + Redacted},
+		// Cloudflare Access session cookie
+		{regexp.MustCompile(`(CF_Authorization=)[^;\s"]+`), "${1}" + Redacted},
+		// JWTs, such as Cf-Access-Jwt-Assertion values
+		{regexp.MustCompile(`eyJ[A-Za-z0-9_-]+\.eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`), Redacted},
+		// Passwords in URLs
+		{regexp.MustCompile(`(://[^/\s:@]+:)[^/\s@]+@`), "${1}" + Redacted + "@"},
+	}
+
+	mu      sync.RWMutex
+	secrets = map[string]bool{}
+)
+
+// Secret registers a value that must never be output, such as the
+// Cloudflare Access client secret
+func Secret(values ...string) {
+	mu.Lock()
+	defer mu.Unlock()
+	for _, v := range values {
+		// Short values would redact unrelated text
+		if len(v) >= 4 {
+			secrets[v] = true
+		}
+	}
+}
+
+// Reset forgets the registered secrets
+func Reset() {
+	mu.Lock()
+	defer mu.Unlock()
+	secrets = map[string]bool{}
+}
+
+// String redacts the registered secrets and the well-known sensitive
+// values from s
+func String(s string) string {
+	mu.RLock()
+	for secret := range secrets {
+		s = strings.ReplaceAll(s, secret, Redacted)
+		if escaped := url.QueryEscape(secret); escaped != secret {
+			s = strings.ReplaceAll(s, escaped, Redacted)
+		}
+	}
+	mu.RUnlock()
+	for _, p := range patterns {
+		s = p.re.ReplaceAllString(s, p.repl)
+	}
+	return s
+}
+
+// Error redacts the message of err, which is returned unchanged when there
+// is nothing to redact
+func Error(err error) error {
+	if err == nil {
+		return nil
+	}
+	msg := err.Error()
+	if redacted := String(msg); redacted != msg {
+		return &redactedError{err: err, msg: redacted}
+	}
+	return err
+}
+
+// Error implements error
+func (e *redactedError) Error() string {
+	return e.msg
+}
+
+// Unwrap returns the original error
+func (e *redactedError) Unwrap() error {
+	return e.err
+}
+
+// Writer redacts everything written to w. Each write is redacted on its
+// own, which suits loggers and dumps writing whole records at once.
+func Writer(w io.Writer) io.Writer {
+	if _, ok := w.(*writer); ok {
+		return w
+	}
+	return &writer{w: w}
+}
+
+// Write implements io.Writer
+func (w *writer) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(w.w, String(string(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Header redacts the sensitive headers in place
+func Header(header http.Header) {
+	for _, name := range SensitiveHeaders {
+		if _, ok := header[http.CanonicalHeaderKey(name)]; ok {
+			header.Set(name, Redacted)
+		}
+	}
+}
+
+// URL returns u with its password redacted
+func URL(u *url.URL) string {
+	if u.User == nil {
+		return u.String()
+	}
+	clone := *u
+	clone.User = url.UserPassword(u.User.Username(), Redacted)
+	return clone.String()
+}
+
+// Recover is meant to be deferred in main, it reports panics with their
+// message and stack trace redacted then exits like the runtime does
+func Recover() {
+	if r := recover(); r != nil {
+		fmt.Fprintf(os.Stderr, "panic: %s\n\n%s", String(fmt.Sprint(r)), String(string(debug.Stack())))
+		os.Exit(2)
+	}
+}
@@ -0,0 +1,105 @@
+package sbom
+
+import (
+	"time"
+
+	"helm.sh/helm/v3/pkg/chart"
+)
+
+// CycloneDX JSON encoding, see https://cyclonedx.org/docs/1.5/json/
+
+type (
+	cdxDocument struct {
+		BOMFormat    string          `json:"bomFormat"`
+		SpecVersion  string          `json:"specVersion"`
+		SerialNumber string          `json:"serialNumber"`
+		Version      int             `json:"version"`
+		Metadata     cdxMetadata     `json:"metadata"`
+		Components   []cdxComponent  `json:"components"`
+		Dependencies []cdxDependency `json:"dependencies,omitempty"`
+	}
+
+	cdxMetadata struct {
+		Timestamp string       `json:"timestamp"`
+		Tools     []cdxTool    `json:"tools"`
+		Component cdxComponent `json:"component"`
+	}
+
+	cdxTool struct {
+		Name string `json:"name"`
+	}
+
+	cdxComponent struct {
+		BOMRef      string    `json:"bom-ref,omitempty"`
+		Type        string    `json:"type"`
+		Name        string    `json:"name"`
+		Version     string    `json:"version,omitempty"`
+		Description string    `json:"description,omitempty"`
+		PURL        string    `json:"purl,omitempty"`
+		Hashes      []cdxHash `json:"hashes,omitempty"`
+	}
+
+	cdxHash struct {
+		Alg     string `json:"alg"`
+		Content string `json:"content"`
+	}
+
+	cdxDependency struct {
+		Ref       string   `json:"ref"`
+		DependsOn []string `json:"dependsOn"`
+	}
+)
+
+func cycloneDXDocument(c *chart.Chart, components []component, id string, t time.Time) cdxDocument {
+	root := chartPURL(c)
+	doc := cdxDocument{
+		BOMFormat:    "CycloneDX",
+		SpecVersion:  "1.5",
+		SerialNumber: "urn:uuid:" + id,
+		Version:      1,
+		Metadata: cdxMetadata{
+			Timestamp: t.UTC().Format(time.RFC3339),
+			Tools:     []cdxTool{{Name: "helm-push"}},
+			Component: cdxComponent{
+				BOMRef:      root,
+				Type:        "application",
+				Name:        c.Name(),
+				Version:     c.Metadata.Version,
+				Description: c.Metadata.Description,
+				PURL:        root,
+			},
+		},
+		Components: []cdxComponent{},
+	}
+
+	dependsOn := map[string][]string{}
+	seen := map[string]bool{}
+	var refs []string
+	for _, comp := range components {
+		cc := cdxComponent{Name: comp.name, Version: comp.version, PURL: comp.purl}
+		switch comp.kind {
+		case "chart":
+			cc.Type, cc.BOMRef = "application", comp.purl
+		case "image":
+			cc.Type, cc.BOMRef = "container", comp.purl
+		default:
+			cc.Type = "file"
+			cc.Hashes = []cdxHash{{Alg: "SHA-256", Content: comp.sha256}}
+		}
+		// bom-refs must be unique, shared images are listed once
+		if cc.BOMRef == "" || !seen[cc.BOMRef] {
+			doc.Components = append(doc.Components, cc)
+		}
+		if cc.BOMRef != "" {
+			seen[cc.BOMRef] = true
+			if _, ok := dependsOn[comp.parent]; !ok {
+				refs = append(refs, comp.parent)
+			}
+			dependsOn[comp.parent] = append(dependsOn[comp.parent], cc.BOMRef)
+		}
+	}
+	for _, ref := range refs {
+		doc.Dependencies = append(doc.Dependencies, cdxDependency{Ref: ref, DependsOn: dependsOn[ref]})
+	}
+	return doc
+}
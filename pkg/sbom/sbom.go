@@ -0,0 +1,236 @@
+package sbom
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/IxDay/helm-push-cloudflare-access/pkg/helm"
+	"helm.sh/helm/v3/pkg/chart"
+)
+
+// Supported SBOM formats
+const (
+	FormatCycloneDX = "cyclonedx"
+	FormatSPDX      = "spdx"
+)
+
+// Annotation is the Chart.yaml annotation referencing the embedded SBOM
+const Annotation = "helm-push/sbom"
+
+type (
+	// Options controls the content of the generated document
+	Options struct {
+		// Format is one of FormatCycloneDX or FormatSPDX
+		Format string
+		// Images adds the container images referenced in the values
+		Images bool
+		// Time is the creation time of the document, helm.SourceDate()
+		// when zero so that the document is reproducible
+		Time time.Time
+	}
+
+	// component is a format agnostic entry of the SBOM
+	component struct {
+		kind    string // chart, file or image
+		name    string
+		version string
+		purl    string
+		sha256  string
+		parent  string // purl of the chart holding the component
+	}
+)
+
+// Validate checks the format is supported
+func Validate(format string) error {
+	switch format {
+	case FormatCycloneDX, FormatSPDX:
+		return nil
+	default:
+		return fmt.Errorf("invalid sbom format %q, must be one of: %s, %s", format, FormatCycloneDX, FormatSPDX)
+	}
+}
+
+// FileName returns the name of the SBOM file within the chart package
+func FileName(format string) string {
+	if format == FormatSPDX {
+		return "sbom.spdx.json"
+	}
+	return "sbom.cdx.json"
+}
+
+// Generate builds the SBOM of a chart, its files, its dependencies and
+// optionally the images referenced in its values
+func Generate(c *chart.Chart, opts Options) ([]byte, error) {
+	if err := Validate(opts.Format); err != nil {
+		return nil, err
+	}
+	if opts.Time.IsZero() {
+		t, err := helm.SourceDate()
+		if err != nil {
+			return nil, err
+		}
+		opts.Time = t
+	}
+	components := collect(c, "", opts.Images)
+	id := documentID(c, components)
+	if opts.Format == FormatSPDX {
+		return json.MarshalIndent(spdxDocument(c, components, id, opts.Time), "", "  ")
+	}
+	return json.MarshalIndent(cycloneDXDocument(c, components, id, opts.Time), "", "  ")
+}
+
+// Embed adds the SBOM to the chart files and references it, with its
+// digest, in the chart annotations
+func Embed(c *chart.Chart, format string, data []byte) {
+	name := FileName(format)
+	files := c.Files[:0]
+	for _, f := range c.Files {
+		if f.Name != name {
+			files = append(files, f)
+		}
+	}
+	c.Files = append(files, &chart.File{Name: name, Data: data})
+	if c.Metadata.Annotations == nil {
+		c.Metadata.Annotations = map[string]string{}
+	}
+	c.Metadata.Annotations[Annotation] = fmt.Sprintf("%s#sha256:%x", name, sha256.Sum256(data))
+}
+
+func chartPURL(c *chart.Chart) string {
+	return fmt.Sprintf("pkg:helm/%s@%s", url.PathEscape(c.Name()), url.PathEscape(c.Metadata.Version))
+}
+
+func collect(c *chart.Chart, parent string, images bool) []component {
+	purl := chartPURL(c)
+	components := []component{}
+	if parent != "" {
+		components = append(components, component{kind: "chart", name: c.Name(), version: c.Metadata.Version, purl: purl, parent: parent})
+	}
+	for _, f := range c.Raw {
+		components = append(components, component{
+			kind:   "file",
+			name:   c.Name() + "/" + f.Name,
+			sha256: fmt.Sprintf("%x", sha256.Sum256(f.Data)),
+			parent: purl,
+		})
+	}
+	if images {
+		for _, ref := range Images(c.Values) {
+			name, version := splitImage(ref)
+			components = append(components, component{
+				kind:    "image",
+				name:    name,
+				version: version,
+				purl:    imagePURL(name, version),
+				parent:  purl,
+			})
+		}
+	}
+	for _, dep := range c.Dependencies() {
+		components = append(components, collect(dep, purl, images)...)
+	}
+	return components
+}
+
+// Images returns the sorted image references found in chart values, either
+// as "image: repo:tag" strings or "image: {registry, repository, tag}" maps
+func Images(values map[string]interface{}) []string {
+	seen := map[string]bool{}
+	var walk func(v interface{})
+	walk = func(v interface{}) {
+		switch v := v.(type) {
+		case map[string]interface{}:
+			for k, child := range v {
+				if k == "image" {
+					if ref := imageRef(child); ref != "" {
+						seen[ref] = true
+						continue
+					}
+				}
+				walk(child)
+			}
+		case []interface{}:
+			for _, child := range v {
+				walk(child)
+			}
+		}
+	}
+	walk(values)
+
+	refs := make([]string, 0, len(seen))
+	for ref := range seen {
+		refs = append(refs, ref)
+	}
+	sort.Strings(refs)
+	return refs
+}
+
+func imageRef(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return strings.TrimSpace(v)
+	case map[string]interface{}:
+		repository, _ := v["repository"].(string)
+		if repository == "" {
+			return ""
+		}
+		if registry, _ := v["registry"].(string); registry != "" {
+			repository = strings.TrimSuffix(registry, "/") + "/" + repository
+		}
+		if digest, _ := v["digest"].(string); digest != "" {
+			return repository + "@" + digest
+		}
+		if tag := fmt.Sprint(v["tag"]); v["tag"] != nil && tag != "" {
+			return repository + ":" + tag
+		}
+		return repository
+	}
+	return ""
+}
+
+// splitImage splits an image reference into its name and tag or digest
+func splitImage(ref string) (string, string) {
+	if i := strings.Index(ref, "@"); i >= 0 {
+		return ref[:i], ref[i+1:]
+	}
+	if i := strings.LastIndex(ref, ":"); i > strings.LastIndex(ref, "/") {
+		return ref[:i], ref[i+1:]
+	}
+	return ref, ""
+}
+
+func imagePURL(name, version string) string {
+	purl := "pkg:docker/" + name
+	if version != "" {
+		purl += "@" + url.PathEscape(version)
+	}
+	return purl
+}
+
+// urlNamespace is the RFC 4122 namespace of name based UUIDs built from
+// URLs, package URLs included
+var urlNamespace = []byte{0x6b, 0xa7, 0xb8, 0x11, 0x9d, 0xad, 0x11, 0xd1, 0x80, 0xb4, 0x00, 0xc0, 0x4f, 0xd4, 0x30, 0xc8}
+
+// documentID returns a name based UUID (version 5) identifying the
+// document, derived from the chart and its components so that generating
+// it again for the same content gives the same serial number
+func documentID(c *chart.Chart, components []component) string {
+	h := sha1.New()
+	h.Write(urlNamespace)
+	fmt.Fprintln(h, chartPURL(c))
+	for _, comp := range components {
+		fmt.Fprintln(h, comp.purl, comp.sha256, comp.parent)
+	}
+	b := h.Sum(nil)[:16]
+	b[6] = (b[6] & 0x0f) | 0x50
+	b[8] = (b[8] & 0x3f) | 0x80
+	x := hex.EncodeToString(b)
+	return x[0:8] + "-" + x[8:12] + "-" + x[12:16] + "-" + x[16:20] + "-" + x[20:]
+}
@@ -0,0 +1,176 @@
+package sbom
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"helm.sh/helm/v3/pkg/chart"
+)
+
+func testChart() *chart.Chart {
+	sub := &chart.Chart{
+		Metadata: &chart.Metadata{Name: "redis", Version: "17.0.1"},
+		Raw:      []*chart.File{{Name: "Chart.yaml", Data: []byte("name: redis")}},
+		Values: map[string]interface{}{
+			"image": map[string]interface{}{"registry": "docker.io", "repository": "bitnami/redis", "tag": "7.0.5"},
+		},
+	}
+	c := &chart.Chart{
+		Metadata: &chart.Metadata{Name: "mychart", Version: "0.1.0", Description: "A chart"},
+		Raw: []*chart.File{
+			{Name: "Chart.yaml", Data: []byte("name: mychart")},
+			{Name: "templates/deployment.yaml", Data: []byte("kind: Deployment")},
+		},
+		Values: map[string]interface{}{
+			"image": "nginx:1.25",
+			"sidecars": []interface{}{
+				map[string]interface{}{"image": map[string]interface{}{"repository": "busybox", "digest": "sha256:abc"}},
+			},
+			"replicaCount": 1,
+		},
+	}
+	c.AddDependency(sub)
+	return c
+}
+
+func TestImages(t *testing.T) {
+	images := Images(testChart().Values)
+	expected := []string{"busybox@sha256:abc", "nginx:1.25"}
+	if !reflect.DeepEqual(images, expected) {
+		t.Errorf("expected images %v, got %v", expected, images)
+	}
+}
+
+func TestGenerateCycloneDX(t *testing.T) {
+	b, err := Generate(testChart(), Options{Format: FormatCycloneDX, Images: true, Time: time.Unix(0, 0)})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	var doc cdxDocument
+	if err := json.Unmarshal(b, &doc); err != nil {
+		t.Fatalf("unexpected error decoding document: %s", err)
+	}
+	if doc.BOMFormat != "CycloneDX" || doc.Metadata.Component.PURL != "pkg:helm/mychart@0.1.0" {
+		t.Errorf("unexpected document metadata %+v", doc.Metadata)
+	}
+	if doc.Metadata.Timestamp != "1970-01-01T00:00:00Z" {
+		t.Errorf("unexpected timestamp %s", doc.Metadata.Timestamp)
+	}
+
+	purls := map[string]string{}
+	files := 0
+	for _, c := range doc.Components {
+		if c.Type == "file" {
+			files++
+			if len(c.Hashes) != 1 || len(c.Hashes[0].Content) != 64 {
+				t.Errorf("expected file %s to have a sha256 hash, got %+v", c.Name, c.Hashes)
+			}
+			continue
+		}
+		purls[c.PURL] = c.Type
+	}
+	if files != 3 {
+		t.Errorf("expected 3 files, got %d", files)
+	}
+	expected := map[string]string{
+		"pkg:helm/redis@17.0.1":                    "application",
+		"pkg:docker/nginx@1.25":                    "container",
+		"pkg:docker/busybox@sha256:abc":            "container",
+		"pkg:docker/docker.io/bitnami/redis@7.0.5": "container",
+	}
+	if !reflect.DeepEqual(purls, expected) {
+		t.Errorf("expected components %v, got %v", expected, purls)
+	}
+	if len(doc.Dependencies) != 2 || doc.Dependencies[0].Ref != "pkg:helm/mychart@0.1.0" {
+		t.Errorf("unexpected dependencies %+v", doc.Dependencies)
+	}
+
+	// Images are opt-in
+	b, _ = Generate(testChart(), Options{Format: FormatCycloneDX})
+	if strings.Contains(string(b), "pkg:docker/") {
+		t.Errorf("expected no images without Images option:\n%s", b)
+	}
+}
+
+func TestGenerateSPDX(t *testing.T) {
+	b, err := Generate(testChart(), Options{Format: FormatSPDX, Images: true})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	var doc spdxDoc
+	if err := json.Unmarshal(b, &doc); err != nil {
+		t.Fatalf("unexpected error decoding document: %s", err)
+	}
+	if doc.SPDXVersion != "SPDX-2.3" || doc.Name != "mychart-0.1.0" {
+		t.Errorf("unexpected document %s %s", doc.SPDXVersion, doc.Name)
+	}
+	if len(doc.Packages) != 5 || len(doc.Files) != 3 {
+		t.Errorf("expected 5 packages and 3 files, got %d and %d", len(doc.Packages), len(doc.Files))
+	}
+	ids := map[string]bool{"SPDXRef-DOCUMENT": true}
+	for _, p := range doc.Packages {
+		ids[p.SPDXID] = true
+	}
+	for _, f := range doc.Files {
+		ids[f.SPDXID] = true
+	}
+	for _, r := range doc.Relationships {
+		if !ids[r.SPDXElementID] || !ids[r.RelatedSPDXElement] {
+			t.Errorf("relationship %+v references an unknown element", r)
+		}
+	}
+}
+
+func TestGenerateReproducible(t *testing.T) {
+	defer os.Unsetenv("SOURCE_DATE_EPOCH")
+	os.Setenv("SOURCE_DATE_EPOCH", "1700000000")
+	for _, format := range []string{FormatCycloneDX, FormatSPDX} {
+		first, err := Generate(testChart(), Options{Format: format})
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		second, _ := Generate(testChart(), Options{Format: format})
+		if !bytes.Equal(first, second) {
+			t.Errorf("expected the same %s document for the same chart, got:\n%s\n%s", format, first, second)
+		}
+		if !strings.Contains(string(first), "2023-11-14T22:13:20Z") {
+			t.Errorf("expected the %s document to be dated with SOURCE_DATE_EPOCH:\n%s", format, first)
+		}
+	}
+
+	// Another version is another document
+	c := testChart()
+	c.Metadata.Version = "0.2.0"
+	if documentID(c, nil) == documentID(testChart(), nil) {
+		t.Error("expected another serial number for another version")
+	}
+
+	os.Setenv("SOURCE_DATE_EPOCH", "yesterday")
+	if _, err := Generate(testChart(), Options{Format: FormatCycloneDX}); err == nil {
+		t.Error("expected error with invalid SOURCE_DATE_EPOCH, instead got nil")
+	}
+}
+
+func TestGenerateInvalidFormat(t *testing.T) {
+	if _, err := Generate(testChart(), Options{Format: "swid"}); err == nil {
+		t.Error("expected error with invalid format, instead got nil")
+	}
+}
+
+func TestEmbed(t *testing.T) {
+	c := testChart()
+	Embed(c, FormatCycloneDX, []byte("old"))
+	Embed(c, FormatCycloneDX, []byte("{}"))
+	if len(c.Files) != 1 || c.Files[0].Name != "sbom.cdx.json" || string(c.Files[0].Data) != "{}" {
+		t.Errorf("expected a single embedded sbom, got %+v", c.Files)
+	}
+	expected := "sbom.cdx.json#sha256:44136fa355b3678a1146ad16f7e8649e94fb4fc21fe77e8310c060f61caaff8a"
+	if a := c.Metadata.Annotations[Annotation]; a != expected {
+		t.Errorf("expected annotation %s, got %s", expected, a)
+	}
+}
@@ -0,0 +1,128 @@
+package sbom
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+
+	"helm.sh/helm/v3/pkg/chart"
+)
+
+// SPDX JSON encoding, see https://spdx.github.io/spdx-spec/v2.3/
+
+type (
+	spdxDoc struct {
+		SPDXVersion       string             `json:"spdxVersion"`
+		DataLicense       string             `json:"dataLicense"`
+		SPDXID            string             `json:"SPDXID"`
+		Name              string             `json:"name"`
+		DocumentNamespace string             `json:"documentNamespace"`
+		CreationInfo      spdxCreationInfo   `json:"creationInfo"`
+		Packages          []spdxPackage      `json:"packages"`
+		Files             []spdxFile         `json:"files,omitempty"`
+		Relationships     []spdxRelationship `json:"relationships"`
+	}
+
+	spdxCreationInfo struct {
+		Created  string   `json:"created"`
+		Creators []string `json:"creators"`
+	}
+
+	spdxPackage struct {
+		SPDXID           string            `json:"SPDXID"`
+		Name             string            `json:"name"`
+		VersionInfo      string            `json:"versionInfo,omitempty"`
+		DownloadLocation string            `json:"downloadLocation"`
+		FilesAnalyzed    bool              `json:"filesAnalyzed"`
+		ExternalRefs     []spdxExternalRef `json:"externalRefs,omitempty"`
+	}
+
+	spdxExternalRef struct {
+		ReferenceCategory string `json:"referenceCategory"`
+		ReferenceType     string `json:"referenceType"`
+		ReferenceLocator  string `json:"referenceLocator"`
+	}
+
+	spdxFile struct {
+		SPDXID    string         `json:"SPDXID"`
+		FileName  string         `json:"fileName"`
+		Checksums []spdxChecksum `json:"checksums"`
+	}
+
+	spdxChecksum struct {
+		Algorithm     string `json:"algorithm"`
+		ChecksumValue string `json:"checksumValue"`
+	}
+
+	spdxRelationship struct {
+		SPDXElementID      string `json:"spdxElementId"`
+		RelationshipType   string `json:"relationshipType"`
+		RelatedSPDXElement string `json:"relatedSpdxElement"`
+	}
+)
+
+var spdxIDInvalid = regexp.MustCompile(`[^a-zA-Z0-9.-]+`)
+
+func spdxID(kind, name string) string {
+	return "SPDXRef-" + kind + "-" + spdxIDInvalid.ReplaceAllString(name, "-")
+}
+
+func spdxPackageOf(name, version, purl string) spdxPackage {
+	return spdxPackage{
+		SPDXID:           spdxID("Package", purl),
+		Name:             name,
+		VersionInfo:      version,
+		DownloadLocation: "NOASSERTION",
+		ExternalRefs: []spdxExternalRef{{
+			ReferenceCategory: "PACKAGE-MANAGER",
+			ReferenceType:     "purl",
+			ReferenceLocator:  purl,
+		}},
+	}
+}
+
+func spdxDocument(c *chart.Chart, components []component, id string, t time.Time) spdxDoc {
+	root := chartPURL(c)
+	doc := spdxDoc{
+		SPDXVersion:       "SPDX-2.3",
+		DataLicense:       "CC0-1.0",
+		SPDXID:            "SPDXRef-DOCUMENT",
+		Name:              fmt.Sprintf("%s-%s", c.Name(), c.Metadata.Version),
+		DocumentNamespace: fmt.Sprintf("https://spdx.org/spdxdocs/helm-push/%s-%s-%s", c.Name(), c.Metadata.Version, id),
+		CreationInfo: spdxCreationInfo{
+			Created:  t.UTC().Format(time.RFC3339),
+			Creators: []string{"Tool: helm-push"},
+		},
+		Packages: []spdxPackage{spdxPackageOf(c.Name(), c.Metadata.Version, root)},
+		Relationships: []spdxRelationship{{
+			SPDXElementID:      "SPDXRef-DOCUMENT",
+			RelationshipType:   "DESCRIBES",
+			RelatedSPDXElement: spdxID("Package", root),
+		}},
+	}
+
+	seen := map[string]bool{root: true}
+	for _, comp := range components {
+		parent := spdxID("Package", comp.parent)
+		if comp.kind == "file" {
+			id := spdxID("File", comp.name)
+			doc.Files = append(doc.Files, spdxFile{
+				SPDXID:    id,
+				FileName:  comp.name,
+				Checksums: []spdxChecksum{{Algorithm: "SHA256", ChecksumValue: comp.sha256}},
+			})
+			doc.Relationships = append(doc.Relationships, spdxRelationship{
+				SPDXElementID: parent, RelationshipType: "CONTAINS", RelatedSPDXElement: id,
+			})
+			continue
+		}
+		if !seen[comp.purl] {
+			seen[comp.purl] = true
+			doc.Packages = append(doc.Packages, spdxPackageOf(comp.name, comp.version, comp.purl))
+		}
+		doc.Relationships = append(doc.Relationships, spdxRelationship{
+			SPDXElementID: parent, RelationshipType: "DEPENDS_ON", RelatedSPDXElement: spdxID("Package", comp.purl),
+		})
+	}
+	return doc
+}
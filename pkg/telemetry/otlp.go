@@ -0,0 +1,230 @@
+package telemetry
+
+import (
+	"sort"
+	"strconv"
+	"time"
+)
+
+// OTLP JSON encoding, see https://opentelemetry.io/docs/specs/otlp/#json-protobuf-encoding
+
+const (
+	spanKindInternal = 1
+	statusCodeOK     = 1
+	statusCodeError  = 2
+
+	aggregationTemporalityDelta = 1
+)
+
+type (
+	resource struct {
+		Attributes []attribute `json:"attributes"`
+	}
+
+	scope struct {
+		Name string `json:"name"`
+	}
+
+	attribute struct {
+		Key   string         `json:"key"`
+		Value attributeValue `json:"value"`
+	}
+
+	attributeValue struct {
+		StringValue string `json:"stringValue"`
+	}
+
+	tracesPayload struct {
+		ResourceSpans []resourceSpans `json:"resourceSpans"`
+	}
+
+	resourceSpans struct {
+		Resource   resource     `json:"resource"`
+		ScopeSpans []scopeSpans `json:"scopeSpans"`
+	}
+
+	scopeSpans struct {
+		Scope scope      `json:"scope"`
+		Spans []spanJSON `json:"spans"`
+	}
+
+	spanJSON struct {
+		TraceID           string      `json:"traceId"`
+		SpanID            string      `json:"spanId"`
+		ParentSpanID      string      `json:"parentSpanId,omitempty"`
+		Name              string      `json:"name"`
+		Kind              int         `json:"kind"`
+		StartTimeUnixNano string      `json:"startTimeUnixNano"`
+		EndTimeUnixNano   string      `json:"endTimeUnixNano"`
+		Attributes        []attribute `json:"attributes,omitempty"`
+		Status            status      `json:"status"`
+	}
+
+	status struct {
+		Code    int    `json:"code"`
+		Message string `json:"message,omitempty"`
+	}
+
+	metricsPayload struct {
+		ResourceMetrics []resourceMetrics `json:"resourceMetrics"`
+	}
+
+	resourceMetrics struct {
+		Resource     resource       `json:"resource"`
+		ScopeMetrics []scopeMetrics `json:"scopeMetrics"`
+	}
+
+	scopeMetrics struct {
+		Scope   scope        `json:"scope"`
+		Metrics []metricJSON `json:"metrics"`
+	}
+
+	metricJSON struct {
+		Name      string         `json:"name"`
+		Unit      string         `json:"unit,omitempty"`
+		Sum       *sumJSON       `json:"sum,omitempty"`
+		Gauge     *gaugeJSON     `json:"gauge,omitempty"`
+		Histogram *histogramJSON `json:"histogram,omitempty"`
+	}
+
+	sumJSON struct {
+		DataPoints             []dataPoint `json:"dataPoints"`
+		AggregationTemporality int         `json:"aggregationTemporality"`
+		IsMonotonic            bool        `json:"isMonotonic"`
+	}
+
+	gaugeJSON struct {
+		DataPoints []dataPoint `json:"dataPoints"`
+	}
+
+	histogramJSON struct {
+		DataPoints             []histogramPoint `json:"dataPoints"`
+		AggregationTemporality int              `json:"aggregationTemporality"`
+	}
+
+	histogramPoint struct {
+		Attributes        []attribute `json:"attributes,omitempty"`
+		StartTimeUnixNano string      `json:"startTimeUnixNano"`
+		TimeUnixNano      string      `json:"timeUnixNano"`
+		Count             string      `json:"count"`
+		Sum               float64     `json:"sum"`
+		BucketCounts      []string    `json:"bucketCounts"`
+		ExplicitBounds    []float64   `json:"explicitBounds"`
+		Min               float64     `json:"min"`
+		Max               float64     `json:"max"`
+	}
+
+	dataPoint struct {
+		Attributes        []attribute `json:"attributes,omitempty"`
+		StartTimeUnixNano string      `json:"startTimeUnixNano,omitempty"`
+		TimeUnixNano      string      `json:"timeUnixNano"`
+		AsInt             string      `json:"asInt,omitempty"`
+		AsDouble          *float64    `json:"asDouble,omitempty"`
+	}
+
+	metric struct {
+		name        string
+		unit        string
+		sum         bool
+		intValue    int64
+		doubleValue float64
+		bounds      []float64 // histogram bucket bounds, nil for others
+		attrs       map[string]string
+		time        time.Time
+	}
+)
+
+func stringAttribute(key, value string) attribute {
+	return attribute{Key: key, Value: attributeValue{StringValue: value}}
+}
+
+func attributes(kv map[string]string) []attribute {
+	attrs := make([]attribute, 0, len(kv))
+	for k, v := range kv {
+		attrs = append(attrs, stringAttribute(k, v))
+	}
+	return attrs
+}
+
+func unixNano(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
+
+func (e *Exporter) tracesPayload(spans []*Span) tracesPayload {
+	out := make([]spanJSON, 0, len(spans))
+	for _, s := range spans {
+		st := status{Code: statusCodeOK}
+		if s.err != nil {
+			st = status{Code: statusCodeError, Message: s.err.Error()}
+		}
+		out = append(out, spanJSON{
+			TraceID:           s.traceID,
+			SpanID:            s.spanID,
+			ParentSpanID:      s.parentID,
+			Name:              s.name,
+			Kind:              spanKindInternal,
+			StartTimeUnixNano: unixNano(s.start),
+			EndTimeUnixNano:   unixNano(s.end),
+			Attributes:        s.attrs,
+			Status:            st,
+		})
+	}
+	return tracesPayload{ResourceSpans: []resourceSpans{{
+		Resource:   e.resource,
+		ScopeSpans: []scopeSpans{{Scope: scope{Name: scopeName}, Spans: out}},
+	}}}
+}
+
+func (e *Exporter) metricsPayload(metrics []metric) metricsPayload {
+	out := make([]metricJSON, 0, len(metrics))
+	for _, m := range metrics {
+		m := m
+		point := dataPoint{Attributes: attributes(m.attrs), TimeUnixNano: unixNano(m.time)}
+		mj := metricJSON{Name: m.name, Unit: m.unit}
+		switch {
+		case m.bounds != nil:
+			mj.Histogram = &histogramJSON{
+				DataPoints:             []histogramPoint{histogram(m)},
+				AggregationTemporality: aggregationTemporalityDelta,
+			}
+		case m.sum:
+			point.AsInt = strconv.FormatInt(m.intValue, 10)
+			point.StartTimeUnixNano = point.TimeUnixNano
+			mj.Sum = &sumJSON{
+				DataPoints:             []dataPoint{point},
+				AggregationTemporality: aggregationTemporalityDelta,
+				IsMonotonic:            true,
+			}
+		default:
+			point.AsDouble = &m.doubleValue
+			mj.Gauge = &gaugeJSON{DataPoints: []dataPoint{point}}
+		}
+		out = append(out, mj)
+	}
+	return metricsPayload{ResourceMetrics: []resourceMetrics{{
+		Resource:     e.resource,
+		ScopeMetrics: []scopeMetrics{{Scope: scope{Name: scopeName}, Metrics: out}},
+	}}}
+}
+
+// histogram returns the data point of a histogram holding the single
+// value of m
+func histogram(m metric) histogramPoint {
+	counts := make([]string, len(m.bounds)+1)
+	bucket := sort.SearchFloat64s(m.bounds, m.doubleValue)
+	for i := range counts {
+		counts[i] = "0"
+	}
+	counts[bucket] = "1"
+	return histogramPoint{
+		Attributes:        attributes(m.attrs),
+		StartTimeUnixNano: unixNano(m.time),
+		TimeUnixNano:      unixNano(m.time),
+		Count:             "1",
+		Sum:               m.doubleValue,
+		BucketCounts:      counts,
+		ExplicitBounds:    m.bounds,
+		Min:               m.doubleValue,
+		Max:               m.doubleValue,
+	}
+}
@@ -0,0 +1,195 @@
+package telemetry
+
+import (
+	"encoding/hex"
+	"math"
+	"strconv"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// OTLP protobuf encoding of the payloads, see
+// https://github.com/open-telemetry/opentelemetry-proto for the messages and
+// their field numbers. Only the fields of the JSON payloads are encoded.
+
+func (p tracesPayload) marshalProto() []byte {
+	var b []byte
+	for _, rs := range p.ResourceSpans {
+		b = appendMessage(b, 1, rs.marshalProto())
+	}
+	return b
+}
+
+func (rs resourceSpans) marshalProto() []byte {
+	b := appendMessage(nil, 1, rs.Resource.marshalProto())
+	for _, ss := range rs.ScopeSpans {
+		m := appendMessage(nil, 1, ss.Scope.marshalProto())
+		for _, s := range ss.Spans {
+			m = appendMessage(m, 2, s.marshalProto())
+		}
+		b = appendMessage(b, 2, m)
+	}
+	return b
+}
+
+func (s spanJSON) marshalProto() []byte {
+	b := appendHex(nil, 1, s.TraceID)
+	b = appendHex(b, 2, s.SpanID)
+	b = appendHex(b, 4, s.ParentSpanID)
+	b = appendString(b, 5, s.Name)
+	b = appendVarint(b, 6, uint64(s.Kind))
+	b = appendNano(b, 7, s.StartTimeUnixNano)
+	b = appendNano(b, 8, s.EndTimeUnixNano)
+	b = appendAttributes(b, 9, s.Attributes)
+	st := appendString(nil, 2, s.Status.Message)
+	st = appendVarint(st, 3, uint64(s.Status.Code))
+	return appendMessage(b, 15, st)
+}
+
+func (p metricsPayload) marshalProto() []byte {
+	var b []byte
+	for _, rm := range p.ResourceMetrics {
+		b = appendMessage(b, 1, rm.marshalProto())
+	}
+	return b
+}
+
+func (rm resourceMetrics) marshalProto() []byte {
+	b := appendMessage(nil, 1, rm.Resource.marshalProto())
+	for _, sm := range rm.ScopeMetrics {
+		m := appendMessage(nil, 1, sm.Scope.marshalProto())
+		for _, metric := range sm.Metrics {
+			m = appendMessage(m, 2, metric.marshalProto())
+		}
+		b = appendMessage(b, 2, m)
+	}
+	return b
+}
+
+func (m metricJSON) marshalProto() []byte {
+	b := appendString(nil, 1, m.Name)
+	b = appendString(b, 3, m.Unit)
+	switch {
+	case m.Gauge != nil:
+		var g []byte
+		for _, p := range m.Gauge.DataPoints {
+			g = appendMessage(g, 1, p.marshalProto())
+		}
+		b = appendMessage(b, 5, g)
+	case m.Sum != nil:
+		var s []byte
+		for _, p := range m.Sum.DataPoints {
+			s = appendMessage(s, 1, p.marshalProto())
+		}
+		s = appendVarint(s, 2, uint64(m.Sum.AggregationTemporality))
+		if m.Sum.IsMonotonic {
+			s = appendVarint(s, 3, 1)
+		}
+		b = appendMessage(b, 7, s)
+	case m.Histogram != nil:
+		var h []byte
+		for _, p := range m.Histogram.DataPoints {
+			h = appendMessage(h, 1, p.marshalProto())
+		}
+		h = appendVarint(h, 2, uint64(m.Histogram.AggregationTemporality))
+		b = appendMessage(b, 9, h)
+	}
+	return b
+}
+
+func (p dataPoint) marshalProto() []byte {
+	b := appendNano(nil, 2, p.StartTimeUnixNano)
+	b = appendNano(b, 3, p.TimeUnixNano)
+	if p.AsDouble != nil {
+		b = appendDouble(b, 4, *p.AsDouble)
+	}
+	if p.AsInt != "" {
+		v, _ := strconv.ParseInt(p.AsInt, 10, 64)
+		b = protowire.AppendTag(b, 6, protowire.Fixed64Type)
+		b = protowire.AppendFixed64(b, uint64(v))
+	}
+	return appendAttributes(b, 7, p.Attributes)
+}
+
+func (p histogramPoint) marshalProto() []byte {
+	b := appendNano(nil, 2, p.StartTimeUnixNano)
+	b = appendNano(b, 3, p.TimeUnixNano)
+	b = appendNano(b, 4, p.Count)
+	b = appendDouble(b, 5, p.Sum)
+	var counts, bounds []byte
+	for _, c := range p.BucketCounts {
+		v, _ := strconv.ParseUint(c, 10, 64)
+		counts = protowire.AppendFixed64(counts, v)
+	}
+	for _, v := range p.ExplicitBounds {
+		bounds = protowire.AppendFixed64(bounds, math.Float64bits(v))
+	}
+	b = appendMessage(b, 6, counts)
+	b = appendMessage(b, 7, bounds)
+	b = appendAttributes(b, 9, p.Attributes)
+	b = appendDouble(b, 11, p.Min)
+	return appendDouble(b, 12, p.Max)
+}
+
+func (r resource) marshalProto() []byte {
+	return appendAttributes(nil, 1, r.Attributes)
+}
+
+func (s scope) marshalProto() []byte {
+	return appendString(nil, 1, s.Name)
+}
+
+func appendAttributes(b []byte, num protowire.Number, attrs []attribute) []byte {
+	for _, a := range attrs {
+		kv := appendString(nil, 1, a.Key)
+		kv = appendMessage(kv, 2, appendString(nil, 1, a.Value.StringValue))
+		b = appendMessage(b, num, kv)
+	}
+	return b
+}
+
+// appendMessage appends a length delimited field: embedded messages,
+// packed repeated fields, strings and bytes
+func appendMessage(b []byte, num protowire.Number, v []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, v)
+}
+
+// appendString appends a string field, omitted when empty as proto3 does
+func appendString(b []byte, num protowire.Number, v string) []byte {
+	if v == "" {
+		return b
+	}
+	return appendMessage(b, num, []byte(v))
+}
+
+// appendHex appends a bytes field from its hex encoding, trace and span
+// IDs being hex encoded in JSON
+func appendHex(b []byte, num protowire.Number, v string) []byte {
+	id, err := hex.DecodeString(v)
+	if err != nil || len(id) == 0 {
+		return b
+	}
+	return appendMessage(b, num, id)
+}
+
+func appendVarint(b []byte, num protowire.Number, v uint64) []byte {
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, v)
+}
+
+// appendNano appends a fixed64 field from its decimal encoding, 64 bits
+// integers being strings in JSON
+func appendNano(b []byte, num protowire.Number, v string) []byte {
+	n, err := strconv.ParseUint(v, 10, 64)
+	if err != nil {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.Fixed64Type)
+	return protowire.AppendFixed64(b, n)
+}
+
+func appendDouble(b []byte, num protowire.Number, v float64) []byte {
+	b = protowire.AppendTag(b, num, protowire.Fixed64Type)
+	return protowire.AppendFixed64(b, math.Float64bits(v))
+}
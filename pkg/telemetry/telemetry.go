@@ -0,0 +1,338 @@
+package telemetry
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultServiceName = "helm-push"
+	scopeName          = "github.com/IxDay/helm-push-cloudflare-access"
+)
+
+type (
+	// Exporter collects spans and metrics during a run and sends them to an
+	// OTLP/HTTP endpoint (protobuf or JSON encoding) on Shutdown. A nil
+	// *Exporter is valid and records nothing.
+	Exporter struct {
+		traces   signal
+		metrics  signal
+		client   *http.Client
+		resource resource
+
+		traceID  string
+		parentID string
+
+		mu       sync.Mutex
+		spans    []*Span
+		recorded []metric
+	}
+
+	// signal is the export configuration of traces or metrics, the
+	// signal is not exported without url
+	signal struct {
+		url      string
+		protocol string
+		headers  map[string]string
+		timeout  time.Duration
+	}
+
+	// payload is a request body, encoded according to the protocol
+	payload interface {
+		marshalProto() []byte
+	}
+
+	// Span is a timed operation, a nil *Span is valid and records nothing
+	Span struct {
+		exporter *Exporter
+		traceID  string
+		spanID   string
+		parentID string
+		name     string
+		start    time.Time
+		end      time.Time
+		attrs    []attribute
+		err      error
+	}
+)
+
+// FromEnv configures an exporter from the standard OTEL_* environment
+// variables, it returns nil when no OTLP endpoint is configured. An error
+// is returned for unsupported protocols, http/protobuf and http/json being
+// the ones spoken.
+func FromEnv() (*Exporter, error) {
+	if v, _ := strconv.ParseBool(os.Getenv("OTEL_SDK_DISABLED")); v {
+		return nil, nil
+	}
+
+	traces, err := signalFromEnv("TRACES", "v1/traces")
+	if err != nil {
+		return nil, err
+	}
+	metrics, err := signalFromEnv("METRICS", "v1/metrics")
+	if err != nil {
+		return nil, err
+	}
+	if traces.url == "" && metrics.url == "" {
+		return nil, nil
+	}
+
+	e := &Exporter{
+		traces:  traces,
+		metrics: metrics,
+		client:  &http.Client{},
+		traceID: randomHex(16),
+	}
+
+	attrs, err := parseKeyValues(os.Getenv("OTEL_RESOURCE_ATTRIBUTES"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid OTEL_RESOURCE_ATTRIBUTES: %s", err)
+	}
+	if v := os.Getenv("OTEL_SERVICE_NAME"); v != "" {
+		attrs["service.name"] = v
+	} else if _, ok := attrs["service.name"]; !ok {
+		attrs["service.name"] = defaultServiceName
+	}
+	for k, v := range attrs {
+		e.resource.Attributes = append(e.resource.Attributes, stringAttribute(k, v))
+	}
+
+	// Join the trace of the calling CI pipeline when it propagates one
+	if traceID, parentID, ok := parseTraceparent(os.Getenv("TRACEPARENT")); ok {
+		e.traceID, e.parentID = traceID, parentID
+	}
+	return e, nil
+}
+
+// signalFromEnv reads the export configuration of a signal, the signal
+// specific variables taking precedence over the generic ones
+func signalFromEnv(name, path string) (signal, error) {
+	sig := signal{url: signalURL(name, path), protocol: signalEnv(name, "PROTOCOL")}
+	if sig.url == "" {
+		return sig, nil
+	}
+	switch sig.protocol {
+	case "":
+		sig.protocol = "http/protobuf"
+	case "http/protobuf", "http/json":
+	default:
+		return sig, fmt.Errorf("OTLP protocol %s is not supported, use http/protobuf or http/json", sig.protocol)
+	}
+
+	sig.timeout = 10 * time.Second
+	if v := signalEnv(name, "TIMEOUT"); v != "" {
+		ms, err := strconv.Atoi(v)
+		if err != nil {
+			return sig, fmt.Errorf("invalid OTLP timeout: %s", err)
+		}
+		sig.timeout = time.Duration(ms) * time.Millisecond
+	}
+
+	var err error
+	if sig.headers, err = parseKeyValues(signalEnv(name, "HEADERS")); err != nil {
+		return sig, fmt.Errorf("invalid OTLP headers: %s", err)
+	}
+	return sig, nil
+}
+
+// signalURL resolves the endpoint of a signal following the OTLP exporter
+// specification: the signal specific variable is used as is while the
+// generic one gets the signal path appended.
+func signalURL(signal, path string) string {
+	if v := os.Getenv("OTEL_EXPORTER_OTLP_" + signal + "_ENDPOINT"); v != "" {
+		return v
+	}
+	if v := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"); v != "" {
+		return strings.TrimSuffix(v, "/") + "/" + path
+	}
+	return ""
+}
+
+// signalEnv returns the OTEL_EXPORTER_OTLP_<signal>_<setting> variable,
+// falling back to OTEL_EXPORTER_OTLP_<setting>
+func signalEnv(signal, setting string) string {
+	if v := os.Getenv("OTEL_EXPORTER_OTLP_" + signal + "_" + setting); v != "" {
+		return v
+	}
+	return os.Getenv("OTEL_EXPORTER_OTLP_" + setting)
+}
+
+// StartSpan starts a span, child of parent if not nil
+func (e *Exporter) StartSpan(name string, parent *Span) *Span {
+	return e.StartSpanAt(name, parent, time.Now())
+}
+
+// StartSpanAt starts a span at start, for operations timed by others
+func (e *Exporter) StartSpanAt(name string, parent *Span, start time.Time) *Span {
+	if e == nil {
+		return nil
+	}
+	s := &Span{
+		exporter: e,
+		traceID:  e.traceID,
+		spanID:   randomHex(8),
+		parentID: e.parentID,
+		name:     name,
+		start:    start,
+	}
+	if parent != nil {
+		s.parentID = parent.spanID
+	}
+	return s
+}
+
+// SetAttribute adds a string attribute to the span
+func (s *Span) SetAttribute(key, value string) {
+	if s == nil {
+		return
+	}
+	s.attrs = append(s.attrs, stringAttribute(key, value))
+}
+
+// End stops the span, a non nil err marks it as failed
+func (s *Span) End(err error) {
+	if s == nil {
+		return
+	}
+	s.end = time.Now()
+	s.err = err
+	s.exporter.mu.Lock()
+	s.exporter.spans = append(s.exporter.spans, s)
+	s.exporter.mu.Unlock()
+}
+
+// Count records a monotonic counter increment
+func (e *Exporter) Count(name string, value int64, attrs map[string]string) {
+	e.record(metric{name: name, unit: "1", intValue: value, attrs: attrs, sum: true})
+}
+
+// Gauge records a point in time measurement
+func (e *Exporter) Gauge(name, unit string, value float64, attrs map[string]string) {
+	e.record(metric{name: name, unit: unit, doubleValue: value, attrs: attrs})
+}
+
+// Histogram records a measurement into buckets bounded by bounds, in
+// increasing order, so that backends aggregate its distribution
+func (e *Exporter) Histogram(name, unit string, value float64, bounds []float64, attrs map[string]string) {
+	e.record(metric{name: name, unit: unit, doubleValue: value, bounds: bounds, attrs: attrs})
+}
+
+func (e *Exporter) record(m metric) {
+	if e == nil {
+		return
+	}
+	m.time = time.Now()
+	e.mu.Lock()
+	e.recorded = append(e.recorded, m)
+	e.mu.Unlock()
+}
+
+// Shutdown exports everything recorded so far
+func (e *Exporter) Shutdown(ctx context.Context) error {
+	if e == nil {
+		return nil
+	}
+	e.mu.Lock()
+	spans, metrics := e.spans, e.recorded
+	e.spans, e.recorded = nil, nil
+	e.mu.Unlock()
+
+	if len(spans) > 0 && e.traces.url != "" {
+		if err := e.post(ctx, e.traces, e.tracesPayload(spans)); err != nil {
+			return fmt.Errorf("exporting traces: %s", err)
+		}
+	}
+	if len(metrics) > 0 && e.metrics.url != "" {
+		if err := e.post(ctx, e.metrics, e.metricsPayload(metrics)); err != nil {
+			return fmt.Errorf("exporting metrics: %s", err)
+		}
+	}
+	return nil
+}
+
+func (e *Exporter) post(ctx context.Context, sig signal, p payload) error {
+	b, contentType := p.marshalProto(), "application/x-protobuf"
+	if sig.protocol == "http/json" {
+		var err error
+		if b, err = json.Marshal(p); err != nil {
+			return err
+		}
+		contentType = "application/json"
+	}
+	ctx, cancel := context.WithTimeout(ctx, sig.timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "POST", sig.url, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	for k, v := range sig.headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// parseKeyValues parses the "key1=value1,key2=value2" format used by the
+// OTEL_* variables, values are URL encoded
+func parseKeyValues(s string) (map[string]string, error) {
+	kv := map[string]string{}
+	for _, pair := range strings.Split(s, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("missing '=' in %q", pair)
+		}
+		value, err := url.QueryUnescape(strings.TrimSpace(parts[1]))
+		if err != nil {
+			return nil, err
+		}
+		kv[strings.TrimSpace(parts[0])] = value
+	}
+	return kv, nil
+}
+
+// parseTraceparent extracts the trace and parent span IDs of a W3C
+// traceparent header value
+func parseTraceparent(s string) (string, string, bool) {
+	parts := strings.Split(strings.TrimSpace(s), "-")
+	if len(parts) != 4 || len(parts[1]) != 32 || len(parts[2]) != 16 {
+		return "", "", false
+	}
+	if _, err := hex.DecodeString(parts[1] + parts[2]); err != nil {
+		return "", "", false
+	}
+	if parts[1] == strings.Repeat("0", 32) || parts[2] == strings.Repeat("0", 16) {
+		return "", "", false
+	}
+	return parts[1], parts[2], true
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,273 @@
+package telemetry
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+func clearEnv() {
+	for _, name := range []string{
+		"OTEL_SDK_DISABLED",
+		"OTEL_EXPORTER_OTLP_ENDPOINT",
+		"OTEL_EXPORTER_OTLP_TRACES_ENDPOINT",
+		"OTEL_EXPORTER_OTLP_METRICS_ENDPOINT",
+		"OTEL_EXPORTER_OTLP_PROTOCOL",
+		"OTEL_EXPORTER_OTLP_TRACES_PROTOCOL",
+		"OTEL_EXPORTER_OTLP_METRICS_PROTOCOL",
+		"OTEL_EXPORTER_OTLP_HEADERS",
+		"OTEL_EXPORTER_OTLP_TRACES_HEADERS",
+		"OTEL_EXPORTER_OTLP_METRICS_HEADERS",
+		"OTEL_EXPORTER_OTLP_TIMEOUT",
+		"OTEL_EXPORTER_OTLP_TRACES_TIMEOUT",
+		"OTEL_EXPORTER_OTLP_METRICS_TIMEOUT",
+		"OTEL_RESOURCE_ATTRIBUTES",
+		"OTEL_SERVICE_NAME",
+		"TRACEPARENT",
+	} {
+		os.Unsetenv(name)
+	}
+}
+
+func TestFromEnv(t *testing.T) {
+	clearEnv()
+	defer clearEnv()
+
+	// Nothing configured
+	e, err := FromEnv()
+	if err != nil || e != nil {
+		t.Fatalf("expected no exporter without endpoint, got %v, %v", e, err)
+	}
+	// A nil exporter is usable
+	e.StartSpan("noop", nil).End(nil)
+	e.Count("noop", 1, nil)
+	if err := e.Shutdown(context.Background()); err != nil {
+		t.Errorf("unexpected error shutting down nil exporter: %s", err)
+	}
+
+	// Unsupported protocol
+	os.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "http://localhost:4318/")
+	os.Setenv("OTEL_EXPORTER_OTLP_PROTOCOL", "grpc")
+	if _, err := FromEnv(); err == nil {
+		t.Error("expected error with grpc protocol, instead got nil")
+	}
+	os.Setenv("OTEL_EXPORTER_OTLP_PROTOCOL", "http/json")
+	os.Setenv("OTEL_EXPORTER_OTLP_METRICS_PROTOCOL", "grpc")
+	if _, err := FromEnv(); err == nil {
+		t.Error("expected error with the grpc metrics protocol, instead got nil")
+	}
+	os.Unsetenv("OTEL_EXPORTER_OTLP_METRICS_PROTOCOL")
+	os.Unsetenv("OTEL_EXPORTER_OTLP_PROTOCOL")
+
+	// Signal specific settings
+	os.Setenv("OTEL_EXPORTER_OTLP_TRACES_PROTOCOL", "http/json")
+	os.Setenv("OTEL_EXPORTER_OTLP_HEADERS", "x-api-key=generic")
+	os.Setenv("OTEL_EXPORTER_OTLP_METRICS_HEADERS", "x-api-key=metrics")
+	os.Setenv("OTEL_EXPORTER_OTLP_TIMEOUT", "2000")
+	os.Setenv("OTEL_EXPORTER_OTLP_TRACES_TIMEOUT", "500")
+	e, err = FromEnv()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if e.traces.protocol != "http/json" || e.metrics.protocol != "http/protobuf" {
+		t.Errorf("expected http/json traces and the default http/protobuf metrics, got %s and %s", e.traces.protocol, e.metrics.protocol)
+	}
+	if e.traces.headers["x-api-key"] != "generic" || e.metrics.headers["x-api-key"] != "metrics" {
+		t.Errorf("unexpected headers %v and %v", e.traces.headers, e.metrics.headers)
+	}
+	if e.traces.timeout != 500*time.Millisecond || e.metrics.timeout != 2*time.Second {
+		t.Errorf("unexpected timeouts %s and %s", e.traces.timeout, e.metrics.timeout)
+	}
+	os.Setenv("OTEL_EXPORTER_OTLP_METRICS_TIMEOUT", "soon")
+	if _, err := FromEnv(); err == nil {
+		t.Error("expected error with an invalid timeout, instead got nil")
+	}
+	clearEnv()
+	os.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "http://localhost:4318/")
+
+	// Generic and signal specific endpoints
+	os.Setenv("OTEL_EXPORTER_OTLP_METRICS_ENDPOINT", "http://metrics:4318/custom")
+	os.Setenv("TRACEPARENT", "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")
+	e, err = FromEnv()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if e.traces.url != "http://localhost:4318/v1/traces" {
+		t.Errorf("unexpected traces URL %s", e.traces.url)
+	}
+	if e.metrics.url != "http://metrics:4318/custom" {
+		t.Errorf("unexpected metrics URL %s", e.metrics.url)
+	}
+	if e.traceID != "0af7651916cd43dd8448eb211c80319c" || e.parentID != "b7ad6b7169203331" {
+		t.Errorf("expected trace to be joined from TRACEPARENT, got %s/%s", e.traceID, e.parentID)
+	}
+
+	// Disabled
+	os.Setenv("OTEL_SDK_DISABLED", "true")
+	if e, _ := FromEnv(); e != nil {
+		t.Error("expected no exporter when the SDK is disabled")
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	clearEnv()
+	defer clearEnv()
+
+	var traces tracesPayload
+	var metrics metricsPayload
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Api-Key") != "s3cr=t" {
+			w.WriteHeader(401)
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/traces":
+			json.NewDecoder(r.Body).Decode(&traces)
+		case "/v1/metrics":
+			json.NewDecoder(r.Body).Decode(&metrics)
+		default:
+			w.WriteHeader(404)
+		}
+	}))
+	defer ts.Close()
+
+	os.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", ts.URL)
+	os.Setenv("OTEL_EXPORTER_OTLP_PROTOCOL", "http/json")
+	os.Setenv("OTEL_EXPORTER_OTLP_HEADERS", "x-api-key=s3cr%3Dt")
+	os.Setenv("OTEL_SERVICE_NAME", "release-pipeline")
+	e, err := FromEnv()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	root := e.StartSpan("helm push", nil)
+	root.SetAttribute("helm.chart.name", "mychart")
+	e.StartSpan("upload", root).End(nil)
+	root.End(errors.New("409: package already exists"))
+	e.Count("helm_push.pushes", 1, map[string]string{"result": "failure"})
+	e.Histogram("helm_push.push.duration", "s", 3, []float64{1, 5, 10}, nil)
+
+	if err := e.Shutdown(context.Background()); err != nil {
+		t.Fatalf("unexpected error exporting: %s", err)
+	}
+
+	if len(traces.ResourceSpans) != 1 {
+		t.Fatalf("expected traces to be exported, got %+v", traces)
+	}
+	rs := traces.ResourceSpans[0]
+	if len(rs.Resource.Attributes) != 1 || rs.Resource.Attributes[0].Value.StringValue != "release-pipeline" {
+		t.Errorf("unexpected resource %+v", rs.Resource)
+	}
+	spans := rs.ScopeSpans[0].Spans
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 spans, got %d", len(spans))
+	}
+	upload, push := spans[0], spans[1]
+	if upload.ParentSpanID != push.SpanID || push.ParentSpanID != "" {
+		t.Errorf("expected upload to be child of the root span, got %+v", spans)
+	}
+	if push.Status.Code != statusCodeError || upload.Status.Code != statusCodeOK {
+		t.Errorf("unexpected span statuses %+v", spans)
+	}
+
+	if len(metrics.ResourceMetrics) != 1 {
+		t.Fatalf("expected metrics to be exported, got %+v", metrics)
+	}
+	m := metrics.ResourceMetrics[0].ScopeMetrics[0].Metrics[0]
+	if m.Name != "helm_push.pushes" || m.Sum == nil || m.Sum.DataPoints[0].AsInt != "1" {
+		t.Errorf("unexpected metric %+v", m)
+	}
+	h := metrics.ResourceMetrics[0].ScopeMetrics[0].Metrics[1].Histogram
+	if h == nil || strings.Join(h.DataPoints[0].BucketCounts, ",") != "0,1,0,0" || h.DataPoints[0].Sum != 3 {
+		t.Errorf("unexpected histogram %+v", h)
+	}
+
+	// Export failure
+	os.Setenv("OTEL_EXPORTER_OTLP_HEADERS", "")
+	e, _ = FromEnv()
+	e.StartSpan("helm push", nil).End(nil)
+	if err := e.Shutdown(context.Background()); err == nil {
+		t.Error("expected error with rejected export, instead got nil")
+	}
+}
+
+func TestShutdownProtobuf(t *testing.T) {
+	clearEnv()
+	defer clearEnv()
+
+	bodies := map[string][]byte{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Type") != "application/x-protobuf" {
+			w.WriteHeader(415)
+			return
+		}
+		bodies[r.URL.Path], _ = ioutil.ReadAll(r.Body)
+	}))
+	defer ts.Close()
+
+	// http/protobuf is the default protocol
+	os.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", ts.URL)
+	e, err := FromEnv()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	e.StartSpan("helm push", nil).End(nil)
+	e.Histogram("helm_push.push.duration", "s", 3, []float64{1, 5, 10}, nil)
+	if err := e.Shutdown(context.Background()); err != nil {
+		t.Fatalf("unexpected error exporting: %s", err)
+	}
+
+	// resource_spans.scope_spans.spans.name
+	if name := protoField(bodies["/v1/traces"], 1, 2, 2, 5); string(name) != "helm push" {
+		t.Errorf("expected the span name in the traces, got %q", name)
+	}
+	// resource_metrics.scope_metrics.metrics.name and histogram
+	metric := protoField(bodies["/v1/metrics"], 1, 2, 2)
+	if name := protoField(metric, 1); string(name) != "helm_push.push.duration" {
+		t.Errorf("expected the metric name, got %q", name)
+	}
+	if protoField(metric, 9, 1) == nil {
+		t.Error("expected a histogram data point")
+	}
+}
+
+// protoField returns the first length delimited field found following the
+// path of field numbers, nil if there is none
+func protoField(b []byte, path ...protowire.Number) []byte {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return nil
+		}
+		b = b[n:]
+		if typ != protowire.BytesType {
+			n = protowire.ConsumeFieldValue(num, typ, b)
+			if n < 0 {
+				return nil
+			}
+			b = b[n:]
+			continue
+		}
+		v, n := protowire.ConsumeBytes(b)
+		if n < 0 {
+			return nil
+		}
+		b = b[n:]
+		if num == path[0] {
+			if len(path) == 1 {
+				return v
+			}
+			return protoField(v, path[1:]...)
+		}
+	}
+	return nil
+}
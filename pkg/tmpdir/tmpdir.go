@@ -0,0 +1,70 @@
+package tmpdir
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// MaxAge is the age after which a temporary file is considered left over
+// by a crashed run
+const MaxAge = 24 * time.Hour
+
+// legacyPattern matches the temporary files created in the system
+// temporary directory by previous versions
+const legacyPattern = "helm-push-*"
+
+// Root returns the per user directory holding the temporary files of the
+// plugin: $HELM_PUSH_TMPDIR, or helm-push/tmp in the user cache directory
+func Root() string {
+	if v, ok := os.LookupEnv("HELM_PUSH_TMPDIR"); ok && v != "" {
+		return v
+	}
+	if cache, err := os.UserCacheDir(); err == nil {
+		return filepath.Join(cache, "helm-push", "tmp")
+	}
+	return filepath.Join(os.TempDir(), "helm-push")
+}
+
+// New creates a temporary directory in Root, see ioutil.TempDir
+func New(pattern string) (string, error) {
+	if err := os.MkdirAll(Root(), 0700); err != nil {
+		return "", err
+	}
+	return ioutil.TempDir(Root(), pattern)
+}
+
+// NewFile creates a temporary file in Root, see ioutil.TempFile
+func NewFile(pattern string) (*os.File, error) {
+	if err := os.MkdirAll(Root(), 0700); err != nil {
+		return nil, err
+	}
+	return ioutil.TempFile(Root(), pattern)
+}
+
+// Prune removes the temporary files of Root older than maxAge, along with
+// the ones previous versions left in the system temporary directory. It
+// returns the paths removed, files that can't be removed are skipped.
+func Prune(maxAge time.Duration) []string {
+	var candidates []string
+	if entries, err := ioutil.ReadDir(Root()); err == nil {
+		for _, e := range entries {
+			candidates = append(candidates, filepath.Join(Root(), e.Name()))
+		}
+	}
+	legacy, _ := filepath.Glob(filepath.Join(os.TempDir(), legacyPattern))
+	candidates = append(candidates, legacy...)
+
+	var removed []string
+	for _, path := range candidates {
+		fi, err := os.Lstat(path)
+		if err != nil || time.Since(fi.ModTime()) < maxAge {
+			continue
+		}
+		if os.RemoveAll(path) == nil {
+			removed = append(removed, path)
+		}
+	}
+	return removed
+}
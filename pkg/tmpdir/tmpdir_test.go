@@ -0,0 +1,61 @@
+package tmpdir
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPrune(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "tmpdir-test")
+	if err != nil {
+		t.Fatal("unexpected error creating temp test dir", err)
+	}
+	defer os.RemoveAll(tmp)
+	os.Setenv("HELM_PUSH_TMPDIR", filepath.Join(tmp, "root"))
+	defer os.Unsetenv("HELM_PUSH_TMPDIR")
+	os.Setenv("TMPDIR", tmp)
+	defer os.Unsetenv("TMPDIR")
+
+	fresh, err := New("helm-push-")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !strings.HasPrefix(fresh, Root()) {
+		t.Errorf("expected %s to be created in %s", fresh, Root())
+	}
+	stale, _ := New("helm-push-")
+	ioutil.WriteFile(filepath.Join(stale, "mychart-0.1.0.tgz"), []byte("chart"), 0644)
+	f, err := NewFile("helm-push-keyring-")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	f.Close()
+	legacy := filepath.Join(tmp, "helm-push-123456")
+	os.Mkdir(legacy, 0755)
+	unrelated := filepath.Join(tmp, "other-123456")
+	os.Mkdir(unrelated, 0755)
+
+	old := time.Now().Add(-2 * MaxAge)
+	for _, path := range []string{stale, f.Name(), legacy, unrelated} {
+		os.Chtimes(path, old, old)
+	}
+
+	removed := Prune(MaxAge)
+	if len(removed) != 3 {
+		t.Errorf("expected 3 paths to be removed, got %v", removed)
+	}
+	for _, path := range []string{stale, f.Name(), legacy} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("expected %s to be removed", path)
+		}
+	}
+	for _, path := range []string{fresh, unrelated} {
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("expected %s to be kept: %s", path, err)
+		}
+	}
+}
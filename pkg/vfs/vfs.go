@@ -0,0 +1,191 @@
+// Package vfs abstracts the filesystem charts, packages and configuration
+// files are read from and written to, so that programs embedding chart
+// publishing can work in memory and tests stay hermetic
+package vfs
+
+import (
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing/fstest"
+	"time"
+)
+
+type (
+	// FS is a writable filesystem, reading goes through io/fs
+	FS interface {
+		fs.FS
+		// WriteFile writes data to the file name, replacing it if it
+		// exists, see os.WriteFile
+		WriteFile(name string, data []byte, perm fs.FileMode) error
+		// MkdirAll creates the directory name and its parents, see
+		// os.MkdirAll
+		MkdirAll(name string, perm fs.FileMode) error
+		// RemoveAll removes name and its children, see os.RemoveAll
+		RemoveAll(name string) error
+		// MkdirTemp creates a new directory in dir, with a name made of
+		// pattern and a random string, see os.MkdirTemp
+		MkdirTemp(dir, pattern string) (string, error)
+	}
+
+	// osFS is the filesystem of the host
+	osFS struct{}
+
+	// Mem is an in-memory filesystem, names are slash separated paths,
+	// leading slashes are ignored. It is safe for concurrent use.
+	Mem struct {
+		mu    sync.Mutex
+		files fstest.MapFS
+		temp  int
+	}
+)
+
+// OS is the filesystem of the host, names are host paths, absolute or
+// relative to the working directory, rather than io/fs paths
+var OS FS = osFS{}
+
+// IsOS tells if fsys is the filesystem of the host
+func IsOS(fsys FS) bool {
+	_, ok := fsys.(osFS)
+	return ok
+}
+
+// ReadFile reads the file name of fsys
+func ReadFile(fsys FS, name string) ([]byte, error) {
+	return fs.ReadFile(fsys, name)
+}
+
+// Open implements fs.FS
+func (osFS) Open(name string) (fs.File, error) {
+	return os.Open(name)
+}
+
+// ReadFile implements fs.ReadFileFS
+func (osFS) ReadFile(name string) ([]byte, error) {
+	return ioutil.ReadFile(name)
+}
+
+// WriteFile implements FS
+func (osFS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	return ioutil.WriteFile(name, data, perm)
+}
+
+// MkdirAll implements FS
+func (osFS) MkdirAll(name string, perm fs.FileMode) error {
+	return os.MkdirAll(name, perm)
+}
+
+// RemoveAll implements FS
+func (osFS) RemoveAll(name string) error {
+	return os.RemoveAll(name)
+}
+
+// MkdirTemp implements FS
+func (osFS) MkdirTemp(dir, pattern string) (string, error) {
+	return ioutil.TempDir(dir, pattern)
+}
+
+// NewMem returns an empty in-memory filesystem
+func NewMem() *Mem {
+	return &Mem{files: fstest.MapFS{}}
+}
+
+// clean turns name into an io/fs path
+func clean(name string) string {
+	name = strings.TrimLeft(path.Clean(filepath.ToSlash(name)), "/")
+	if name == "" {
+		return "."
+	}
+	return name
+}
+
+// Open implements fs.FS
+func (m *Mem) Open(name string) (fs.File, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.files.Open(clean(name))
+}
+
+// ReadFile implements fs.ReadFileFS
+func (m *Mem) ReadFile(name string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.files.ReadFile(clean(name))
+}
+
+// Stat implements fs.StatFS
+func (m *Mem) Stat(name string) (fs.FileInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.files.Stat(clean(name))
+}
+
+// WriteFile implements FS, parent directories are created as needed
+func (m *Mem) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	name = clean(name)
+	if f, ok := m.files[name]; ok && f.Mode.IsDir() {
+		return &fs.PathError{Op: "write", Path: name, Err: fs.ErrExist}
+	}
+	m.files[name] = &fstest.MapFile{Data: append([]byte{}, data...), Mode: perm, ModTime: time.Now()}
+	return nil
+}
+
+// MkdirAll implements FS
+func (m *Mem) MkdirAll(name string, perm fs.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.mkdirAll(clean(name), perm)
+}
+
+// mkdirAll creates the directory name, m.mu must be held
+func (m *Mem) mkdirAll(name string, perm fs.FileMode) error {
+	for dir := name; dir != "."; dir = path.Dir(dir) {
+		if f, ok := m.files[dir]; ok && !f.Mode.IsDir() {
+			return &fs.PathError{Op: "mkdir", Path: dir, Err: fs.ErrExist}
+		}
+	}
+	for dir := name; dir != "."; dir = path.Dir(dir) {
+		if _, ok := m.files[dir]; !ok {
+			m.files[dir] = &fstest.MapFile{Mode: fs.ModeDir | perm, ModTime: time.Now()}
+		}
+	}
+	return nil
+}
+
+// RemoveAll implements FS
+func (m *Mem) RemoveAll(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	name = clean(name)
+	for f := range m.files {
+		if f == name || name == "." || strings.HasPrefix(f, name+"/") {
+			delete(m.files, f)
+		}
+	}
+	return nil
+}
+
+// MkdirTemp implements FS, names are unique rather than random
+func (m *Mem) MkdirTemp(dir, pattern string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for {
+		m.temp++
+		prefix, suffix := pattern, ""
+		if i := strings.LastIndex(pattern, "*"); i >= 0 {
+			prefix, suffix = pattern[:i], pattern[i+1:]
+		}
+		name := clean(path.Join(dir, prefix+strconv.Itoa(m.temp)+suffix))
+		if _, ok := m.files[name]; ok {
+			continue
+		}
+		return name, m.mkdirAll(name, 0700)
+	}
+}
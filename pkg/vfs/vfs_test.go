@@ -0,0 +1,74 @@
+package vfs
+
+import (
+	"errors"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMem(t *testing.T) {
+	m := NewMem()
+	if err := m.WriteFile("/charts/api/Chart.yaml", []byte("name: api\n"), 0644); err != nil {
+		t.Fatalf("unexpected error writing file: %s", err)
+	}
+	if err := m.MkdirAll("charts/api/templates", 0755); err != nil {
+		t.Fatalf("unexpected error creating directory: %s", err)
+	}
+	entries, err := fs.ReadDir(m, "/charts/api")
+	if err != nil || len(entries) != 2 || entries[0].Name() != "Chart.yaml" || !entries[1].IsDir() {
+		t.Errorf("unexpected directory entries %v, %v", entries, err)
+	}
+	if b, err := ReadFile(m, "charts/api/Chart.yaml"); err != nil || string(b) != "name: api\n" {
+		t.Errorf("unexpected content %q, %v", b, err)
+	}
+	if err := m.MkdirAll("/charts/api/Chart.yaml/templates", 0755); err == nil {
+		t.Error("expected error creating a directory below a file, instead got nil")
+	}
+	if err := m.WriteFile("/charts/api", nil, 0644); err == nil {
+		t.Error("expected error writing a directory, instead got nil")
+	}
+
+	tmp, err := m.MkdirTemp("/tmp", "helm-push-*.d")
+	if err != nil || !strings.HasPrefix(tmp, "tmp/helm-push-") || !strings.HasSuffix(tmp, ".d") {
+		t.Errorf("unexpected temporary directory %q, %v", tmp, err)
+	}
+	if other, _ := m.MkdirTemp("/tmp", "helm-push-*.d"); other == tmp {
+		t.Error("expected temporary directories to be unique")
+	}
+
+	if err := m.RemoveAll("/charts"); err != nil {
+		t.Fatalf("unexpected error removing directory: %s", err)
+	}
+	if _, err := m.Stat("charts/api/Chart.yaml"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected files to be removed, got %v", err)
+	}
+}
+
+func TestOS(t *testing.T) {
+	tmp, err := OS.MkdirTemp("", "helm-push-test")
+	if err != nil {
+		t.Fatal("unexpected error creating temp test dir", err)
+	}
+	defer OS.RemoveAll(tmp)
+	path := filepath.Join(tmp, "push.yaml")
+	if err := OS.WriteFile(path, []byte("verify: provenance\n"), 0600); err != nil {
+		t.Fatalf("unexpected error writing file: %s", err)
+	}
+	if b, err := ioutil.ReadFile(path); err != nil || string(b) != "verify: provenance\n" {
+		t.Errorf("expected file to be written on the host, got %q, %v", b, err)
+	}
+	if b, err := ReadFile(OS, path); err != nil || len(b) == 0 {
+		t.Errorf("unexpected error reading file: %v", err)
+	}
+	if !IsOS(OS) || IsOS(NewMem()) {
+		t.Error("expected only OS to be the host filesystem")
+	}
+	OS.RemoveAll(tmp)
+	if _, err := os.Stat(tmp); !os.IsNotExist(err) {
+		t.Errorf("expected directory to be removed, got %v", err)
+	}
+}
@@ -0,0 +1,107 @@
+package watch
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Defaults of Options
+const (
+	DefaultInterval = 500 * time.Millisecond
+	DefaultDebounce = time.Second
+)
+
+type (
+	// Options configures how a directory is watched
+	Options struct {
+		// Interval is the delay between two scans of the directory
+		Interval time.Duration
+		// Debounce is how long the directory must stay unchanged before
+		// a change is reported, so that bursts of writes (editor swap
+		// files, git checkouts...) are reported once
+		Debounce time.Duration
+		// Ignore lists paths, relative to the directory, whose changes
+		// are not reported: files generated by the callback itself would
+		// report a change after each call otherwise
+		Ignore []string
+	}
+)
+
+// Watch calls changed every time the content of dir changes, until ctx is
+// done. Changes are detected by scanning the directory, which needs no
+// platform specific API; .git directories are skipped.
+func Watch(ctx context.Context, dir string, opts Options, changed func()) error {
+	if opts.Interval <= 0 {
+		opts.Interval = DefaultInterval
+	}
+	if opts.Debounce <= 0 {
+		opts.Debounce = DefaultDebounce
+	}
+	last, err := Fingerprint(dir, opts.Ignore...)
+	if err != nil {
+		return err
+	}
+	ticker := time.NewTicker(opts.Interval)
+	defer ticker.Stop()
+
+	var pending time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case now := <-ticker.C:
+			current, err := Fingerprint(dir, opts.Ignore...)
+			if err != nil {
+				// files may disappear while being scanned, retry
+				continue
+			}
+			if current != last {
+				last = current
+				pending = now
+				continue
+			}
+			if !pending.IsZero() && now.Sub(pending) >= opts.Debounce {
+				pending = time.Time{}
+				changed()
+			}
+		}
+	}
+}
+
+// Fingerprint returns a digest of the names, sizes and modification times
+// of the files of dir, directories themselves are not taken into account.
+// The ignored files and directories, relative to dir, are skipped.
+func Fingerprint(dir string, ignore ...string) (string, error) {
+	skip := map[string]bool{}
+	for _, path := range ignore {
+		skip[filepath.Join(dir, path)] = true
+	}
+	h := sha256.New()
+	err := filepath.Walk(dir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if skip[path] {
+			if fi.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if fi.IsDir() {
+			if fi.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		fmt.Fprintf(h, "%s\x00%d\x00%d\x00%s\n", path, fi.Size(), fi.ModTime().UnixNano(), fi.Mode())
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
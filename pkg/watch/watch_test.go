@@ -0,0 +1,85 @@
+package watch
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWatch(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "helm-push-test")
+	if err != nil {
+		t.Fatal("unexpected error creating temp test dir", err)
+	}
+	defer os.RemoveAll(tmp)
+	ioutil.WriteFile(filepath.Join(tmp, "Chart.yaml"), []byte("name: mychart\n"), 0644)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	changes := make(chan struct{}, 10)
+	done := make(chan error)
+	go func() {
+		done <- Watch(ctx, tmp, Options{Interval: 10 * time.Millisecond, Debounce: 50 * time.Millisecond}, func() {
+			changes <- struct{}{}
+		})
+	}()
+
+	// A burst of writes is reported once
+	time.Sleep(30 * time.Millisecond)
+	for i := 0; i < 3; i++ {
+		os.MkdirAll(filepath.Join(tmp, "templates"), 0755)
+		ioutil.WriteFile(filepath.Join(tmp, "templates", "pod.yaml"), []byte{byte('a' + i)}, 0644)
+		time.Sleep(15 * time.Millisecond)
+	}
+	select {
+	case <-changes:
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected change to be reported")
+	}
+	time.Sleep(150 * time.Millisecond)
+	if n := len(changes); n != 0 {
+		t.Errorf("expected burst to be reported once, got %d more changes", n)
+	}
+
+	// .git is ignored
+	os.MkdirAll(filepath.Join(tmp, ".git"), 0755)
+	ioutil.WriteFile(filepath.Join(tmp, ".git", "HEAD"), []byte("ref: refs/heads/main\n"), 0644)
+	time.Sleep(150 * time.Millisecond)
+	if n := len(changes); n != 0 {
+		t.Errorf("expected .git changes to be ignored, got %d changes", n)
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("unexpected error watching: %s", err)
+	}
+	if err := Watch(context.Background(), filepath.Join(tmp, "missing"), Options{}, func() {}); err == nil {
+		t.Error("expected error watching missing directory, instead got nil")
+	}
+}
+
+func TestFingerprintIgnore(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "helm-push-test")
+	if err != nil {
+		t.Fatal("unexpected error creating temp test dir", err)
+	}
+	defer os.RemoveAll(tmp)
+	ioutil.WriteFile(filepath.Join(tmp, "Chart.yaml"), []byte("name: mychart\n"), 0644)
+	ignore := []string{"charts", "Chart.lock"}
+
+	before, err := Fingerprint(tmp, ignore...)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	os.MkdirAll(filepath.Join(tmp, "charts"), 0755)
+	ioutil.WriteFile(filepath.Join(tmp, "charts", "redis-17.0.1.tgz"), []byte("tgz"), 0644)
+	ioutil.WriteFile(filepath.Join(tmp, "Chart.lock"), []byte("dependencies: []\n"), 0644)
+	if after, _ := Fingerprint(tmp, ignore...); after != before {
+		t.Error("expected changes of ignored paths not to change the fingerprint")
+	}
+	if all, _ := Fingerprint(tmp); all == before {
+		t.Error("expected changes to change the fingerprint without ignored paths")
+	}
+}
@@ -0,0 +1,94 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Payload formats
+const (
+	FormatJSON  = "json"
+	FormatSlack = "slack"
+)
+
+type (
+	// Hook is an endpoint notified after successful pushes
+	Hook struct {
+		URL     string            `json:"url"`
+		Format  string            `json:"format,omitempty"`
+		Headers map[string]string `json:"headers,omitempty"`
+	}
+
+	// Event describes a pushed chart
+	Event struct {
+		Type    string    `json:"event"`
+		Time    time.Time `json:"time"`
+		Chart   string    `json:"chart"`
+		Version string    `json:"version"`
+		Digest  string    `json:"digest,omitempty"`
+		Repo    string    `json:"repo"`
+	}
+
+	slackPayload struct {
+		Text string `json:"text"`
+	}
+)
+
+// Validate checks the hook configuration
+func (h Hook) Validate() error {
+	if h.URL == "" {
+		return fmt.Errorf("webhook url is required")
+	}
+	switch h.Format {
+	case "", FormatJSON, FormatSlack:
+		return nil
+	default:
+		return fmt.Errorf("invalid webhook format %q, must be one of: json, slack", h.Format)
+	}
+}
+
+// Send posts the event to the hook
+func (h Hook) Send(ctx context.Context, client *http.Client, e Event) error {
+	var payload interface{} = e
+	if h.Format == FormatSlack {
+		payload = slackPayload{Text: fmt.Sprintf("Pushed chart *%s* version `%s` to %s", e.Chart, e.Version, e.Repo)}
+	}
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", h.URL, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range h.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		// Incoming webhook URLs are secrets, only their host is reported
+		var ue *url.Error
+		if errors.As(err, &ue) {
+			return fmt.Errorf("%s %s: %w", ue.Op, req.URL.Host, ue.Err)
+		}
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
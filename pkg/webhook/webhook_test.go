@@ -0,0 +1,54 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSend(t *testing.T) {
+	var received map[string]interface{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Token") != "t0ken" {
+			w.WriteHeader(401)
+			return
+		}
+		received = nil
+		json.NewDecoder(r.Body).Decode(&received)
+	}))
+	defer ts.Close()
+
+	event := Event{Type: "chart.pushed", Time: time.Now(), Chart: "mychart", Version: "0.1.0", Digest: "abc", Repo: "https://my.chart.repo.com"}
+	headers := map[string]string{"X-Token": "t0ken"}
+
+	// Generic JSON
+	if err := (Hook{URL: ts.URL, Headers: headers}).Send(context.Background(), http.DefaultClient, event); err != nil {
+		t.Fatalf("unexpected error sending json webhook: %s", err)
+	}
+	if received["event"] != "chart.pushed" || received["chart"] != "mychart" || received["version"] != "0.1.0" {
+		t.Errorf("unexpected json payload %v", received)
+	}
+
+	// Slack
+	if err := (Hook{URL: ts.URL, Format: FormatSlack, Headers: headers}).Send(context.Background(), http.DefaultClient, event); err != nil {
+		t.Fatalf("unexpected error sending slack webhook: %s", err)
+	}
+	if received["text"] != "Pushed chart *mychart* version `0.1.0` to https://my.chart.repo.com" {
+		t.Errorf("unexpected slack payload %v", received)
+	}
+
+	// Rejected
+	if err := (Hook{URL: ts.URL}).Send(context.Background(), http.DefaultClient, event); err == nil {
+		t.Error("expected error with rejected webhook, instead got nil")
+	}
+
+	// Unreachable, the secret part of the URL is not reported
+	err := (Hook{URL: "http://127.0.0.1:1/services/T000/B000/XXX"}).Send(context.Background(), http.DefaultClient, event)
+	if err == nil || strings.Contains(err.Error(), "XXX") || !strings.Contains(err.Error(), "127.0.0.1:1") {
+		t.Errorf("expected error with the webhook host only, got %v", err)
+	}
+}
@@ -0,0 +1,21 @@
+// Package wincred stores credentials in the Windows Credential Manager,
+// as generic credentials. On other systems Supported is false and every
+// operation fails with ErrUnsupported.
+package wincred
+
+import (
+	"errors"
+)
+
+var (
+	// ErrNotFound is returned by Get when there is no such credential
+	ErrNotFound = errors.New("credential not found")
+	// ErrUnsupported is returned on systems without Credential Manager
+	ErrUnsupported = errors.New("the Windows Credential Manager is not available on this system")
+)
+
+// Target returns the name of the credential of a repository, given by
+// name or URL
+func Target(repo string) string {
+	return "helm-push:" + repo
+}
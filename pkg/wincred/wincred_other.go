@@ -0,0 +1,22 @@
+//go:build !windows
+
+package wincred
+
+// Supported tells if the Credential Manager is available
+const Supported = false
+
+// Get returns the user name and secret of the credential target
+func Get(target string) (string, string, error) {
+	return "", "", ErrUnsupported
+}
+
+// Set creates or replaces the credential target, persisted for the
+// current user on this machine
+func Set(target, user, secret string) error {
+	return ErrUnsupported
+}
+
+// Delete removes the credential target
+func Delete(target string) error {
+	return ErrUnsupported
+}
@@ -0,0 +1,34 @@
+package wincred
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCredentials(t *testing.T) {
+	target := Target("https://charts.example.com/wincred-test")
+	if !Supported {
+		if _, _, err := Get(target); !errors.Is(err, ErrUnsupported) {
+			t.Errorf("expected unsupported error, got %v", err)
+		}
+		if err := Set(target, "id", "secret"); !errors.Is(err, ErrUnsupported) {
+			t.Errorf("expected unsupported error, got %v", err)
+		}
+		return
+	}
+
+	if _, _, err := Get(Target("helm-push-test-missing")); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected not found error, got %v", err)
+	}
+	if err := Set(target, "my-id", "my-secret"); err != nil {
+		t.Fatalf("unexpected error storing credential: %s", err)
+	}
+	defer Delete(target)
+	user, secret, err := Get(target)
+	if err != nil {
+		t.Fatalf("unexpected error reading credential: %s", err)
+	}
+	if user != "my-id" || secret != "my-secret" {
+		t.Errorf("unexpected credential %q, %q", user, secret)
+	}
+}
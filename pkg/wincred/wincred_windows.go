@@ -0,0 +1,118 @@
+//go:build windows
+
+package wincred
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+// Supported tells if the Credential Manager is available
+const Supported = true
+
+const (
+	credTypeGeneric         = 1
+	credPersistLocalMachine = 2
+	errorNotFound           = syscall.Errno(1168)
+)
+
+var (
+	advapi32        = syscall.NewLazyDLL("advapi32.dll")
+	procCredReadW   = advapi32.NewProc("CredReadW")
+	procCredWriteW  = advapi32.NewProc("CredWriteW")
+	procCredDeleteW = advapi32.NewProc("CredDeleteW")
+	procCredFree    = advapi32.NewProc("CredFree")
+)
+
+// credential is the CREDENTIALW structure
+type credential struct {
+	Flags              uint32
+	Type               uint32
+	TargetName         *uint16
+	Comment            *uint16
+	LastWritten        syscall.Filetime
+	CredentialBlobSize uint32
+	CredentialBlob     *byte
+	Persist            uint32
+	AttributeCount     uint32
+	Attributes         uintptr
+	TargetAlias        *uint16
+	UserName           *uint16
+}
+
+// Get returns the user name and secret of the credential target
+func Get(target string) (string, string, error) {
+	name, err := syscall.UTF16PtrFromString(target)
+	if err != nil {
+		return "", "", err
+	}
+	var cred *credential
+	r, _, err := procCredReadW.Call(uintptr(unsafe.Pointer(name)), credTypeGeneric, 0, uintptr(unsafe.Pointer(&cred)))
+	if r == 0 {
+		if err == errorNotFound {
+			return "", "", ErrNotFound
+		}
+		return "", "", err
+	}
+	defer procCredFree.Call(uintptr(unsafe.Pointer(cred)))
+	secret := ""
+	if cred.CredentialBlobSize > 0 {
+		secret = string(unsafe.Slice(cred.CredentialBlob, cred.CredentialBlobSize))
+	}
+	return utf16PtrToString(cred.UserName), secret, nil
+}
+
+// Set creates or replaces the credential target, persisted for the
+// current user on this machine
+func Set(target, user, secret string) error {
+	name, err := syscall.UTF16PtrFromString(target)
+	if err != nil {
+		return err
+	}
+	userName, err := syscall.UTF16PtrFromString(user)
+	if err != nil {
+		return err
+	}
+	blob := []byte(secret)
+	cred := credential{
+		Type:               credTypeGeneric,
+		TargetName:         name,
+		CredentialBlobSize: uint32(len(blob)),
+		Persist:            credPersistLocalMachine,
+		UserName:           userName,
+	}
+	if len(blob) > 0 {
+		cred.CredentialBlob = &blob[0]
+	}
+	if r, _, err := procCredWriteW.Call(uintptr(unsafe.Pointer(&cred)), 0); r == 0 {
+		return err
+	}
+	return nil
+}
+
+// Delete removes the credential target
+func Delete(target string) error {
+	name, err := syscall.UTF16PtrFromString(target)
+	if err != nil {
+		return err
+	}
+	if r, _, err := procCredDeleteW.Call(uintptr(unsafe.Pointer(name)), credTypeGeneric, 0); r == 0 {
+		if err == errorNotFound {
+			return ErrNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+// utf16PtrToString converts a NUL terminated UTF-16 string
+func utf16PtrToString(p *uint16) string {
+	if p == nil {
+		return ""
+	}
+	n := 0
+	for ptr := unsafe.Pointer(p); *(*uint16)(ptr) != 0; n++ {
+		ptr = unsafe.Add(ptr, unsafe.Sizeof(*p))
+	}
+	return syscall.UTF16ToString(unsafe.Slice(p, n))
+}
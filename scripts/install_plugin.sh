@@ -13,6 +13,8 @@ echo "Downloading and installing helm-push v${version} ..."
 url=""
 if [ "$(uname)" = "Darwin" ]; then
     url="https://github.com/IxDay/helm-push-cloudflare-access/releases/download/v${version}/helm-push_${version}_darwin_amd64.tar.gz"
+elif [ "$(uname)" = "Linux" ] && [ -n "${HELM_PUSH_FIPS}" ]; then
+    url="https://github.com/IxDay/helm-push-cloudflare-access/releases/download/v${version}/helm-push_${version}_linux_amd64-fips.tar.gz"
 elif [ "$(uname)" = "Linux" ] ; then
     url="https://github.com/IxDay/helm-push-cloudflare-access/releases/download/v${version}/helm-push_${version}_linux_amd64.tar.gz"
 else
@@ -31,6 +33,8 @@ else
     wget -q "${url}" -O "releases/v${version}.tar.gz"
 fi
 tar xzf "releases/v${version}.tar.gz" -C "releases/v${version}"
+# Windows only runs executables with an extension, Helm finds helmpush.exe
+# when running bin/helmpush
 mv "releases/v${version}/bin/helmpush" "bin/helmpush" || \
-    mv "releases/v${version}/bin/helmpush.exe" "bin/helmpush"
+    mv "releases/v${version}/bin/helmpush.exe" "bin/helmpush.exe"
 